@@ -0,0 +1,119 @@
+// Package atlas is a minimal client for the MongoDB Atlas Admin API, used to
+// manage Atlas Search and Vector Search indexes on tiers where the database
+// commands for them are unavailable.
+package atlas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// DefaultBaseURL is the Atlas Admin API endpoint.
+	DefaultBaseURL = "https://cloud.mongodb.com"
+
+	mediaType = "application/vnd.atlas.2024-05-30+json"
+)
+
+// Client calls the Atlas Admin API for one cluster, authenticating with a
+// programmatic API key.
+type Client struct {
+	baseURL     string
+	projectID   string
+	clusterName string
+	http        *http.Client
+}
+
+// NewClient returns a client for the cluster, using DefaultBaseURL when
+// baseURL is empty.
+func NewClient(baseURL, publicKey, privateKey, projectID, clusterName string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		baseURL:     baseURL,
+		projectID:   projectID,
+		clusterName: clusterName,
+		http: &http.Client{
+			Timeout: time.Minute,
+			Transport: &digestTransport{
+				username: publicKey,
+				password: privateKey,
+				base:     http.DefaultTransport,
+			},
+		},
+	}
+}
+
+// APIError is an error response of the Admin API.
+type APIError struct {
+	Status    int    `json:"error"`
+	ErrorCode string `json:"errorCode"`
+	Detail    string `json:"detail"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("atlas admin api: %d %s: %s", e.Status, e.ErrorCode, e.Detail)
+}
+
+// do sends a request and decodes a JSON response into out when it is not nil.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", mediaType)
+	if body != nil {
+		req.Header.Set("Content-Type", mediaType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("atlas admin api: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("atlas admin api: reading response: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &APIError{Status: resp.StatusCode}
+		if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Detail == "" {
+			apiErr.Detail = string(data)
+		}
+		return apiErr
+	}
+
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("atlas admin api: decoding response: %w", err)
+		}
+	}
+	return nil
+}
+
+// clusterPath returns the API path of a cluster resource.
+func (c *Client) clusterPath(elems ...string) string {
+	path := "/api/atlas/v2/groups/" + url.PathEscape(c.projectID) + "/clusters/" + url.PathEscape(c.clusterName)
+	for _, elem := range elems {
+		path += "/" + url.PathEscape(elem)
+	}
+	return path
+}
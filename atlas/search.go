@@ -0,0 +1,75 @@
+package atlas
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Search index statuses reported by Atlas.
+const (
+	StatusReady  = "READY"
+	StatusFailed = "FAILED"
+)
+
+// SearchIndex is an Atlas Search or Vector Search index.
+type SearchIndex struct {
+	Database   string `json:"database"`
+	Collection string `json:"collectionName"`
+	Name       string `json:"name"`
+	// Type is "search" or "vectorSearch"; empty means search.
+	Type       string          `json:"type,omitempty"`
+	Definition json.RawMessage `json:"definition"`
+	Status     string          `json:"status,omitempty"`
+}
+
+// CreateSearchIndex creates the search index.
+func (c *Client) CreateSearchIndex(ctx context.Context, index SearchIndex) error {
+	return c.do(ctx, http.MethodPost, c.clusterPath("search", "indexes"), index, nil)
+}
+
+// UpdateSearchIndex replaces the definition of the search index.
+func (c *Client) UpdateSearchIndex(ctx context.Context, index SearchIndex) error {
+	body := map[string]json.RawMessage{"definition": index.Definition}
+	return c.do(ctx, http.MethodPatch, c.clusterPath("search", "indexes", index.Database, index.Collection, index.Name), body, nil)
+}
+
+// DeleteSearchIndex deletes the search index.
+func (c *Client) DeleteSearchIndex(ctx context.Context, database, collection, name string) error {
+	return c.do(ctx, http.MethodDelete, c.clusterPath("search", "indexes", database, collection, name), nil, nil)
+}
+
+// GetSearchIndex returns the search index with its build status.
+func (c *Client) GetSearchIndex(ctx context.Context, database, collection, name string) (SearchIndex, error) {
+	var index SearchIndex
+	err := c.do(ctx, http.MethodGet, c.clusterPath("search", "indexes", database, collection, name), nil, &index)
+	return index, err
+}
+
+// WaitForSearchIndex polls the search index until it is ready, fails or the
+// context ends.
+func (c *Client) WaitForSearchIndex(ctx context.Context, database, collection, name string, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		index, err := c.GetSearchIndex(ctx, database, collection, name)
+		if err != nil {
+			return err
+		}
+		switch index.Status {
+		case StatusReady:
+			return nil
+		case StatusFailed:
+			return fmt.Errorf("search index %s on %s.%s failed to build", name, database, collection)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for search index %s: %w", name, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Package atomicfile writes files so readers and interrupted runs never see
+// them partially written.
+package atomicfile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Permissions control the mode and group of the files written.
+type Permissions struct {
+	// Mode is applied as is; zero creates files honoring the umask and leaves
+	// the mode of replaced files unchanged.
+	Mode os.FileMode
+	// Group is the group ID files are assigned to; -1 keeps the default.
+	Group int
+}
+
+// DefaultPermissions honor the umask and keep the default group.
+var DefaultPermissions = Permissions{Group: -1}
+
+// File is a file to write with Permissions.WriteAll.
+type File struct {
+	Path string
+	Data []byte
+	// Stream, when set, writes the contents instead of Data, so large files
+	// needn't be held in memory.
+	Stream func(w io.Writer) error
+	// Private files are only accessible by their owner whatever the
+	// configured permissions, for files that may hold credentials.
+	Private bool
+}
+
+// Write writes data to a temporary file in the directory of path and renames it
+// over path.
+func (p Permissions) Write(path string, data []byte) error {
+	return p.WriteAll([]File{{Path: path, Data: data}})
+}
+
+// WriteStream writes the contents produced by stream to a temporary file in
+// the directory of path and renames it over path.
+func (p Permissions) WriteStream(path string, stream func(w io.Writer) error) error {
+	return p.WriteAll([]File{{Path: path, Stream: stream}})
+}
+
+// WriteAll writes the files so they appear together or not at all: every file
+// is written to a temporary file first and only renamed into place once all of
+// them were written. If a rename fails, the files it already created are removed.
+// The files get the permissions p.
+func (p Permissions) WriteAll(files []File) error {
+	temps := make([]string, 0, len(files))
+	defer func() {
+		for _, temp := range temps {
+			_ = os.Remove(temp)
+		}
+	}()
+
+	for _, file := range files {
+		temp, err := writeTemp(file, p)
+		if err != nil {
+			return err
+		}
+		temps = append(temps, temp)
+	}
+
+	var created []string
+	for i, file := range files {
+		_, statErr := os.Stat(file.Path)
+		if err := os.Rename(temps[i], file.Path); err != nil {
+			for _, path := range created {
+				_ = os.Remove(path)
+			}
+			return fmt.Errorf("replacing %s: %w", file.Path, err)
+		}
+		if errors.Is(statErr, fs.ErrNotExist) {
+			created = append(created, file.Path)
+		}
+	}
+
+	for _, dir := range dirs(files) {
+		syncDir(dir)
+	}
+	return nil
+}
+
+// writeTemp writes the file's data to a synced temporary file next to it. The
+// name starts with a dot so migration sources and globs skip it.
+func writeTemp(file File, permissions Permissions) (string, error) {
+	f, err := createTemp(file.Path)
+	if err != nil {
+		return "", fmt.Errorf("creating temporary file for %s: %w", file.Path, err)
+	}
+
+	if file.Stream != nil {
+		w := bufio.NewWriter(f)
+		if err = file.Stream(w); err == nil {
+			err = w.Flush()
+		}
+	} else {
+		_, err = f.Write(file.Data)
+	}
+	if err == nil {
+		err = applyPermissions(f, file, permissions)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	err = errors.Join(err, f.Close())
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("writing temporary file for %s: %w", file.Path, err)
+	}
+	return f.Name(), nil
+}
+
+// createTemp creates a new file next to path. Unlike os.CreateTemp it creates
+// the file with mode 0666, so the umask decides its permissions.
+func createTemp(path string) (*os.File, error) {
+	prefix := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	for {
+		name := prefix + strconv.FormatUint(uint64(rand.Uint32()), 10)
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666) //nolint:gosec // the name is derived from a path chosen by the user
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		return f, err
+	}
+}
+
+func applyPermissions(f *os.File, file File, permissions Permissions) error {
+	mode := permissions.Mode
+	if mode == 0 {
+		if info, err := os.Stat(file.Path); err == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+	if file.Private {
+		mode = 0600
+	}
+	if mode != 0 {
+		if err := f.Chmod(mode); err != nil {
+			return err
+		}
+	}
+
+	if permissions.Group >= 0 {
+		if err := f.Chown(-1, permissions.Group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dirs(files []File) []string {
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, file := range files {
+		dir := filepath.Dir(file.Path)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// syncDir makes the renames durable. Not every platform supports syncing a
+// directory, so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
@@ -0,0 +1,117 @@
+package atomicfile
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chdir makes dir the working directory for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+// checkNoTemps fails when temporary files are left behind in dir.
+func checkNoTemps(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("temporary file left behind: %s", filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+func TestWriteAllPaths(t *testing.T) {
+	root := t.TempDir()
+	chdir(t, root)
+	for _, dir := range []string{"plain", "with spaces", filepath.Join("nested", "dir")} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, path := range []string{
+		filepath.Join(root, "plain", "absolute.json"),
+		filepath.Join("plain", "relative.json"),
+		filepath.Join("with spaces", "000001_add index.up.json"),
+		filepath.Join("nested", "..", "plain", "dotdot.json"),
+		filepath.Join(".", "nested", "dir", "dot.json"),
+		"bare.json",
+	} {
+		t.Run(path, func(t *testing.T) {
+			data := []byte("[]\n")
+			if err := DefaultPermissions.WriteAll([]File{{Path: path, Data: data}}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(data) {
+				t.Errorf("got %q, want %q", got, data)
+			}
+			checkNoTemps(t, filepath.Dir(path))
+		})
+	}
+}
+
+func TestWriteAllReplaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema file.json")
+	for _, data := range []string{"first", "second"} {
+		if err := DefaultPermissions.Write(path, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("got %q, want %q", got, data)
+		}
+	}
+	checkNoTemps(t, filepath.Dir(path))
+}
+
+func TestWriteAllIsAllOrNothing(t *testing.T) {
+	dir := t.TempDir()
+	// A file can't replace a directory, so the second rename fails.
+	blocked := filepath.Join(dir, "000001_blocked.down.json")
+	if err := os.Mkdir(blocked, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(blocked, "keep"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	up := filepath.Join(dir, "000001_blocked.up.json")
+	err := DefaultPermissions.WriteAll([]File{{Path: up, Data: []byte("[]")}, {Path: blocked, Data: []byte("[]")}})
+	if err == nil {
+		t.Fatal("WriteAll succeeded replacing a directory")
+	}
+	if _, err := os.Stat(up); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("file created before the failure left behind: %v", err)
+	}
+	checkNoTemps(t, dir)
+}
+
+func TestWriteAllMissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "file.json")
+	if err := DefaultPermissions.Write(path, []byte("[]")); err == nil {
+		t.Fatal("Write succeeded in a missing directory")
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"text/tabwriter"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ltman/mondex/migration"
+	"github.com/spf13/cobra"
+)
+
+// adviseOptions are the command-specific options of advise.
+type adviseOptions struct {
+	write  bool
+	dryRun bool
+}
+
+func newAdviseCmd() *cobra.Command {
+	var opts adviseOptions
+
+	cmd := &cobra.Command{
+		Use:   "advise",
+		Short: "Propose partial indexes replacing the declared sparse indexes",
+		Long: `Flag the sparse indexes of the schema file and propose equivalent partial
+indexes, as MongoDB recommends. With --write, the schema file is updated and the
+conversion is written as two migrations: one creating the partial indexes and
+one dropping the sparse indexes, to apply once queries use the replacements.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runAdvise(cmd, opts)
+		},
+	}
+
+	addSchemaFlags(cmd.Flags())
+	addMigrationFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.write, "write", false, "Update the schema file and write the two-step migration")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry_run", false, "Show the migrations and schema --write would produce without writing files")
+
+	return cmd
+}
+
+func runAdvise(cmd *cobra.Command, opts adviseOptions) error {
+	requiredFields := []string{"schema_file_path"}
+	if opts.write {
+		requiredFields = append(requiredFields, "migration_dir")
+	}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		declared, err := migration.ReadDeclaredSchema(config.settings, config.SchemaFilePath)
+		if err != nil {
+			return fmt.Errorf("reading declared schema: %w", err)
+		}
+
+		advice := migration.AdviseSparseIndexes(declared)
+		if len(advice) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "No sparse indexes to convert")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "COLLECTION\tSPARSE INDEX\tPARTIAL INDEX\tPARTIAL FILTER")
+		for _, a := range advice {
+			filter, err := bson.MarshalExtJSON(a.Partial.PartialFilterExpression, false, false)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", a.Collection, a.Sparse.Name, a.Partial.Name, filter)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if !opts.write && !opts.dryRun {
+			return nil
+		}
+
+		return migration.ConvertSparseIndexes(
+			ctx,
+			logger,
+			config.settings,
+			config.SchemaFilePath,
+			config.MigrationDir,
+			advice,
+			opts.dryRun,
+		)
+	})
+}
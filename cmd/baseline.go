@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/ltman/mondex/migration"
+	"github.com/spf13/cobra"
+)
+
+func newBaselineCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "baseline [version]",
+		Short: "Record a version as applied without running migrations",
+		Long: `Record the version, or the latest migration of the directory, as applied to
+a database whose indexes already exist, without running any migration, so
+apply only runs the newer ones. Databases with a recorded version are
+refused.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var version uint64
+			if len(args) > 0 {
+				v, err := strconv.ParseUint(args[0], 10, 64)
+				if err != nil || v == 0 {
+					return fmt.Errorf("invalid version %q", args[0])
+				}
+				version = v
+			}
+			return runBaseline(cmd, version)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	addMigrationFlags(cmd.Flags())
+
+	return cmd
+}
+
+func runBaseline(cmd *cobra.Command, version uint64) error {
+	requiredFields := []string{"mongo_uri", "database_name", "migration_dir"}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		version, err := migration.Baseline(ctx, logger, config.settings, config.MongoURI, config.DatabaseName, config.MigrationDir,
+			version, config.applyOptions().Lock)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Recorded version %d as applied to %s\n", version, config.DatabaseName)
+		return nil
+	})
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/ltman/mondex/tui"
+	"github.com/spf13/cobra"
+)
+
+// browseOptions are the command-specific options of browse.
+type browseOptions struct {
+	source string
+}
+
+func newBrowseCmd() *cobra.Command {
+	var opts browseOptions
+
+	cmd := &cobra.Command{
+		Use:   "browse",
+		Short: "Browse collections and indexes in an interactive terminal UI",
+		Long: `Browse collections and indexes of the schema file, the live database, or both.
+
+With both sources loaded, press d for a side-by-side drift view and tab to switch
+between them. Press / to search collections and q to quit.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runBrowse(cmd, opts)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	addReadFlags(cmd.Flags())
+	addSchemaFlags(cmd.Flags())
+	cmd.Flags().StringVar(&opts.source, "source", "", "What to browse: file, db or both (default: everything configured)")
+
+	return cmd
+}
+
+func runBrowse(cmd *cobra.Command, opts browseOptions) error {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return fmt.Errorf("browse needs an interactive terminal")
+	}
+
+	source, requiredFields, err := resolveSource(cmd, opts.source, true)
+	if err != nil {
+		return err
+	}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		declared, current, err := loadSource(ctx, logger, config, source)
+		if err != nil {
+			return err
+		}
+
+		var sources []tui.Source
+		if source != sourceDB {
+			sources = append(sources, tui.Source{Name: "declared", Schemas: declared})
+		}
+		if source != sourceFile {
+			sources = append(sources, tui.Source{Name: "live", Schemas: current})
+		}
+
+		return tui.Browse(os.Stdin, os.Stdout, config.comparison(), sources...)
+	})
+}
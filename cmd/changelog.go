@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/migration"
+	"github.com/spf13/cobra"
+)
+
+// changelogOptions are the command-specific options of changelog.
+type changelogOptions struct {
+	applied bool
+	out     string
+}
+
+func newChangelogCmd() *cobra.Command {
+	var opts changelogOptions
+
+	cmd := &cobra.Command{
+		Use:   "changelog",
+		Short: "Generate a changelog of schema changes from the migration files",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runChangelog(cmd, opts)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	addMigrationFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.applied, "applied", false, "Mark each version as applied or pending in the database")
+	cmd.Flags().StringVar(&opts.out, "out", "", "Write the changelog to this file instead of stdout")
+
+	return cmd
+}
+
+func runChangelog(cmd *cobra.Command, opts changelogOptions) error {
+	requiredFields := []string{"migration_dir"}
+	if opts.applied {
+		requiredFields = append(requiredFields, "mongo_uri", "database_name")
+	}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		entries, err := migration.ReadChangelog(config.MigrationDir)
+		if err != nil {
+			return err
+		}
+
+		status := func(uint64) string { return "" }
+		if opts.applied {
+			version, dirty, err := migration.ReadAppliedVersion(ctx, logger, config.settings, config.MongoURI, config.DatabaseName)
+			if err != nil {
+				return err
+			}
+			status = func(v uint64) string {
+				switch {
+				case version == db.NilVersion || v > uint64(version):
+					return " (pending)"
+				case v == uint64(version) && dirty:
+					return " (failed)"
+				default:
+					return " (applied)"
+				}
+			}
+		}
+
+		var buf bytes.Buffer
+		buf.WriteString("# Schema Changelog\n")
+		for _, entry := range slices.Backward(entries) {
+			fmt.Fprintf(&buf, "\n## %06d %s%s\n\n", entry.Version, strings.ReplaceAll(entry.Name, "_", " "), status(entry.Version))
+			if len(entry.Changes) == 0 {
+				buf.WriteString("- No changes\n")
+			}
+			for _, change := range entry.Changes {
+				var parts []string
+				if len(change.Created) > 0 {
+					parts = append(parts, "created "+strings.Join(change.Created, ", "))
+				}
+				if len(change.Dropped) > 0 {
+					parts = append(parts, "dropped "+strings.Join(change.Dropped, ", "))
+				}
+				if len(change.Commands) > 0 {
+					parts = append(parts, "ran "+strings.Join(change.Commands, ", "))
+				}
+				fmt.Fprintf(&buf, "- **%s**: %s\n", change.Collection, strings.Join(parts, "; "))
+			}
+		}
+
+		return writeResult(cmd, logger, config, opts.out, buf.Bytes())
+	})
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ltman/mondex/migration"
+)
+
+// checkExitDrift is the exit code of check when the database drifted.
+const checkExitDrift = 2
+
+// checkOptions are the command-specific options of check.
+type checkOptions struct {
+	json bool
+}
+
+func newCheckCmd() *cobra.Command {
+	var opts checkOptions
+
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check the live database against the schema file",
+		Long: `Compare the live database with the schema file, as diff does, and list every
+index or validator that differs, without writing anything.
+
+check exits with 2 when the database drifted, with 1 when it couldn't check,
+and with 0 otherwise.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runCheck(cmd, opts)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	addReadFlags(cmd.Flags())
+	addSchemaFlags(cmd.Flags())
+	addDiffFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print the differences as JSON")
+
+	return cmd
+}
+
+func runCheck(cmd *cobra.Command, opts checkOptions) error {
+	opts.json = opts.json || configOf(cmd).output.json()
+
+	requiredFields := []string{"mongo_uri", "database_name", "schema_file_path"}
+	tenants := tenantMode(cmd)
+	if tenants {
+		requiredFields = withoutDatabaseName(requiredFields)
+	}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		diffOptions, err := config.diffOptions()
+		if err != nil {
+			return err
+		}
+		// Nothing is written: collections to drop are only reported.
+		diffOptions.ConfirmDrop = func([]string) bool { return true }
+
+		if tenants {
+			return checkTenants(ctx, logger, cmd, config, diffOptions, opts)
+		}
+
+		differences, err := migration.CheckSchema(ctx, logger, config.settings, config.MongoURI, config.DatabaseName, diffOptions)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if opts.json {
+			if differences == nil {
+				differences = []migration.SchemaDifference{}
+			}
+			if err := printJSON(out, differences); err != nil {
+				return err
+			}
+		} else if len(differences) == 0 {
+			fmt.Fprintln(out, "Database matches the schema file")
+		} else {
+			fmt.Fprintf(out, "Database drifted from the schema file, %d difference(s):\n", len(differences))
+			printDifferences(out, differences)
+		}
+
+		if len(differences) == 0 {
+			return nil
+		}
+		// The differences are reported above; usage would bury them.
+		cmd.SilenceUsage = true
+		return &exitError{code: checkExitDrift, err: fmt.Errorf("database drifted from the schema file")}
+	})
+}
+
+// checkTenants checks every tenant database, printing the differences of
+// each that drifted followed by a summary.
+func checkTenants(
+	ctx context.Context,
+	logger *slog.Logger,
+	cmd *cobra.Command,
+	config Config,
+	diffOptions migration.DiffOptions,
+	opts checkOptions,
+) error {
+	var mu sync.Mutex
+	drifted := make(map[string][]migration.SchemaDifference)
+	results, err := migration.ForEachTenant(
+		ctx, logger, config.settings, config.MongoURI, config.Tenants.Databases, config.Tenants.Concurrency,
+		func(ctx context.Context, logger *slog.Logger, settings migration.Settings, database string) error {
+			differences, err := migration.CheckSchema(ctx, logger, settings, config.MongoURI, database, diffOptions)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(differences) > 0 {
+				drifted[database] = differences
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	// The differences are reported below; usage would bury them.
+	cmd.SilenceUsage = true
+	if opts.json {
+		if err := printJSON(out, drifted); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range results {
+			if differences := drifted[r.Database]; len(differences) > 0 {
+				fmt.Fprintf(out, "Database %s drifted from the schema file, %d difference(s):\n", r.Database, len(differences))
+				printDifferences(out, differences)
+			}
+		}
+	}
+	summary := out
+	if opts.json {
+		summary = cmd.ErrOrStderr()
+	}
+	if err := printTenantSummary(summary, results); err != nil {
+		return err
+	}
+
+	if len(drifted) == 0 {
+		return nil
+	}
+	return &exitError{code: checkExitDrift, err: fmt.Errorf("%d database(s) drifted from the schema file", len(drifted))}
+}
+
+// printDifferences lists the differences, one per line.
+func printDifferences(out io.Writer, differences []migration.SchemaDifference) {
+	for _, d := range differences {
+		fmt.Fprintf(out, "  %s\n", d)
+	}
+}
+
+// printJSON prints v as indented JSON.
+func printJSON(out io.Writer, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s\n", data)
+	return err
+}
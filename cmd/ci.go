@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ltman/mondex/migration"
+)
+
+// Exit codes of ci.
+const (
+	ciExitFailed = 1
+	ciExitDrift  = 2
+)
+
+// Results of a ci step.
+const (
+	ciPassed  = "ok"
+	ciFailed  = "failed"
+	ciDrift   = "drift"
+	ciSkipped = "skipped"
+)
+
+// ciOptions are the command-specific options of ci.
+type ciOptions struct {
+	useState       bool
+	useRemoteState bool
+	skipDrift      bool
+	planDir        string
+	json           bool
+}
+
+// ciStep is the outcome of one check of ci.
+type ciStep struct {
+	Step   string `json:"step"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func newCiCmd() *cobra.Command {
+	var opts ciOptions
+
+	cmd := &cobra.Command{
+		Use:   "ci",
+		Short: "Run every check of a CI pipeline and report them together",
+		Long: `Run every check of a CI pipeline in one invocation: the schema file is formatted,
+it is valid, and the database doesn't drift from it. With --plan-dir, the
+migrations diff would generate are written there as build artifacts.
+
+Every check runs even when an earlier one fails. ci exits with 1 when any check
+failed, with 2 when the only finding is drift, and with 0 otherwise.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runCi(cmd, opts)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	addReadFlags(cmd.Flags())
+	addSchemaFlags(cmd.Flags())
+	addAccessFlags(cmd.Flags())
+	addStateFlags(cmd.Flags())
+	addDiffFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.useState, "use-state", false, "Check drift against the state file instead of the live database")
+	cmd.Flags().BoolVar(&opts.useRemoteState, "use-remote-state", false,
+		"Check drift against the schema recorded by apply in the mondex_state collection")
+	cmd.MarkFlagsMutuallyExclusive("use-state", "use-remote-state")
+	cmd.Flags().BoolVar(&opts.skipDrift, "skip-drift", false, "Only check the schema file, without a database or state file")
+	cmd.MarkFlagsMutuallyExclusive("skip-drift", "use-state")
+	cmd.MarkFlagsMutuallyExclusive("skip-drift", "use-remote-state")
+	cmd.Flags().StringVar(&opts.planDir, "plan-dir", "", "Write the migrations diff would generate to this directory")
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print the report as JSON")
+
+	return cmd
+}
+
+func runCi(cmd *cobra.Command, opts ciOptions) error {
+	opts.json = opts.json || configOf(cmd).output.json()
+
+	requiredFields := []string{"schema_file_path"}
+	switch {
+	case opts.skipDrift:
+	case opts.useState:
+		requiredFields = append(requiredFields, "state_file_path")
+	default:
+		requiredFields = append(requiredFields, "mongo_uri", "database_name")
+	}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	source := migration.SourceDatabase
+	switch {
+	case opts.useState:
+		source = migration.SourceStateFile
+	case opts.useRemoteState:
+		source = migration.SourceRemoteState
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		var steps []ciStep
+		check := func(step string, err error) {
+			if err != nil {
+				logger.Error("Check failed", "step", step, "error", err)
+				steps = append(steps, ciStep{Step: step, Result: ciFailed, Detail: err.Error()})
+				return
+			}
+			steps = append(steps, ciStep{Step: step, Result: ciPassed})
+		}
+
+		check("format", migration.FormatSchemaFile(ctx, logger, config.settings, config.SchemaFilePath, migration.FormatOptions{Check: true}))
+		check("lint", migration.LintSchemaFile(logger, config.SchemaFilePath))
+
+		if opts.skipDrift {
+			steps = append(steps, ciStep{Step: "drift", Result: ciSkipped})
+		} else {
+			diffOptions, err := config.diffOptions()
+			if err != nil {
+				return err
+			}
+			// Nothing is written to the migration directory: dropping
+			// collections only shows in the report and the plan.
+			diffOptions.ConfirmDrop = func([]string) bool { return true }
+			diffOptions.Source, diffOptions.StatePath = source, config.StateFilePath
+			diffOptions.PreviewDir = opts.planDir
+
+			drift, err := migration.CheckDrift(ctx, logger, config.settings, config.MongoURI, config.DatabaseName, diffOptions)
+			switch {
+			case err != nil:
+				check("drift", err)
+			case drift.Migrations > 0 || len(drift.ReadOnly) > 0:
+				var details []string
+				if drift.Migrations > 0 {
+					detail := fmt.Sprintf("%d migration(s) to generate, run mondex diff", drift.Migrations)
+					if opts.planDir != "" {
+						detail += ", plan written to " + opts.planDir
+					}
+					details = append(details, detail)
+				}
+				if len(drift.ReadOnly) > 0 {
+					details = append(details, "read-only collections drifted: "+strings.Join(drift.ReadOnly, "; "))
+				}
+				steps = append(steps, ciStep{Step: "drift", Result: ciDrift, Detail: strings.Join(details, ", ")})
+			default:
+				check("drift", nil)
+			}
+		}
+
+		if err := printCiReport(cmd.OutOrStdout(), steps, opts.json); err != nil {
+			return err
+		}
+		// Findings are reported above; usage would bury them.
+		cmd.SilenceUsage = true
+		return ciResult(steps)
+	})
+}
+
+func printCiReport(out io.Writer, steps []ciStep, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(steps, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", data)
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tRESULT\tDETAIL")
+	for _, step := range steps {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", step.Step, step.Result, firstLine(step.Detail))
+	}
+	return w.Flush()
+}
+
+// firstLine returns the first line of a possibly multi-line message, such as a
+// parse error quoting the offending line.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// ciResult fails with the exit code of the worst result of the steps.
+func ciResult(steps []ciStep) error {
+	var failed, drift int
+	for _, step := range steps {
+		switch step.Result {
+		case ciFailed:
+			failed++
+		case ciDrift:
+			drift++
+		}
+	}
+
+	switch {
+	case failed > 0:
+		return &exitError{code: ciExitFailed, err: fmt.Errorf("%d check(s) failed", failed)}
+	case drift > 0:
+		return &exitError{code: ciExitDrift, err: fmt.Errorf("database drifted from the schema file")}
+	}
+	return nil
+}
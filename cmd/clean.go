@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/ltman/mondex/migration"
+	"github.com/spf13/cobra"
+)
+
+func newCleanCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Find orphaned, duplicate and empty migration files and offer to fix them",
+		Long: `Find up migrations without down migrations and vice versa, versions used by
+several migrations, empty files and gaps in the numbering. On a terminal, each
+problem can be fixed, deleted or skipped; otherwise the problems are only
+reported and the command fails if any needs attention.`,
+		Args: cobra.NoArgs,
+		RunE: runClean,
+	}
+
+	addMigrationFlags(cmd.Flags())
+
+	return cmd
+}
+
+func runClean(cmd *cobra.Command, _ []string) error {
+	requiredFields := []string{"migration_dir"}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		problems, err := migration.CheckMigrationDir(config.MigrationDir)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if len(problems) == 0 {
+			fmt.Fprintln(out, "No problems found in", config.MigrationDir)
+			return nil
+		}
+
+		interactive := isTerminal(os.Stdin)
+		in := bufio.NewReader(cmd.InOrStdin())
+
+		var unresolved int
+		for _, problem := range problems {
+			fmt.Fprintln(out, problem.String())
+			if problem.Kind == migration.ProblemGap {
+				continue
+			}
+			if !interactive {
+				unresolved++
+				continue
+			}
+
+			resolved, err := resolveProblem(out, in, logger, config.settings, problem)
+			if err != nil {
+				return err
+			}
+			if !resolved {
+				unresolved++
+			}
+		}
+
+		if unresolved > 0 {
+			return fmt.Errorf("%d problem(s) left in %s", unresolved, config.MigrationDir)
+		}
+		return nil
+	})
+}
+
+// resolveProblem asks how to handle the problem and applies the answer,
+// reporting whether the problem was resolved.
+func resolveProblem(out io.Writer, in *bufio.Reader, logger *slog.Logger, settings migration.Settings, problem migration.MigrationProblem) (bool, error) {
+	var choices []string
+	if action := problem.FixAction(); action != "" {
+		fmt.Fprintf(out, "  [f]ix: %s\n", action)
+		choices = append(choices, "f")
+	}
+	if problem.CanDelete() {
+		fmt.Fprintf(out, "  [d]elete: %s\n", strings.Join(problem.Paths, ", "))
+		choices = append(choices, "d")
+	}
+	fmt.Fprintln(out, "  [s]kip")
+	choices = append(choices, "s")
+
+	for {
+		fmt.Fprintf(out, "Action (%s)? ", strings.Join(choices, "/"))
+		answer, err := in.ReadString('\n')
+		if err != nil && answer == "" {
+			return false, nil
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "f":
+			if problem.FixAction() == "" {
+				continue
+			}
+			if err := problem.Fix(settings); err != nil {
+				return false, fmt.Errorf("fixing %s: %w", problem.Kind, err)
+			}
+			logger.Info("Fixed problem", "kind", problem.Kind, "version", problem.Version)
+			return true, nil
+		case "d":
+			if !problem.CanDelete() {
+				continue
+			}
+			if err := problem.Delete(); err != nil {
+				return false, fmt.Errorf("deleting %s: %w", strings.Join(problem.Paths, ", "), err)
+			}
+			logger.Info("Deleted files", "paths", problem.Paths)
+			return true, nil
+		case "s", "":
+			return false, nil
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/token"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/ltman/mondex/codegen"
+	"github.com/ltman/mondex/migration"
+	"github.com/spf13/cobra"
+)
+
+// codegenOptions are the command-specific options of codegen.
+type codegenOptions struct {
+	lang        string
+	out         string
+	packageName string
+}
+
+func newCodegenCmd() *cobra.Command {
+	var opts codegenOptions
+
+	cmd := &cobra.Command{
+		Use:   "codegen",
+		Short: "Generate constants for the declared collection and index names",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runCodegen(cmd, opts)
+		},
+	}
+
+	addSchemaFlags(cmd.Flags())
+	cmd.Flags().StringVar(&opts.lang, "lang", "go", "Language to generate: go")
+	cmd.Flags().StringVar(&opts.out, "out", "", "Write the code to this file instead of stdout")
+	cmd.Flags().StringVar(&opts.packageName, "package", "", "Package name (default: the name of the output directory)")
+
+	return cmd
+}
+
+func runCodegen(cmd *cobra.Command, opts codegenOptions) error {
+	if opts.lang != "go" {
+		return fmt.Errorf("invalid language %q (want go)", opts.lang)
+	}
+
+	packageName := opts.packageName
+	if packageName == "" {
+		packageName = "schema"
+		if opts.out != "" {
+			if abs, err := filepath.Abs(opts.out); err == nil {
+				packageName = strings.ToLower(strings.NewReplacer("-", "", ".", "").Replace(filepath.Base(filepath.Dir(abs))))
+			}
+		}
+	}
+	if !token.IsIdentifier(packageName) {
+		return fmt.Errorf("invalid package name %q, set one with --package", packageName)
+	}
+
+	requiredFields := []string{"schema_file_path"}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		declared, err := migration.ReadDeclaredSchema(config.settings, config.SchemaFilePath)
+		if err != nil {
+			return fmt.Errorf("reading declared schema: %w", err)
+		}
+
+		var buf bytes.Buffer
+		if err := codegen.Go(&buf, packageName, declared); err != nil {
+			return err
+		}
+
+		return writeResult(cmd, logger, config, opts.out, buf.Bytes())
+	})
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/migration"
+)
+
+// compareEnvsOptions are the command-specific options of compare-envs.
+type compareEnvsOptions struct {
+	envs []string
+	json bool
+}
+
+func newCompareEnvsCmd() *cobra.Command {
+	var opts compareEnvsOptions
+
+	cmd := &cobra.Command{
+		Use:   "compare-envs",
+		Short: "Show which indexes differ between environments",
+		Long: `Inspect every environment of the environments config section and print a matrix
+of the indexes that aren't the same everywhere. Each cell names the definition an
+environment has, the same letter for the same definition, or - when the index is
+missing. With schema_file_path set, the declared schema is compared too.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runCompareEnvs(cmd, opts)
+		},
+	}
+
+	addReadFlags(cmd.Flags())
+	addSchemaFlags(cmd.Flags())
+	cmd.Flags().StringSliceVar(&opts.envs, "env", nil, "Only compare these environments")
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print the matrix as JSON")
+
+	return cmd
+}
+
+func runCompareEnvs(cmd *cobra.Command, opts compareEnvsOptions) error {
+	opts.json = opts.json || configOf(cmd).output.json()
+
+	if err := validateConfig(cmd, nil); err != nil {
+		return err
+	}
+
+	cfg := configOf(cmd)
+	names := slices.Sorted(maps.Keys(cfg.Environments))
+	if len(opts.envs) > 0 {
+		for _, name := range opts.envs {
+			if _, ok := cfg.Environments[name]; !ok {
+				return fmt.Errorf("unknown environment %q (configured: %s)", name, strings.Join(names, ", "))
+			}
+		}
+		names = opts.envs
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no environments configured, declare them in the environments section")
+	}
+
+	var environments []migration.Environment
+	for _, name := range names {
+		env := cfg.Environments[name]
+		if env.MongoURI == "" || env.DatabaseName == "" {
+			return fmt.Errorf("environment %s: mongo_uri and database_name are required", name)
+		}
+		environments = append(environments, migration.Environment{
+			Name:         name,
+			MongoURI:     env.MongoURI,
+			DatabaseName: env.DatabaseName,
+			ReadOptions: db.ReadOptions{
+				Preference:    cmp.Or(env.ReadPreference, cfg.ReadPreference),
+				Concern:       cmp.Or(env.ReadConcern, cfg.ReadConcern),
+				Concurrency:   cfg.ReadConcurrency,
+				SearchIndexes: cfg.SearchIndexes,
+			},
+		})
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		matrix, err := migration.CompareEnvironments(ctx, logger, config.settings, environments, config.SchemaFilePath)
+		if err != nil {
+			return err
+		}
+		return printEnvironmentMatrix(cmd.OutOrStdout(), matrix, opts.json)
+	})
+}
+
+func printEnvironmentMatrix(out io.Writer, matrix migration.EnvironmentMatrix, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(matrix, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", data)
+		return err
+	}
+
+	if len(matrix.Rows) == 0 {
+		_, err := fmt.Fprintf(out, "All %d index(es) are the same in %s\n", matrix.Indexes, strings.Join(matrix.Columns, ", "))
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "COLLECTION\tINDEX\t%s\n", strings.ToUpper(strings.Join(matrix.Columns, "\t")))
+	for _, row := range matrix.Rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", row.Collection, row.Index, strings.Join(row.Cells, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "\n%d of %d index(es) differ\n", len(matrix.Rows), matrix.Indexes)
+	return err
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ltman/mondex/migration"
+	"github.com/spf13/cobra"
+)
+
+func newCompletionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion bash|zsh|fish|powershell",
+		Short: "Generate the autocompletion script for the specified shell",
+		Long: `Generate the autocompletion script for mondex for the specified shell.
+
+Collection names are completed dynamically from the configured schema file.
+
+To load completions in the current bash session:
+
+  source <(mondex completion bash)
+
+To load completions for every zsh session, write the script into your fpath:
+
+  mondex completion zsh > "${fpath[1]}/_mondex"`,
+		ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+		Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, out := cmd.Root(), cmd.OutOrStdout()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(out, true)
+			case "zsh":
+				return root.GenZshCompletion(out)
+			case "fish":
+				return root.GenFishCompletion(out, true)
+			case "powershell":
+				return root.GenPowerShellCompletionWithDesc(out)
+			}
+			return fmt.Errorf("unsupported shell %q", args[0])
+		},
+	}
+}
+
+// completeCollections completes collection names declared in the schema file,
+// for the flags taking one.
+func completeCollections(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if err := initConfig(cmd); err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	config := configOf(cmd)
+	if config.SchemaFilePath == "" {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	settings, err := config.migrationSettings()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	collections, err := migration.DeclaredCollections(settings, config.SchemaFilePath)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var matches []string
+	for _, collection := range collections {
+		if strings.HasPrefix(collection, toComplete) {
+			matches = append(matches, collection)
+		}
+	}
+	return matches, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCollectionFlagsComplete(t *testing.T) {
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		if cmd.Flags().Lookup("collection") != nil {
+			if _, ok := cmd.GetFlagCompletionFunc("collection"); !ok {
+				t.Errorf("%s: --collection has no completion", cmd.CommandPath())
+			}
+		}
+		for _, child := range cmd.Commands() {
+			walk(child)
+		}
+	}
+	walk(newRootCmd())
+}
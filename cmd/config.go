@@ -0,0 +1,563 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ltman/mondex/migration"
+)
+
+// envPrefix is the prefix of environment variables overriding config keys,
+// e.g. MONDEX_MONGO_URI or MONDEX_WRITE_CONCERN_W.
+const envPrefix = "MONDEX"
+
+const redacted = "<redacted>"
+
+// workflowRequiredFields lists the config keys each workflow needs, as checked by config validate.
+var workflowRequiredFields = map[string][]string{
+	"apply":   {"mongo_uri", "database_name", "migration_dir"},
+	"diff":    {"mongo_uri", "database_name", "schema_file_path", "migration_dir"},
+	"format":  {"schema_file_path"},
+	"inspect": {"mongo_uri", "database_name", "schema_file_path"},
+}
+
+// secretKeyMarkers mark config keys whose values are never printed.
+var secretKeyMarkers = []string{"password", "secret", "private_key", "token", "auth_mechanism_properties"}
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the mondex configuration",
+	}
+
+	addConnectionFlags(cmd.PersistentFlags())
+	addReadFlags(cmd.PersistentFlags())
+	addSchemaFlags(cmd.PersistentFlags())
+	addAccessFlags(cmd.PersistentFlags())
+	addMigrationFlags(cmd.PersistentFlags())
+	addStateFlags(cmd.PersistentFlags())
+	addDiffFlags(cmd.PersistentFlags())
+	addApplyFlags(cmd.PersistentFlags())
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Print the effective configuration and where each value comes from",
+		Args:  cobra.NoArgs,
+		RunE:  runConfigShow,
+	})
+
+	var workflows []string
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the configuration for unknown keys, missing fields and unusable values",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runConfigValidate(cmd, workflows)
+		},
+	}
+	validateCmd.Flags().StringSliceVar(&workflows, "for", []string{"apply", "diff", "format", "inspect"},
+		"Workflows whose required fields are checked")
+	cmd.AddCommand(validateCmd)
+
+	return cmd
+}
+
+// configError is a single problem found in the configuration.
+type configError struct {
+	Key     string
+	Problem string
+}
+
+func (e configError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Problem)
+}
+
+func runConfigValidate(cmd *cobra.Command, workflows []string) error {
+	problems, err := validateConfigFile(configOf(cmd), workflows)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	for _, problem := range problems {
+		fmt.Fprintln(out, problem.Error())
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %d problem(s) found", len(problems))
+	}
+
+	fmt.Fprintln(out, "Configuration is valid")
+	return nil
+}
+
+// validateConfigFile checks the effective configuration for the given
+// workflows. The settings are only built, never installed, so validating has
+// no effect on the commands that run afterwards.
+func validateConfigFile(config Config, workflows []string) ([]configError, error) {
+	var problems []configError
+
+	if path := viper.ConfigFileUsed(); path != "" {
+		unknown, err := unknownConfigKeys(path)
+		if err != nil {
+			problems = append(problems, configError{Key: "config", Problem: err.Error()})
+		}
+		for _, key := range unknown {
+			problems = append(problems, configError{Key: key, Problem: "unknown key"})
+		}
+	}
+
+	var required []string
+	for _, workflow := range workflows {
+		fields, ok := workflowRequiredFields[workflow]
+		if !ok {
+			return nil, fmt.Errorf("unknown workflow %q", workflow)
+		}
+		for _, field := range fields {
+			if !slices.Contains(required, field) {
+				required = append(required, field)
+			}
+		}
+	}
+	slices.Sort(required)
+	if len(config.Tenants.Databases) > 0 && !slices.Contains(workflows, "inspect") {
+		// The tenants replace database_name, except for inspect.
+		required = withoutDatabaseName(required)
+	}
+	for _, field := range config.missingFields(required) {
+		problems = append(problems, configError{Key: field, Problem: "required by " + strings.Join(workflowsRequiring(field, workflows), ", ")})
+	}
+
+	if config.MongoURI != "" {
+		if err := options.Client().ApplyURI(config.MongoURI).Validate(); err != nil {
+			problems = append(problems, configError{Key: "mongo_uri", Problem: redactURI(err.Error())})
+		}
+	}
+
+	if config.SchemaFilePath != "" && config.SchemaFilePath != migration.StdinPath {
+		if f, err := os.Open(config.SchemaFilePath); err != nil {
+			problems = append(problems, configError{Key: "schema_file_path", Problem: err.Error()})
+		} else {
+			_ = f.Close()
+		}
+	}
+
+	if config.MigrationDir != "" {
+		if info, err := os.Stat(config.MigrationDir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			problems = append(problems, configError{Key: "migration_dir", Problem: err.Error()})
+		} else if err == nil && !info.IsDir() {
+			problems = append(problems, configError{Key: "migration_dir", Problem: "not a directory"})
+		}
+	}
+
+	if config.Atlas.PublicKey != "" {
+		for _, field := range []struct{ key, value string }{
+			{"atlas.private_key", config.Atlas.PrivateKey},
+			{"atlas.project_id", config.Atlas.ProjectID},
+			{"atlas.cluster_name", config.Atlas.ClusterName},
+		} {
+			if field.value == "" {
+				problems = append(problems, configError{Key: field.key, Problem: "required with atlas.public_key"})
+			}
+		}
+	}
+
+	for _, field := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"timeout", config.Timeout},
+		{"connect_timeout", config.ConnectTimeout},
+		{"connection.server_selection_timeout", config.Connection.ServerSelectionTimeout},
+		{"stage_timeouts.inspect", config.StageTimeouts.Inspect},
+		{"stage_timeouts.diff", config.StageTimeouts.Diff},
+		{"stage_timeouts.apply", config.StageTimeouts.Apply},
+		{"lock.timeout", config.Lock.Timeout},
+		{"lock.initial_interval", config.Lock.InitialInterval},
+		{"lock.max_interval", config.Lock.MaxInterval},
+		{"index_builds.max_time", config.IndexBuilds.MaxTime},
+		{"index_builds.log_interval", config.IndexBuilds.LogInterval},
+	} {
+		if field.value < 0 {
+			problems = append(problems, configError{Key: field.key, Problem: "must not be negative"})
+		}
+	}
+
+	if _, err := config.fileMode(); err != nil {
+		problems = append(problems, configError{Key: "file_mode", Problem: err.Error()})
+	}
+
+	if _, err := config.fileGroup(); err != nil {
+		problems = append(problems, configError{Key: "file_group", Problem: err.Error()})
+	}
+
+	if err := (migration.Settings{IgnoredCollections: config.Ignore.Collections, IgnoredIndexes: config.Ignore.Indexes}).Check(); err != nil {
+		problems = append(problems, configError{Key: "ignore", Problem: err.Error()})
+	}
+
+	if err := migration.CheckTenantPatterns(config.Tenants.Databases); err != nil {
+		problems = append(problems, configError{Key: "tenants.databases", Problem: err.Error()})
+	}
+	if err := checkMigrationFormat(config.MigrationFormat); err != nil {
+		problems = append(problems, configError{Key: "migration_format", Problem: err.Error()})
+	}
+
+	if config.ReadConcurrency < 0 {
+		problems = append(problems, configError{Key: "read_concurrency", Problem: "must not be negative"})
+	}
+	if config.Tenants.Concurrency < 0 {
+		problems = append(problems, configError{Key: "tenants.concurrency", Problem: "must not be negative"})
+	}
+
+	if _, err := config.suppressionRules(); err != nil {
+		problems = append(problems, configError{Key: "suppress", Problem: err.Error()})
+	}
+
+	if style, err := config.formatStyle(); err != nil {
+		problems = append(problems, configError{Key: "format.order", Problem: err.Error()})
+	} else if err := (migration.Settings{FormatStyle: style}).Check(); err != nil {
+		problems = append(problems, configError{Key: "format", Problem: err.Error()})
+	}
+
+	if err := config.comparison().Check(); err != nil {
+		problems = append(problems, configError{Key: "comparison.key_order", Problem: err.Error()})
+	}
+
+	if _, err := initLogger(config.LogLevel, false); err != nil {
+		problems = append(problems, configError{Key: "log_level", Problem: err.Error()})
+	}
+
+	if err := config.connectionOptions().Check(); err != nil {
+		problems = append(problems, configError{Key: "connection", Problem: err.Error()})
+	}
+
+	if _, err := config.readOptions().DatabaseOptions(); err != nil {
+		problems = append(problems, configError{Key: "read_preference", Problem: err.Error()})
+	}
+
+	return problems, nil
+}
+
+// unknownConfigKeys returns the keys of the config file that mondex doesn't recognize.
+func unknownConfigKeys(path string) ([]string, error) {
+	file := viper.New()
+	file.SetConfigFile(path)
+	if err := file.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	known := configKeys()
+	environmentKeys := structKeys(reflect.TypeOf(EnvironmentConfig{}), "")
+	var unknown []string
+	for _, key := range file.AllKeys() {
+		if slices.Contains(known, key) {
+			continue
+		}
+		if strings.HasPrefix(key, "connection.auth_mechanism_properties.") {
+			// Property names are up to the auth mechanism.
+			continue
+		}
+		if section, rest, ok := strings.Cut(key, "."); ok && section == "environments" {
+			if _, field, ok := strings.Cut(rest, "."); ok && slices.Contains(environmentKeys, field) {
+				continue
+			}
+		}
+		unknown = append(unknown, key)
+	}
+	slices.Sort(unknown)
+	return unknown, nil
+}
+
+func workflowsRequiring(field string, workflows []string) []string {
+	var requiring []string
+	for _, workflow := range workflows {
+		if slices.Contains(workflowRequiredFields[workflow], field) {
+			requiring = append(requiring, workflow)
+		}
+	}
+	return requiring
+}
+
+func runConfigShow(cmd *cobra.Command, _ []string) error {
+	writeConfig(cmd.OutOrStdout(), cmd)
+	return nil
+}
+
+// writeConfig writes the effective configuration with secrets redacted and
+// the source of every value annotated.
+func writeConfig(out io.Writer, cmd *cobra.Command) {
+	for _, key := range configKeys() {
+		value := redactValue(key, viper.Get(key))
+		fmt.Fprintf(out, "%s = %v  # %s\n", key, value, configSource(cmd, key))
+	}
+}
+
+// pathKeys are config keys holding paths that are relative to the config file.
+var pathKeys = []string{"schema_file_path", "access_file_path", "migration_dir", "state_file_path", "script_dir"}
+
+// discoverConfigFile looks for mondex.yml in the working directory and its
+// parents, like git does, and falls back to $XDG_CONFIG_HOME/mondex/config.yml.
+// When nothing is found it returns the default name so viper reports it missing.
+func discoverConfigFile() string {
+	if dir, err := os.Getwd(); err == nil {
+		for {
+			candidate := filepath.Join(dir, defaultConfigFile)
+			if _, err := os.Stat(candidate); err == nil {
+				return candidate
+			}
+
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+
+	if configHome, err := os.UserConfigDir(); err == nil {
+		candidate := filepath.Join(configHome, "mondex", "config.yml")
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+
+	return defaultConfigFile
+}
+
+// resolveConfigPaths makes relative paths read from the config file relative
+// to the file's directory, so a config discovered in a parent directory keeps
+// pointing at the right schema file and migrations.
+func resolveConfigPaths(config *Config) {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		return
+	}
+	dir := filepath.Dir(path)
+
+	file := viper.New()
+	file.SetConfigFile(path)
+	if err := file.ReadInConfig(); err != nil {
+		return
+	}
+
+	for _, key := range pathKeys {
+		value := expandEnv(file.GetString(key))
+		if value == "" || value == migration.StdinPath || filepath.IsAbs(value) || viper.GetString(key) != value {
+			continue
+		}
+		resolved := filepath.Join(dir, value)
+		viper.Set(key, resolved)
+		switch key {
+		case "schema_file_path":
+			config.SchemaFilePath = resolved
+		case "access_file_path":
+			config.AccessFilePath = resolved
+		case "migration_dir":
+			config.MigrationDir = resolved
+		case "state_file_path":
+			config.StateFilePath = resolved
+		case "script_dir":
+			config.ScriptDir = resolved
+		}
+	}
+}
+
+// envReferenceRegex matches the ${VAR} references to environment variables
+// of config values.
+var envReferenceRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the ${VAR} references of s with the values of the
+// environment variables, unset ones expanding to nothing. A lone $, as in
+// regular expressions, is kept.
+func expandEnv(s string) string {
+	return envReferenceRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		return os.Getenv(envReferenceRegex.FindStringSubmatch(ref)[1])
+	})
+}
+
+// expandConfigEnv expands the ${VAR} references of every config value, so
+// secrets can be kept out of the config file.
+func expandConfigEnv() {
+	for _, key := range viper.AllKeys() {
+		if expanded, changed := expandEnvValue(viper.Get(key)); changed {
+			viper.Set(key, expanded)
+		}
+	}
+}
+
+// expandEnvValue expands the ${VAR} references of the strings of a config
+// value, lists and sections included, reporting whether any changed.
+func expandEnvValue(value any) (any, bool) {
+	switch v := value.(type) {
+	case string:
+		expanded := expandEnv(v)
+		return expanded, expanded != v
+	case []any:
+		expanded := make([]any, len(v))
+		changed := false
+		for i, item := range v {
+			var itemChanged bool
+			expanded[i], itemChanged = expandEnvValue(item)
+			changed = changed || itemChanged
+		}
+		return expanded, changed
+	case map[string]any:
+		expanded := make(map[string]any, len(v))
+		changed := false
+		for k, item := range v {
+			var itemChanged bool
+			expanded[k], itemChanged = expandEnvValue(item)
+			changed = changed || itemChanged
+		}
+		return expanded, changed
+	}
+	return value, false
+}
+
+// applyEnvironment overrides the connection settings with those of the
+// environment selected by --env, unless a flag or environment variable sets
+// them.
+func applyEnvironment(cmd *cobra.Command, config *Config) error {
+	name := configEnvironment(cmd)
+	if name == "" {
+		return nil
+	}
+	environment, ok := config.Environments[name]
+	if !ok {
+		return fmt.Errorf("unknown environment %q (configured: %s)",
+			name, strings.Join(slices.Sorted(maps.Keys(config.Environments)), ", "))
+	}
+
+	for _, field := range []struct {
+		key   string
+		value string
+		dst   *string
+	}{
+		{"mongo_uri", environment.MongoURI, &config.MongoURI},
+		{"database_name", environment.DatabaseName, &config.DatabaseName},
+		{"read_preference", environment.ReadPreference, &config.ReadPreference},
+		{"read_concern", environment.ReadConcern, &config.ReadConcern},
+	} {
+		if field.value == "" || overriddenOutsideFile(cmd, field.key) {
+			continue
+		}
+		viper.Set(field.key, field.value)
+		*field.dst = field.value
+	}
+	return nil
+}
+
+// overriddenOutsideFile reports whether a flag or environment variable sets
+// the key, taking precedence over the config file.
+func overriddenOutsideFile(cmd *cobra.Command, key string) bool {
+	if flag := cmd.Flags().Lookup(key); flag != nil && flag.Changed {
+		return true
+	}
+	_, ok := os.LookupEnv(configEnvKey(key))
+	return ok
+}
+
+// configEnvKey returns the environment variable overriding the key.
+func configEnvKey(key string) string {
+	return envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// configKeys lists every config key, flattening nested sections with dots.
+func configKeys() []string {
+	return structKeys(reflect.TypeOf(Config{}), "")
+}
+
+func structKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		key := prefix + tag
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Duration(0)) {
+			keys = append(keys, structKeys(field.Type, key+".")...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// configSource reports which configuration layer the key's value comes from,
+// following viper's precedence: flag, environment, config file, default.
+func configSource(cmd *cobra.Command, key string) string {
+	if flag := cmd.Flags().Lookup(key); flag != nil && flag.Changed {
+		return "flag --" + key
+	}
+
+	envKey := configEnvKey(key)
+	if _, ok := os.LookupEnv(envKey); ok {
+		return "env " + envKey
+	}
+
+	if name := configEnvironment(cmd); name != "" && viper.GetString("environments."+name+"."+key) != "" {
+		return "environment " + name
+	}
+
+	if viper.InConfig(key) {
+		return "config " + viper.ConfigFileUsed()
+	}
+
+	return "default"
+}
+
+// redactValue hides secrets: values of secret-looking keys entirely,
+// and passwords embedded in connection URIs.
+func redactValue(key string, value any) any {
+	if slices.ContainsFunc(secretKeyMarkers, func(marker string) bool {
+		return strings.Contains(key, marker)
+	}) {
+		if value == nil || value == "" {
+			return value
+		}
+		return redacted
+	}
+
+	switch v := value.(type) {
+	case string:
+		return redactURI(v)
+	case map[string]any:
+		// Sections of named entries, such as environments.
+		redactedMap := make(map[string]any, len(v))
+		for k, entry := range v {
+			redactedMap[k] = redactValue(key+"."+k, entry)
+		}
+		return redactedMap
+	}
+	return value
+}
+
+// redactURI replaces the password of a URI, leaving other strings untouched.
+func redactURI(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return s
+	}
+	return u.Redacted()
+}
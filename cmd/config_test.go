@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestValidateConfigFileReportsInvalidSettings(t *testing.T) {
+	config := Config{
+		LogLevel:   "info",
+		Ignore:     IgnoreConfig{Collections: []string{"/[/"}},
+		Format:     FormatConfig{Indent: 9},
+		Comparison: ComparisonConfig{KeyOrder: "sideways"},
+		FileMode:   "0999",
+	}
+	problems, err := validateConfigFile(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	for _, problem := range problems {
+		keys = append(keys, problem.Key)
+	}
+	for _, key := range []string{"ignore", "format", "comparison.key_order", "file_mode"} {
+		if !slices.Contains(keys, key) {
+			t.Errorf("no problem reported for %s, got %v", key, problems)
+		}
+	}
+
+	if problems, err := validateConfigFile(Config{LogLevel: "info"}, nil); err != nil || len(problems) > 0 {
+		t.Errorf("valid config: problems %v, err %v", problems, err)
+	}
+}
+
+func TestValidateConfigReadsTheResolvedConfig(t *testing.T) {
+	cmd := &cobra.Command{}
+	// Set by an environment of the config file, which viper's top-level
+	// keys don't see.
+	setConfig(cmd, Config{MongoURI: "mongodb://localhost", DatabaseName: "app"})
+
+	if err := validateConfig(cmd, []string{"mongo_uri", "database_name"}); err != nil {
+		t.Errorf("resolved fields reported missing: %v", err)
+	}
+	err := validateConfig(cmd, []string{"mongo_uri", "migration_dir"})
+	if err == nil || !strings.Contains(err.Error(), "migration_dir") || strings.Contains(err.Error(), "mongo_uri") {
+		t.Errorf("got %v, want migration_dir missing", err)
+	}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/ltman/mondex/export"
+	"github.com/ltman/mondex/migration"
+	"github.com/ltman/mondex/schema"
+	"github.com/spf13/cobra"
+)
+
+// diagramOptions are the command-specific options of diagram.
+type diagramOptions struct {
+	format string
+	out    string
+}
+
+func newDiagramCmd() *cobra.Command {
+	var opts diagramOptions
+
+	cmd := &cobra.Command{
+		Use:   "diagram",
+		Short: "Generate a diagram of the declared collections and indexes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runDiagram(cmd, opts)
+		},
+	}
+
+	addSchemaFlags(cmd.Flags())
+	cmd.Flags().StringVar(&opts.format, "format", "mermaid", "Diagram format: mermaid or dot (Graphviz)")
+	cmd.Flags().StringVar(&opts.out, "out", "", "Write the diagram to this file instead of stdout")
+
+	return cmd
+}
+
+func runDiagram(cmd *cobra.Command, opts diagramOptions) error {
+	var write func(io.Writer, []schema.Schema) error
+	switch opts.format {
+	case "mermaid":
+		write = export.Mermaid
+	case "dot", "graphviz":
+		write = export.Graphviz
+	default:
+		return fmt.Errorf("invalid format %q (want mermaid or dot)", opts.format)
+	}
+
+	requiredFields := []string{"schema_file_path"}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		declared, err := migration.ReadDeclaredSchema(config.settings, config.SchemaFilePath)
+		if err != nil {
+			return fmt.Errorf("reading declared schema: %w", err)
+		}
+
+		var buf bytes.Buffer
+		if err := write(&buf, declared); err != nil {
+			return fmt.Errorf("rendering diagram: %w", err)
+		}
+
+		return writeResult(cmd, logger, config, opts.out, buf.Bytes())
+	})
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/ltman/mondex/export"
+	"github.com/ltman/mondex/migration"
+	"github.com/ltman/mondex/schema"
+	"github.com/spf13/cobra"
+)
+
+// docsOptions are the command-specific options of docs.
+type docsOptions struct {
+	format string
+	out    string
+	title  string
+}
+
+func newDocsCmd() *cobra.Command {
+	var opts docsOptions
+
+	cmd := &cobra.Command{
+		Use:   "docs",
+		Short: "Generate documentation of the declared schema",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runDocs(cmd, opts)
+		},
+	}
+
+	addSchemaFlags(cmd.Flags())
+	cmd.Flags().StringVar(&opts.format, "format", "markdown", "Output format: markdown or html")
+	cmd.Flags().StringVar(&opts.out, "out", "", "Write the documentation to this file instead of stdout")
+	cmd.Flags().StringVar(&opts.title, "title", "", "Document title (default: the database name)")
+
+	return cmd
+}
+
+func runDocs(cmd *cobra.Command, opts docsOptions) error {
+	var write func(io.Writer, string, []schema.Schema) error
+	switch opts.format {
+	case "markdown", "md":
+		write = export.Markdown
+	case "html":
+		write = export.HTML
+	default:
+		return fmt.Errorf("invalid format %q (want markdown or html)", opts.format)
+	}
+
+	requiredFields := []string{"schema_file_path"}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		declared, err := migration.ReadDeclaredSchema(config.settings, config.SchemaFilePath)
+		if err != nil {
+			return fmt.Errorf("reading declared schema: %w", err)
+		}
+
+		title := opts.title
+		switch {
+		case title != "":
+		case config.DatabaseName != "":
+			title = config.DatabaseName + " schema"
+		default:
+			title = "Schema"
+		}
+
+		var buf bytes.Buffer
+		if err := write(&buf, title, declared); err != nil {
+			return fmt.Errorf("rendering documentation: %w", err)
+		}
+
+		return writeResult(cmd, logger, config, opts.out, buf.Bytes())
+	})
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/ltman/mondex/export"
+	"github.com/ltman/mondex/schema"
+	"github.com/spf13/cobra"
+)
+
+// exportOptions are the command-specific options of export.
+type exportOptions struct {
+	format string
+	source string
+	out    string
+}
+
+func newExportCmd() *cobra.Command {
+	var opts exportOptions
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the schema for use outside mondex",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runExport(cmd, opts)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	addReadFlags(cmd.Flags())
+	addSchemaFlags(cmd.Flags())
+	cmd.Flags().StringVar(&opts.format, "format", "csv", "Export format: csv or terraform")
+	cmd.Flags().StringVar(&opts.source, "source", "", "What to export: file or db (default: db when configured)")
+	cmd.Flags().StringVar(&opts.out, "out", "", "Write the export to this file instead of stdout")
+
+	return cmd
+}
+
+func runExport(cmd *cobra.Command, opts exportOptions) error {
+	var write func(io.Writer, string, []schema.Schema) error
+	switch opts.format {
+	case "csv":
+		write = export.CSV
+	case "terraform", "tf":
+		write = export.Terraform
+	default:
+		return fmt.Errorf("invalid format %q (want csv or terraform)", opts.format)
+	}
+
+	source, requiredFields, err := resolveSource(cmd, opts.source, false)
+	if err != nil {
+		return err
+	}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		declared, current, err := loadSource(ctx, logger, config, source)
+		if err != nil {
+			return err
+		}
+
+		schemas := declared
+		if source == sourceDB {
+			schemas = current
+		}
+
+		var buf bytes.Buffer
+		if err := write(&buf, config.DatabaseName, schemas); err != nil {
+			return fmt.Errorf("exporting schema: %w", err)
+		}
+
+		return writeResult(cmd, logger, config, opts.out, buf.Bytes())
+	})
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Flags named after a config key override that key. They are declared per
+// command, and only the executing command's flags are bound to viper, so an
+// option registered by one command never leaks into another.
+
+func addConnectionFlags(flags *pflag.FlagSet) {
+	flags.String("mongo_uri", "", "MongoDB connection URI")
+	flags.String("database_name", "", "Name of the database")
+	flags.Duration("connect_timeout", 0, "How long to wait for a server to answer when connecting (default 10s)")
+}
+
+func addReadFlags(flags *pflag.FlagSet) {
+	flags.String("read_preference", "", "Read preference used when reading the current schema (e.g. secondaryPreferred)")
+	flags.String("read_concern", "", "Read concern level used when reading the current schema (e.g. majority)")
+	flags.Int("read_concurrency", 0, "How many collections are read at a time when reading the current schema (default 1)")
+	flags.Bool("search_indexes", false, "Also read and diff Atlas Search indexes, which the deployment must support")
+}
+
+func addSchemaFlags(flags *pflag.FlagSet) {
+	flags.String("schema_file_path", "", "Path to the schema file")
+}
+
+func addAccessFlags(flags *pflag.FlagSet) {
+	flags.String("access_file_path", "", "Path to the file declaring the users and roles to manage, if any")
+}
+
+func addMigrationFlags(flags *pflag.FlagSet) {
+	flags.String("migration_dir", "", "Directory for migration files")
+}
+
+func addStateFlags(flags *pflag.FlagSet) {
+	flags.String("state_file_path", "", "File recording the schema as of the last generated migration")
+}
+
+func addDiffFlags(flags *pflag.FlagSet) {
+	flags.Bool("managed_collections_only", false, "Ignore collections that aren't declared instead of dropping their indexes")
+	flags.Bool("drop_removed_collections", false, "Drop collections removed from the schema file, documents included")
+	flags.Bool("blue_green", false, "Replace modified indexes side by side in two migrations instead of dropping and recreating them")
+}
+
+func addApplyFlags(flags *pflag.FlagSet) {
+	flags.Bool("wait_for_secondaries", false, "Wait until created indexes exist on every replica set member")
+	flags.Bool("remote_state", false, "Record the schema the applied migrations produce in the mondex_state collection")
+}
+
+// bindConfigFlags binds the flags of the executing command that override config keys.
+func bindConfigFlags(flags *pflag.FlagSet) error {
+	for _, key := range configKeys() {
+		if flag := flags.Lookup(key); flag != nil {
+			if err := viper.BindPFlag(key, flag); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ltman/mondex/migration"
+	"github.com/spf13/cobra"
+)
+
+// historyOptions are the command-specific options of history.
+type historyOptions struct {
+	json bool
+}
+
+func newHistoryCmd() *cobra.Command {
+	var opts historyOptions
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "List the migrations applied to the database",
+		Long: `List every migration run recorded by apply, oldest first, with when and by whom
+it was applied, how long it took and whether it failed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runHistory(cmd, opts)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print the history as JSON, including per-command durations")
+
+	return cmd
+}
+
+func runHistory(cmd *cobra.Command, opts historyOptions) error {
+	opts.json = opts.json || configOf(cmd).output.json()
+
+	requiredFields := []string{"mongo_uri", "database_name"}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		runs, err := migration.ReadHistory(ctx, logger, config.settings, config.MongoURI, config.DatabaseName)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if opts.json {
+			data, err := json.MarshalIndent(runs, "", "  ")
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(out, "%s\n", data)
+			return err
+		}
+
+		if len(runs) == 0 {
+			fmt.Fprintln(out, "No migrations applied yet")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT\tDURATION\tAPPLIED BY\tSTATUS")
+		for _, run := range runs {
+			status := "ok"
+			switch {
+			case run.Down && run.Error != "":
+				status = "rollback failed"
+			case run.Down:
+				status = "rolled back"
+			case run.Error != "":
+				status = "failed"
+			}
+			fmt.Fprintf(w, "%06d\t%s\t%s\t%s\t%s\t%s\n",
+				run.Version,
+				run.Name,
+				run.StartedAt.Local().Format(time.DateTime),
+				time.Duration(run.DurationMS)*time.Millisecond,
+				run.AppliedBy,
+				status,
+			)
+		}
+		return w.Flush()
+	})
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/ltman/mondex/importer"
+	"github.com/ltman/mondex/migration"
+	"github.com/spf13/cobra"
+)
+
+// importOptions are the command-specific options of the import subcommands.
+type importOptions struct {
+	dryRun   bool
+	baseline bool
+}
+
+func newImportCmd() *cobra.Command {
+	var opts importOptions
+
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import index declarations from other tools into the schema file",
+	}
+
+	addSchemaFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().BoolVar(&opts.dryRun, "dry_run", false, "Show the merged schema without writing the file")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "prisma <schema.prisma>",
+		Short: "Import @@index, @@unique and @@fulltext declarations of Prisma models",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImportPrisma(cmd, args[0], opts)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "go <dir>...",
+		Short: "Import indexes declared with mondexIndex tags on structs marked //mondex:collection",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImportGo(cmd, args, opts)
+		},
+	})
+
+	adoptCmd := &cobra.Command{
+		Use:   "golang-migrate <dir>",
+		Short: "Replay an existing golang-migrate JSON migration directory into the schema file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImportGolangMigrate(cmd, args[0], opts)
+		},
+	}
+	addMigrationFlags(adoptCmd.Flags())
+	adoptCmd.Flags().BoolVar(&opts.baseline, "baseline", false,
+		"Write an empty migration with the last replayed version to migration_dir")
+	cmd.AddCommand(adoptCmd)
+
+	return cmd
+}
+
+func runImportGolangMigrate(cmd *cobra.Command, dir string, opts importOptions) error {
+	requiredFields := []string{"schema_file_path"}
+	if opts.baseline {
+		requiredFields = append(requiredFields, "migration_dir")
+	}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		imported, baseline, err := migration.ReplayMigrations(logger, config.settings, dir)
+		if err != nil {
+			return err
+		}
+		logger.Info("Replayed migrations", "collections", len(imported), "baselineVersion", baseline)
+
+		if err := migration.MergeIntoSchemaFile(ctx, logger, config.settings, config.SchemaFilePath, imported, opts.dryRun); err != nil {
+			return err
+		}
+
+		if !opts.baseline || opts.dryRun {
+			return nil
+		}
+		if baseline == 0 {
+			return fmt.Errorf("no migrations found in %s", dir)
+		}
+		return migration.WriteBaselineMigration(logger, config.settings, config.MigrationDir, baseline)
+	})
+}
+
+func runImportGo(cmd *cobra.Command, dirs []string, opts importOptions) error {
+	requiredFields := []string{"schema_file_path"}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		imported, err := importer.GoStructs(dirs)
+		if err != nil {
+			return fmt.Errorf("scanning Go packages: %w", err)
+		}
+		logger.Debug("Scanned Go packages", "collections", len(imported))
+
+		return migration.MergeIntoSchemaFile(ctx, logger, config.settings, config.SchemaFilePath, imported, opts.dryRun)
+	})
+}
+
+func runImportPrisma(cmd *cobra.Command, path string, opts importOptions) error {
+	requiredFields := []string{"schema_file_path"}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		imported, err := importer.Prisma(f)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", path, err)
+		}
+		logger.Debug("Parsed Prisma schema", "collections", len(imported))
+
+		return migration.MergeIntoSchemaFile(ctx, logger, config.settings, config.SchemaFilePath, imported, opts.dryRun)
+	})
+}
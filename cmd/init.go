@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ltman/mondex/atomicfile"
+	"github.com/ltman/mondex/migration"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultConfigFile     = "mondex.yml"
+	defaultSchemaFilePath = "schema.json"
+	defaultMigrationDir   = "migrations"
+	defaultMongoURI       = "mongodb://localhost:27017"
+)
+
+// initOptions are the command-specific options of init.
+type initOptions struct {
+	force bool
+	seed  bool
+}
+
+func newInitCmd() *cobra.Command {
+	var opts initOptions
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Scaffold a mondex.yml, an empty schema file and the migration directory",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runInit(cmd, opts)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	addReadFlags(cmd.Flags())
+	addSchemaFlags(cmd.Flags())
+	addMigrationFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.force, "force", false, "Overwrite an existing config file, and schema file with --seed")
+	cmd.Flags().BoolVar(&opts.seed, "seed", false, "Seed the schema file by inspecting mongo_uri/database_name")
+
+	return cmd
+}
+
+func runInit(cmd *cobra.Command, opts initOptions) error {
+	configPath := defaultConfigFile
+	if path, _ := cmd.Flags().GetString("config"); path != "" {
+		configPath = path
+	}
+
+	if _, err := os.Stat(configPath); err == nil && !opts.force {
+		return fmt.Errorf("config file already exists: %s (use --force to overwrite)", configPath)
+	}
+
+	project := configOf(cmd)
+	project.MongoURI = cmp.Or(project.MongoURI, defaultMongoURI)
+	project.SchemaFilePath = cmp.Or(project.SchemaFilePath, defaultSchemaFilePath)
+	project.MigrationDir = cmp.Or(project.MigrationDir, defaultMigrationDir)
+	project.LogLevel = cmp.Or(project.LogLevel, "info")
+
+	if opts.seed {
+		if err := validateConfig(cmd, []string{"mongo_uri", "database_name"}); err != nil {
+			return fmt.Errorf("seeding requires a database: %w", err)
+		}
+		// Seeding replaces the schema file, which may hold declarations
+		// the database doesn't have yet.
+		if _, err := os.Stat(project.SchemaFilePath); err == nil && !opts.force {
+			return fmt.Errorf("schema file already exists: %s (use --force to overwrite)", project.SchemaFilePath)
+		}
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		logger.Info("Writing config file", "path", configPath)
+		if err := config.settings.FilePermissions.WriteAll([]atomicfile.File{{Path: configPath, Data: renderConfig(project), Private: true}}); err != nil {
+			return fmt.Errorf("writing config file: %w", err)
+		}
+
+		logger.Info("Creating migration directory", "path", project.MigrationDir)
+		if err := os.MkdirAll(project.MigrationDir, os.ModePerm); err != nil {
+			return fmt.Errorf("creating migration directory: %w", err)
+		}
+
+		if opts.seed {
+			return migration.InspectCurrentSchema(
+				ctx,
+				logger,
+				config.settings,
+				config.MongoURI,
+				config.DatabaseName,
+				config.readOptions(),
+				project.SchemaFilePath,
+				false,
+				false,
+			)
+		}
+
+		if _, err := os.Stat(project.SchemaFilePath); err == nil {
+			logger.Info("Keeping existing schema file", "path", project.SchemaFilePath)
+			return nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("checking schema file: %w", err)
+		}
+
+		logger.Info("Writing empty schema file", "path", project.SchemaFilePath)
+		if err := config.settings.FilePermissions.Write(project.SchemaFilePath, []byte("[]\n")); err != nil {
+			return fmt.Errorf("writing schema file: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// renderConfig renders a starter config file for the given project settings.
+func renderConfig(project Config) []byte {
+	var b strings.Builder
+	for _, entry := range []struct{ key, value string }{
+		{"mongo_uri", project.MongoURI},
+		{"database_name", project.DatabaseName},
+		{"schema_file_path", project.SchemaFilePath},
+		{"migration_dir", project.MigrationDir},
+		{"log_level", project.LogLevel},
+	} {
+		fmt.Fprintf(&b, "%s: %s\n", entry.key, strconv.Quote(entry.value))
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ltman/mondex/migration"
+)
+
+// lintExitDestructive is the exit code of lint when migrations are
+// destructive.
+const lintExitDestructive = 2
+
+// lintOptions are the command-specific options of lint.
+type lintOptions struct {
+	since uint64
+	json  bool
+}
+
+func newLintCmd() *cobra.Command {
+	var opts lintOptions
+
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Report destructive operations of the migrations",
+		Long: `List the operations of the up migrations that drop indexes, collections or
+privileges, which diff and apply refuse without --allow-destructive, so they
+can be reviewed in CI. Nothing is run.
+
+lint exits with 2 when a migration is destructive, with 1 when it couldn't
+read them, and with 0 otherwise.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runLint(cmd, opts)
+		},
+	}
+
+	addMigrationFlags(cmd.Flags())
+	cmd.Flags().Uint64Var(&opts.since, "since", 0, "Only lint the migrations newer than this version")
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print the destructive operations as JSON")
+
+	return cmd
+}
+
+func runLint(cmd *cobra.Command, opts lintOptions) error {
+	opts.json = opts.json || configOf(cmd).output.json()
+
+	requiredFields := []string{"migration_dir"}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(_ context.Context, _ *slog.Logger, config Config) error {
+		destructive, err := migration.LintMigrations(config.MigrationDir, opts.since)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		switch {
+		case opts.json:
+			if destructive == nil {
+				destructive = []migration.DestructiveChange{}
+			}
+			if err := printJSON(out, destructive); err != nil {
+				return err
+			}
+		case len(destructive) == 0:
+			fmt.Fprintln(out, "No destructive operation found")
+		default:
+			fmt.Fprintf(out, "%d destructive operation(s):\n", len(destructive))
+			for _, d := range destructive {
+				fmt.Fprintf(out, "  %s\n", d)
+			}
+		}
+
+		if len(destructive) == 0 {
+			return nil
+		}
+		// The operations are reported above; usage would bury them.
+		cmd.SilenceUsage = true
+		return &exitError{code: lintExitDestructive, err: fmt.Errorf("migrations are destructive")}
+	})
+}
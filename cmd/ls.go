@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/ltman/mondex/migration"
+	"github.com/ltman/mondex/schema"
+	"github.com/spf13/cobra"
+)
+
+// lsOptions are the command-specific options of ls.
+type lsOptions struct {
+	source      string
+	sort        string
+	collections []string
+	unique      bool
+	ttl         bool
+}
+
+// indexRow is one line of the ls table.
+type indexRow struct {
+	collection string
+	index      schema.Index
+	size       int64
+	hasSize    bool
+}
+
+func newLsCmd() *cobra.Command {
+	var opts lsOptions
+
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List collections and indexes as a table",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runLs(cmd, opts)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	addReadFlags(cmd.Flags())
+	addSchemaFlags(cmd.Flags())
+	cmd.Flags().StringVar(&opts.source, "source", "", "What to list: file or db (default: db when configured)")
+	cmd.Flags().StringVar(&opts.sort, "sort", "collection", "Sort rows by collection, name, size or ttl")
+	cmd.Flags().StringSliceVar(&opts.collections, "collection", nil, "Only list these collections")
+	_ = cmd.RegisterFlagCompletionFunc("collection", completeCollections)
+	cmd.Flags().BoolVar(&opts.unique, "unique", false, "Only list unique indexes")
+	cmd.Flags().BoolVar(&opts.ttl, "ttl", false, "Only list TTL indexes")
+
+	return cmd
+}
+
+func runLs(cmd *cobra.Command, opts lsOptions) error {
+	source, requiredFields, err := resolveSource(cmd, opts.source, false)
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains([]string{"collection", "name", "size", "ttl"}, opts.sort) {
+		return fmt.Errorf("invalid sort %q (want collection, name, size or ttl)", opts.sort)
+	}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		declared, current, err := loadSource(ctx, logger, config, source)
+		if err != nil {
+			return err
+		}
+
+		schemas := declared
+		if source == sourceDB {
+			schemas = current
+		}
+
+		var rows []indexRow
+		var collections []string
+		for _, s := range schemas {
+			if len(opts.collections) > 0 && !slices.Contains(opts.collections, s.Collection) {
+				continue
+			}
+			collections = append(collections, s.Collection)
+			for _, index := range s.Indexes {
+				if opts.unique && !index.Unique || opts.ttl && index.ExpireAfterSeconds == nil {
+					continue
+				}
+				rows = append(rows, indexRow{collection: s.Collection, index: index})
+			}
+		}
+
+		if source == sourceDB {
+			sizes, err := migration.ReadIndexSizes(ctx, logger, config.settings, config.MongoURI, config.DatabaseName, config.readOptions(), collections)
+			if err != nil {
+				return err
+			}
+			for i, row := range rows {
+				rows[i].size, rows[i].hasSize = sizes[row.collection][row.index.Name]
+			}
+		}
+
+		sortIndexRows(rows, opts.sort)
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "COLLECTION\tINDEX\tKEYS\tUNIQUE\tTTL\tSIZE")
+		for _, row := range rows {
+			ttl, size := "-", "-"
+			if row.index.ExpireAfterSeconds != nil {
+				ttl = strconv.Itoa(int(*row.index.ExpireAfterSeconds)) + "s"
+			}
+			if row.hasSize {
+				size = formatBytes(row.size)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%s\n",
+				row.collection, row.index.Name, row.index.KeySpec(), row.index.Unique, ttl, size)
+		}
+		return w.Flush()
+	})
+}
+
+func sortIndexRows(rows []indexRow, by string) {
+	slices.SortStableFunc(rows, func(a, b indexRow) int {
+		switch by {
+		case "name":
+			return cmp.Compare(a.index.Name, b.index.Name)
+		case "size":
+			return cmp.Compare(b.size, a.size)
+		case "ttl":
+			return cmp.Compare(ttlSeconds(a.index), ttlSeconds(b.index))
+		default:
+			return cmp.Or(cmp.Compare(a.collection, b.collection), cmp.Compare(a.index.Name, b.index.Name))
+		}
+	})
+}
+
+func ttlSeconds(index schema.Index) int64 {
+	if index.ExpireAfterSeconds == nil {
+		return -1
+	}
+	return int64(*index.ExpireAfterSeconds)
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. 1.5 MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ltman/mondex/migration"
+	"github.com/ltman/mondex/schema"
+	"github.com/spf13/cobra"
+)
+
+// mergeOptions are the command-specific options of merge.
+type mergeOptions struct {
+	dryRun         bool
+	useRemoteState bool
+	resolve        string
+}
+
+// resolutions maps the --resolve values and interactive answers to resolutions.
+var resolutions = map[string]migration.Resolution{
+	"adopt":  migration.ResolveAdopt,
+	"revert": migration.ResolveRevert,
+	"defer":  migration.ResolveDefer,
+}
+
+func newMergeCmd() *cobra.Command {
+	var opts mergeOptions
+
+	cmd := &cobra.Command{
+		Use:   "merge [migration_name]",
+		Short: "Resolve drift of the live database with a three-way merge",
+		Long: `Compare the base state recorded by the last migration, the live database and the
+declared schema, and show every index they disagree on. Indexes the live database
+drifted on since the base state can be adopted into the schema file, reverted by
+the migration, or deferred to a later migration. On a terminal, each one is
+resolved interactively; otherwise --resolve applies to all of them.
+
+The base state is the state file, or with --use-remote-state the mondex_state
+collection written by apply.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMerge(cmd, args, opts)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	addReadFlags(cmd.Flags())
+	addSchemaFlags(cmd.Flags())
+	addMigrationFlags(cmd.Flags())
+	addStateFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.dryRun, "dry_run", false, "Show the resolution without writing files")
+	cmd.Flags().BoolVar(&opts.useRemoteState, "use-remote-state", false,
+		"Use the schema recorded by apply in the mondex_state collection as the base state")
+	cmd.Flags().StringVar(&opts.resolve, "resolve", "",
+		"Resolve all drift without prompting: adopt, revert or defer")
+
+	return cmd
+}
+
+func runMerge(cmd *cobra.Command, args []string, opts mergeOptions) error {
+	requiredFields := []string{"mongo_uri", "database_name", "schema_file_path"}
+	if !opts.useRemoteState {
+		requiredFields = append(requiredFields, "state_file_path")
+	}
+	if !opts.dryRun {
+		requiredFields = append(requiredFields, "migration_dir")
+	}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	var migrationName string
+	if len(args) > 0 {
+		migrationName = args[0]
+	}
+
+	resolution, ok := resolutions[opts.resolve]
+	if opts.resolve != "" && !ok {
+		return fmt.Errorf("invalid resolution %q, want adopt, revert or defer", opts.resolve)
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		source, statePath := migration.SourceStateFile, config.StateFilePath
+		if opts.useRemoteState {
+			source, statePath = migration.SourceRemoteState, ""
+		}
+
+		merge, err := migration.ReadMerge(
+			ctx,
+			logger,
+			config.settings,
+			config.MongoURI,
+			config.DatabaseName,
+			config.readOptions(),
+			config.SchemaFilePath,
+			config.StateFilePath,
+			source,
+		)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if len(merge.Entries) == 0 {
+			fmt.Fprintln(out, "Base state, live database and schema file agree")
+			return nil
+		}
+		if err := printMerge(out, merge.Entries); err != nil {
+			return err
+		}
+
+		drifted := merge.Drifted()
+		switch {
+		case len(drifted) == 0:
+		case opts.resolve != "":
+			for _, e := range drifted {
+				e.Resolution = resolution
+			}
+		case isTerminal(os.Stdin):
+			in := bufio.NewReader(cmd.InOrStdin())
+			for _, e := range drifted {
+				e.Resolution = askResolution(out, in, e)
+			}
+		default:
+			return fmt.Errorf("%d drifted index(es) need a resolution, use --resolve", len(drifted))
+		}
+
+		if !opts.dryRun && migrationName == "" {
+			return fmt.Errorf("missing required fields: migration_name")
+		}
+
+		return merge.Resolve(ctx, logger, config.SchemaFilePath, config.MigrationDir, migrationName, statePath, opts.dryRun)
+	})
+}
+
+// printMerge shows the three sides of every index they disagree on.
+func printMerge(out io.Writer, entries []migration.MergeEntry) error {
+	describe := func(index *schema.Index) string {
+		if index == nil {
+			return "-"
+		}
+		return strings.Join(append([]string{index.KeySpec()}, index.Flags()...), " ")
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COLLECTION\tINDEX\tBASE\tLIVE\tDECLARED\tSTATUS")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Collection, e.Name, describe(e.Base), describe(e.Live), describe(e.Declared), e.Status())
+	}
+	return w.Flush()
+}
+
+// askResolution asks how to resolve the drift of one index, deferring when no
+// answer can be read.
+func askResolution(out io.Writer, in *bufio.Reader, e *migration.MergeEntry) migration.Resolution {
+	fmt.Fprintf(out, "%s.%s (%s)\n", e.Collection, e.Name, e.Status())
+	fmt.Fprintln(out, "  [a]dopt: copy the live index into the schema file")
+	fmt.Fprintln(out, "  [r]evert: generate a migration undoing the drift")
+	fmt.Fprintln(out, "  [d]efer: leave the index out of this migration")
+
+	for {
+		fmt.Fprint(out, "Action (a/r/d)? ")
+		answer, err := in.ReadString('\n')
+		if err != nil && answer == "" {
+			return migration.ResolveDefer
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "a":
+			return migration.ResolveAdopt
+		case "r":
+			return migration.ResolveRevert
+		case "d", "":
+			return migration.ResolveDefer
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// outputOptions control how much mondex prints and whether it uses color.
+type outputOptions struct {
+	quiet     bool
+	verbosity int
+	noColor   bool
+	// format is outputText for people or outputJSON for tools wrapping
+	// mondex, logs going to stderr either way.
+	format string
+}
+
+func addOutputFlags(flags *pflag.FlagSet) {
+	flags.BoolP("quiet", "q", false, "Only print errors and the command's result")
+	flags.CountP("verbose", "v", "Increase log verbosity (-v for debug, -vv to include source locations)")
+	flags.Bool("no-color", false, "Disable colored output (also honors NO_COLOR)")
+	flags.String("output", outputText,
+		"Print results as text or as json, e.g. the report of diff or the schema inspect reads")
+}
+
+// outputOptionsOf returns the output options the flags set, failing on an
+// unknown output format.
+func outputOptionsOf(flags *pflag.FlagSet) (outputOptions, error) {
+	var o outputOptions
+	var err error
+	if o.quiet, err = flags.GetBool("quiet"); err != nil {
+		return outputOptions{}, err
+	}
+	if o.verbosity, err = flags.GetCount("verbose"); err != nil {
+		return outputOptions{}, err
+	}
+	if o.noColor, err = flags.GetBool("no-color"); err != nil {
+		return outputOptions{}, err
+	}
+	if o.format, err = flags.GetString("output"); err != nil {
+		return outputOptions{}, err
+	}
+	if o.format != outputText && o.format != outputJSON {
+		return outputOptions{}, fmt.Errorf("invalid output %q (want %s or %s)", o.format, outputText, outputJSON)
+	}
+	return o, nil
+}
+
+// json reports whether results are printed as JSON.
+func (o outputOptions) json() bool {
+	return o.format == outputJSON
+}
+
+// logLevel returns the log level to use, letting -q and -v override the configured level.
+func (o outputOptions) logLevel(configured string) string {
+	switch {
+	case o.quiet:
+		return "error"
+	case o.verbosity > 0:
+		return "debug"
+	default:
+		return configured
+	}
+}
+
+// logSource reports whether log records should include source locations.
+func (o outputOptions) logSource() bool {
+	return o.verbosity > 1
+}
+
+// colorEnabled reports whether colored output may be written to f:
+// never with --no-color or NO_COLOR set, and only when f is a terminal.
+func (o outputOptions) colorEnabled(f *os.File) bool {
+	if o.noColor {
+		return false
+	}
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return isTerminal(f)
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// writeResult writes a generated artifact to path, with the file permissions
+// of the config, or to stdout when path is empty.
+func writeResult(cmd *cobra.Command, logger *slog.Logger, config Config, path string, data []byte) error {
+	if path == "" {
+		_, err := cmd.OutOrStdout().Write(data)
+		return err
+	}
+
+	logger.Info("Writing output to file", "path", path)
+	if err := config.settings.FilePermissions.Write(path, data); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ltman/mondex/migration"
+	"github.com/ltman/mondex/schema"
+	"github.com/spf13/cobra"
+)
+
+// unowned labels collections declared without an owner in the ownership report.
+const unowned = "(unowned)"
+
+func newOwnersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "owners",
+		Short: "Report which team owns each declared collection",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runOwners(cmd)
+		},
+	}
+
+	addSchemaFlags(cmd.Flags())
+
+	return cmd
+}
+
+func runOwners(cmd *cobra.Command) error {
+	requiredFields := []string{"schema_file_path"}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, _ *slog.Logger, config Config) error {
+		declared, err := migration.ReadDeclaredSchema(config.settings, config.SchemaFilePath)
+		if err != nil {
+			return fmt.Errorf("reading declared schema: %w", err)
+		}
+
+		byOwner := make(map[string][]schema.Schema)
+		for _, s := range declared {
+			owner := cmp.Or(s.Owner, unowned)
+			byOwner[owner] = append(byOwner[owner], s)
+		}
+
+		owners := make([]string, 0, len(byOwner))
+		for owner := range byOwner {
+			owners = append(owners, owner)
+		}
+		slices.SortFunc(owners, func(a, b string) int {
+			// Keep unowned collections last, where they stand out.
+			switch {
+			case a == unowned:
+				return 1
+			case b == unowned:
+				return -1
+			}
+			return cmp.Compare(a, b)
+		})
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "OWNER\tCOLLECTIONS\tINDEXES\tNAMES")
+		for _, owner := range owners {
+			var indexes int
+			names := make([]string, 0, len(byOwner[owner]))
+			for _, s := range byOwner[owner] {
+				indexes += len(s.Indexes)
+				names = append(names, s.Collection)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", owner, len(names), indexes, strings.Join(names, ", "))
+		}
+		return w.Flush()
+	})
+}
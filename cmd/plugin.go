@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ltman/mondex/migration"
+	"github.com/ltman/mondex/schema"
+	"github.com/spf13/cobra"
+)
+
+// pluginPrefix names the executables on PATH that provide subcommands,
+// e.g. mondex-lint provides "mondex lint".
+const pluginPrefix = "mondex-"
+
+// pluginInput is written as JSON to the stdin of a plugin.
+type pluginInput struct {
+	Args   []string        `json:"args"`
+	Config map[string]any  `json:"config"`
+	Schema []schema.Schema `json:"schema"`
+}
+
+// addPluginCmds registers a subcommand for every plugin found on PATH whose
+// name doesn't clash with a built-in command.
+func addPluginCmds(root *cobra.Command) {
+	for name, path := range findPlugins() {
+		if cmd, _, err := root.Find([]string{name}); err == nil && cmd != root {
+			continue
+		}
+		root.AddCommand(newPluginCmd(name, path))
+	}
+}
+
+// findPlugins maps plugin names to executables, preferring earlier PATH entries.
+func findPlugins() map[string]string {
+	plugins := make(map[string]string)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutPrefix(entry.Name(), pluginPrefix)
+			if !ok || name == "" || entry.IsDir() {
+				continue
+			}
+			name = strings.TrimSuffix(name, filepath.Ext(name))
+			if _, seen := plugins[name]; seen {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if info, err := os.Stat(path); err != nil || info.Mode()&0111 == 0 {
+				continue
+			}
+			plugins[name] = path
+		}
+	}
+	return plugins
+}
+
+func newPluginCmd(name, path string) *cobra.Command {
+	return &cobra.Command{
+		Use:                name,
+		Short:              "Plugin provided by " + path,
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPlugin(cmd, path, args)
+		},
+	}
+}
+
+func runPlugin(cmd *cobra.Command, path string, args []string) error {
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		input := pluginInput{
+			Args:   args,
+			Config: configMap(reflect.ValueOf(config)),
+			Schema: []schema.Schema{},
+		}
+
+		if config.SchemaFilePath != "" {
+			declared, err := migration.ReadDeclaredSchema(config.settings, config.SchemaFilePath)
+			switch {
+			case err == nil:
+				input.Schema = declared
+			case !errors.Is(err, fs.ErrNotExist):
+				return fmt.Errorf("reading declared schema: %w", err)
+			}
+		}
+
+		stdin, err := json.Marshal(input)
+		if err != nil {
+			return fmt.Errorf("encoding plugin input: %w", err)
+		}
+
+		logger.Debug("Running plugin", "path", path, "args", args)
+		plugin := exec.CommandContext(ctx, path, args...) //nolint:gosec // plugins are executables the user installed on PATH
+		plugin.Stdin = strings.NewReader(string(stdin))
+		plugin.Stdout = cmd.OutOrStdout()
+		plugin.Stderr = cmd.ErrOrStderr()
+		plugin.Env = append(os.Environ(), "MONDEX_PLUGIN_NAME="+cmd.Name())
+
+		if err := plugin.Run(); err != nil {
+			return fmt.Errorf("plugin %s: %w", cmd.Name(), err)
+		}
+		return nil
+	})
+}
+
+// configMap converts the config to a map keyed by config key names, with
+// nested sections as nested maps and durations in their string form.
+func configMap(v reflect.Value) map[string]any {
+	m := make(map[string]any)
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		value := v.Field(i)
+		switch {
+		case field.Type == reflect.TypeOf(time.Duration(0)):
+			m[tag] = time.Duration(value.Int()).String()
+		case field.Type == reflect.TypeOf(time.Time{}):
+			if t := value.Interface().(time.Time); !t.IsZero() {
+				m[tag] = t.Format(time.DateOnly)
+			}
+		case field.Type.Kind() == reflect.Struct:
+			m[tag] = configMap(value)
+		case field.Type.Kind() == reflect.Map && field.Type.Elem().Kind() == reflect.Struct:
+			entries := make(map[string]any, value.Len())
+			for iter := value.MapRange(); iter.Next(); {
+				entries[iter.Key().String()] = configMap(iter.Value())
+			}
+			m[tag] = entries
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+			entries := make([]any, 0, value.Len())
+			for j := range value.Len() {
+				entries = append(entries, configMap(value.Index(j)))
+			}
+			m[tag] = entries
+		default:
+			m[tag] = value.Interface()
+		}
+	}
+	return m
+}
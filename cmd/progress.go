@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/migration"
+)
+
+const (
+	progressAuto   = "auto"
+	progressAlways = "always"
+	progressNever  = "never"
+
+	progressBarWidth = 30
+
+	ansiGreen = "\x1b[32m"
+	ansiRed   = "\x1b[31m"
+	ansiDim   = "\x1b[2m"
+	ansiReset = "\x1b[0m"
+)
+
+// newProgressReporter returns a terminal progress display for the given mode
+// and output options, or nil when apply should fall back to plain logs.
+func newProgressReporter(mode string, output outputOptions) (migration.ProgressReporter, error) {
+	switch mode {
+	case progressNever:
+		return nil, nil
+	case progressAuto:
+		if output.quiet || !isTerminal(os.Stdout) {
+			return nil, nil
+		}
+	case progressAlways:
+	default:
+		return nil, fmt.Errorf("invalid progress mode %q (want %s, %s or %s)", mode, progressAuto, progressAlways, progressNever)
+	}
+
+	return &terminalProgress{out: os.Stdout, color: output.colorEnabled(os.Stdout)}, nil
+}
+
+// terminalProgress renders apply progress as a live region redrawn in place:
+// finished migrations and commands scroll up as permanent lines, while the
+// running command and its index builds are drawn with progress bars.
+type terminalProgress struct {
+	out   io.Writer
+	color bool
+
+	// drawn is the number of lines of the live region currently on screen.
+	drawn int
+
+	migration        string
+	migrationStarted time.Time
+	command          string
+	commandStarted   time.Time
+	builds           []db.IndexBuild
+}
+
+func (p *terminalProgress) MigrationStarted(version uint64, name string) {
+	p.migration = fmt.Sprintf("%06d_%s", version, name)
+	p.migrationStarted = time.Now()
+	p.redraw()
+}
+
+func (p *terminalProgress) CommandStarted(command, collection string, indexes []string) {
+	p.command = command + " " + collection
+	if len(indexes) > 0 {
+		p.command += " (" + strings.Join(indexes, ", ") + ")"
+	}
+	p.commandStarted = time.Now()
+	p.builds = nil
+	p.redraw()
+}
+
+func (p *terminalProgress) IndexBuildsProgressed(builds []db.IndexBuild) {
+	p.builds = builds
+	p.redraw()
+}
+
+func (p *terminalProgress) CommandFinished(err error) {
+	p.clear()
+	p.println(fmt.Sprintf("  %s %s %s", p.status(err), p.command, p.dim(elapsed(p.commandStarted))))
+	p.command = ""
+	p.builds = nil
+	p.redraw()
+}
+
+func (p *terminalProgress) MigrationFinished(err error) {
+	p.clear()
+	p.println(fmt.Sprintf("%s %s %s", p.status(err), p.migration, p.dim(elapsed(p.migrationStarted))))
+	p.migration = ""
+}
+
+// redraw replaces the live region with the current state.
+func (p *terminalProgress) redraw() {
+	p.clear()
+
+	var lines []string
+	if p.migration != "" {
+		lines = append(lines, fmt.Sprintf("… %s %s", p.migration, p.dim(elapsed(p.migrationStarted))))
+	}
+	if p.command != "" {
+		lines = append(lines, fmt.Sprintf("  … %s %s", p.command, p.dim(elapsed(p.commandStarted))))
+	}
+	for _, build := range p.builds {
+		lines = append(lines, "      "+progressLine(build))
+	}
+
+	for _, line := range lines {
+		p.println(line)
+	}
+	p.drawn = len(lines)
+}
+
+// clear erases the live region.
+func (p *terminalProgress) clear() {
+	for ; p.drawn > 0; p.drawn-- {
+		fmt.Fprint(p.out, "\x1b[1A\x1b[2K")
+	}
+}
+
+func (p *terminalProgress) println(line string) {
+	fmt.Fprintln(p.out, line)
+}
+
+func (p *terminalProgress) status(err error) string {
+	if err != nil {
+		return p.paint(ansiRed, "✗")
+	}
+	return p.paint(ansiGreen, "✓")
+}
+
+func (p *terminalProgress) dim(s string) string {
+	return p.paint(ansiDim, s)
+}
+
+func (p *terminalProgress) paint(code, s string) string {
+	if !p.color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// progressLine renders one index build as a progress bar with an ETA.
+func progressLine(build db.IndexBuild) string {
+	phase := build.Phase
+	if phase == "" {
+		phase = "building"
+	}
+
+	percent := build.Percent()
+	if percent < 0 {
+		return fmt.Sprintf("%s: %s", strings.Join(build.Indexes, ", "), phase)
+	}
+
+	filled := min(int(percent/100*progressBarWidth), progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+
+	line := fmt.Sprintf("%s [%s] %5.1f%% %d/%d", phase, bar, percent, build.Done, build.Total)
+	if eta := build.ETA(); eta > 0 {
+		line += " ETA " + eta.Round(time.Second).String()
+	}
+	return line
+}
+
+func elapsed(since time.Time) string {
+	return time.Since(since).Round(100 * time.Millisecond).String()
+}
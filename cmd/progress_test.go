@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ltman/mondex/db"
+)
+
+func TestProgressLine(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		build db.IndexBuild
+		want  string
+	}{
+		{
+			name:  "unknown percent",
+			build: db.IndexBuild{Indexes: []string{"a_1", "b_1"}},
+			want:  "a_1, b_1: building",
+		},
+		{
+			name:  "0%",
+			build: db.IndexBuild{Phase: "collection scan", Total: 200},
+			want:  "collection scan [" + strings.Repeat(" ", 30) + "]   0.0% 0/200",
+		},
+		{
+			name:  "100%",
+			build: db.IndexBuild{Done: 200, Total: 200, Elapsed: time.Minute},
+			want:  "building [" + strings.Repeat("=", 30) + "] 100.0% 200/200",
+		},
+		{
+			name:  "ETA",
+			build: db.IndexBuild{Done: 50, Total: 200, Elapsed: 10 * time.Second},
+			want:  "building [" + strings.Repeat("=", 7) + strings.Repeat(" ", 23) + "]  25.0% 50/200 ETA 30s",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := progressLine(test.build); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTerminalProgressRedrawsInPlace(t *testing.T) {
+	const erase = "\x1b[1A\x1b[2K"
+	var out bytes.Buffer
+	p := &terminalProgress{out: &out}
+
+	// Every step erases the lines drawn by the previous one before drawing
+	// its own.
+	for _, step := range []struct {
+		name   string
+		run    func()
+		erased int
+		drawn  int
+	}{
+		{"migration started", func() { p.MigrationStarted(1, "users") }, 0, 1},
+		{"command started", func() { p.CommandStarted("createIndexes", "users", []string{"a_1"}) }, 1, 2},
+		{"builds progressed", func() { p.IndexBuildsProgressed([]db.IndexBuild{{Indexes: []string{"a_1"}}}) }, 3, 3},
+		{"command finished", func() { p.CommandFinished(nil) }, 6, 1},
+		{"migration finished", func() { p.MigrationFinished(errors.New("failed")) }, 7, 0},
+	} {
+		step.run()
+		if erased := strings.Count(out.String(), erase); erased != step.erased || p.drawn != step.drawn {
+			t.Errorf("%s: erased %d lines and drew %d, want %d and %d", step.name, erased, p.drawn, step.erased, step.drawn)
+		}
+	}
+
+	// What's left once the live region is cleared are the finished lines.
+	lines := strings.Split(strings.TrimSpace(out.String()[strings.LastIndex(out.String(), erase)+len(erase):]), "\n")
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "✗ 000001_users ") {
+		t.Errorf("finished migration printed as %q", lines)
+	}
+	if !strings.Contains(out.String(), "  ✓ createIndexes users (a_1) ") {
+		t.Errorf("finished command not printed: %q", out.String())
+	}
+	if strings.Contains(out.String(), "\x1b[3") {
+		t.Errorf("colored without color: %q", out.String())
+	}
+}
+
+func TestTenantsRejectProgressAlways(t *testing.T) {
+	cmd := newApplyCmd()
+	setConfig(cmd, Config{MongoURI: "mongodb://localhost", MigrationDir: t.TempDir(), Tenants: TenantsConfig{Databases: []string{"tenant_*"}}})
+
+	err := runApply(cmd, applyOptions{progress: progressAlways})
+	if err == nil || !strings.Contains(err.Error(), "--progress always") {
+		t.Errorf("got %v, want --progress always rejected", err)
+	}
+}
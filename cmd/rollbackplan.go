@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/migration"
+	"github.com/spf13/cobra"
+)
+
+// rollbackPlanOptions are the command-specific options of rollback-plan.
+type rollbackPlanOptions struct {
+	from uint64
+	json bool
+}
+
+func newRollbackPlanCmd() *cobra.Command {
+	var opts rollbackPlanOptions
+
+	cmd := &cobra.Command{
+		Use:   "rollback-plan <version>",
+		Short: "Preview rolling the database back to a version",
+		Long: `Print the down migrations rolling the database back to the version would run,
+newest first, what each does to which collections, and the schema expected
+afterwards, replayed from the up migrations. Nothing is run. Version 0 rolls
+back every migration.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRollbackPlan(cmd, args[0], opts)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	addMigrationFlags(cmd.Flags())
+	cmd.Flags().Uint64Var(&opts.from, "from", 0,
+		"Roll back from this version instead of the one applied to the database, which isn't read then")
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print the plan as JSON")
+
+	return cmd
+}
+
+func runRollbackPlan(cmd *cobra.Command, target string, opts rollbackPlanOptions) error {
+	opts.json = opts.json || configOf(cmd).output.json()
+
+	to, err := strconv.ParseUint(target, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid version %q", target)
+	}
+
+	requiredFields := []string{"migration_dir"}
+	if opts.from == 0 {
+		requiredFields = append(requiredFields, "mongo_uri", "database_name")
+	}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		from := opts.from
+		if from == 0 {
+			version, dirty, err := migration.ReadAppliedVersion(ctx, logger, config.settings, config.MongoURI, config.DatabaseName)
+			if err != nil {
+				return err
+			}
+			if version == db.NilVersion {
+				return fmt.Errorf("no migration applied to %s, nothing to roll back", config.DatabaseName)
+			}
+			if dirty {
+				logger.Warn("Last migration failed midway, fix it with golang-migrate force before rolling back",
+					"version", version)
+			}
+			from = uint64(version)
+		}
+
+		plan, err := migration.PlanRollback(logger, config.settings, config.MigrationDir, from, to)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if opts.json {
+			data, err := json.MarshalIndent(plan, "", "  ")
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(out, "%s\n", data)
+			return err
+		}
+
+		if len(plan.Steps) == 0 {
+			fmt.Fprintf(out, "Already at version %d, nothing to roll back\n", plan.To)
+		} else {
+			fmt.Fprintf(out, "Rolling back from version %d to %d runs %d down migration(s):\n",
+				plan.From, plan.To, len(plan.Steps))
+		}
+		printSteps(out, plan.Steps)
+
+		data, err := json.MarshalIndent(plan.Schema, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "\nSchema expected afterwards:\n%s\n", data)
+		return err
+	})
+}
+
+// printSteps prints the numbered migrations with what each does to which
+// collections.
+func printSteps(out io.Writer, steps []migration.ChangelogEntry) {
+	for i, step := range steps {
+		fmt.Fprintf(out, "\n%d. %06d %s\n", i+1, step.Version, step.Name)
+		if len(step.Changes) == 0 {
+			fmt.Fprintln(out, "   - No changes")
+		}
+		for _, change := range step.Changes {
+			var parts []string
+			if len(change.Created) > 0 {
+				parts = append(parts, "creates "+strings.Join(change.Created, ", "))
+			}
+			if len(change.Dropped) > 0 {
+				parts = append(parts, "drops "+strings.Join(change.Dropped, ", "))
+			}
+			if len(change.Commands) > 0 {
+				parts = append(parts, "runs "+strings.Join(change.Commands, ", "))
+			}
+			fmt.Fprintf(out, "   - %s: %s\n", change.Collection, strings.Join(parts, "; "))
+		}
+	}
+}
@@ -1,18 +1,32 @@
 package cmd
 
 import (
+	"bufio"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
-	"log"
 	"log/slog"
 	"os"
 	"os/signal"
+	"os/user"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/ltman/mondex/atlas"
+	"github.com/ltman/mondex/atomicfile"
+	"github.com/ltman/mondex/db"
 	"github.com/ltman/mondex/migration"
+	"github.com/ltman/mondex/query"
+	"github.com/ltman/mondex/schema"
+	"github.com/ltman/mondex/tui"
+	"github.com/ltman/mondex/version"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -21,238 +35,1307 @@ type Config struct {
 	MongoURI       string `mapstructure:"mongo_uri"`
 	DatabaseName   string `mapstructure:"database_name"`
 	SchemaFilePath string `mapstructure:"schema_file_path"`
+	AccessFilePath string `mapstructure:"access_file_path"`
 	MigrationDir   string `mapstructure:"migration_dir"`
-	MigrationName  string `mapstructure:"-"`
+	StateFilePath  string `mapstructure:"state_file_path"`
 	LogLevel       string `mapstructure:"log_level"`
+	ReadPreference string `mapstructure:"read_preference"`
+	ReadConcern    string `mapstructure:"read_concern"`
+
+	// ReadConcurrency is how many collections are read at once when
+	// reading the current schema.
+	ReadConcurrency int `mapstructure:"read_concurrency"`
+
+	// SearchIndexes makes inspect and diff read and compare Atlas Search
+	// indexes, which only Atlas and deployments running mongot list.
+	SearchIndexes bool `mapstructure:"search_indexes"`
+
+	// ConnectTimeout bounds waiting for a server to answer when connecting;
+	// zero keeps the default.
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+
+	Connection ConnectionConfig `mapstructure:"connection"`
+
+	WriteConcern WriteConcernConfig `mapstructure:"write_concern"`
+
+	WaitForSecondaries        bool          `mapstructure:"wait_for_secondaries"`
+	WaitForSecondariesTimeout time.Duration `mapstructure:"wait_for_secondaries_timeout"`
+
+	IndexBuilds IndexBuildsConfig `mapstructure:"index_builds"`
+
+	Lock LockConfig `mapstructure:"lock"`
+
+	// Timeout bounds every operation; StageTimeouts override it for a
+	// command, unless --timeout is given.
+	Timeout       time.Duration       `mapstructure:"timeout"`
+	StageTimeouts StageTimeoutsConfig `mapstructure:"stage_timeouts"`
+
+	RemoteState bool `mapstructure:"remote_state"`
+
+	ManagedCollectionsOnly bool `mapstructure:"managed_collections_only"`
+	DropRemovedCollections bool `mapstructure:"drop_removed_collections"`
+	BlueGreen              bool `mapstructure:"blue_green"`
+
+	// MigrationFormat is json, the commands apply runs, or js to generate
+	// mongosh scripts instead.
+	MigrationFormat string `mapstructure:"migration_format"`
+	// ScriptDir is where mongosh scripts are written, the mongosh directory
+	// of the migration directory when empty.
+	ScriptDir string `mapstructure:"script_dir"`
+
+	Atlas AtlasConfig `mapstructure:"atlas"`
+
+	Policies []string `mapstructure:"policies"`
+
+	Ignore IgnoreConfig `mapstructure:"ignore"`
+
+	Format FormatConfig `mapstructure:"format"`
+
+	Comparison ComparisonConfig `mapstructure:"comparison"`
+
+	// Suppress lists the known differences diff reports without acting on.
+	Suppress []SuppressionConfig `mapstructure:"suppress"`
+
+	// Environments are the databases compare-envs compares, by name.
+	Environments map[string]EnvironmentConfig `mapstructure:"environments"`
+
+	// Tenants makes diff, check and apply run on every database matching
+	// its patterns instead of database_name.
+	Tenants TenantsConfig `mapstructure:"tenants"`
+
+	// FileMode sets the permissions of the files mondex writes, in octal;
+	// empty honors the umask. FileGroup sets their group by name or ID.
+	FileMode  string `mapstructure:"file_mode"`
+	FileGroup string `mapstructure:"file_group"`
+
+	// output is how much the command prints and how, set by its flags
+	// rather than the config file.
+	output outputOptions
+	// settings are the migration settings resolved from the config, set by
+	// runWithContext.
+	settings migration.Settings
 }
 
-var (
-	cfg     Config
-	cfgFile string
+// ConnectionConfig holds the TLS, authentication and client settings that
+// don't fit in mongo_uri, which they take precedence over.
+type ConnectionConfig struct {
+	TLSCAFile                     string            `mapstructure:"tls_ca_file"`
+	TLSCertificateKeyFile         string            `mapstructure:"tls_certificate_key_file"`
+	TLSCertificateKeyFilePassword string            `mapstructure:"tls_certificate_key_file_password"`
+	AuthMechanism                 string            `mapstructure:"auth_mechanism"`
+	AuthMechanismProperties       map[string]string `mapstructure:"auth_mechanism_properties"`
+	AuthSource                    string            `mapstructure:"auth_source"`
+	Username                      string            `mapstructure:"username"`
+	Password                      string            `mapstructure:"password"`
+	PasswordFile                  string            `mapstructure:"password_file"`
+	ServerSelectionTimeout        time.Duration     `mapstructure:"server_selection_timeout"`
+	AppName                       string            `mapstructure:"app_name"`
+}
 
-	dryRun bool
-)
+// AtlasConfig holds the Atlas Admin API credentials apply uses for search indexes.
+type AtlasConfig struct {
+	PublicKey   string `mapstructure:"public_key"`
+	PrivateKey  string `mapstructure:"private_key"`
+	ProjectID   string `mapstructure:"project_id"`
+	ClusterName string `mapstructure:"cluster_name"`
+	BaseURL     string `mapstructure:"base_url"`
+}
 
-func Execute() {
-	cobra.OnInitialize(initConfig)
+// IgnoreConfig replaces the patterns of the collections and indexes mondex
+// leaves alone; unset lists keep the defaults.
+type IgnoreConfig struct {
+	Collections []string `mapstructure:"collections"`
+	Indexes     []string `mapstructure:"indexes"`
+}
+
+// FormatConfig is the style of the schema files mondex writes; unset fields
+// keep the defaults.
+type FormatConfig struct {
+	Indent               int    `mapstructure:"indent"`
+	SortIndexes          string `mapstructure:"sort_indexes"`
+	Order                string `mapstructure:"order"`
+	KeepEmptyCollections bool   `mapstructure:"keep_empty_collections"`
+}
+
+// LockConfig sets how apply waits for the database lock held by another
+// process.
+type LockConfig struct {
+	Timeout         time.Duration `mapstructure:"timeout"`
+	InitialInterval time.Duration `mapstructure:"initial_interval"`
+	MaxInterval     time.Duration `mapstructure:"max_interval"`
+}
+
+// StageTimeoutsConfig bounds the operations of single commands.
+type StageTimeoutsConfig struct {
+	Inspect time.Duration `mapstructure:"inspect"`
+	Diff    time.Duration `mapstructure:"diff"`
+	Apply   time.Duration `mapstructure:"apply"`
+}
+
+// timeout returns the timeout of the command, falling back to the global one.
+func (c StageTimeoutsConfig) timeout(command string, global time.Duration) time.Duration {
+	var stage time.Duration
+	switch command {
+	case "inspect":
+		stage = c.Inspect
+	case "diff":
+		stage = c.Diff
+	case "apply":
+		stage = c.Apply
+	}
+	if stage > 0 {
+		return stage
+	}
+	return global
+}
+
+// EnvironmentConfig locates the database of an environment. The read
+// settings default to the top-level ones.
+type EnvironmentConfig struct {
+	MongoURI       string `mapstructure:"mongo_uri"`
+	DatabaseName   string `mapstructure:"database_name"`
+	ReadPreference string `mapstructure:"read_preference"`
+	ReadConcern    string `mapstructure:"read_concern"`
+}
+
+// TenantsConfig selects databases sharing the schema file and migrations,
+// by patterns as those of ignore, and how many are processed at once.
+type TenantsConfig struct {
+	Databases   []string `mapstructure:"databases"`
+	Concurrency int      `mapstructure:"concurrency"`
+}
+
+// SuppressionConfig is a rule suppressing differences of the indexes matching
+// its patterns.
+type SuppressionConfig struct {
+	Collection   string        `mapstructure:"collection"`
+	Index        string        `mapstructure:"index"`
+	TTLTolerance time.Duration `mapstructure:"ttl_tolerance"`
+	IgnoreHidden bool          `mapstructure:"ignore_hidden"`
+	Until        time.Time     `mapstructure:"until"`
+	Reason       string        `mapstructure:"reason"`
+}
+
+// ComparisonConfig sets how indexes are compared when looking for changes.
+type ComparisonConfig struct {
+	KeyOrder            string `mapstructure:"key_order"`
+	IgnoreStorageEngine bool   `mapstructure:"ignore_storage_engine"`
+}
+
+// WriteConcernConfig is the write concern attached to commands run by apply.
+type WriteConcernConfig struct {
+	W        string        `mapstructure:"w"`
+	Journal  *bool         `mapstructure:"j"`
+	WTimeout time.Duration `mapstructure:"wtimeout"`
+}
+
+// IndexBuildsConfig tunes the createIndexes commands run by apply and how
+// their builds are reported in logs.
+type IndexBuildsConfig struct {
+	CommitQuorum string        `mapstructure:"commit_quorum"`
+	MaxTime      time.Duration `mapstructure:"max_time"`
+	LogInterval  time.Duration `mapstructure:"log_interval"`
+}
+
+func (c Config) readOptions() db.ReadOptions {
+	return db.ReadOptions{
+		Preference:    c.ReadPreference,
+		Concern:       c.ReadConcern,
+		Concurrency:   c.ReadConcurrency,
+		SearchIndexes: c.SearchIndexes,
+	}
+}
+
+func (c Config) connectionOptions() db.ConnectionOptions {
+	// Viper lowercases keys, while the driver expects property names such
+	// as AWS_SESSION_TOKEN.
+	var properties map[string]string
+	for name, value := range c.Connection.AuthMechanismProperties {
+		if properties == nil {
+			properties = make(map[string]string)
+		}
+		properties[strings.ToUpper(name)] = value
+	}
+	return db.ConnectionOptions{
+		TLSCAFile:                     c.Connection.TLSCAFile,
+		TLSCertificateKeyFile:         c.Connection.TLSCertificateKeyFile,
+		TLSCertificateKeyFilePassword: c.Connection.TLSCertificateKeyFilePassword,
+		AuthMechanism:                 c.Connection.AuthMechanism,
+		AuthMechanismProperties:       properties,
+		AuthSource:                    c.Connection.AuthSource,
+		Username:                      c.Connection.Username,
+		Password:                      c.Connection.Password,
+		PasswordFile:                  c.Connection.PasswordFile,
+		ServerSelectionTimeout:        c.Connection.ServerSelectionTimeout,
+		AppName:                       c.Connection.AppName,
+		ConnectTimeout:                c.ConnectTimeout,
+	}
+}
+
+func (c Config) applyOptions() migration.ApplyOptions {
+	return migration.ApplyOptions{
+		WriteConcern: db.WriteOptions{
+			W:        c.WriteConcern.W,
+			Journal:  c.WriteConcern.Journal,
+			WTimeout: c.WriteConcern.WTimeout,
+		},
+		WaitForSecondaries: c.WaitForSecondaries,
+		WaitTimeout:        c.WaitForSecondariesTimeout,
+		IndexBuilds: migration.IndexBuildOptions{
+			CommitQuorum: c.IndexBuilds.CommitQuorum,
+			MaxTime:      c.IndexBuilds.MaxTime,
+			LogInterval:  c.IndexBuilds.LogInterval,
+		},
+		Atlas:       c.atlasClient(),
+		Policies:    c.Policies,
+		RemoteState: c.RemoteState,
+		Lock: migration.LockOptions{
+			Timeout:         c.Lock.Timeout,
+			InitialInterval: c.Lock.InitialInterval,
+			MaxInterval:     c.Lock.MaxInterval,
+		},
+	}
+}
+
+func (c Config) diffOptions() (migration.DiffOptions, error) {
+	suppressions, err := c.suppressionRules()
+	if err != nil {
+		return migration.DiffOptions{}, err
+	}
+	if err := checkMigrationFormat(c.MigrationFormat); err != nil {
+		return migration.DiffOptions{}, fmt.Errorf("migration_format: %w", err)
+	}
+	return migration.DiffOptions{
+		SchemaFilePath:         c.SchemaFilePath,
+		ReadOptions:            c.readOptions(),
+		MigrationDir:           c.MigrationDir,
+		ManagedCollectionsOnly: c.ManagedCollectionsOnly,
+		DropRemovedCollections: c.DropRemovedCollections,
+		BlueGreen:              c.BlueGreen,
+		AccessFilePath:         c.AccessFilePath,
+		Suppressions:           suppressions,
+		MigrationFormat:        c.MigrationFormat,
+		ScriptDir:              c.ScriptDir,
+		Policies:               c.Policies,
+	}, nil
+}
+
+// checkMigrationFormat checks the migration_format setting.
+func checkMigrationFormat(format string) error {
+	switch format {
+	case "", migration.MigrationFormatJSON, migration.MigrationFormatJS:
+		return nil
+	}
+	return fmt.Errorf("invalid format %q (want %s or %s)", format, migration.MigrationFormatJSON, migration.MigrationFormatJS)
+}
+
+// suppressionRules checks the suppress rules.
+func (c Config) suppressionRules() ([]migration.SuppressionRule, error) {
+	rules := make([]migration.SuppressionRule, 0, len(c.Suppress))
+	for _, s := range c.Suppress {
+		rules = append(rules, migration.SuppressionRule{
+			Collection:   s.Collection,
+			Index:        s.Index,
+			TTLTolerance: s.TTLTolerance,
+			IgnoreHidden: s.IgnoreHidden,
+			Until:        s.Until,
+			Reason:       s.Reason,
+		})
+	}
+	if err := migration.CheckSuppressionRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
 
+// formatStyle parses the format settings.
+func (c Config) formatStyle() (migration.FormatStyle, error) {
+	style := migration.FormatStyle{
+		Indent:               c.Format.Indent,
+		SortIndexes:          c.Format.SortIndexes,
+		KeepEmptyCollections: c.Format.KeepEmptyCollections,
+	}
+	switch c.Format.Order {
+	case "", "asc":
+	case "desc":
+		style.Descending = true
+	default:
+		return style, fmt.Errorf("invalid order %q, want asc or desc", c.Format.Order)
+	}
+	return style, nil
+}
+
+// migrationSettings returns the settings the operations of the command use:
+// how schemas are read, compared and written, the file permissions and the
+// connection options.
+func (c Config) migrationSettings() (migration.Settings, error) {
+	style, err := c.formatStyle()
+	if err != nil {
+		return migration.Settings{}, err
+	}
+	permissions, err := c.filePermissions()
+	if err != nil {
+		return migration.Settings{}, err
+	}
+	return migration.Settings{
+		IgnoredCollections: c.Ignore.Collections,
+		IgnoredIndexes:     c.Ignore.Indexes,
+		FormatStyle:        style,
+		Comparison:         c.comparison(),
+		FilePermissions:    &permissions,
+		Connection:         c.connectionOptions(),
+	}, nil
+}
+
+// comparison returns how indexes are compared.
+func (c Config) comparison() schema.Comparison {
+	return schema.Comparison{
+		KeyOrder:            schema.KeyOrder(c.Comparison.KeyOrder),
+		IgnoreStorageEngine: c.Comparison.IgnoreStorageEngine,
+	}
+}
+
+// filePermissions returns the permissions of the files mondex writes, from
+// file_mode and file_group.
+func (c Config) filePermissions() (atomicfile.Permissions, error) {
+	mode, err := c.fileMode()
+	if err != nil {
+		return atomicfile.Permissions{}, err
+	}
+	group, err := c.fileGroup()
+	if err != nil {
+		return atomicfile.Permissions{}, err
+	}
+	return atomicfile.Permissions{Mode: mode, Group: group}, nil
+}
+
+// fileMode parses file_mode, returning zero when it's unset.
+func (c Config) fileMode() (os.FileMode, error) {
+	if c.FileMode == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(c.FileMode, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("invalid file mode %q, want octal permissions such as 0640", c.FileMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// fileGroup resolves file_group to a group ID, returning -1 when it's unset.
+func (c Config) fileGroup() (int, error) {
+	if c.FileGroup == "" {
+		return -1, nil
+	}
+	if gid, err := strconv.Atoi(c.FileGroup); err == nil {
+		return gid, nil
+	}
+	group, err := user.LookupGroup(c.FileGroup)
+	if err != nil {
+		return -1, fmt.Errorf("invalid file group: %w", err)
+	}
+	gid, err := strconv.Atoi(group.Gid)
+	if err != nil {
+		return -1, fmt.Errorf("group %s has a non-numeric ID %q", c.FileGroup, group.Gid)
+	}
+	return gid, nil
+}
+
+// missingFields returns the fields, by config key, that are empty once the
+// config is resolved.
+func (c Config) missingFields(fields []string) []string {
+	values := map[string]string{
+		"mongo_uri":        c.MongoURI,
+		"database_name":    c.DatabaseName,
+		"schema_file_path": c.SchemaFilePath,
+		"migration_dir":    c.MigrationDir,
+		"state_file_path":  c.StateFilePath,
+	}
+	var missing []string
+	for _, field := range fields {
+		if values[field] == "" {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+// atlasClient returns an Admin API client when Atlas credentials are configured.
+func (c Config) atlasClient() *atlas.Client {
+	if c.Atlas.PublicKey == "" {
+		return nil
+	}
+	return atlas.NewClient(c.Atlas.BaseURL, c.Atlas.PublicKey, c.Atlas.PrivateKey, c.Atlas.ProjectID, c.Atlas.ClusterName)
+}
+
+// configKey is the context key of the config initConfig resolves for the
+// command.
+type configKey struct{}
+
+// configOf returns the config resolved for the command.
+func configOf(cmd *cobra.Command) Config {
+	config, _ := commandContext(cmd).Value(configKey{}).(Config)
+	return config
+}
+
+// setConfig makes config the one the command runs with.
+func setConfig(cmd *cobra.Command, config Config) {
+	cmd.SetContext(context.WithValue(commandContext(cmd), configKey{}, config))
+}
+
+// commandContext returns the context of the command, which is unset when it
+// runs outside Execute, e.g. to complete flags.
+func commandContext(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+// configEnvironment names the environment of the environments section whose
+// connection settings override the top-level ones, selected by --env or
+// MONDEX_ENV.
+func configEnvironment(cmd *cobra.Command) string {
+	if env, _ := cmd.Flags().GetString("env"); env != "" {
+		return env
+	}
+	return os.Getenv(envPrefix + "_ENV")
+}
+
+func Execute() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
 	if err := newRootCmd().ExecuteContext(ctx); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		code := 1
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.code
+		}
+		os.Exit(code)
 	}
 }
 
-func initConfig() {
-	const defaultConfigFile = "mondex.yml"
+// exitError makes mondex exit with a status other than 1.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
 
-	if cfgFile != "" {
-		viper.SetConfigFile(cfgFile)
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func initConfig(cmd *cobra.Command) error {
+	output, err := outputOptionsOf(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	if err := bindConfigFlags(cmd.Flags()); err != nil {
+		return fmt.Errorf("binding flags: %w", err)
+	}
+
+	if path, _ := cmd.Flags().GetString("config"); path != "" {
+		viper.SetConfigFile(path)
 	} else {
-		viper.SetConfigFile(defaultConfigFile)
+		viper.SetConfigFile(discoverConfigFile())
+	}
+
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	for _, key := range configKeys() {
+		if err := viper.BindEnv(key); err != nil {
+			return fmt.Errorf("binding environment variable for %s: %w", key, err)
+		}
 	}
 
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+	if err := viper.ReadInConfig(); err == nil && !output.quiet {
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
+	expandConfigEnv()
 
-	if err := viper.Unmarshal(&cfg); err != nil {
-		fmt.Printf("Unable to decode config into struct: %v\n", err)
+	// Dates, such as suppress.until, are written YYYY-MM-DD.
+	decodeHook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		mapstructure.StringToTimeHookFunc(time.DateOnly),
+	))
+	var config Config
+	if err := viper.Unmarshal(&config, decodeHook); err != nil {
+		return fmt.Errorf("decoding config: %w", err)
 	}
+
+	resolveConfigPaths(&config)
+
+	if err := applyEnvironment(cmd, &config); err != nil {
+		return err
+	}
+
+	if !cmd.Flags().Changed("timeout") {
+		config.Timeout = config.StageTimeouts.timeout(cmd.Name(), config.Timeout)
+	}
+	config.output = output
+
+	setConfig(cmd, config)
+	return nil
 }
 
-func initLogger(level string) (*slog.Logger, error) {
+func initLogger(level string, addSource bool) (*slog.Logger, error) {
 	var logLevel slog.Level
 	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
 		return nil, err
 	}
-	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})), nil
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel, AddSource: addSource})), nil
 }
 
 func newRootCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "mondex",
 		Short: "MongoDB migration tool",
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			return initConfig(cmd)
+		},
 	}
 
-	cmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is ./mondex.yaml)")
-	cmd.PersistentFlags().String("mongo_uri", "", "MongoDB connection URI")
-	cmd.PersistentFlags().String("database_name", "", "Name of the database")
-	cmd.PersistentFlags().String("schema_file_path", "", "Path to the schema file")
-	cmd.PersistentFlags().String("migration_dir", "", "Directory for migration files")
+	cmd.PersistentFlags().String("config", "", "config file (default is ./mondex.yml)")
+	cmd.PersistentFlags().String("env", "",
+		"Use the connection settings of this environment of the config file (also MONDEX_ENV)")
 	cmd.PersistentFlags().String("log_level", "info", "Logging level (debug, info, warn, error)")
-	cmd.PersistentFlags().BoolVar(&dryRun, "dry_run", false, "Show changes without writing files")
+	cmd.PersistentFlags().Duration("timeout", 0, "Abort the operation after this long, e.g. 30m (default no limit)")
+	addOutputFlags(cmd.PersistentFlags())
 
-	if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
-		// Since this is called during initialization, we can't return an error.
-		// Instead, we'll print the error and exit.
-		fmt.Printf("Error binding flags: %v\n", err)
-		os.Exit(1)
-	}
-
-	cmd.AddCommand(newApplyCmd(), newDiffCmd(), newFormatCmd(), newInspectCmd())
+	cmd.CompletionOptions.DisableDefaultCmd = true
+	cmd.AddCommand(
+		newAdviseCmd(),
+		newApplyCmd(),
+		newBaselineCmd(),
+		newBrowseCmd(),
+		newChangelogCmd(),
+		newCheckCmd(),
+		newCiCmd(),
+		newCleanCmd(),
+		newCodegenCmd(),
+		newCompareEnvsCmd(),
+		newCompletionCmd(),
+		newConfigCmd(),
+		newDiagramCmd(),
+		newDiffCmd(),
+		newDocsCmd(),
+		newExportCmd(),
+		newFormatCmd(),
+		newHistoryCmd(),
+		newImportCmd(),
+		newInitCmd(),
+		newInspectCmd(),
+		newLintCmd(),
+		newLsCmd(),
+		newMergeCmd(),
+		newOwnersCmd(),
+		newRollbackPlanCmd(),
+		newSchemaSpecCmd(),
+		newShowCmd(),
+		newSnapshotCmd(),
+		newSquashCmd(),
+		newStatusCmd(),
+		newVersionCmd(),
+	)
+	addPluginCmds(cmd)
 
 	return cmd
 }
 
+// applyOptions are the command-specific options of apply.
+type applyOptions struct {
+	progress          string
+	only              uint64
+	steps             int
+	toVersion         uint64
+	toVersionSet      bool
+	canaryURI         string
+	canaryDatabase    string
+	canaryMaxDuration time.Duration
+	verify            bool
+	allowDestructive  bool
+	plan              bool
+}
+
 func newApplyCmd() *cobra.Command {
-	return &cobra.Command{
+	var opts applyOptions
+
+	cmd := &cobra.Command{
 		Use:   "apply",
 		Short: "Apply current migrations",
-		RunE:  runApply,
+		Long: `Apply the pending migrations, or with --steps only the next ones. --to-version
+migrates up or down to a version, and apply down rolls back.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if opts.steps < 0 {
+				return fmt.Errorf("--steps must be positive, roll back with apply down")
+			}
+			opts.toVersionSet = cmd.Flags().Changed("to-version")
+			return runApply(cmd, opts)
+		},
 	}
+
+	addConnectionFlags(cmd.Flags())
+	addMigrationFlags(cmd.Flags())
+	addApplyFlags(cmd.Flags())
+	cmd.Flags().StringVar(&opts.progress, "progress", progressAuto,
+		"Show a live progress display: auto (when stdout is a terminal), always or never")
+	cmd.Flags().Uint64Var(&opts.only, "only", 0,
+		"Apply only the pending migration of this version, ahead of earlier ones")
+	cmd.Flags().IntVar(&opts.steps, "steps", 0, "Apply only this many pending migrations (default all)")
+	cmd.Flags().Uint64Var(&opts.toVersion, "to-version", 0,
+		"Migrate up or down to this version, 0 rolling back every migration")
+	cmd.MarkFlagsMutuallyExclusive("only", "steps", "to-version")
+	cmd.Flags().StringVar(&opts.canaryURI, "canary-uri", "",
+		"Apply the migrations to this shadow deployment first and only then to the target")
+	cmd.Flags().StringVar(&opts.canaryDatabase, "canary-database", "",
+		"Database of the shadow deployment (default database_name)")
+	cmd.Flags().DurationVar(&opts.canaryMaxDuration, "canary-max-duration", 0,
+		"Fail before touching the target when the canary takes longer")
+	cmd.Flags().BoolVar(&opts.verify, "verify", false,
+		"Fail unless the indexes match the schema file once the migrations ran")
+	cmd.Flags().BoolVar(&opts.allowDestructive, "allow-destructive", false,
+		"Apply pending migrations dropping indexes, collections or privileges, which are refused otherwise")
+	cmd.Flags().BoolVar(&opts.plan, "plan", false,
+		"Print the migrations apply would run and what each does to which collections, without running anything")
+	cmd.MarkFlagsMutuallyExclusive("plan", "canary-uri")
+	cmd.MarkFlagsMutuallyExclusive("plan", "verify")
+	addSchemaFlags(cmd.Flags())
+
+	cmd.AddCommand(newApplyDownCmd())
+
+	return cmd
+}
+
+// applyDownOptions are the command-specific options of apply down.
+type applyDownOptions struct {
+	steps int
+	all   bool
+}
+
+func newApplyDownCmd() *cobra.Command {
+	var opts applyDownOptions
+
+	cmd := &cobra.Command{
+		Use:   "down",
+		Short: "Roll back applied migrations",
+		Long: `Run the down migrations of the last applied migrations, newest first: one by
+default, --steps of them, or with --all every one. apply --to-version rolls
+back to a version. Preview a rollback with rollback-plan first.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if opts.steps <= 0 {
+				return fmt.Errorf("--steps must be positive")
+			}
+			applyOpts := applyOptions{progress: progressAuto, steps: -opts.steps}
+			if opts.all {
+				applyOpts.steps, applyOpts.toVersionSet = 0, true
+			}
+			return runApply(cmd, applyOpts)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	addMigrationFlags(cmd.Flags())
+	addApplyFlags(cmd.Flags())
+	cmd.Flags().IntVar(&opts.steps, "steps", 1, "Roll back this many migrations")
+	cmd.Flags().BoolVar(&opts.all, "all", false, "Roll back every applied migration")
+	cmd.MarkFlagsMutuallyExclusive("steps", "all")
+
+	return cmd
 }
 
+// diffOptions are the command-specific options of diff.
+type diffOptions struct {
+	dryRun           bool
+	owner            string
+	useState         bool
+	useRemoteState   bool
+	confirmDrop      bool
+	upOnly           bool
+	downOnly         bool
+	outDir           string
+	noPager          bool
+	format           string
+	split            bool
+	allDatabases     bool
+	allowEmpty       bool
+	allowDestructive bool
+}
+
+// Formats of diff.
+const (
+	diffFormatMigrations = "migrations"
+	diffFormatJS         = "js"
+	diffFormatJSONPatch  = "json-patch"
+)
+
 func newDiffCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "diff [migration_name]",
+	var opts diffOptions
+
+	cmd := &cobra.Command{
+		Use:   "diff [collection...] [--] [migration_name]",
 		Short: "Generate migration scripts based on schema differences",
-		Args:  cobra.MaximumNArgs(1),
-		RunE:  runDiff,
+		Long: `Generate migration scripts based on schema differences.
+
+Collections given before -- restrict the migration to their changes, e.g.
+"mondex diff users orders -- add_user_indexes", leaving other drift for later.`,
+		Args: diffArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDiff(cmd, args, opts)
+		},
+		ValidArgsFunction: completeCollections,
 	}
+
+	addConnectionFlags(cmd.Flags())
+	addReadFlags(cmd.Flags())
+	addSchemaFlags(cmd.Flags())
+	addAccessFlags(cmd.Flags())
+	addMigrationFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.dryRun, "dry_run", false, "Show changes without writing files")
+	cmd.Flags().StringVar(&opts.owner, "owner", "", "Only diff the collections declared with this owner")
+	cmd.Flags().BoolVar(&opts.useState, "use-state", false, "Diff against the state file instead of the live database")
+	cmd.Flags().BoolVar(&opts.useRemoteState, "use-remote-state", false,
+		"Diff against the schema recorded by apply in the mondex_state collection, reporting out-of-band changes")
+	cmd.MarkFlagsMutuallyExclusive("use-state", "use-remote-state")
+	cmd.Flags().BoolVar(&opts.confirmDrop, "confirm-drop-collections", false,
+		"Confirm dropping the collections removed from the schema file, with drop_removed_collections")
+	cmd.Flags().BoolVar(&opts.upOnly, "up-only", false, "Only generate up migrations")
+	cmd.Flags().BoolVar(&opts.downOnly, "down-only", false, "Only generate down migrations, to write the up migrations by hand")
+	cmd.MarkFlagsMutuallyExclusive("up-only", "down-only")
+	cmd.Flags().StringVar(&opts.outDir, "out-dir", "",
+		"With --dry_run, write the migrations to this directory, without versions, instead of stdout")
+	cmd.Flags().BoolVar(&opts.noPager, "no-pager", false, "With --dry_run, print the migrations instead of paging them on a terminal")
+	cmd.Flags().BoolVar(&opts.allDatabases, "all-databases", false,
+		"Diff every database of a multi-database schema file, writing migrations to a directory per database")
+	cmd.MarkFlagsMutuallyExclusive("all-databases", "use-state")
+	cmd.MarkFlagsMutuallyExclusive("all-databases", "out-dir")
+	cmd.Flags().BoolVar(&opts.allowEmpty, "allow-empty", false,
+		"Generate an empty migration when nothing changed, e.g. as a release checkpoint")
+	cmd.Flags().BoolVar(&opts.allowDestructive, "allow-destructive", false,
+		"Write up migrations dropping indexes, collections or privileges, which are refused otherwise")
+	cmd.Flags().BoolVar(&opts.split, "split", false,
+		"Generate a migration per changed collection, with consecutive versions, instead of a single one")
+	cmd.Flags().StringVar(&opts.format, "format", diffFormatMigrations,
+		"What to generate: migrations, js for mongosh scripts instead of JSON migrations, "+
+			"or json-patch to print the differences as a JSON Patch against the schema file")
+	addStateFlags(cmd.Flags())
+	addDiffFlags(cmd.Flags())
+
+	return cmd
+}
+
+// formatOptions are the command-specific options of format.
+type formatOptions struct {
+	dryRun   bool
+	strict   bool
+	validate bool
+	check    bool
+	to       string
 }
 
 func newFormatCmd() *cobra.Command {
-	return &cobra.Command{
+	var opts formatOptions
+
+	cmd := &cobra.Command{
 		Use:   "format",
 		Short: "Format current schema file",
-		RunE:  runFormat,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runFormat(cmd, opts)
+		},
 	}
+
+	addSchemaFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.dryRun, "dry_run", false, "Show changes without writing files")
+	cmd.Flags().BoolVar(&opts.strict, "strict", true, "Fail on fields that aren't part of the schema format instead of dropping them")
+	cmd.Flags().BoolVar(&opts.validate, "validate", false, "Validate the schema file against the JSON Schema printed by schema-spec")
+	cmd.Flags().BoolVar(&opts.check, "check", false, "Fail if the schema file isn't formatted, without writing it")
+	cmd.Flags().StringVar(&opts.to, "to", "",
+		"Convert the schema file to "+strings.Join(schema.CodecNames(), ", ")+" or a dir of collection files, next to the original")
+	cmd.MarkFlagsMutuallyExclusive("check", "to")
+
+	return cmd
+}
+
+// inspectOptions are the command-specific options of inspect.
+type inspectOptions struct {
+	dryRun       bool
+	query        string
+	anonymize    bool
+	allDatabases bool
+	exclude      []string
 }
 
 func newInspectCmd() *cobra.Command {
-	return &cobra.Command{
+	var opts inspectOptions
+
+	cmd := &cobra.Command{
 		Use:   "inspect",
 		Short: "Inspect and output the current database schema",
-		RunE:  runInspect,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runInspect(cmd, opts)
+		},
 	}
-}
 
-func validateConfig(requiredFields []string) error {
-	var missingFields []string
-	for _, field := range requiredFields {
-		if viper.GetString(field) == "" {
-			missingFields = append(missingFields, field)
-		}
-	}
+	addConnectionFlags(cmd.Flags())
+	addReadFlags(cmd.Flags())
+	addSchemaFlags(cmd.Flags())
+	addAccessFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.dryRun, "dry_run", false, "Show schema without writing the file")
+	cmd.Flags().StringVar(&opts.query, "query", "",
+		"Print the parts of the schema matching a JSONPath expression instead of writing the file")
+	cmd.Flags().BoolVar(&opts.anonymize, "anonymize", false,
+		"Hash collection, field and index names so the schema can be shared in bug reports")
+	cmd.MarkFlagsMutuallyExclusive("anonymize", "query")
+	cmd.Flags().BoolVar(&opts.allDatabases, "all-databases", false,
+		"Inspect every database of the cluster into a multi-database schema file")
+	cmd.Flags().StringSliceVar(&opts.exclude, "exclude-database", nil,
+		"With --all-databases, also leave out the databases matching these patterns (admin, config and local always are)")
+	cmd.MarkFlagsMutuallyExclusive("all-databases", "query")
+	cmd.MarkFlagsMutuallyExclusive("all-databases", "anonymize")
 
-	if len(missingFields) > 0 {
+	return cmd
+}
+
+func validateConfig(cmd *cobra.Command, requiredFields []string) error {
+	config := configOf(cmd)
+	if missingFields := config.missingFields(requiredFields); len(missingFields) > 0 {
 		return fmt.Errorf("missing required fields: %s", strings.Join(missingFields, ", "))
 	}
 
-	if cfg.SchemaFilePath != "" {
-		if _, err := os.Stat(cfg.SchemaFilePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
-			return fmt.Errorf("schema file does not exist: %s", cfg.SchemaFilePath)
+	if path := config.SchemaFilePath; path != "" {
+		if _, err := os.Stat(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("schema file does not exist: %s", path)
 		}
 	}
 
 	return nil
 }
 
-func runApply(cmd *cobra.Command, _ []string) error {
+func runApply(cmd *cobra.Command, opts applyOptions) error {
 	requiredFields := []string{"mongo_uri", "database_name", "migration_dir"}
-	if dryRun {
-		return fmt.Errorf("apply command doesn't support dry run mode")
+	if opts.verify {
+		requiredFields = append(requiredFields, "schema_file_path")
+	}
+	tenants := tenantMode(cmd)
+	if tenants {
+		requiredFields = withoutDatabaseName(requiredFields)
+		if opts.canaryURI != "" {
+			return fmt.Errorf("--canary-uri applies to a single database, not to tenants")
+		}
+		// Tenants migrated at once would tear a live display apart.
+		if opts.progress == progressAlways {
+			return fmt.Errorf("--progress %s shows a single database, not tenants", progressAlways)
+		}
+		opts.progress = progressNever
 	}
 
-	if err := validateConfig(requiredFields); err != nil {
+	if err := validateConfig(cmd, requiredFields); err != nil {
 		return err
 	}
 
+	progress, err := newProgressReporter(opts.progress, configOf(cmd).output)
+	if err != nil {
+		return err
+	}
+	if config := configOf(cmd); progress != nil && config.output.verbosity == 0 && config.LogLevel == "info" {
+		// Informational logs would tear the live display apart.
+		config.LogLevel = "warn"
+		setConfig(cmd, config)
+	}
+
 	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		applyOptions := config.applyOptions()
+		applyOptions.Progress = progress
+		applyOptions.Only = opts.only
+		applyOptions.Steps = opts.steps
+		applyOptions.AllowDestructive = opts.allowDestructive
+		if opts.toVersionSet {
+			applyOptions.ToVersion = &opts.toVersion
+		}
+		if opts.canaryURI != "" {
+			applyOptions.Canary = &migration.CanaryOptions{
+				MongoURI:     opts.canaryURI,
+				DatabaseName: cmp.Or(opts.canaryDatabase, config.DatabaseName),
+				MaxDuration:  opts.canaryMaxDuration,
+			}
+		}
+		if opts.verify {
+			applyOptions.Verify = &migration.VerifyOptions{
+				SchemaFilePath:         config.SchemaFilePath,
+				ManagedCollectionsOnly: config.ManagedCollectionsOnly,
+			}
+		}
+
+		if opts.plan {
+			plan := func(ctx context.Context, logger *slog.Logger, settings migration.Settings, database string) error {
+				return printApplyPlan(ctx, logger, settings, cmd.OutOrStdout(), config, database, applyOptions)
+			}
+			if tenants {
+				// Databases are planned one at a time, their plans being printed.
+				return runTenants(ctx, logger, config, cmd.OutOrStdout(), 1, plan)
+			}
+			return plan(ctx, logger, config.settings, config.DatabaseName)
+		}
+
+		if tenants {
+			return runTenants(ctx, logger, config, cmd.OutOrStdout(), config.Tenants.Concurrency,
+				func(ctx context.Context, logger *slog.Logger, settings migration.Settings, database string) error {
+					return migration.ApplyMigrations(ctx, logger, settings, config.MongoURI, database, config.MigrationDir, applyOptions)
+				})
+		}
+
 		return migration.ApplyMigrations(
 			ctx,
 			logger,
+			config.settings,
 			config.MongoURI,
 			config.DatabaseName,
 			config.MigrationDir,
+			applyOptions,
 		)
 	})
 }
 
-func runDiff(cmd *cobra.Command, args []string) error {
+// printApplyPlan prints the migrations apply would run against the database.
+func printApplyPlan(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings migration.Settings,
+	out io.Writer,
+	config Config,
+	database string,
+	applyOptions migration.ApplyOptions,
+) error {
+	plan, err := migration.PlanApply(ctx, logger, settings, config.MongoURI, database, config.MigrationDir, applyOptions)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case plan.Dirty:
+		fmt.Fprintf(out, "Database %s is dirty at version %d, fix it with golang-migrate force before applying\n",
+			database, plan.From)
+	case len(plan.Steps) == 0:
+		fmt.Fprintf(out, "Database %s is at version %d, nothing to apply\n", database, plan.From)
+	case plan.Down:
+		fmt.Fprintf(out, "Database %s is at version %d, rolling back runs %d down migration(s):\n",
+			database, plan.From, len(plan.Steps))
+	default:
+		fmt.Fprintf(out, "Database %s is at version %d, applying runs %d migration(s):\n",
+			database, plan.From, len(plan.Steps))
+	}
+	if plan.Dirty {
+		return nil
+	}
+	printSteps(out, plan.Steps)
+
+	if len(plan.Destructive) > 0 {
+		fmt.Fprintln(out, "\nDestructive changes, refused without --allow-destructive:")
+		for _, d := range plan.Destructive {
+			fmt.Fprintf(out, "  %s\n", d)
+		}
+	}
+	return nil
+}
+
+func runDiff(cmd *cobra.Command, args []string, opts diffOptions) error {
 	requiredFields := []string{"mongo_uri", "database_name", "schema_file_path"}
-	if !dryRun {
-		log.Println(args)
-		if len(args) == 1 {
-			viper.Set("migration_name", args[0])
-			cfg.MigrationName = args[0]
+	if opts.useState {
+		requiredFields = []string{"schema_file_path", "state_file_path"}
+	}
+	patch := opts.format == diffFormatJSONPatch
+	if opts.format != diffFormatMigrations && opts.format != diffFormatJS && !patch {
+		return fmt.Errorf("invalid format %q (want %s, %s or %s)", opts.format, diffFormatMigrations, diffFormatJS, diffFormatJSONPatch)
+	}
+	if opts.allDatabases {
+		if patch {
+			return fmt.Errorf("--all-databases only generates migrations")
+		}
+		requiredFields = []string{"mongo_uri", "schema_file_path"}
+	}
+	if configOf(cmd).output.json() && (opts.allDatabases || tenantMode(cmd)) {
+		return fmt.Errorf("--output %s reports the migrations of a single database", outputJSON)
+	}
+	tenants := tenantMode(cmd)
+	if tenants {
+		if !opts.dryRun || patch || opts.allDatabases || opts.useState || opts.outDir != "" {
+			return fmt.Errorf("with tenants, diff only prints the migrations of each database with --dry_run; " +
+				"generate the shared migrations against one database with --database_name")
 		}
-		requiredFields = append(requiredFields, "migration_dir", "migration_name")
+		requiredFields = withoutDatabaseName(requiredFields)
+	}
+	if !opts.dryRun && !patch {
+		requiredFields = append(requiredFields, "migration_dir")
 	}
 
-	if err := validateConfig(requiredFields); err != nil {
+	if err := validateConfig(cmd, requiredFields); err != nil {
 		return err
 	}
 
+	collections, migrationName := splitDiffArgs(cmd, args)
+	if patch && opts.outDir != "" {
+		return fmt.Errorf("--out-dir doesn't apply to --format %s", diffFormatJSONPatch)
+	}
+	if !opts.dryRun && !patch && migrationName == "" {
+		return fmt.Errorf("missing required fields: migration_name")
+	}
+	if opts.outDir != "" && !opts.dryRun {
+		return fmt.Errorf("--out-dir requires --dry_run")
+	}
+
+	source := migration.SourceDatabase
+	switch {
+	case opts.useState:
+		source = migration.SourceStateFile
+	case opts.useRemoteState:
+		source = migration.SourceRemoteState
+	}
+
 	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
-		return migration.GenerateMigrationScripts(
-			ctx,
-			logger,
-			config.MongoURI,
-			config.DatabaseName,
-			config.SchemaFilePath,
-			config.MigrationDir,
-			config.MigrationName,
-			dryRun,
-		)
+		diffOptions, err := config.diffOptions()
+		if err != nil {
+			return err
+		}
+		diffOptions.ConfirmDrop = func(collections []string) bool {
+			return opts.dryRun || opts.confirmDrop || confirmDropCollections(cmd, collections)
+		}
+		diffOptions.MigrationName = migrationName
+		diffOptions.UpOnly, diffOptions.DownOnly = opts.upOnly, opts.downOnly
+		diffOptions.Split, diffOptions.AllowEmpty = opts.split, opts.allowEmpty
+		diffOptions.AllowDestructive = opts.allowDestructive
+		diffOptions.Owner, diffOptions.Collections = opts.owner, collections
+		diffOptions.Source, diffOptions.StatePath = source, config.StateFilePath
+		diffOptions.DryRun, diffOptions.PreviewDir = opts.dryRun, opts.outDir
+		diffOptions.Pager = dryRunPager(opts.noPager, config.output.colorEnabled(os.Stdout))
+		if opts.format == diffFormatJS {
+			diffOptions.MigrationFormat = migration.MigrationFormatJS
+		}
+		if config.output.json() {
+			diffOptions.Report = func(report migration.DiffReport) error {
+				return printJSON(cmd.OutOrStdout(), report)
+			}
+		}
+
+		if opts.allDatabases {
+			return migration.GenerateAllDatabasesMigrationScripts(ctx, logger, config.settings, config.MongoURI, diffOptions)
+		}
+
+		if tenants {
+			// Databases are diffed one at a time, their migrations being printed.
+			diffOptions.StatePath, diffOptions.Pager = "", nil
+			return runTenants(ctx, logger, config, cmd.OutOrStdout(), 1,
+				func(ctx context.Context, logger *slog.Logger, settings migration.Settings, database string) error {
+					fmt.Fprintf(cmd.OutOrStdout(), "Database %s:\n", database)
+					return migration.GenerateMigrationScripts(ctx, logger, settings, config.MongoURI, database, diffOptions)
+				})
+		}
+
+		if patch {
+			data, err := migration.GenerateJSONPatch(ctx, logger, config.settings, config.MongoURI, config.DatabaseName, diffOptions)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s\n", data)
+			return nil
+		}
+
+		return migration.GenerateMigrationScripts(ctx, logger, config.settings, config.MongoURI, config.DatabaseName, diffOptions)
 	})
 }
 
-func runFormat(cmd *cobra.Command, _ []string) error {
+// dryRunPager returns the pager showing dry-run migrations on a terminal, in
+// color if enabled, or nil to print them.
+func dryRunPager(disabled, color bool) migration.DryRunPager {
+	if disabled || !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return nil
+	}
+	return func(sections []migration.DryRunSection) error {
+		pages := make([]tui.Section, 0, len(sections))
+		for _, s := range sections {
+			pages = append(pages, tui.Section{Title: s.Title, Lines: s.Lines})
+		}
+		return tui.Page(os.Stdin, os.Stdout, pages, color)
+	}
+}
+
+// confirmDropCollections asks on a terminal whether to drop the collections
+// with their documents.
+func confirmDropCollections(cmd *cobra.Command, collections []string) bool {
+	if !isTerminal(os.Stdin) {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Dropping collections %s needs --confirm-drop-collections\n", strings.Join(collections, ", "))
+		return false
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Drop collections %s with all their documents? [y/N] ", strings.Join(collections, ", "))
+	answer, _ := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	return strings.ToLower(strings.TrimSpace(answer)) == "y"
+}
+
+// diffArgs accepts a migration name, optionally preceded by collections and --.
+func diffArgs(cmd *cobra.Command, args []string) error {
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		return cobra.MaximumNArgs(1)(cmd, args[dash:])
+	}
+	return cobra.MaximumNArgs(1)(cmd, args)
+}
+
+// splitDiffArgs splits the arguments of diff into the collections before --
+// and the migration name.
+func splitDiffArgs(cmd *cobra.Command, args []string) (collections []string, migrationName string) {
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		collections, args = args[:dash], args[dash:]
+	}
+	if len(args) == 1 {
+		migrationName = args[0]
+	}
+	return collections, migrationName
+}
+
+func runFormat(cmd *cobra.Command, opts formatOptions) error {
 	requiredFields := []string{"schema_file_path"}
 
-	if err := validateConfig(requiredFields); err != nil {
+	if err := validateConfig(cmd, requiredFields); err != nil {
 		return err
 	}
 
 	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
-		return migration.FormatSchemaFile(
-			ctx,
-			logger,
-			config.SchemaFilePath,
-			dryRun,
-		)
+		return migration.FormatSchemaFile(ctx, logger, config.settings, config.SchemaFilePath, migration.FormatOptions{
+			Strict:   opts.strict,
+			Validate: opts.validate,
+			Check:    opts.check,
+			To:       opts.to,
+			DryRun:   opts.dryRun,
+		})
 	})
 }
 
-func runInspect(cmd *cobra.Command, _ []string) error {
+func runInspect(cmd *cobra.Command, opts inspectOptions) error {
+	output := configOf(cmd).output
 	requiredFields := []string{"mongo_uri", "database_name"}
-	if !dryRun {
+	if opts.allDatabases {
+		requiredFields = []string{"mongo_uri"}
+	}
+	if !opts.dryRun && opts.query == "" && !output.json() {
 		requiredFields = append(requiredFields, "schema_file_path")
 	}
 
-	if err := validateConfig(requiredFields); err != nil {
+	if err := validateConfig(cmd, requiredFields); err != nil {
 		return err
 	}
 
+	if opts.allDatabases && output.json() {
+		return fmt.Errorf("--output %s prints the schema of a single database", outputJSON)
+	}
+
+	if opts.allDatabases {
+		return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+			if config.AccessFilePath != "" {
+				logger.Warn("Not inspecting users and roles, which belong to a single database", "path", config.AccessFilePath)
+			}
+			return migration.InspectAllDatabases(
+				ctx,
+				logger,
+				config.settings,
+				config.MongoURI,
+				config.readOptions(),
+				config.SchemaFilePath,
+				append(slices.Clone(migration.DefaultExcludedDatabases), opts.exclude...),
+				opts.dryRun,
+			)
+		})
+	}
+
+	var path *query.Path
+	if opts.query != "" {
+		var err error
+		if path, err = query.Compile(opts.query); err != nil {
+			return err
+		}
+	}
+
 	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
-		return migration.InspectCurrentSchema(
+		if path != nil {
+			result, err := migration.QueryCurrentSchema(ctx, logger, config.settings, config.MongoURI, config.DatabaseName, config.readOptions(), path)
+			if err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write(result)
+			return err
+		}
+
+		if config.output.json() {
+			if config.AccessFilePath != "" {
+				logger.Warn("Not inspecting users and roles, which aren't part of the schema printed", "path", config.AccessFilePath)
+			}
+			return migration.WriteCurrentSchema(
+				ctx, logger, config.settings, cmd.OutOrStdout(), config.MongoURI, config.DatabaseName, config.readOptions(), opts.anonymize,
+			)
+		}
+
+		if err := migration.InspectCurrentSchema(
 			ctx,
 			logger,
+			config.settings,
 			config.MongoURI,
 			config.DatabaseName,
+			config.readOptions(),
 			config.SchemaFilePath,
-			dryRun,
+			opts.dryRun,
+			opts.anonymize,
+		); err != nil {
+			return err
+		}
+
+		if config.AccessFilePath == "" {
+			return nil
+		}
+		if opts.anonymize {
+			logger.Warn("Not inspecting users and roles, which aren't anonymized", "path", config.AccessFilePath)
+			return nil
+		}
+		return migration.InspectAccess(
+			ctx, logger, config.settings, config.MongoURI, config.DatabaseName, config.readOptions(), config.AccessFilePath, opts.dryRun,
 		)
 	})
 }
 
+// runWithContext runs fn with the config the command resolved, which ctx,
+// the context of the command, carries.
 func runWithContext(ctx context.Context, fn func(context.Context, *slog.Logger, Config) error) error {
+	config, _ := ctx.Value(configKey{}).(Config)
 	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	logger, err := initLogger(cfg.LogLevel)
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	logger, err := initLogger(config.output.logLevel(config.LogLevel), config.output.logSource())
 	if err != nil {
 		return fmt.Errorf("failed to initialize logger: %w", err)
 	}
 
-	logger.Debug("Starting operation")
+	logger.Debug("Starting operation", "version", version.String())
 
-	err = fn(ctx, logger, cfg)
+	config.settings, err = config.migrationSettings()
 	if err != nil {
+		return err
+	}
+
+	err = fn(ctx, logger, config)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("operation timed out after %s: %w", config.Timeout, err)
+		}
 		return fmt.Errorf("operation failed: %w", err)
 	}
 
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/ltman/mondex/schema"
+	"github.com/spf13/cobra"
+)
+
+func newSchemaSpecCmd() *cobra.Command {
+	var out string
+
+	cmd := &cobra.Command{
+		Use:   "schema-spec",
+		Short: "Print the JSON Schema of the schema file format",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runWithContext(cmd.Context(), func(_ context.Context, logger *slog.Logger, config Config) error {
+				spec, err := json.MarshalIndent(schema.Spec(), "", "  ")
+				if err != nil {
+					return fmt.Errorf("marshalling schema spec: %w", err)
+				}
+				return writeResult(cmd, logger, config, out, append(spec, '\n'))
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&out, "out", "", "Write the JSON Schema to this file instead of stdout")
+
+	return cmd
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ltman/mondex/migration"
+	"github.com/ltman/mondex/schema"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// showOptions are the command-specific options of show.
+type showOptions struct {
+	source string
+}
+
+func newShowCmd() *cobra.Command {
+	var opts showOptions
+
+	cmd := &cobra.Command{
+		Use:               "show <collection>",
+		Short:             "Show a collection's indexes, options and statistics",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeCollections,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runShow(cmd, args[0], opts)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	addReadFlags(cmd.Flags())
+	addSchemaFlags(cmd.Flags())
+	cmd.Flags().StringVar(&opts.source, "source", "", "What to show: file or db (default: db when configured)")
+
+	return cmd
+}
+
+func runShow(cmd *cobra.Command, collection string, opts showOptions) error {
+	source, requiredFields, err := resolveSource(cmd, opts.source, false)
+	if err != nil {
+		return err
+	}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		out := cmd.OutOrStdout()
+
+		if source == sourceFile {
+			declared, err := migration.ReadDeclaredSchema(config.settings, config.SchemaFilePath)
+			if err != nil {
+				return fmt.Errorf("reading declared schema: %w", err)
+			}
+			i := slices.IndexFunc(declared, func(s schema.Schema) bool { return s.Collection == collection })
+			if i < 0 {
+				return fmt.Errorf("collection %s is not declared in %s", collection, config.SchemaFilePath)
+			}
+
+			fmt.Fprintf(out, "Collection: %s (declared)\n", collection)
+			if declared[i].Description != "" {
+				fmt.Fprintf(out, "Description: %s\n", declared[i].Description)
+			}
+			printIndexes(out, declared[i].Indexes, migration.CollectionDetails{})
+			return nil
+		}
+
+		details, err := migration.ReadCollectionDetails(ctx, logger, config.settings, config.MongoURI, config.DatabaseName, config.readOptions(), collection)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Collection:\t%s\n", collection)
+		fmt.Fprintf(w, "Type:\t%s\n", details.Type)
+		if len(details.Options) > 0 {
+			fmt.Fprintf(w, "Options:\t%s\n", extJSON(details.Options))
+		}
+		fmt.Fprintf(w, "Documents:\t%d\n", details.Stats.Count)
+		fmt.Fprintf(w, "Data size:\t%s\n", formatBytes(details.Stats.Size))
+		fmt.Fprintf(w, "Storage size:\t%s\n", formatBytes(details.Stats.StorageSize))
+		fmt.Fprintf(w, "Index size:\t%s\n", formatBytes(details.Stats.TotalIndexSize))
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		printIndexes(out, details.Schema.Indexes, details)
+		return nil
+	})
+}
+
+// printIndexes prints every index with all of its options,
+// plus its size and usage counters when details come from the live database.
+func printIndexes(out io.Writer, indexes []schema.Index, details migration.CollectionDetails) {
+	fmt.Fprintf(out, "\nIndexes (%d):\n", len(indexes))
+
+	for _, index := range indexes {
+		fmt.Fprintf(out, "\n  %s\n", index.Name)
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "    key:\t%s\n", index.KeySpec())
+		for _, option := range index.Options() {
+			fmt.Fprintf(w, "    %s:\t%s\n", option.Key, extJSON(option.Value))
+		}
+		if size, ok := details.Stats.IndexSizes[index.Name]; ok {
+			fmt.Fprintf(w, "    size:\t%s\n", formatBytes(size))
+		}
+		if usage, ok := details.Usage[index.Name]; ok {
+			fmt.Fprintf(w, "    usage:\t%d ops since %s\n", usage.Ops, usage.Since.Format(time.RFC3339))
+		}
+		_ = w.Flush()
+	}
+}
+
+// extJSON renders a BSON value as relaxed extended JSON.
+func extJSON(value any) string {
+	data, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: value}}, false, false)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(string(data), `{"v":`), "}")
+}
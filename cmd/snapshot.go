@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ltman/mondex/migration"
+)
+
+// snapshotOptions are the command-specific options of snapshot.
+type snapshotOptions struct {
+	out string
+}
+
+func newSnapshotCmd() *cobra.Command {
+	var opts snapshotOptions
+
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Export a support bundle of the database and mondex setup",
+		Long: `Export a point-in-time bundle to attach to incident tickets and support requests:
+a gzipped tar archive of the live schema, collection and index statistics, the
+server version and topology, the applied and pending migrations, and the
+effective configuration with secrets redacted.
+
+Parts the user isn't allowed to read are left out and listed in manifest.json.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runSnapshot(cmd, opts)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	addReadFlags(cmd.Flags())
+	addMigrationFlags(cmd.Flags())
+	cmd.Flags().StringVar(&opts.out, "out", "", "Archive to write (default mondex-snapshot-<database>-<time>.tar.gz)")
+
+	return cmd
+}
+
+func runSnapshot(cmd *cobra.Command, opts snapshotOptions) error {
+	requiredFields := []string{"mongo_uri", "database_name"}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		out := opts.out
+		if out == "" {
+			out = fmt.Sprintf("mondex-snapshot-%s-%s.tar.gz", config.DatabaseName, time.Now().UTC().Format("20060102T150405Z"))
+		}
+
+		var configText bytes.Buffer
+		writeConfig(&configText, cmd)
+
+		if err := migration.WriteSnapshot(
+			ctx,
+			logger,
+			config.settings,
+			config.MongoURI,
+			config.DatabaseName,
+			config.readOptions(),
+			migration.SnapshotOptions{MigrationDir: config.MigrationDir, Config: configText.Bytes()},
+			out,
+		); err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), out)
+		return nil
+	})
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ltman/mondex/migration"
+	"github.com/ltman/mondex/schema"
+)
+
+const (
+	sourceFile = "file"
+	sourceDB   = "db"
+	sourceBoth = "both"
+)
+
+// resolveSource picks what a read-only command looks at: the given source, or
+// by default everything that is configured. It returns the required config fields.
+func resolveSource(cmd *cobra.Command, source string, allowBoth bool) (string, []string, error) {
+	if source == "" {
+		config := configOf(cmd)
+		switch {
+		case allowBoth && config.MongoURI != "" && config.DatabaseName != "" && config.SchemaFilePath != "":
+			source = sourceBoth
+		case config.MongoURI != "" && config.DatabaseName != "":
+			source = sourceDB
+		default:
+			source = sourceFile
+		}
+	}
+
+	switch {
+	case source == sourceFile:
+		return source, []string{"schema_file_path"}, nil
+	case source == sourceDB:
+		return source, []string{"mongo_uri", "database_name"}, nil
+	case source == sourceBoth && allowBoth:
+		return source, []string{"mongo_uri", "database_name", "schema_file_path"}, nil
+	case allowBoth:
+		return "", nil, fmt.Errorf("invalid source %q (want %s, %s or %s)", source, sourceFile, sourceDB, sourceBoth)
+	default:
+		return "", nil, fmt.Errorf("invalid source %q (want %s or %s)", source, sourceFile, sourceDB)
+	}
+}
+
+// loadSource reads the declared schema and/or the current schema, depending on the source.
+func loadSource(
+	ctx context.Context,
+	logger *slog.Logger,
+	config Config,
+	source string,
+) (declared, current []schema.Schema, err error) {
+	if source != sourceDB {
+		declared, err = migration.ReadDeclaredSchema(config.settings, config.SchemaFilePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading declared schema: %w", err)
+		}
+	}
+
+	if source != sourceFile {
+		current, err = migration.ReadCurrentSchema(ctx, logger, config.settings, config.MongoURI, config.DatabaseName, config.readOptions())
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading current schema: %w", err)
+		}
+	}
+
+	return declared, current, nil
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/ltman/mondex/migration"
+	"github.com/spf13/cobra"
+)
+
+// squashOptions are the command-specific options of squash.
+type squashOptions struct {
+	through        uint64
+	dryRun         bool
+	rewriteVersion bool
+}
+
+func newSquashCmd() *cobra.Command {
+	var opts squashOptions
+
+	cmd := &cobra.Command{
+		Use:   "squash",
+		Short: "Merge the oldest migrations into a single migration",
+		Long: `Replace the migrations up to --through with a single migration pair creating
+the schema they produce, at the version of the first one, and renumber the
+later migrations to follow it. Only JSON migrations whose commands make up the
+schema, i.e. indexes, search indexes, collections and validators, can be
+squashed.
+
+Databases that applied the squashed migrations must have their recorded
+version renumbered too: --rewrite-version does so for the configured database,
+once per environment with --env. Databases that didn't reach --through yet
+must apply the migrations before they are squashed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runSquash(cmd, opts)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	addMigrationFlags(cmd.Flags())
+	cmd.Flags().Uint64Var(&opts.through, "through", 0, "Last version to squash")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry_run", false, "Show what would be squashed and renumbered without writing files")
+	cmd.Flags().BoolVar(&opts.rewriteVersion, "rewrite-version", false,
+		"Renumber the version recorded in the configured database as the migrations are")
+	_ = cmd.MarkFlagRequired("through")
+
+	return cmd
+}
+
+func runSquash(cmd *cobra.Command, opts squashOptions) error {
+	requiredFields := []string{"migration_dir"}
+	if opts.rewriteVersion {
+		requiredFields = append(requiredFields, "mongo_uri", "database_name")
+	}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		// The database is checked first, so files aren't squashed for a
+		// database that can't follow.
+		if opts.rewriteVersion {
+			if err := migration.CheckSquashable(ctx, logger, config.settings, config.MongoURI, config.DatabaseName, opts.through); err != nil {
+				return err
+			}
+		}
+
+		plan, err := migration.SquashMigrations(ctx, logger, config.settings, config.MigrationDir, opts.through, opts.dryRun)
+		if err != nil {
+			return err
+		}
+
+		verb := "Squashed"
+		if opts.dryRun {
+			verb = "Would squash"
+		}
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "%s %d migration(s) through version %d into version %d\n",
+			verb, plan.Squashed, plan.Through, plan.Version)
+		for _, version := range slices.Sorted(maps.Keys(plan.Renumbered)) {
+			fmt.Fprintf(out, "  %06d -> %06d\n", version, plan.Renumbered[version])
+		}
+
+		if !opts.rewriteVersion || opts.dryRun {
+			return nil
+		}
+		return migration.RenumberAppliedVersion(ctx, logger, config.settings, config.MongoURI, config.DatabaseName, plan,
+			config.applyOptions().Lock)
+	})
+}
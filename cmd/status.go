@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ltman/mondex/migration"
+	"github.com/spf13/cobra"
+)
+
+// statusOptions are the command-specific options of status.
+type statusOptions struct {
+	json bool
+}
+
+func newStatusCmd() *cobra.Command {
+	var opts statusOptions
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show which migrations are applied and which are pending",
+		Long: `List every migration of the migration directory with whether it is applied to
+the database, pending or failed midway (dirty), and when it was applied, from
+the version golang-migrate records and the history of apply.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runStatus(cmd, opts)
+		},
+	}
+
+	addConnectionFlags(cmd.Flags())
+	addMigrationFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print the status as JSON")
+
+	return cmd
+}
+
+func runStatus(cmd *cobra.Command, opts statusOptions) error {
+	opts.json = opts.json || configOf(cmd).output.json()
+
+	requiredFields := []string{"mongo_uri", "database_name", "migration_dir"}
+
+	if err := validateConfig(cmd, requiredFields); err != nil {
+		return err
+	}
+
+	return runWithContext(cmd.Context(), func(ctx context.Context, logger *slog.Logger, config Config) error {
+		statuses, err := migration.ReadStatus(ctx, logger, config.settings, config.MongoURI, config.DatabaseName, config.MigrationDir)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if opts.json {
+			data, err := json.MarshalIndent(statuses, "", "  ")
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(out, "%s\n", data)
+			return err
+		}
+
+		if len(statuses) == 0 {
+			fmt.Fprintln(out, "No migrations found")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range statuses {
+			status := "pending"
+			switch {
+			case s.Dirty:
+				status = "dirty"
+			case s.OutOfOrder:
+				status = "applied out of order"
+			case s.Applied:
+				status = "applied"
+			}
+			name := s.Name
+			if s.Missing {
+				name += " (not in migration_dir)"
+			}
+			appliedAt := "-"
+			if !s.AppliedAt.IsZero() {
+				appliedAt = s.AppliedAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%06d\t%s\t%s\t%s\n", s.Version, name, status, appliedAt)
+		}
+		return w.Flush()
+	})
+}
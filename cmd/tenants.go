@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ltman/mondex/migration"
+)
+
+// tenantMode reports whether the command runs on every tenant database
+// rather than database_name: tenants are configured and --database_name
+// doesn't target a single database.
+func tenantMode(cmd *cobra.Command) bool {
+	return len(configOf(cmd).Tenants.Databases) > 0 && !cmd.Flags().Changed("database_name")
+}
+
+// withoutDatabaseName drops database_name from the required fields, which
+// the tenants replace.
+func withoutDatabaseName(fields []string) []string {
+	var kept []string
+	for _, field := range fields {
+		if field != "database_name" {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
+
+// runTenants runs fn on every tenant database, at the configured
+// concurrency, and prints a summary of the outcomes. It fails when any
+// database failed.
+func runTenants(
+	ctx context.Context,
+	logger *slog.Logger,
+	config Config,
+	out io.Writer,
+	concurrency int,
+	fn func(ctx context.Context, logger *slog.Logger, settings migration.Settings, database string) error,
+) error {
+	results, err := migration.ForEachTenant(ctx, logger, config.settings, config.MongoURI, config.Tenants.Databases, concurrency, fn)
+	if err != nil {
+		return err
+	}
+	return printTenantSummary(out, results)
+}
+
+// printTenantSummary prints how many tenant databases succeeded and the
+// error of each that failed.
+func printTenantSummary(out io.Writer, results []migration.TenantResult) error {
+	var failed []string
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r.Database)
+		}
+	}
+
+	fmt.Fprintf(out, "%d database(s): %d succeeded, %d failed\n", len(results), len(results)-len(failed), len(failed))
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(out, "  %s: %v\n", r.Database, r.Err)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed on database(s) %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
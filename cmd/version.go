@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+
+	"github.com/ltman/mondex/version"
+	"github.com/spf13/cobra"
+)
+
+func newVersionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the mondex version and build metadata",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			info := version.Get()
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "mondex %s\n", info.Version)
+			fmt.Fprintf(out, "  commit:        %s\n", cmp.Or(info.Commit, "unknown"))
+			fmt.Fprintf(out, "  built:         %s\n", cmp.Or(info.Date, "unknown"))
+			fmt.Fprintf(out, "  go:            %s\n", info.GoVersion)
+			fmt.Fprintf(out, "  mongo-driver:  %s\n", info.DriverVersion)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,91 @@
+// Package codegen generates source code from the declared schema.
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// Go writes a Go file declaring a typed constant for every collection and
+// index name of the schemas.
+func Go(w io.Writer, packageName string, schemas []schema.Schema) error {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by mondex codegen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", packageName)
+	buf.WriteString("// CollectionName is the name of a MongoDB collection.\n")
+	buf.WriteString("type CollectionName string\n\n")
+	buf.WriteString("// IndexName is the name of a MongoDB index.\n")
+	buf.WriteString("type IndexName string\n\n")
+
+	used := make(map[string]bool)
+
+	buf.WriteString("// Collections.\nconst (\n")
+	for _, s := range schemas {
+		fmt.Fprintf(&buf, "%s CollectionName = %s\n", unique(used, "Collection"+exportedName(s.Collection)), strconv.Quote(s.Collection))
+	}
+	buf.WriteString(")\n")
+
+	for _, s := range schemas {
+		if len(s.Indexes) == 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "\n// Indexes of %s.\nconst (\n", s.Collection)
+		for _, index := range s.Indexes {
+			name := unique(used, "Index"+exportedName(s.Collection)+exportedName(index.Name))
+			fmt.Fprintf(&buf, "%s IndexName = %s\n", name, strconv.Quote(index.Name))
+		}
+		buf.WriteString(")\n")
+	}
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated code: %w", err)
+	}
+	_, err = w.Write(source)
+	return err
+}
+
+// exportedName converts a collection or index name to an exported Go
+// identifier part, e.g. "user_id_1" becomes "UserID1".
+func exportedName(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var sb strings.Builder
+	for _, word := range words {
+		if upper := strings.ToUpper(word); commonInitialisms[upper] {
+			sb.WriteString(upper)
+			continue
+		}
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		sb.WriteString(string(runes))
+	}
+	if sb.Len() == 0 {
+		return "X"
+	}
+	return sb.String()
+}
+
+// commonInitialisms are written in upper case, following Go naming conventions.
+var commonInitialisms = map[string]bool{
+	"ID": true, "URL": true, "URI": true, "API": true, "IP": true, "TTL": true, "UUID": true, "JSON": true,
+}
+
+// unique returns name, or name with a numeric suffix when it is already taken.
+func unique(used map[string]bool, name string) string {
+	candidate := name
+	for i := 2; used[candidate]; i++ {
+		candidate = name + strconv.Itoa(i)
+	}
+	used[candidate] = true
+	return candidate
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// ReadAccess reads the users of the database with the roles granted to them,
+// and the custom roles defined in it with their privileges.
+func ReadAccess(ctx context.Context, db *mongo.Database) (schema.Access, error) {
+	var users struct {
+		Users []schema.User `bson:"users"`
+	}
+	if err := db.RunCommand(ctx, bson.D{{Key: "usersInfo", Value: 1}}).Decode(&users); err != nil {
+		return schema.Access{}, fmt.Errorf("running usersInfo: %w", err)
+	}
+
+	var roles struct {
+		Roles []schema.Role `bson:"roles"`
+	}
+	command := bson.D{{Key: "rolesInfo", Value: 1}, {Key: "showPrivileges", Value: true}}
+	if err := db.RunCommand(ctx, command).Decode(&roles); err != nil {
+		return schema.Access{}, fmt.Errorf("running rolesInfo: %w", err)
+	}
+
+	return schema.Access{Users: users.Users, Roles: roles.Roles}.Canonical(db.Name()), nil
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ConnectionOptions are client options kept outside the URI, such as file
+// paths and credentials, which take precedence over those of the URI.
+type ConnectionOptions struct {
+	// TLSCAFile trusts the certificate authorities of the PEM file, and
+	// TLSCertificateKeyFile presents the client certificate and private key
+	// of the PEM file, decrypted with TLSCertificateKeyFilePassword. Either
+	// enables TLS.
+	TLSCAFile                     string
+	TLSCertificateKeyFile         string
+	TLSCertificateKeyFilePassword string
+
+	// AuthMechanism is e.g. "SCRAM-SHA-256", "MONGODB-X509" or "MONGODB-AWS",
+	// the latter reading credentials from the AWS environment, profile or
+	// instance role when Username is unset.
+	AuthMechanism           string
+	AuthMechanismProperties map[string]string
+	AuthSource              string
+	Username                string
+	// Password is read from PasswordFile when set, e.g. a mounted secret.
+	Password     string
+	PasswordFile string
+
+	// ServerSelectionTimeout bounds waiting for a suitable server for each
+	// operation; zero keeps the default.
+	ServerSelectionTimeout time.Duration
+	AppName                string
+	// ConnectTimeout bounds waiting for a server to answer when connecting,
+	// DefaultConnectTimeout when zero.
+	ConnectTimeout time.Duration
+}
+
+// connectTimeout returns how long connections wait for a server to answer.
+func (o ConnectionOptions) connectTimeout() time.Duration {
+	return cmp.Or(o.ConnectTimeout, DefaultConnectTimeout)
+}
+
+// Check reports options that can't be applied, e.g. unreadable files.
+func (o ConnectionOptions) Check() error {
+	_, err := o.apply(options.Client())
+	return err
+}
+
+// apply sets the options on opts, returning them.
+func (o ConnectionOptions) apply(opts *options.ClientOptions) (*options.ClientOptions, error) {
+	if o.TLSCAFile != "" || o.TLSCertificateKeyFile != "" {
+		tlsOptions := map[string]interface{}{}
+		if o.TLSCAFile != "" {
+			tlsOptions["tlsCAFile"] = o.TLSCAFile
+		}
+		if o.TLSCertificateKeyFile != "" {
+			tlsOptions["tlsCertificateKeyFile"] = o.TLSCertificateKeyFile
+			tlsOptions["tlsCertificateKeyFilePassword"] = o.TLSCertificateKeyFilePassword
+		}
+		tlsConfig, err := options.BuildTLSConfig(tlsOptions)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS files: %w", err)
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	if o.AuthMechanism != "" || o.Username != "" || o.PasswordFile != "" {
+		credential := options.Credential{}
+		if opts.Auth != nil {
+			credential = *opts.Auth
+		}
+		if o.AuthMechanism != "" {
+			credential.AuthMechanism = o.AuthMechanism
+		}
+		if len(o.AuthMechanismProperties) > 0 {
+			credential.AuthMechanismProperties = o.AuthMechanismProperties
+		}
+		if o.AuthSource != "" {
+			credential.AuthSource = o.AuthSource
+		}
+		if o.Username != "" {
+			credential.Username = o.Username
+		}
+		password := o.Password
+		if o.PasswordFile != "" {
+			data, err := os.ReadFile(o.PasswordFile)
+			if err != nil {
+				return nil, fmt.Errorf("reading password file: %w", err)
+			}
+			password = strings.TrimRight(string(data), "\r\n")
+		}
+		if password != "" {
+			credential.Password, credential.PasswordSet = password, true
+		}
+		opts.SetAuth(credential)
+	}
+
+	if o.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(o.ServerSelectionTimeout)
+	}
+	if o.AppName != "" {
+		opts.SetAppName(o.AppName)
+	}
+	return opts, nil
+}
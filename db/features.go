@@ -0,0 +1,24 @@
+package db
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ColumnstoreSupported reports whether the cluster can build columnstore
+// indexes, which only some Atlas clusters enable through a feature flag.
+func ColumnstoreSupported(ctx context.Context, client *mongo.Client) bool {
+	var result struct {
+		Flag struct {
+			Value bool `bson:"value"`
+		} `bson:"featureFlagColumnstoreIndexes"`
+	}
+	command := bson.D{{Key: "getParameter", Value: 1}, {Key: "featureFlagColumnstoreIndexes", Value: 1}}
+	if err := client.Database("admin").RunCommand(ctx, command).Decode(&result); err != nil {
+		// Servers without the flag reject the parameter as unknown.
+		return false
+	}
+	return result.Flag.Value
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// HistoryCollection records every migration run by apply, with its timing.
+const HistoryCollection = "mondex_history"
+
+// MigrationRun is one run of a migration.
+type MigrationRun struct {
+	Version    uint64       `bson:"version"`
+	Name       string       `bson:"name"`
+	StartedAt  time.Time    `bson:"startedAt"`
+	FinishedAt time.Time    `bson:"finishedAt"`
+	DurationMS int64        `bson:"durationMs"`
+	Commands   []CommandRun `bson:"commands"`
+	// AppliedBy identifies who ran apply, as user@host.
+	AppliedBy string `bson:"appliedBy"`
+	// Error is set when the migration failed.
+	Error string `bson:"error,omitempty"`
+	// Down is set when the down migration ran, rolling the version back.
+	Down bool `bson:"down,omitempty"`
+}
+
+// CommandRun is one command of a migration run.
+type CommandRun struct {
+	Command    string    `bson:"command"`
+	Collection string    `bson:"collection"`
+	Indexes    []string  `bson:"indexes,omitempty"`
+	StartedAt  time.Time `bson:"startedAt"`
+	DurationMS int64     `bson:"durationMs"`
+	Error      string    `bson:"error,omitempty"`
+}
+
+// RecordMigrationRun adds a migration run to the history.
+func RecordMigrationRun(ctx context.Context, db *mongo.Database, run MigrationRun) error {
+	if _, err := db.Collection(HistoryCollection).InsertOne(ctx, run); err != nil {
+		return fmt.Errorf("recording migration run: %w", err)
+	}
+	return nil
+}
+
+// MigrationRuns returns the history of migration runs, oldest first.
+func MigrationRuns(ctx context.Context, db *mongo.Database) ([]MigrationRun, error) {
+	cursor, err := db.Collection(HistoryCollection).Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "startedAt", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("listing migration runs: %w", err)
+	}
+
+	var runs []MigrationRun
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, fmt.Errorf("reading migration runs: %w", err)
+	}
+	return runs, nil
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LockCollection holds the advisory lock of golang-migrate, which mondex
+// shares so it excludes other golang-migrate clients of the database too.
+const LockCollection = "migrate_advisory_lock"
+
+// lockIndexName is the unique index that lets a single lock document exist,
+// named as golang-migrate names it.
+const lockIndexName = "lock_unique_key"
+
+// lockKey is the value of the single lock document.
+const lockKey = 0
+
+// MigrationLock is the advisory lock document, identifying the process that
+// holds it.
+type MigrationLock struct {
+	Key       int       `bson:"locking_key"`
+	Pid       int       `bson:"pid"`
+	Hostname  string    `bson:"hostname"`
+	Holder    string    `bson:"holder,omitempty"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// String identifies the holder, e.g. "deploy@web-1 (pid 42)".
+func (l MigrationLock) String() string {
+	holder := l.Holder
+	if holder == "" {
+		holder = l.Hostname
+	}
+	return fmt.Sprintf("%s (pid %d)", holder, l.Pid)
+}
+
+// EnsureLockIndex creates the unique index the advisory lock relies on.
+func EnsureLockIndex(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection(LockCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "locking_key", Value: -1}},
+		Options: options.Index().SetUnique(true).SetName(lockIndexName),
+	})
+	if err != nil {
+		return fmt.Errorf("creating lock index: %w", err)
+	}
+	return nil
+}
+
+// TryLock takes the advisory lock, reporting false when another process
+// holds it.
+func TryLock(ctx context.Context, db *mongo.Database, lock MigrationLock) (bool, error) {
+	lock.Key = lockKey
+	if _, err := db.Collection(LockCollection).InsertOne(ctx, lock); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("taking lock: %w", err)
+	}
+	return true, nil
+}
+
+// LockHolder returns the current lock, or nil when it's free.
+func LockHolder(ctx context.Context, db *mongo.Database) (*MigrationLock, error) {
+	var lock MigrationLock
+	err := db.Collection(LockCollection).FindOne(ctx, bson.D{{Key: "locking_key", Value: lockKey}}).Decode(&lock)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading lock: %w", err)
+	}
+	return &lock, nil
+}
+
+// Unlock releases the advisory lock.
+func Unlock(ctx context.Context, db *mongo.Database) error {
+	if _, err := db.Collection(LockCollection).DeleteMany(ctx, bson.D{{Key: "locking_key", Value: lockKey}}); err != nil {
+		return fmt.Errorf("releasing lock: %w", err)
+	}
+	return nil
+}
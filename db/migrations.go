@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MigrationsCollection is where golang-migrate records the applied version.
+const MigrationsCollection = "schema_migrations"
+
+// NilVersion is returned by MigrationVersion when no migration was applied.
+const NilVersion = -1
+
+// MigrationVersion reads the version recorded by golang-migrate and whether
+// the last migration failed midway.
+func MigrationVersion(ctx context.Context, db *mongo.Database) (version int, dirty bool, err error) {
+	var info struct {
+		Version int  `bson:"version"`
+		Dirty   bool `bson:"dirty"`
+	}
+
+	err = db.Collection(MigrationsCollection).FindOne(ctx, bson.D{}).Decode(&info)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return NilVersion, false, nil
+	case err != nil:
+		return 0, false, fmt.Errorf("reading migration version: %w", err)
+	}
+	return info.Version, info.Dirty, nil
+}
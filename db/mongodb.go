@@ -2,62 +2,435 @@ package db
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ltman/mondex/schema"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-const (
-	mongoConnectTimeout = 10 * time.Second
-)
+// DefaultConnectTimeout bounds connecting to the deployment unless
+// ConnectionOptions set otherwise.
+const DefaultConnectTimeout = 10 * time.Second
+
+// ReadOptions configures how the current schema is read from MongoDB.
+type ReadOptions struct {
+	// Preference is a read preference mode, e.g. "secondaryPreferred".
+	Preference string
+	// Concern is a read concern level, e.g. "majority".
+	Concern string
+	// Concurrency is how many collections are read at a time, one when
+	// unset.
+	Concurrency int
+	// SearchIndexes also reads the Atlas Search indexes of the collections,
+	// which most deployments other than Atlas don't support.
+	SearchIndexes bool
+}
+
+// DatabaseOptions converts the read options into driver database options.
+func (o ReadOptions) DatabaseOptions() (*options.DatabaseOptions, error) {
+	opts := options.Database()
+
+	if o.Preference != "" {
+		mode, err := readpref.ModeFromString(o.Preference)
+		if err != nil {
+			return nil, fmt.Errorf("invalid read preference %q: %w", o.Preference, err)
+		}
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid read preference %q: %w", o.Preference, err)
+		}
+		opts.SetReadPreference(rp)
+	}
+
+	if o.Concern != "" {
+		opts.SetReadConcern(&readconcern.ReadConcern{Level: o.Concern})
+	}
+
+	return opts, nil
+}
 
-func ConnectToMongoDB(ctx context.Context, uri string) (*mongo.Client, error) {
-	ctx, cancel := context.WithTimeout(ctx, mongoConnectTimeout)
+// WriteOptions configures the write concern attached to migration commands.
+type WriteOptions struct {
+	// W is the number of acknowledging members or a tag such as "majority".
+	W string
+	// Journal requests acknowledgement that the write reached the on-disk journal.
+	Journal *bool
+	// WTimeout limits how long the server waits for the write concern.
+	WTimeout time.Duration
+}
+
+// Document renders the write concern as a command sub-document,
+// or returns nil when no write concern is configured.
+func (o WriteOptions) Document() bson.D {
+	var doc bson.D
+
+	if o.W != "" {
+		if n, err := strconv.Atoi(o.W); err == nil {
+			doc = append(doc, bson.E{Key: "w", Value: n})
+		} else {
+			doc = append(doc, bson.E{Key: "w", Value: o.W})
+		}
+	}
+	if o.Journal != nil {
+		doc = append(doc, bson.E{Key: "j", Value: *o.Journal})
+	}
+	if o.WTimeout > 0 {
+		doc = append(doc, bson.E{Key: "wtimeout", Value: o.WTimeout.Milliseconds()})
+	}
+
+	return doc
+}
+
+// Disconnect disconnects the client, even once ctx is canceled.
+func Disconnect(ctx context.Context, client *mongo.Client) error {
+	return client.Disconnect(context.WithoutCancel(ctx))
+}
+
+// ConnectToMongoDB connects to the deployment at uri with the connection
+// options.
+func ConnectToMongoDB(ctx context.Context, uri string, connection ConnectionOptions) (*mongo.Client, error) {
+	opts, err := connection.apply(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	if opts.ConnectTimeout == nil {
+		opts.SetConnectTimeout(connection.connectTimeout())
+	}
+	return connect(ctx, opts, connection.connectTimeout())
+}
+
+// connect connects with the options and pings the deployment, so an
+// unreachable server fails here, within the connect timeout, rather than on
+// the first command. Canceling ctx aborts at once.
+func connect(ctx context.Context, opts *options.ClientOptions, connectTimeout time.Duration) (*mongo.Client, error) {
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, connectTimeout)
 	defer cancel()
-	return mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err := client.Ping(pingCtx, nil); err != nil {
+		_ = client.Disconnect(context.WithoutCancel(ctx))
+		switch {
+		case ctx.Err() != nil:
+			return nil, fmt.Errorf("connecting canceled: %w", ctx.Err())
+		case errors.Is(pingCtx.Err(), context.DeadlineExceeded):
+			return nil, fmt.Errorf("no server answered within %s: %w", connectTimeout, err)
+		}
+		return nil, fmt.Errorf("pinging server: %w", err)
+	}
+	return client, nil
+}
+
+// derivedClientOptions builds options for connecting to specific hosts of the
+// deployment, reusing the credentials and TLS settings of the cluster URI and
+// connection options.
+// The options are built from scratch because a direct connection can't be
+// derived from an SRV URI.
+func derivedClientOptions(uri string, connection ConnectionOptions, hosts []string) *options.ClientOptions {
+	base := options.Client().ApplyURI(uri)
+	if applied, err := connection.apply(base); err == nil {
+		// A failure was already reported connecting to the cluster.
+		base = applied
+	}
+
+	opts := options.Client().SetHosts(hosts)
+	opts.Auth = base.Auth
+	opts.TLSConfig = base.TLSConfig
+	opts.AppName = base.AppName
+	opts.ServerSelectionTimeout = base.ServerSelectionTimeout
+	opts.ConnectTimeout = base.ConnectTimeout
+	if opts.ConnectTimeout == nil {
+		opts.SetConnectTimeout(connection.connectTimeout())
+	}
+
+	return opts
+}
+
+// ListDatabases returns the names of the databases of the deployment.
+func ListDatabases(ctx context.Context, client *mongo.Client) ([]string, error) {
+	names, err := client.ListDatabaseNames(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("listing databases: %w", err)
+	}
+	return names, nil
+}
+
+// OpenDatabase returns a database handle configured with the given read options.
+func OpenDatabase(client *mongo.Client, name string, readOptions ReadOptions) (*mongo.Database, error) {
+	opts, err := readOptions.DatabaseOptions()
+	if err != nil {
+		return nil, err
+	}
+	return client.Database(name, opts), nil
 }
 
-func ReadCurrentSchema(ctx context.Context, db *mongo.Database) ([]schema.Schema, error) {
-	collections, err := db.ListCollectionNames(ctx, bson.M{})
+// ReadCurrentSchema reads the indexes and document validation of every
+// collection of the database, up to concurrency collections at a time. The
+// collections come in name order whatever order they are read in.
+func ReadCurrentSchema(ctx context.Context, db *mongo.Database, concurrency int) ([]schema.Schema, error) {
+	collections, err := listCollections(ctx, db)
 	if err != nil {
 		return nil, err
 	}
 
-	schemas := make([]schema.Schema, 0)
+	// The first collection failing stops reading the others.
+	readCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	for _, collectionName := range collections {
-		collection := db.Collection(collectionName)
-		cursor, err := collection.Indexes().List(ctx)
-		if err != nil {
-			return nil, err
+	schemas := make([]schema.Schema, len(collections))
+	errs := make([]error, len(collections))
+	semaphore := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, specification := range collections {
+		semaphore <- struct{}{}
+		if readCtx.Err() != nil {
+			break
 		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			if schemas[i], errs[i] = readCollection(readCtx, db, specification); errs[i] != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
 
-		var collectionIndexes []schema.Index
-		if err := cursor.All(ctx, &collectionIndexes); err != nil {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// Collections canceled because another failed report that failure.
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
 			return nil, err
 		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return schemas, nil
+}
+
+// SchemaIterator reads the schema of a database one collection at a time, so
+// large databases can be processed incrementally:
+//
+//	it, err := db.NewSchemaIterator(ctx, database)
+//	...
+//	for it.Next(ctx) {
+//		process(it.Schema())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type SchemaIterator struct {
+	db          *mongo.Database
+	collections []mongo.CollectionSpecification
+	current     schema.Schema
+	err         error
+}
 
-		for i, indexes := range collectionIndexes {
-			// NOTE: The index is a fts index,
-			// MongoDB doesn't return what fields are used in the key,
-			// So we will do ourselves.
-			if len(indexes.Weights) > 0 {
-				var key bson.D
-				for _, weight := range indexes.Weights {
-					key = append(key, bson.E{Key: weight.Key, Value: "text"})
-				}
-				collectionIndexes[i].Key = key
+// NewSchemaIterator lists the collections of the database, in name order.
+// Their indexes are read as Next reaches them.
+func NewSchemaIterator(ctx context.Context, db *mongo.Database) (*SchemaIterator, error) {
+	collections, err := listCollections(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return &SchemaIterator{db: db, collections: collections}, nil
+}
+
+// listCollections lists the collections of the database, in name order.
+func listCollections(ctx context.Context, db *mongo.Database) ([]mongo.CollectionSpecification, error) {
+	specifications, err := db.ListCollectionSpecifications(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	collections := make([]mongo.CollectionSpecification, 0, len(specifications))
+	for _, specification := range specifications {
+		collections = append(collections, *specification)
+	}
+	slices.SortFunc(collections, func(a, b mongo.CollectionSpecification) int { return strings.Compare(a.Name, b.Name) })
+	return collections, nil
+}
+
+// Next reads the indexes of the next collection. It returns false once every
+// collection was read, or on an error reported by Err, including the context
+// being canceled between collections.
+func (it *SchemaIterator) Next(ctx context.Context) bool {
+	if it.err != nil || len(it.collections) == 0 {
+		return false
+	}
+	if it.err = ctx.Err(); it.err != nil {
+		return false
+	}
+
+	specification := it.collections[0]
+	it.collections = it.collections[1:]
+	it.current, it.err = readCollection(ctx, it.db, specification)
+	return it.err == nil
+}
+
+// readCollection reads the indexes, document validation and options of the
+// collection.
+func readCollection(ctx context.Context, db *mongo.Database, specification mongo.CollectionSpecification) (schema.Schema, error) {
+	name := specification.Name
+	indexes, err := readIndexes(ctx, db.Collection(name))
+	if err != nil {
+		return schema.Schema{}, fmt.Errorf("reading indexes of %s: %w", name, err)
+	}
+	current := schema.Schema{Collection: name, Indexes: indexes}
+	if current, err = withValidation(current, specification.Options); err != nil {
+		return schema.Schema{}, fmt.Errorf("reading validator of %s: %w", name, err)
+	}
+	if current.Options, err = collectionOptions(specification.Options); err != nil {
+		return schema.Schema{}, fmt.Errorf("reading options of %s: %w", name, err)
+	}
+	return current, nil
+}
+
+// collectionOptions reads the options the collection was created with from
+// its options as listCollections reports them, nil when it has none.
+func collectionOptions(raw bson.Raw) (*schema.CollectionOptions, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var created schema.CollectionOptions
+	if err := bson.Unmarshal(raw, &created); err != nil {
+		return nil, err
+	}
+	if created.IsZero() {
+		return nil, nil
+	}
+	return &created, nil
+}
+
+// withValidation sets the document validation of the collection from its
+// options as listCollections reports them, the validator as relaxed
+// extended JSON, as schema files declare it.
+func withValidation(s schema.Schema, collectionOptions bson.Raw) (schema.Schema, error) {
+	if len(collectionOptions) == 0 {
+		return s, nil
+	}
+	var validation struct {
+		Validator        bson.Raw `bson:"validator"`
+		ValidationLevel  string   `bson:"validationLevel"`
+		ValidationAction string   `bson:"validationAction"`
+	}
+	if err := bson.Unmarshal(collectionOptions, &validation); err != nil {
+		return s, err
+	}
+	if len(validation.Validator) == 0 {
+		return s, nil
+	}
+
+	data, err := bson.MarshalExtJSON(validation.Validator, false, false)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s.Validator); err != nil {
+		return s, err
+	}
+	s.ValidationLevel, s.ValidationAction = validation.ValidationLevel, validation.ValidationAction
+	return s, nil
+}
+
+// Schema returns the collection read by the last call to Next.
+func (it *SchemaIterator) Schema() schema.Schema {
+	return it.current
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *SchemaIterator) Err() error {
+	return it.err
+}
+
+// readIndexes reads the indexes of the collection, including those still
+// being built, which are marked as such.
+func readIndexes(ctx context.Context, collection *mongo.Collection) ([]schema.Index, error) {
+	collectionIndexes, err := listIndexesWithBuilds(ctx, collection)
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) {
+		// Servers before 4.4 reject includeBuildUUIDs and only list the
+		// indexes already built.
+		collectionIndexes, err = listIndexes(ctx, collection)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, indexes := range collectionIndexes {
+		// NOTE: The index is a fts index,
+		// MongoDB doesn't return what fields are used in the key,
+		// So we will do ourselves.
+		if len(indexes.Weights) > 0 {
+			var key bson.D
+			for _, weight := range indexes.Weights {
+				key = append(key, bson.E{Key: weight.Key, Value: "text"})
 			}
+			collectionIndexes[i].Key = key
 		}
+	}
+
+	return collectionIndexes, nil
+}
+
+func listIndexes(ctx context.Context, collection *mongo.Collection) ([]schema.Index, error) {
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-		schemas = append(schemas, schema.Schema{
-			Collection: collectionName,
-			Indexes:    collectionIndexes,
-		})
+	var indexes []schema.Index
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return nil, err
 	}
+	return indexes, nil
+}
 
-	return schemas, nil
+// listIndexesWithBuilds runs listIndexes with includeBuildUUIDs, which reports
+// the indexes still being built as {spec, buildUUID} instead of leaving them
+// out.
+func listIndexesWithBuilds(ctx context.Context, collection *mongo.Collection) ([]schema.Index, error) {
+	command := bson.D{{Key: "listIndexes", Value: collection.Name()}, {Key: "includeBuildUUIDs", Value: true}}
+	opts := options.RunCmd().SetReadPreference(collection.Database().ReadPreference())
+	cursor, err := collection.Database().RunCommandCursor(ctx, command, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []bson.Raw
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	indexes := make([]schema.Index, 0, len(entries))
+	for _, entry := range entries {
+		var index schema.Index
+		if _, err := entry.LookupErr("buildUUID"); err == nil {
+			if err := entry.Lookup("spec").Unmarshal(&index); err != nil {
+				return nil, err
+			}
+			index.Building = true
+		} else if err := bson.Unmarshal(entry, &index); err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
 }
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OutOfOrderCollection records the migrations applied ahead of the version
+// golang-migrate tracks, which runs them again when it reaches them otherwise.
+const OutOfOrderCollection = "mondex_out_of_order"
+
+// OutOfOrderMigration is a migration applied with apply --only.
+type OutOfOrderMigration struct {
+	Version   uint64    `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+// OutOfOrderMigrations lists the migrations applied out of order that
+// golang-migrate didn't reach yet.
+func OutOfOrderMigrations(ctx context.Context, db *mongo.Database) ([]OutOfOrderMigration, error) {
+	cursor, err := db.Collection(OutOfOrderCollection).Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("listing migrations applied out of order: %w", err)
+	}
+
+	var migrations []OutOfOrderMigration
+	if err := cursor.All(ctx, &migrations); err != nil {
+		return nil, fmt.Errorf("reading migrations applied out of order: %w", err)
+	}
+	return migrations, nil
+}
+
+// RecordOutOfOrder records a migration applied out of order.
+func RecordOutOfOrder(ctx context.Context, db *mongo.Database, migration OutOfOrderMigration) error {
+	if _, err := db.Collection(OutOfOrderCollection).InsertOne(ctx, migration); err != nil {
+		return fmt.Errorf("recording migration applied out of order: %w", err)
+	}
+	return nil
+}
+
+// ForgetOutOfOrder removes the record of a migration applied out of order,
+// once golang-migrate reached its version.
+func ForgetOutOfOrder(ctx context.Context, db *mongo.Database, version uint64) error {
+	if _, err := db.Collection(OutOfOrderCollection).DeleteOne(ctx, bson.D{{Key: "_id", Value: version}}); err != nil {
+		return fmt.Errorf("removing record of migration applied out of order: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// IndexBuild is an index build in progress as reported by $currentOp.
+type IndexBuild struct {
+	Collection string
+	Indexes    []string
+	// Phase is the server's description of the build stage.
+	Phase string
+	// Done and Total count the documents (or keys) processed in the current phase.
+	Done, Total int64
+	Elapsed     time.Duration
+}
+
+// Percent returns the completion of the current phase, or -1 when unknown.
+func (b IndexBuild) Percent() float64 {
+	if b.Total <= 0 {
+		return -1
+	}
+	return float64(b.Done) / float64(b.Total) * 100
+}
+
+// ETA estimates the remaining time of the current phase, or zero when unknown.
+func (b IndexBuild) ETA() time.Duration {
+	if b.Done <= 0 || b.Total <= b.Done {
+		return 0
+	}
+	return time.Duration(float64(b.Elapsed) * float64(b.Total-b.Done) / float64(b.Done))
+}
+
+// CurrentIndexBuilds lists the index builds running on collections of the database.
+func CurrentIndexBuilds(ctx context.Context, client *mongo.Client, databaseName string) ([]IndexBuild, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$currentOp", Value: bson.D{{Key: "allUsers", Value: true}, {Key: "idleConnections", Value: false}}}},
+		{{Key: "$match", Value: bson.D{
+			{Key: "ns", Value: primitive.Regex{Pattern: "^" + regexp.QuoteMeta(databaseName) + `\.`}},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "command.createIndexes", Value: bson.D{{Key: "$exists", Value: true}}}},
+				bson.D{{Key: "msg", Value: primitive.Regex{Pattern: "^Index Build"}}},
+			}},
+		}}},
+	}
+
+	cursor, err := client.Database("admin").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("running $currentOp: %w", err)
+	}
+
+	var ops []struct {
+		NS       string `bson:"ns"`
+		Msg      string `bson:"msg"`
+		Micros   int64  `bson:"microsecs_running"`
+		Progress struct {
+			Done  int64 `bson:"done"`
+			Total int64 `bson:"total"`
+		} `bson:"progress"`
+		Command struct {
+			Indexes []struct {
+				Name string `bson:"name"`
+			} `bson:"indexes"`
+		} `bson:"command"`
+	}
+	if err := cursor.All(ctx, &ops); err != nil {
+		return nil, fmt.Errorf("decoding $currentOp: %w", err)
+	}
+
+	builds := make([]IndexBuild, 0, len(ops))
+	for _, op := range ops {
+		// Only the operations carrying a progress document describe the build
+		// itself; the createIndexes command waiting on it is reported too.
+		if op.Progress.Total == 0 && op.Msg == "" {
+			continue
+		}
+
+		build := IndexBuild{
+			Collection: strings.TrimPrefix(op.NS, databaseName+"."),
+			Phase:      buildPhase(op.Msg),
+			Done:       op.Progress.Done,
+			Total:      op.Progress.Total,
+			Elapsed:    time.Duration(op.Micros) * time.Microsecond,
+		}
+		for _, index := range op.Command.Indexes {
+			build.Indexes = append(build.Indexes, index.Name)
+		}
+		builds = append(builds, build)
+	}
+
+	return builds, nil
+}
+
+// buildPhase extracts the phase from a currentOp message such as
+// "Index Build: scanning collection Index Build: scanning collection: 1/2 50%".
+func buildPhase(msg string) string {
+	msg = strings.TrimPrefix(msg, "Index Build: ")
+	if i := strings.Index(msg, " Index Build"); i >= 0 {
+		msg = msg[:i]
+	}
+	return msg
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ReplicaSetMembers returns the hosts of the data-bearing members of the
+// replica set the client is connected to, or nil when the deployment isn't a replica set.
+func ReplicaSetMembers(ctx context.Context, client *mongo.Client) ([]string, error) {
+	var hello struct {
+		SetName  string   `bson:"setName"`
+		Hosts    []string `bson:"hosts"`
+		Passives []string `bson:"passives"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return nil, fmt.Errorf("running hello: %w", err)
+	}
+
+	if hello.SetName == "" {
+		return nil, nil
+	}
+
+	return append(hello.Hosts, hello.Passives...), nil
+}
+
+// WaitForIndexes connects to every member directly, with the connection
+// options, and polls listIndexes until all named indexes exist on the
+// collection, or the context is done.
+func WaitForIndexes(
+	ctx context.Context,
+	uri string,
+	connection ConnectionOptions,
+	members []string,
+	databaseName, collectionName string,
+	indexNames []string,
+	interval time.Duration,
+) error {
+	for _, member := range members {
+		if err := waitForMemberIndexes(ctx, uri, connection, member, databaseName, collectionName, indexNames, interval); err != nil {
+			return fmt.Errorf("waiting for indexes on member %s: %w", member, err)
+		}
+	}
+	return nil
+}
+
+func waitForMemberIndexes(
+	ctx context.Context,
+	uri string,
+	connection ConnectionOptions,
+	member string,
+	databaseName, collectionName string,
+	indexNames []string,
+	interval time.Duration,
+) error {
+	client, err := mongo.Connect(ctx, derivedClientOptions(uri, connection, []string{member}).SetDirect(true))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Disconnect(context.Background())
+	}()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+	for {
+		present, err := listIndexNames(ctx, collection)
+		if err != nil {
+			return err
+		}
+
+		if !slices.ContainsFunc(indexNames, func(name string) bool {
+			return !slices.Contains(present, name)
+		}) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func listIndexNames(ctx context.Context, collection *mongo.Collection) ([]string, error) {
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []struct {
+		Name string `bson:"name"`
+	}
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(indexes))
+	for _, index := range indexes {
+		names = append(names, index.Name)
+	}
+	return names, nil
+}
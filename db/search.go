@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// ReadSearchIndexes sets the Atlas Search and Vector Search indexes of the
+// collections of the schema, listed by $listSearchIndexes, which only Atlas
+// and deployments running mongot support.
+func ReadSearchIndexes(ctx context.Context, db *mongo.Database, schemas []schema.Schema) ([]schema.Schema, error) {
+	for i, s := range schemas {
+		indexes, err := readSearchIndexes(ctx, db.Collection(s.Collection))
+		if err != nil {
+			return nil, fmt.Errorf("reading search indexes of %s: %w", s.Collection, err)
+		}
+		schemas[i].SearchIndexes = indexes
+	}
+	return schemas, nil
+}
+
+// readSearchIndexes lists the search indexes of the collection with their
+// latest definition as relaxed extended JSON, as schema files declare it.
+func readSearchIndexes(ctx context.Context, collection *mongo.Collection) ([]schema.SearchIndex, error) {
+	cursor, err := collection.SearchIndexes().List(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	var listed []struct {
+		Name             string   `bson:"name"`
+		Type             string   `bson:"type"`
+		LatestDefinition bson.Raw `bson:"latestDefinition"`
+	}
+	if err := cursor.All(ctx, &listed); err != nil {
+		return nil, err
+	}
+
+	var indexes []schema.SearchIndex
+	for _, l := range listed {
+		index := schema.SearchIndex{Name: l.Name, Type: l.Type}
+		if len(l.LatestDefinition) > 0 {
+			data, err := bson.MarshalExtJSON(l.LatestDefinition, false, false)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(data, &index.Definition); err != nil {
+				return nil, err
+			}
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
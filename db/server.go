@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Topologies reported in ServerInfo.
+const (
+	TopologyStandalone = "standalone"
+	TopologyReplicaSet = "replicaSet"
+	TopologySharded    = "sharded"
+)
+
+// ServerInfo describes the deployment the client is connected to.
+type ServerInfo struct {
+	Version        string   `json:"version"`
+	GitVersion     string   `json:"gitVersion,omitempty"`
+	StorageEngines []string `json:"storageEngines,omitempty"`
+	Topology       string   `json:"topology"`
+	SetName        string   `json:"setName,omitempty"`
+	Hosts          []string `json:"hosts,omitempty"`
+	Primary        string   `json:"primary,omitempty"`
+	Shards         []Shard  `json:"shards,omitempty"`
+	MaxWireVersion int32    `json:"maxWireVersion"`
+	FCV            string   `json:"featureCompatibilityVersion,omitempty"`
+}
+
+// ReadServerInfo returns the version and topology of the deployment. The
+// feature compatibility version and the shards are left out when the user
+// isn't allowed to read them.
+func ReadServerInfo(ctx context.Context, client *mongo.Client) (ServerInfo, error) {
+	admin := client.Database("admin")
+
+	var build struct {
+		Version        string   `bson:"version"`
+		GitVersion     string   `bson:"gitVersion"`
+		StorageEngines []string `bson:"storageEngines"`
+	}
+	if err := admin.RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&build); err != nil {
+		return ServerInfo{}, fmt.Errorf("running buildInfo: %w", err)
+	}
+
+	var hello struct {
+		Msg            string   `bson:"msg"`
+		SetName        string   `bson:"setName"`
+		Hosts          []string `bson:"hosts"`
+		Passives       []string `bson:"passives"`
+		Primary        string   `bson:"primary"`
+		MaxWireVersion int32    `bson:"maxWireVersion"`
+	}
+	if err := admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return ServerInfo{}, fmt.Errorf("running hello: %w", err)
+	}
+
+	info := ServerInfo{
+		Version:        build.Version,
+		GitVersion:     build.GitVersion,
+		StorageEngines: build.StorageEngines,
+		Topology:       TopologyStandalone,
+		MaxWireVersion: hello.MaxWireVersion,
+	}
+	switch {
+	case hello.Msg == "isdbgrid":
+		info.Topology = TopologySharded
+		info.Shards, _ = ListShards(ctx, client)
+	case hello.SetName != "":
+		info.Topology = TopologyReplicaSet
+		info.SetName = hello.SetName
+		info.Hosts = append(hello.Hosts, hello.Passives...)
+		info.Primary = hello.Primary
+	}
+
+	var fcv struct {
+		FeatureCompatibilityVersion struct {
+			Version string `bson:"version"`
+		} `bson:"featureCompatibilityVersion"`
+	}
+	if err := admin.RunCommand(ctx, bson.D{
+		{Key: "getParameter", Value: 1},
+		{Key: "featureCompatibilityVersion", Value: 1},
+	}).Decode(&fcv); err == nil {
+		info.FCV = fcv.FeatureCompatibilityVersion.Version
+	}
+
+	return info, nil
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// namespaceNotFoundCode is returned by listIndexes when the collection doesn't exist.
+const namespaceNotFoundCode = 26
+
+// Shard is a member shard of a sharded cluster as reported by listShards.
+type Shard struct {
+	ID   string `bson:"_id"`
+	Host string `bson:"host"`
+}
+
+// ShardError reports a command that failed or left work undone on specific shards.
+type ShardError struct {
+	// Failures maps shard names to the problem reported for each of them.
+	Failures map[string]string
+}
+
+func (e *ShardError) Error() string {
+	shards := slices.Sorted(maps.Keys(e.Failures))
+	parts := make([]string, 0, len(shards))
+	for _, shard := range shards {
+		parts = append(parts, fmt.Sprintf("%s: %s", shard, e.Failures[shard]))
+	}
+	return fmt.Sprintf("failed on %d shard(s): %s", len(shards), strings.Join(parts, "; "))
+}
+
+// IsMongos reports whether the client is connected to a mongos router.
+func IsMongos(ctx context.Context, client *mongo.Client) (bool, error) {
+	var hello struct {
+		Msg string `bson:"msg"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false, fmt.Errorf("running hello: %w", err)
+	}
+	return hello.Msg == "isdbgrid", nil
+}
+
+// ListShards returns the shards of the cluster the mongos client is connected to.
+func ListShards(ctx context.Context, client *mongo.Client) ([]Shard, error) {
+	var result struct {
+		Shards []Shard `bson:"shards"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "listShards", Value: 1}}).Decode(&result); err != nil {
+		return nil, fmt.Errorf("listing shards: %w", err)
+	}
+	return result.Shards, nil
+}
+
+// ShardFailures inspects the per-shard "raw" section of a mongos command
+// response and returns a ShardError for every shard that didn't succeed,
+// or nil when all shards reported success.
+func ShardFailures(response bson.Raw) *ShardError {
+	raw, ok := response.Lookup("raw").DocumentOK()
+	if !ok {
+		return nil
+	}
+
+	elements, err := raw.Elements()
+	if err != nil {
+		return nil
+	}
+
+	failures := make(map[string]string)
+	for _, element := range elements {
+		var status struct {
+			OK     float64 `bson:"ok"`
+			ErrMsg string  `bson:"errmsg"`
+		}
+		if err := element.Value().Unmarshal(&status); err != nil || status.OK == 1 {
+			continue
+		}
+		if status.ErrMsg == "" {
+			status.ErrMsg = "command failed"
+		}
+		failures[element.Key()] = status.ErrMsg
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+	return &ShardError{Failures: failures}
+}
+
+// VerifyShardIndexes connects to every shard, with the connection options,
+// and checks that all named indexes exist on the collection. Shards that don't
+// hold the collection are skipped.
+func VerifyShardIndexes(
+	ctx context.Context,
+	uri string,
+	connection ConnectionOptions,
+	shards []Shard,
+	databaseName, collectionName string,
+	indexNames []string,
+) error {
+	failures := make(map[string]string)
+	for _, shard := range shards {
+		missing, err := missingShardIndexes(ctx, uri, connection, shard, databaseName, collectionName, indexNames)
+		if err != nil {
+			failures[shard.ID] = err.Error()
+			continue
+		}
+		if len(missing) > 0 {
+			failures[shard.ID] = fmt.Sprintf("missing indexes %s", strings.Join(missing, ", "))
+		}
+	}
+
+	if len(failures) > 0 {
+		return &ShardError{Failures: failures}
+	}
+	return nil
+}
+
+func missingShardIndexes(
+	ctx context.Context,
+	uri string,
+	connection ConnectionOptions,
+	shard Shard,
+	databaseName, collectionName string,
+	indexNames []string,
+) ([]string, error) {
+	client, err := mongo.Connect(ctx, shardClientOptions(uri, connection, shard))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = client.Disconnect(context.Background())
+	}()
+
+	present, err := listIndexNames(ctx, client.Database(databaseName).Collection(collectionName))
+	if err != nil {
+		var commandErr mongo.CommandError
+		if errors.As(err, &commandErr) && commandErr.Code == namespaceNotFoundCode {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return slices.DeleteFunc(slices.Clone(indexNames), func(name string) bool {
+		return slices.Contains(present, name)
+	}), nil
+}
+
+// shardClientOptions parses a listShards host string,
+// either "replicaSet/host1,host2" or a single "host".
+func shardClientOptions(uri string, connection ConnectionOptions, shard Shard) *options.ClientOptions {
+	replicaSet, hosts, found := strings.Cut(shard.Host, "/")
+	if !found {
+		return derivedClientOptions(uri, connection, []string{shard.Host}).SetDirect(true)
+	}
+	return derivedClientOptions(uri, connection, strings.Split(hosts, ",")).SetReplicaSet(replicaSet)
+}
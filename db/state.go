@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// StateCollection stores the schema the applied migrations produce.
+const StateCollection = "mondex_state"
+
+// stateID is the _id of the single document of the state collection.
+const stateID = "schema"
+
+// State is the last known managed schema: what the migrations applied up to
+// Version produce, regardless of changes made to the database out of band.
+type State struct {
+	Version   int             `bson:"version"`
+	Schema    []schema.Schema `bson:"schema"`
+	UpdatedAt time.Time       `bson:"updatedAt"`
+}
+
+// ReadState reads the state recorded by apply, reporting whether there is one.
+func ReadState(ctx context.Context, db *mongo.Database) (State, bool, error) {
+	var state State
+	err := db.Collection(StateCollection).FindOne(ctx, bson.D{{Key: "_id", Value: stateID}}).Decode(&state)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return State{}, false, nil
+	case err != nil:
+		return State{}, false, fmt.Errorf("reading state: %w", err)
+	}
+	return state, true, nil
+}
+
+// WriteState replaces the recorded state.
+func WriteState(ctx context.Context, db *mongo.Database, state State) error {
+	_, err := db.Collection(StateCollection).ReplaceOne(ctx,
+		bson.D{{Key: "_id", Value: stateID}},
+		state,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+	return nil
+}
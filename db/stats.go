@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CollectionStats are the storage statistics of a collection.
+// On sharded clusters the statistics of all shards are summed.
+type CollectionStats struct {
+	Count          int64
+	Size           int64
+	StorageSize    int64
+	TotalIndexSize int64
+	IndexSizes     map[string]int64
+}
+
+// IndexUsage is the usage counter of an index as reported by $indexStats.
+type IndexUsage struct {
+	Ops   int64
+	Since time.Time
+}
+
+// ReadCollectionStats returns the storage statistics of the collection.
+func ReadCollectionStats(ctx context.Context, database *mongo.Database, collection string) (CollectionStats, error) {
+	cursor, err := database.Collection(collection).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$collStats", Value: bson.D{{Key: "storageStats", Value: bson.D{}}}}},
+	})
+	if err != nil {
+		return CollectionStats{}, fmt.Errorf("running $collStats: %w", err)
+	}
+
+	var shards []struct {
+		StorageStats struct {
+			Count          int64            `bson:"count"`
+			Size           int64            `bson:"size"`
+			StorageSize    int64            `bson:"storageSize"`
+			TotalIndexSize int64            `bson:"totalIndexSize"`
+			IndexSizes     map[string]int64 `bson:"indexSizes"`
+		} `bson:"storageStats"`
+	}
+	if err := cursor.All(ctx, &shards); err != nil {
+		return CollectionStats{}, fmt.Errorf("decoding $collStats: %w", err)
+	}
+
+	stats := CollectionStats{IndexSizes: make(map[string]int64)}
+	for _, shard := range shards {
+		stats.Count += shard.StorageStats.Count
+		stats.Size += shard.StorageStats.Size
+		stats.StorageSize += shard.StorageStats.StorageSize
+		stats.TotalIndexSize += shard.StorageStats.TotalIndexSize
+		for name, size := range shard.StorageStats.IndexSizes {
+			stats.IndexSizes[name] += size
+		}
+	}
+	return stats, nil
+}
+
+// IndexSizes returns the on-disk size in bytes of each index of the collection.
+func IndexSizes(ctx context.Context, database *mongo.Database, collection string) (map[string]int64, error) {
+	stats, err := ReadCollectionStats(ctx, database, collection)
+	if err != nil {
+		return nil, err
+	}
+	return stats.IndexSizes, nil
+}
+
+// ReadIndexUsage returns the usage counters of each index of the collection.
+// On sharded clusters the operations of all shards are summed.
+func ReadIndexUsage(ctx context.Context, database *mongo.Database, collection string) (map[string]IndexUsage, error) {
+	cursor, err := database.Collection(collection).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$indexStats", Value: bson.D{}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("running $indexStats: %w", err)
+	}
+
+	var stats []struct {
+		Name     string `bson:"name"`
+		Accesses struct {
+			Ops   int64     `bson:"ops"`
+			Since time.Time `bson:"since"`
+		} `bson:"accesses"`
+	}
+	if err := cursor.All(ctx, &stats); err != nil {
+		return nil, fmt.Errorf("decoding $indexStats: %w", err)
+	}
+
+	usage := make(map[string]IndexUsage, len(stats))
+	for _, s := range stats {
+		u := usage[s.Name]
+		u.Ops += s.Accesses.Ops
+		if u.Since.IsZero() || s.Accesses.Since.Before(u.Since) {
+			u.Since = s.Accesses.Since
+		}
+		usage[s.Name] = u
+	}
+	return usage, nil
+}
+
+// ReadCollectionOptions returns the type and the creation options of the collection
+// as reported by listCollections.
+func ReadCollectionOptions(ctx context.Context, database *mongo.Database, collection string) (string, bson.D, error) {
+	cursor, err := database.ListCollections(ctx, bson.D{{Key: "name", Value: collection}})
+	if err != nil {
+		return "", nil, fmt.Errorf("listing collections: %w", err)
+	}
+
+	var specs []struct {
+		Type    string `bson:"type"`
+		Options bson.D `bson:"options"`
+	}
+	if err := cursor.All(ctx, &specs); err != nil {
+		return "", nil, fmt.Errorf("decoding collections: %w", err)
+	}
+	if len(specs) == 0 {
+		return "", nil, fmt.Errorf("collection %s not found", collection)
+	}
+	return specs[0].Type, specs[0].Options, nil
+}
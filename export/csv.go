@@ -0,0 +1,46 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// CSV writes one row per index, with keys and options as relaxed extended JSON.
+func CSV(w io.Writer, database string, schemas []schema.Schema) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"database", "collection", "index", "keys", "options"}); err != nil {
+		return err
+	}
+
+	for _, s := range schemas {
+		for _, index := range s.Indexes {
+			keys, err := documentJSON(index.Key)
+			if err != nil {
+				return fmt.Errorf("encoding keys of %s.%s: %w", s.Collection, index.Name, err)
+			}
+			options, err := documentJSON(index.WithoutAnnotations().Options())
+			if err != nil {
+				return fmt.Errorf("encoding options of %s.%s: %w", s.Collection, index.Name, err)
+			}
+			if err := cw.Write([]string{database, s.Collection, index.Name, keys, options}); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func documentJSON(doc bson.D) (string, error) {
+	if doc == nil {
+		doc = bson.D{}
+	}
+	data, err := bson.MarshalExtJSON(doc, false, false)
+	return string(data), err
+}
@@ -0,0 +1,73 @@
+package export
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/ltman/mondex/schema"
+)
+
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// badges returns the short markers shown next to an index in diagrams.
+func badges(index schema.Index) []string {
+	var b []string
+	if index.Unique {
+		b = append(b, "UNIQUE")
+	}
+	if index.ExpireAfterSeconds != nil {
+		b = append(b, "TTL "+ttlString(*index.ExpireAfterSeconds))
+	}
+	return b
+}
+
+// Mermaid writes a Mermaid ER diagram with one entity per collection and one
+// attribute per index.
+func Mermaid(w io.Writer, schemas []schema.Schema) error {
+	var sb strings.Builder
+	sb.WriteString("erDiagram\n")
+	for _, s := range schemas {
+		fmt.Fprintf(&sb, "    %s {\n", mermaidIdentifier(s.Collection))
+		for _, index := range s.Indexes {
+			comment := index.KeySpec()
+			if b := badges(index); len(b) > 0 {
+				comment += " " + strings.Join(b, " ")
+			}
+			fmt.Fprintf(&sb, "        index %s %q\n",
+				mermaidIdentifier(index.Name), strings.ReplaceAll(comment, `"`, "'"))
+		}
+		sb.WriteString("    }\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Graphviz writes a DOT graph with one table-shaped node per collection.
+func Graphviz(w io.Writer, schemas []schema.Schema) error {
+	var sb strings.Builder
+	sb.WriteString("digraph schema {\n")
+	sb.WriteString("    rankdir=LR;\n")
+	sb.WriteString("    node [shape=plaintext, fontname=\"Helvetica\"];\n")
+	for _, s := range schemas {
+		fmt.Fprintf(&sb, "    %q [label=<\n", s.Collection)
+		sb.WriteString("        <table border=\"0\" cellborder=\"1\" cellspacing=\"0\" cellpadding=\"4\">\n")
+		fmt.Fprintf(&sb, "        <tr><td colspan=\"3\" bgcolor=\"lightgrey\"><b>%s</b></td></tr>\n", html.EscapeString(s.Collection))
+		for _, index := range s.Indexes {
+			fmt.Fprintf(&sb, "        <tr><td align=\"left\">%s</td><td align=\"left\">%s</td><td>%s</td></tr>\n",
+				html.EscapeString(index.Name),
+				html.EscapeString(index.KeySpec()),
+				html.EscapeString(strings.Join(badges(index), " ")))
+		}
+		sb.WriteString("        </table>\n    >];\n")
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func mermaidIdentifier(name string) string {
+	return nonIdentifier.ReplaceAllString(name, "_")
+}
@@ -0,0 +1,205 @@
+// Package export renders a schema into formats consumed outside mondex,
+// such as documentation, diagrams and inventories.
+package export
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// docsCollection is the view of one collection used by the docs templates.
+type docsCollection struct {
+	Name        string
+	Owner       string
+	Description string
+	Indexes     []docsIndex
+}
+
+type docsIndex struct {
+	Name        string
+	Key         string
+	Unique      bool
+	TTL         string
+	Options     string
+	Description string
+}
+
+type docsPolicy struct {
+	Collection string
+	Index      string
+	Key        string
+	Detail     string
+}
+
+type docsView struct {
+	Title       string
+	Collections []docsCollection
+	TTL         []docsPolicy
+	Unique      []docsPolicy
+}
+
+func newDocsView(title string, schemas []schema.Schema) docsView {
+	view := docsView{Title: title}
+	for _, s := range schemas {
+		collection := docsCollection{Name: s.Collection, Owner: s.Owner, Description: s.Description}
+		for _, index := range s.Indexes {
+			di := docsIndex{
+				Name:        index.Name,
+				Key:         index.KeySpec(),
+				Unique:      index.Unique,
+				Description: index.Description,
+			}
+			var options []string
+			for _, flag := range index.Flags() {
+				if flag != "unique" && !strings.HasPrefix(flag, "ttl=") {
+					options = append(options, flag)
+				}
+			}
+			di.Options = strings.Join(options, ", ")
+
+			if index.ExpireAfterSeconds != nil {
+				di.TTL = ttlString(*index.ExpireAfterSeconds)
+				view.TTL = append(view.TTL, docsPolicy{Collection: s.Collection, Index: index.Name, Key: di.Key, Detail: di.TTL})
+			}
+			if index.Unique {
+				detail := ""
+				if len(index.PartialFilterExpression) > 0 {
+					detail = "partial"
+				}
+				view.Unique = append(view.Unique, docsPolicy{Collection: s.Collection, Index: index.Name, Key: di.Key, Detail: detail})
+			}
+			collection.Indexes = append(collection.Indexes, di)
+		}
+		view.Collections = append(view.Collections, collection)
+	}
+	return view
+}
+
+// ttlString renders a TTL in the largest whole unit, e.g. "7d" or "90s".
+func ttlString(seconds int32) string {
+	units := []struct {
+		suffix string
+		size   int32
+	}{{"d", 86400}, {"h", 3600}, {"m", 60}}
+	for _, unit := range units {
+		if seconds >= unit.size && seconds%unit.size == 0 {
+			return strconv.Itoa(int(seconds/unit.size)) + unit.suffix
+		}
+	}
+	return strconv.Itoa(int(seconds)) + "s"
+}
+
+var markdownTemplate = template.Must(template.New("markdown").Funcs(template.FuncMap{
+	"cell": markdownCell,
+}).Parse(`# {{.Title}}
+
+{{- if .TTL}}
+
+## TTL Policies
+
+| Collection | Index | Key | Expires After |
+|---|---|---|---|
+{{- range .TTL}}
+| {{cell .Collection}} | {{cell .Index}} | {{cell .Key}} | {{.Detail}} |
+{{- end}}
+{{- end}}
+
+{{- if .Unique}}
+
+## Uniqueness Constraints
+
+| Collection | Index | Key | Notes |
+|---|---|---|---|
+{{- range .Unique}}
+| {{cell .Collection}} | {{cell .Index}} | {{cell .Key}} | {{.Detail}} |
+{{- end}}
+{{- end}}
+
+## Collections
+{{range .Collections}}
+### {{.Name}}
+{{if .Owner}}
+Owner: {{.Owner}}
+{{end}}
+{{- if .Description}}
+{{.Description}}
+{{end}}
+| Index | Key | Unique | TTL | Options | Description |
+|---|---|---|---|---|---|
+{{- range .Indexes}}
+| {{cell .Name}} | {{cell .Key}} | {{if .Unique}}yes{{end}} | {{.TTL}} | {{cell .Options}} | {{cell .Description}} |
+{{- end}}
+{{end}}`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+code { font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{- if .TTL}}
+<h2>TTL Policies</h2>
+<table>
+<tr><th>Collection</th><th>Index</th><th>Key</th><th>Expires After</th></tr>
+{{- range .TTL}}
+<tr><td>{{.Collection}}</td><td>{{.Index}}</td><td><code>{{.Key}}</code></td><td>{{.Detail}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Unique}}
+<h2>Uniqueness Constraints</h2>
+<table>
+<tr><th>Collection</th><th>Index</th><th>Key</th><th>Notes</th></tr>
+{{- range .Unique}}
+<tr><td>{{.Collection}}</td><td>{{.Index}}</td><td><code>{{.Key}}</code></td><td>{{.Detail}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+<h2>Collections</h2>
+{{- range .Collections}}
+<h3 id="{{.Name}}">{{.Name}}</h3>
+{{- if .Owner}}
+<p>Owner: {{.Owner}}</p>
+{{- end}}
+{{- if .Description}}
+<p>{{.Description}}</p>
+{{- end}}
+<table>
+<tr><th>Index</th><th>Key</th><th>Unique</th><th>TTL</th><th>Options</th><th>Description</th></tr>
+{{- range .Indexes}}
+<tr><td>{{.Name}}</td><td><code>{{.Key}}</code></td><td>{{if .Unique}}yes{{end}}</td><td>{{.TTL}}</td><td>{{.Options}}</td><td>{{.Description}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+// Markdown writes documentation of the schemas as Markdown.
+func Markdown(w io.Writer, title string, schemas []schema.Schema) error {
+	return markdownTemplate.Execute(w, newDocsView(title, schemas))
+}
+
+// HTML writes documentation of the schemas as a standalone HTML page.
+func HTML(w io.Writer, title string, schemas []schema.Schema) error {
+	return htmlTemplate.Execute(w, newDocsView(title, schemas))
+}
+
+// markdownCell escapes a value for use inside a Markdown table cell.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
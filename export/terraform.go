@@ -0,0 +1,34 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// Terraform writes the schema as Terraform configuration for the
+// mongodbatlas provider. Regular indexes have no mongodbatlas resource, so
+// they are listed in comments and stay managed by mondex.
+func Terraform(w io.Writer, database string, schemas []schema.Schema) error {
+	var sb strings.Builder
+	sb.WriteString("# Generated by mondex export --format terraform.\n\n")
+	sb.WriteString("variable \"project_id\" {\n  type = string\n}\n\n")
+	sb.WriteString("variable \"cluster_name\" {\n  type = string\n}\n\n")
+	fmt.Fprintf(&sb, "locals {\n  database = %q\n}\n", database)
+
+	for _, s := range schemas {
+		fmt.Fprintf(&sb, "\n# %s: regular indexes have no mongodbatlas resource and stay managed by mondex.\n", s.Collection)
+		for _, index := range s.Indexes {
+			line := index.Name + " " + index.KeySpec()
+			if flags := index.Flags(); len(flags) > 0 {
+				line += " " + strings.Join(flags, " ")
+			}
+			fmt.Fprintf(&sb, "#   %s\n", line)
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,232 @@
+package importer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"math"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ltman/mondex/schema"
+)
+
+const (
+	// collectionDirective marks a struct as the model of a collection:
+	//
+	//	//mondex:collection users
+	collectionDirective = "mondex:collection"
+
+	// indexTag declares the indexes a field is part of, separated by ';':
+	//
+	//	Email string `bson:"email" mondexIndex:"email_1,unique"`
+	//
+	// Fields sharing an index name form a compound index in field order.
+	// Options are desc, unique, sparse, hidden, text and ttl=<duration>.
+	indexTag = "mondexIndex"
+)
+
+// GoStructs scans the Go packages in the directories for structs marked with
+// //mondex:collection and returns their collections with the indexes declared
+// by mondexIndex field tags. A directory ending in /... is scanned recursively.
+func GoStructs(dirs []string) ([]schema.Schema, error) {
+	var files []string
+	for _, dir := range dirs {
+		found, err := goFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, found...)
+	}
+
+	var schemas []schema.Schema
+	fset := token.NewFileSet()
+	for _, path := range files {
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+
+		found, err := fileSchemas(fset, file)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, found...)
+	}
+
+	return schemas, nil
+}
+
+func goFiles(dir string) ([]string, error) {
+	root, recursive := strings.CutSuffix(dir, "/...")
+	if root == "" {
+		root = "."
+	}
+
+	var files []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			name := entry.Name()
+			if path != root && (!recursive || name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".go") && !strings.HasSuffix(path, "_test.go") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+func fileSchemas(fset *token.FileSet, file *ast.File) ([]schema.Schema, error) {
+	var schemas []schema.Schema
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			structType, ok := typeSpec.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+
+			doc := typeSpec.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+			collection := collectionName(doc)
+			if collection == "" {
+				continue
+			}
+
+			indexes, err := structIndexes(structType)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", fset.Position(typeSpec.Pos()), typeSpec.Name.Name, err)
+			}
+			schemas = append(schemas, schema.Schema{Collection: collection, Indexes: indexes})
+		}
+	}
+	return schemas, nil
+}
+
+func collectionName(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	for _, comment := range doc.List {
+		text := strings.TrimPrefix(comment.Text, "//")
+		if rest, ok := strings.CutPrefix(text, collectionDirective); ok {
+			return strings.TrimSpace(rest)
+		}
+	}
+	return ""
+}
+
+func structIndexes(structType *ast.StructType) ([]schema.Index, error) {
+	var indexes []schema.Index
+	for _, field := range structType.Fields.List {
+		if field.Tag == nil || len(field.Names) == 0 {
+			continue
+		}
+		rawTag, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			return nil, err
+		}
+		tag := reflect.StructTag(rawTag)
+
+		declaration, ok := tag.Lookup(indexTag)
+		if !ok {
+			continue
+		}
+
+		// Without a bson name the driver lowercases the field name.
+		column := strings.Split(tag.Get("bson"), ",")[0]
+		if column == "" {
+			column = strings.ToLower(field.Names[0].Name)
+		}
+
+		for _, spec := range strings.Split(declaration, ";") {
+			if err := addIndexField(&indexes, column, spec); err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Names[0].Name, err)
+			}
+		}
+	}
+	return indexes, nil
+}
+
+// addIndexField adds the field to the index named in the spec, creating the index
+// on first use.
+func addIndexField(indexes *[]schema.Index, column, spec string) error {
+	parts := strings.Split(spec, ",")
+	name := strings.TrimSpace(parts[0])
+	if name == "" {
+		return fmt.Errorf("missing index name in %q", spec)
+	}
+
+	i := slices.IndexFunc(*indexes, func(index schema.Index) bool { return index.Name == name })
+	if i < 0 {
+		*indexes = append(*indexes, schema.Index{Name: name})
+		i = len(*indexes) - 1
+	}
+	index := &(*indexes)[i]
+
+	var value any = int32(1)
+	for _, option := range parts[1:] {
+		option = strings.TrimSpace(option)
+		key, arg, _ := strings.Cut(option, "=")
+		switch key {
+		case "desc":
+			value = int32(-1)
+		case "text":
+			value = "text"
+		case "unique":
+			index.Unique = true
+		case "sparse":
+			index.Sparse = true
+		case "hidden":
+			index.Hidden = true
+		case "ttl":
+			seconds, err := ttlSeconds(arg)
+			if err != nil {
+				return err
+			}
+			index.ExpireAfterSeconds = &seconds
+		default:
+			return fmt.Errorf("unknown index option %q", option)
+		}
+	}
+
+	index.Key = append(index.Key, bson.E{Key: column, Value: value})
+	return nil
+}
+
+// ttlSeconds parses a TTL given as seconds or as a Go duration.
+func ttlSeconds(s string) (int32, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 32); err == nil {
+		return int32(seconds), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 || d/time.Second > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid ttl %q", s)
+	}
+	return int32(d / time.Second), nil
+}
@@ -0,0 +1,255 @@
+// Package importer converts index declarations kept by other tools into
+// mondex schema entries.
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ltman/mondex/schema"
+)
+
+var (
+	prismaModelRegex = regexp.MustCompile(`^model\s+(\w+)\s*\{`)
+	prismaFieldRegex = regexp.MustCompile(`^(\w+)\s+\S+(.*)$`)
+	prismaMapRegex   = regexp.MustCompile(`@map\(\s*"([^"]*)"`)
+	prismaNameArg    = regexp.MustCompile(`\b(?:map|name)\s*:\s*"([^"]*)"`)
+	prismaSortArg    = regexp.MustCompile(`sort\s*:\s*Desc`)
+	prismaUnique     = regexp.MustCompile(`@unique\b(\([^)]*\))?`)
+)
+
+// prismaModel is the index-relevant part of a Prisma model.
+type prismaModel struct {
+	name       string
+	collection string
+	// columns maps Prisma field names to their database names.
+	columns    map[string]string
+	attributes []string
+	unique     []prismaUniqueField
+}
+
+// prismaUniqueField is a field declared with @unique, with the index name
+// given by map, if any.
+type prismaUniqueField struct {
+	field string
+	name  string
+}
+
+// Prisma reads a Prisma schema and returns the collections of its models with
+// the indexes declared by @@index, @@unique, @@fulltext and field-level @unique.
+// Index names follow Prisma's defaults unless set with map.
+func Prisma(r io.Reader) ([]schema.Schema, error) {
+	models, err := parsePrismaModels(r)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := make([]schema.Schema, 0, len(models))
+	for _, model := range models {
+		s := schema.Schema{Collection: model.collection}
+
+		for _, unique := range model.unique {
+			column := model.column(unique.field)
+			name := unique.name
+			if name == "" {
+				name = model.collection + "_" + column + "_key"
+			}
+			s.Indexes = append(s.Indexes, schema.Index{
+				Key:    bson.D{{Key: column, Value: int32(1)}},
+				Name:   name,
+				Unique: true,
+			})
+		}
+
+		for _, attribute := range model.attributes {
+			index, ok, err := model.index(attribute)
+			if err != nil {
+				return nil, fmt.Errorf("model %s: %w", model.name, err)
+			}
+			if ok {
+				s.Indexes = append(s.Indexes, index)
+			}
+		}
+
+		if len(s.Indexes) > 0 {
+			schemas = append(schemas, s)
+		}
+	}
+
+	return schemas, nil
+}
+
+func parsePrismaModels(r io.Reader) ([]prismaModel, error) {
+	var models []prismaModel
+	var current *prismaModel
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(stripPrismaComment(scanner.Text()))
+		if text == "" {
+			continue
+		}
+
+		if current == nil {
+			if match := prismaModelRegex.FindStringSubmatch(text); match != nil {
+				current = &prismaModel{name: match[1], collection: match[1], columns: make(map[string]string)}
+			}
+			continue
+		}
+
+		switch {
+		case text == "}":
+			models = append(models, *current)
+			current = nil
+		case strings.HasPrefix(text, "@@map"):
+			match := prismaMapRegex.FindStringSubmatch(strings.TrimPrefix(text, "@"))
+			if match == nil {
+				return nil, fmt.Errorf("line %d: malformed @@map", line)
+			}
+			current.collection = match[1]
+		case strings.HasPrefix(text, "@@"):
+			current.attributes = append(current.attributes, text)
+		default:
+			match := prismaFieldRegex.FindStringSubmatch(text)
+			if match == nil {
+				continue
+			}
+			field, attributes := match[1], match[2]
+			if m := prismaMapRegex.FindStringSubmatch(attributes); m != nil {
+				current.columns[field] = m[1]
+			}
+			if m := prismaUnique.FindStringSubmatch(attributes); m != nil {
+				unique := prismaUniqueField{field: field}
+				if name := prismaNameArg.FindStringSubmatch(m[1]); name != nil {
+					unique.name = name[1]
+				}
+				current.unique = append(current.unique, unique)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return nil, fmt.Errorf("model %s is not closed", current.name)
+	}
+
+	return models, nil
+}
+
+// index converts a block attribute into an index; other attributes are skipped.
+func (m prismaModel) index(attribute string) (schema.Index, bool, error) {
+	kind, args, ok := strings.Cut(strings.TrimPrefix(attribute, "@@"), "(")
+	if !ok {
+		return schema.Index{}, false, nil
+	}
+	kind = strings.TrimSpace(kind)
+	if kind != "index" && kind != "unique" && kind != "fulltext" {
+		return schema.Index{}, false, nil
+	}
+
+	open, end := strings.Index(args, "["), matchingBracket(args)
+	if open < 0 || end < 0 {
+		return schema.Index{}, false, fmt.Errorf("malformed @@%s: missing field list", kind)
+	}
+
+	var key bson.D
+	var columns []string
+	for _, field := range splitTopLevel(args[open+1 : end]) {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, options, _ := strings.Cut(field, "(")
+		column := m.column(strings.TrimSpace(name))
+		columns = append(columns, strings.ReplaceAll(column, ".", "_"))
+
+		var value any = int32(1)
+		switch {
+		case kind == "fulltext":
+			value = "text"
+		case prismaSortArg.MatchString(options):
+			value = int32(-1)
+		}
+		key = append(key, bson.E{Key: column, Value: value})
+	}
+
+	suffix := "_idx"
+	if kind == "unique" {
+		suffix = "_key"
+	}
+	name := m.collection + "_" + strings.Join(columns, "_") + suffix
+	if match := prismaNameArg.FindStringSubmatch(args[end:]); match != nil {
+		name = match[1]
+	}
+
+	return schema.Index{Key: key, Name: name, Unique: kind == "unique"}, true, nil
+}
+
+// column maps a Prisma field reference, possibly a dotted path into a composite
+// type, to its database name.
+func (m prismaModel) column(field string) string {
+	first, rest, dotted := strings.Cut(field, ".")
+	if column, ok := m.columns[first]; ok {
+		first = column
+	}
+	if dotted {
+		return first + "." + rest
+	}
+	return first
+}
+
+func stripPrismaComment(line string) string {
+	var quoted bool
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '"':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(line[i:], "//"):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// matchingBracket returns the position of the bracket closing the first '['.
+func matchingBracket(s string) int {
+	depth := 0
+	for i, c := range s {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitTopLevel splits on commas outside parentheses.
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,303 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/schema"
+)
+
+// accessSuffix names the migration of access control changes, generated after
+// the index migration.
+const accessSuffix = "_access"
+
+// roleCommands and userCommands are the access control commands generated by
+// diff. They change no index.
+var (
+	roleCommands = []string{"createRole", "updateRole", "dropRole"}
+	userCommands = []string{"grantRolesToUser", "revokeRolesFromUser"}
+)
+
+// isAccessCommand reports whether the migration command changes access
+// control rather than indexes.
+func isAccessCommand(name string) bool {
+	return slices.Contains(roleCommands, name) || slices.Contains(userCommands, name)
+}
+
+// InspectAccess connects to MongoDB and writes the users and custom roles of
+// the database to the access file.
+func InspectAccess(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+	readOptions db.ReadOptions,
+	accessFilePath string,
+	dryRun bool,
+) error {
+	compiled, err := settings.compile()
+	if err != nil {
+		return err
+	}
+
+	logger.Debug("Connecting to MongoDB")
+	client, err := compiled.connect(ctx, mongoURI)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer func() {
+		if err := compiled.disconnect(ctx, client); err != nil {
+			logger.Error("Failed to disconnect from MongoDB", "error", err)
+		}
+	}()
+
+	database, err := db.OpenDatabase(client, databaseName, readOptions)
+	if err != nil {
+		return err
+	}
+
+	logger.Debug("Reading users and roles from MongoDB")
+	access, err := db.ReadAccess(ctx, database)
+	if err != nil {
+		return fmt.Errorf("failed to read access control: %w", err)
+	}
+
+	data, err := marshalAccess(compiled, accessFilePath, access)
+	if err != nil {
+		return fmt.Errorf("marshalling access control: %w", err)
+	}
+
+	if dryRun {
+		fmt.Printf("\nAccess control that would be written to %s:\n", accessFilePath) //nolint:forbidigo
+		if _, err := os.Stdout.Write(data); err != nil {
+			return fmt.Errorf("writing access control: %w", err)
+		}
+		return nil
+	}
+
+	logger.Info("Writing access control to file", "path", accessFilePath)
+	if err := compiled.permissions.Write(accessFilePath, data); err != nil {
+		return fmt.Errorf("writing access control: %w", err)
+	}
+	return nil
+}
+
+// readAccessFile reads the declared users and roles.
+func readAccessFile(path string) (schema.Access, error) {
+	data, err := readSchemaFile(path)
+	if err != nil {
+		return schema.Access{}, err
+	}
+	access, err := schema.ParseAccess(data)
+	if err != nil {
+		return schema.Access{}, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return access, nil
+}
+
+// marshalAccess renders the access file at path, in the format of its
+// extension and with the configured indent. Users are written with the names
+// of their roles only.
+func marshalAccess(settings compiledSettings, path string, access schema.Access) ([]byte, error) {
+	formatStyle := settings.style
+	data, err := json.MarshalIndent(access, "", strings.Repeat(" ", formatStyle.Indent))
+	if err != nil {
+		return nil, err
+	}
+	return schema.CodecFor(path).FromJSON(data, formatStyle.Indent)
+}
+
+// diffAccess generates the migration from the live users and roles to those
+// of the access file, reporting whether there are changes.
+func diffAccess(
+	ctx context.Context,
+	logger *slog.Logger,
+	client *mongo.Client,
+	databaseName string,
+	readOptions db.ReadOptions,
+	accessFilePath string,
+) (generatedMigration, bool, error) {
+	logger.Debug("Reading declared access control from file", "path", accessFilePath)
+	declared, err := readAccessFile(accessFilePath)
+	if err != nil {
+		return generatedMigration{}, false, fmt.Errorf("failed to read declared access control: %w", err)
+	}
+
+	database, err := db.OpenDatabase(client, databaseName, readOptions)
+	if err != nil {
+		return generatedMigration{}, false, err
+	}
+
+	logger.Debug("Reading users and roles from MongoDB")
+	current, err := db.ReadAccess(ctx, database)
+	if err != nil {
+		return generatedMigration{}, false, fmt.Errorf("failed to read access control: %w", err)
+	}
+
+	up, down := generateAccessCommands(logger, current, declared.Canonical(databaseName))
+	if len(up) == 0 {
+		return generatedMigration{}, false, nil
+	}
+
+	m := generatedMigration{Suffix: accessSuffix}
+	if m.Up, err = marshalCommands(up); err != nil {
+		return generatedMigration{}, false, err
+	}
+	if m.Down, err = marshalCommands(down); err != nil {
+		return generatedMigration{}, false, err
+	}
+	return m, true, nil
+}
+
+// generateAccessCommands generates the migration from the current users and
+// roles to the declared ones, both in canonical form. Only declared users are
+// managed, and only when the roles are declared are undeclared custom roles
+// dropped. Users are never created or dropped, as that takes a password.
+func generateAccessCommands(logger *slog.Logger, current, declared schema.Access) (up, down []bson.D) {
+	findRole := func(roles []schema.Role, name string) (schema.Role, bool) {
+		i := slices.IndexFunc(roles, func(r schema.Role) bool { return r.Role == name })
+		if i < 0 {
+			return schema.Role{}, false
+		}
+		return roles[i], true
+	}
+
+	var created, updated, restored, dropped []bson.D
+	var lossy []bson.D
+	for _, role := range declared.Roles {
+		live, ok := findRole(current.Roles, role.Role)
+		switch {
+		case !ok:
+			logger.Debug("New role to create", "role", role.Role)
+			created = append(created, roleCommand("createRole", role))
+			dropped = append(dropped, bson.D{{Key: "dropRole", Value: role.Role}})
+		case !live.Equal(role):
+			logger.Debug("Role to update", "role", role.Role)
+			updated = append(updated, roleCommand("updateRole", role))
+			restored = append(restored, roleCommand("updateRole", live))
+		}
+	}
+
+	var undeclared, recreated []bson.D
+	if declared.Roles != nil {
+		for _, live := range current.Roles {
+			if _, ok := findRole(declared.Roles, live.Role); ok {
+				continue
+			}
+			logger.Debug("Role to drop", "role", live.Role)
+			undeclared = append(undeclared, bson.D{{Key: "dropRole", Value: live.Role}})
+			recreated = append(recreated, roleCommand("createRole", live))
+
+			warning := fmt.Sprintf("users granted role %s aren't granted it again when it's recreated", live.Role)
+			logger.Warn("Down migration is lossy", "reason", warning)
+			lossy = append(lossy, bson.D{{Key: lossyDownCommand, Value: warning}})
+		}
+	}
+
+	var grants, revokes, regrants, rerevokes []bson.D
+	for _, user := range declared.Users {
+		i := slices.IndexFunc(current.Users, func(u schema.User) bool { return u.User == user.User })
+		if i < 0 {
+			logger.Warn("User doesn't exist, create it outside mondex", "user", user.User)
+			continue
+		}
+
+		granted := rolesDifference(user.Roles, current.Users[i].Roles)
+		revoked := rolesDifference(current.Users[i].Roles, user.Roles)
+		if len(granted) > 0 {
+			logger.Debug("Roles to grant", "user", user.User, "roles", granted)
+			grants = append(grants, userCommand("grantRolesToUser", user.User, granted))
+			rerevokes = append(rerevokes, userCommand("revokeRolesFromUser", user.User, granted))
+		}
+		if len(revoked) > 0 {
+			logger.Debug("Roles to revoke", "user", user.User, "roles", revoked)
+			revokes = append(revokes, userCommand("revokeRolesFromUser", user.User, revoked))
+			regrants = append(regrants, userCommand("grantRolesToUser", user.User, revoked))
+		}
+	}
+
+	// Roles exist before they are granted and are dropped once revoked.
+	up = slices.Concat(created, updated, grants, revokes, undeclared)
+	down = slices.Concat(lossy, recreated, restored, regrants, rerevokes, dropped)
+	return up, down
+}
+
+// rolesDifference returns the roles of a missing from b.
+func rolesDifference(a, b []schema.RoleRef) []schema.RoleRef {
+	var diff []schema.RoleRef
+	for _, role := range a {
+		if !slices.Contains(b, role) {
+			diff = append(diff, role)
+		}
+	}
+	return diff
+}
+
+func roleCommand(name string, role schema.Role) bson.D {
+	privileges := bson.A{}
+	for _, p := range role.Privileges {
+		privileges = append(privileges, bson.D{
+			{Key: "resource", Value: resourceDocument(p.Resource)},
+			{Key: "actions", Value: p.Actions},
+		})
+	}
+	return bson.D{
+		{Key: name, Value: role.Role},
+		{Key: "privileges", Value: privileges},
+		{Key: "roles", Value: roleRefs(role.Roles)},
+	}
+}
+
+func userCommand(name, user string, roles []schema.RoleRef) bson.D {
+	return bson.D{{Key: name, Value: user}, {Key: "roles", Value: roleRefs(roles)}}
+}
+
+func roleRefs(refs []schema.RoleRef) bson.A {
+	roles := bson.A{}
+	for _, ref := range refs {
+		roles = append(roles, bson.D{{Key: "role", Value: ref.Role}, {Key: "db", Value: ref.DB}})
+	}
+	return roles
+}
+
+// resourceDocument renders a privilege resource as the server expects it,
+// with both db and collection for database resources.
+func resourceDocument(r schema.Resource) bson.D {
+	switch {
+	case r.Cluster:
+		return bson.D{{Key: "cluster", Value: true}}
+	case r.AnyResource:
+		return bson.D{{Key: "anyResource", Value: true}}
+	}
+	value := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	return bson.D{{Key: "db", Value: value(r.DB)}, {Key: "collection", Value: value(r.Collection)}}
+}
+
+// marshalCommands renders migration commands as a migration file, keeping the
+// order of their fields: the command name must come first, which a map
+// doesn't guarantee.
+func marshalCommands(commands []bson.D) ([]byte, error) {
+	entries := make([]json.RawMessage, 0, len(commands))
+	for _, command := range commands {
+		entry, err := bson.MarshalExtJSON(command, false, false)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return json.MarshalIndent(entries, "", "  ")
+}
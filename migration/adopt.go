@@ -0,0 +1,298 @@
+package migration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ltman/mondex/atomicfile"
+	"github.com/ltman/mondex/schema"
+)
+
+// ReplayMigrations replays the index, search index, collection and
+// renameCollection commands of the JSON up migrations in the directory and
+// returns the resulting schema together with the last version, which becomes
+// the baseline for migrations generated by mondex.
+func ReplayMigrations(logger *slog.Logger, settings Settings, migrationDir string) ([]schema.Schema, uint64, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return nil, 0, err
+	}
+	return replayMigrations(logger, compiled, dirSource(migrationDir), math.MaxUint64)
+}
+
+// replayMigrations replays the up migrations with versions up to the given one.
+func replayMigrations(logger *slog.Logger, settings compiledSettings, migrations migrationSource, upTo uint64) ([]schema.Schema, uint64, error) {
+	files, err := migrations.files()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var schemas []schema.Schema
+	var baseline uint64
+	for _, file := range files {
+		if file.Direction != "up" || file.Version > upTo {
+			continue
+		}
+		if filepath.Ext(file.Path) != ".json" {
+			logger.Warn("Skipping migration that isn't JSON", "path", file.Path)
+			continue
+		}
+
+		body, err := file.read()
+		if err != nil {
+			return nil, 0, fmt.Errorf("reading %s: %w", file.Path, err)
+		}
+
+		var commands []bson.D
+		if err := bson.UnmarshalExtJSON(body, true, &commands); err != nil {
+			return nil, 0, fmt.Errorf("unmarshaling migration commands of %s: %w", file.Path, err)
+		}
+
+		for _, command := range commands {
+			if schemas, err = replayCommand(logger, schemas, command); err != nil {
+				return nil, 0, fmt.Errorf("replaying %s: %w", file.Path, err)
+			}
+		}
+		baseline = file.Version
+	}
+
+	return prepareSchemas(settings, schemas), baseline, nil
+}
+
+// replayCommand applies the effect of one migration command to the schemas.
+func replayCommand(logger *slog.Logger, schemas []schema.Schema, command bson.D) ([]schema.Schema, error) {
+	if len(command) == 0 || isAnnotation(command) {
+		return schemas, nil
+	}
+	name := command[0].Key
+	collection, _ := command[0].Value.(string)
+	i := slices.IndexFunc(schemas, func(s schema.Schema) bool { return s.Collection == collection })
+
+	switch name {
+	case "createIndexes":
+		var body struct {
+			Indexes []schema.Index `bson:"indexes"`
+		}
+		if err := decodeCommand(command, &body); err != nil {
+			return nil, err
+		}
+		if i < 0 {
+			schemas = append(schemas, schema.Schema{Collection: collection})
+			i = len(schemas) - 1
+		}
+		for _, index := range body.Indexes {
+			schemas[i].Indexes = slices.DeleteFunc(schemas[i].Indexes, func(existing schema.Index) bool {
+				return existing.Name == index.Name
+			})
+			schemas[i].Indexes = append(schemas[i].Indexes, index)
+		}
+	case "dropIndexes":
+		if i < 0 {
+			return schemas, nil
+		}
+		for _, e := range command {
+			if e.Key != "index" {
+				continue
+			}
+			schemas[i].Indexes = slices.DeleteFunc(schemas[i].Indexes, func(index schema.Index) bool {
+				return droppedBy(e.Value, index)
+			})
+		}
+	case "drop":
+		if i >= 0 {
+			schemas = slices.Delete(schemas, i, i+1)
+		}
+	case "create", "collMod":
+		var body struct {
+			Validator        bson.Raw `bson:"validator"`
+			ValidationLevel  string   `bson:"validationLevel"`
+			ValidationAction string   `bson:"validationAction"`
+			Index            *struct {
+				Name               string `bson:"name"`
+				ExpireAfterSeconds *int32 `bson:"expireAfterSeconds"`
+				Hidden             *bool  `bson:"hidden"`
+			} `bson:"index"`
+		}
+		if err := decodeCommand(command, &body); err != nil {
+			return nil, err
+		}
+		if body.Index != nil && i >= 0 {
+			if j := slices.IndexFunc(schemas[i].Indexes, func(index schema.Index) bool { return index.Name == body.Index.Name }); j >= 0 {
+				if body.Index.ExpireAfterSeconds != nil {
+					schemas[i].Indexes[j].ExpireAfterSeconds = body.Index.ExpireAfterSeconds
+				}
+				if body.Index.Hidden != nil {
+					schemas[i].Indexes[j].Hidden = *body.Index.Hidden
+				}
+			}
+		}
+		if name == "create" {
+			var options schema.CollectionOptions
+			if err := decodeCommand(command, &options); err != nil {
+				return nil, err
+			}
+			if !options.IsZero() {
+				if i < 0 {
+					schemas = append(schemas, schema.Schema{Collection: collection})
+					i = len(schemas) - 1
+				}
+				schemas[i].Options = &options
+			}
+		}
+		if body.Validator == nil {
+			// Other collMod options aren't part of the schema.
+			return schemas, nil
+		}
+		validation := schema.Schema{ValidationLevel: body.ValidationLevel, ValidationAction: body.ValidationAction}
+		if err := decodeDefinition(body.Validator, &validation.Validator); err != nil {
+			return nil, err
+		}
+		if i < 0 {
+			schemas = append(schemas, schema.Schema{Collection: collection})
+			i = len(schemas) - 1
+		}
+		schemas[i] = schemas[i].WithValidationOf(validation)
+	case "createSearchIndexes":
+		var body struct {
+			Indexes []struct {
+				Name       string   `bson:"name"`
+				Type       string   `bson:"type"`
+				Definition bson.Raw `bson:"definition"`
+			} `bson:"indexes"`
+		}
+		if err := decodeCommand(command, &body); err != nil {
+			return nil, err
+		}
+		if i < 0 {
+			schemas = append(schemas, schema.Schema{Collection: collection})
+			i = len(schemas) - 1
+		}
+		for _, created := range body.Indexes {
+			index := schema.SearchIndex{Name: created.Name, Type: created.Type}
+			if err := decodeDefinition(created.Definition, &index.Definition); err != nil {
+				return nil, err
+			}
+			schemas[i].SearchIndexes = slices.DeleteFunc(schemas[i].SearchIndexes, func(existing schema.SearchIndex) bool {
+				return existing.Name == index.Name
+			})
+			schemas[i].SearchIndexes = append(schemas[i].SearchIndexes, index)
+		}
+	case "updateSearchIndex", "dropSearchIndex":
+		var body struct {
+			Name       string   `bson:"name"`
+			Definition bson.Raw `bson:"definition"`
+		}
+		if err := decodeCommand(command, &body); err != nil {
+			return nil, err
+		}
+		if i < 0 {
+			return schemas, nil
+		}
+		j := slices.IndexFunc(schemas[i].SearchIndexes, func(index schema.SearchIndex) bool { return index.Name == body.Name })
+		switch {
+		case j < 0:
+		case name == "dropSearchIndex":
+			schemas[i].SearchIndexes = slices.Delete(schemas[i].SearchIndexes, j, j+1)
+		default:
+			if err := decodeDefinition(body.Definition, &schemas[i].SearchIndexes[j].Definition); err != nil {
+				return nil, err
+			}
+		}
+	case "renameCollection":
+		var body struct {
+			To string `bson:"to"`
+		}
+		if err := decodeCommand(command, &body); err != nil {
+			return nil, err
+		}
+		// renameCollection takes full namespaces, e.g. "app.users".
+		from := collection[strings.Index(collection, ".")+1:]
+		to := body.To[strings.Index(body.To, ".")+1:]
+		if j := slices.IndexFunc(schemas, func(s schema.Schema) bool { return s.Collection == from }); j >= 0 {
+			schemas[j].Collection = to
+		}
+	default:
+		if isAccessCommand(name) {
+			// Access control isn't part of the recorded schema.
+			return schemas, nil
+		}
+		logger.Warn("Ignoring command that doesn't change indexes", "command", name, "collection", collection)
+	}
+
+	return schemas, nil
+}
+
+// decodeDefinition decodes a validator or search index definition of a
+// command as relaxed extended JSON, as schema files declare them.
+func decodeDefinition(raw bson.Raw, out *map[string]any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	data, err := bson.MarshalExtJSON(raw, false, false)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// droppedBy reports whether a dropIndexes "index" value matches the index.
+func droppedBy(value any, index schema.Index) bool {
+	switch v := value.(type) {
+	case string:
+		return v == index.Name || (v == "*" && index.Name != "_id_")
+	case bson.A:
+		return slices.Contains(v, any(index.Name))
+	case bson.D:
+		a, errA := bson.Marshal(v)
+		b, errB := bson.Marshal(index.Key)
+		return errA == nil && errB == nil && string(a) == string(b)
+	}
+	return false
+}
+
+// WriteBaselineMigration writes an empty migration with the baseline version to
+// a migration directory that has none yet, so databases already migrated to the
+// baseline see nothing to apply and new migrations are numbered after it.
+func WriteBaselineMigration(logger *slog.Logger, settings Settings, migrationDir string, version uint64) error {
+	compiled, err := settings.compile()
+	if err != nil {
+		return err
+	}
+
+	files, err := listMigrationFiles(migrationDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(files) > 0 {
+		return fmt.Errorf("migration directory %s already contains migrations", migrationDir)
+	}
+
+	if err := os.MkdirAll(migrationDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	data, err := withHeader([]byte("[]"), newMigrationHeader("", ""))
+	if err != nil {
+		return err
+	}
+	var baseline []atomicfile.File
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(migrationDir, fmt.Sprintf("%06d_baseline.%s.json", version, direction))
+		logger.Info("Writing baseline migration", "path", path)
+		baseline = append(baseline, atomicfile.File{Path: path, Data: data})
+	}
+	if err := compiled.permissions.WriteAll(baseline); err != nil {
+		return fmt.Errorf("failed to write baseline migration: %w", err)
+	}
+	return nil
+}
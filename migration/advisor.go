@@ -0,0 +1,171 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// partialSuffix is appended to the name of a sparse index to name its partial
+// replacement, so both can exist between the two migration steps.
+const partialSuffix = "_partial"
+
+// SparseAdvice proposes replacing a sparse index by the equivalent partial index.
+type SparseAdvice struct {
+	Collection string
+	Sparse     schema.Index
+	Partial    schema.Index
+}
+
+// AdviseSparseIndexes flags the sparse indexes of the declared schema and
+// proposes partial indexes only covering documents having one of the indexed
+// fields, which is what sparse does. Text and geospatial indexes are skipped
+// as they are always sparse.
+func AdviseSparseIndexes(declared []schema.Schema) []SparseAdvice {
+	var advice []SparseAdvice
+	for _, s := range declared {
+		for _, index := range s.Indexes {
+			if !index.Sparse || len(index.PartialFilterExpression) > 0 || hasSparseIndexType(index) {
+				continue
+			}
+			advice = append(advice, SparseAdvice{
+				Collection: s.Collection,
+				Sparse:     index,
+				Partial:    partialEquivalent(index),
+			})
+		}
+	}
+	return advice
+}
+
+func hasSparseIndexType(index schema.Index) bool {
+	return slices.ContainsFunc(index.Key, func(e bson.E) bool {
+		return e.Value == "text" || e.Value == "2d" || e.Value == "2dsphere"
+	})
+}
+
+// partialEquivalent converts a sparse index into a partial index on the fields'
+// existence. Compound keys need $or in the filter, which MongoDB 6.0 and later
+// accept.
+func partialEquivalent(index schema.Index) schema.Index {
+	partial := index
+	partial.Name = index.Name + partialSuffix
+	partial.Sparse = false
+
+	exists := make(bson.A, 0, len(index.Key))
+	for _, e := range index.Key {
+		exists = append(exists, bson.M{e.Key: bson.M{"$exists": true}})
+	}
+	if len(exists) == 1 {
+		partial.PartialFilterExpression = exists[0].(bson.M)
+	} else {
+		partial.PartialFilterExpression = bson.M{"$or": exists}
+	}
+	return partial
+}
+
+// ConvertSparseIndexes replaces the advised sparse indexes by their partial
+// equivalents in the schema file and writes the conversion as two migrations:
+// the first creates the partial indexes, the second drops the sparse ones once
+// queries can use the replacements.
+func ConvertSparseIndexes(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	schemaFilePath string,
+	migrationDir string,
+	advice []SparseAdvice,
+	dryRun bool,
+) error {
+	compiled, err := settings.compile()
+	if err != nil {
+		return err
+	}
+
+	var partials, sparse []schema.Schema
+	for _, a := range advice {
+		partials = mergeSchemas(partials, []schema.Schema{{Collection: a.Collection, Indexes: []schema.Index{a.Partial}}})
+		sparse = mergeSchemas(sparse, []schema.Schema{{Collection: a.Collection, Indexes: []schema.Index{a.Sparse}}})
+	}
+
+	createUp, err := json.MarshalIndent(generateCreateIndexesCommands(partials), "", "  ")
+	if err != nil {
+		return err
+	}
+	createDown, err := json.MarshalIndent(generateDestroyIndexCommands(partials), "", "  ")
+	if err != nil {
+		return err
+	}
+	dropUp, err := json.MarshalIndent(generateDestroyIndexCommands(sparse), "", "  ")
+	if err != nil {
+		return err
+	}
+	dropDown, err := json.MarshalIndent(generateCreateIndexesCommands(sparse), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	declared, err := readDeclaredSchema(schemaFilePath)
+	if err != nil {
+		return fmt.Errorf("reading declared schema: %w", err)
+	}
+	for _, a := range advice {
+		i := slices.IndexFunc(declared, func(s schema.Schema) bool { return s.Collection == a.Collection })
+		if i < 0 {
+			continue
+		}
+		declared[i].Indexes = slices.DeleteFunc(slices.Clone(declared[i].Indexes), func(index schema.Index) bool {
+			return index.Name == a.Sparse.Name
+		})
+	}
+	schemas, err := marshalSchemas(compiled, schemaFilePath, mergeSchemas(declared, partials))
+	if err != nil {
+		return fmt.Errorf("marshalling schema: %w", err)
+	}
+
+	if dryRun {
+		logger.Info("Dry-run: showing conversion without writing files")
+
+		for _, step := range []struct {
+			title string
+			data  []byte
+		}{
+			{"Step 1, create partial indexes, up migration:", createUp},
+			{"\nStep 1, down migration:", createDown},
+			{"\nStep 2, drop sparse indexes, up migration:", dropUp},
+			{"\nStep 2, down migration:", dropDown},
+			{fmt.Sprintf("\nSchema that would be written to %s:", schemaFilePath), schemas},
+		} {
+			fmt.Println(step.title) //nolint:forbidigo
+			if _, err := os.Stdout.Write(step.data); err != nil {
+				return fmt.Errorf("writing conversion to stdout: %w", err)
+			}
+		}
+
+		return nil
+	}
+
+	logger.Info("Writing migration creating partial indexes", "migrationDir", migrationDir)
+	if err := writeMigrationCommands(ctx, logger, compiled, createUp, createDown, newMigrationHeader(schemaHash(schemas), ""), migrationDir, "create_partial_indexes"); err != nil {
+		return fmt.Errorf("failed to write migration commands: %w", err)
+	}
+
+	logger.Info("Writing migration dropping sparse indexes", "migrationDir", migrationDir)
+	if err := writeMigrationCommands(ctx, logger, compiled, dropUp, dropDown, newMigrationHeader(schemaHash(schemas), ""), migrationDir, "drop_sparse_indexes"); err != nil {
+		return fmt.Errorf("failed to write migration commands: %w", err)
+	}
+
+	logger.Info("Writing converted schema to file", "path", schemaFilePath)
+	if err := writeSchemaFile(compiled, schemaFilePath, schemas); err != nil {
+		return fmt.Errorf("writing declared schema: %w", err)
+	}
+
+	return nil
+}
@@ -1,29 +1,237 @@
 package migration
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/mongodb"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 
+	"github.com/ltman/mondex/atlas"
 	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/policy"
 )
 
+// ApplyOptions tunes how migration commands are executed.
+type ApplyOptions struct {
+	// WriteConcern is attached to every command that doesn't set one itself.
+	WriteConcern db.WriteOptions
+	// WaitForSecondaries polls every replica set member after createIndexes
+	// until the new indexes exist everywhere.
+	WaitForSecondaries bool
+	// WaitTimeout bounds how long to wait for secondaries; zero means no limit.
+	WaitTimeout time.Duration
+	// IndexBuilds is attached to every createIndexes command that doesn't
+	// set it itself.
+	IndexBuilds IndexBuildOptions
+	// Progress receives progress events; nil discards them.
+	Progress ProgressReporter
+	// Atlas, when set, runs search index commands through the Atlas Admin API
+	// instead of the database.
+	Atlas *atlas.Client
+	// Policies are evaluated against the pending migrations before any runs.
+	Policies []string
+	// RemoteState records the schema produced by the applied migrations in
+	// the state collection once they ran.
+	RemoteState bool
+	// Only applies the pending migration of this version alone, ahead of
+	// the earlier ones; zero applies all pending migrations.
+	Only uint64
+	// Steps applies only this many pending migrations, or with a negative
+	// value rolls back this many applied ones; zero applies them all.
+	Steps int
+	// ToVersion, when set, migrates up or down to this version, 0 rolling
+	// back every migration.
+	ToVersion *uint64
+	// Canary, when set, applies the migrations to a shadow database first and
+	// only proceeds to the target once they succeeded there.
+	Canary *CanaryOptions
+	// Verify, when set, reads the indexes once the migrations ran and fails
+	// if they don't match the declared schema.
+	Verify *VerifyOptions
+	// Lock tunes waiting for the database lock held by another process.
+	Lock LockOptions
+	// AllowDestructive applies pending migrations dropping indexes,
+	// collections or privileges, which are refused otherwise. Rolling back
+	// isn't affected.
+	AllowDestructive bool
+}
+
+// IndexBuildOptions tune the index builds of createIndexes commands.
+type IndexBuildOptions struct {
+	// CommitQuorum is the number of voting members, or "majority",
+	// "votingMembers" or a replica set tag, that must be ready to commit the
+	// builds before any member does; empty keeps the server default.
+	CommitQuorum string
+	// MaxTime aborts a command whose builds take longer; zero means no
+	// limit.
+	MaxTime time.Duration
+	// LogInterval is how often the progress of the builds is logged when no
+	// ProgressReporter is set; zero takes DefaultIndexBuildLogInterval.
+	LogInterval time.Duration
+}
+
+// DefaultIndexBuildLogInterval is how often index build progress is logged
+// by default.
+const DefaultIndexBuildLogInterval = 30 * time.Second
+
+// fields returns the createIndexes fields setting the options, in command
+// order.
+func (o IndexBuildOptions) fields() bson.D {
+	var fields bson.D
+	if o.CommitQuorum != "" {
+		if n, err := strconv.Atoi(o.CommitQuorum); err == nil {
+			fields = append(fields, bson.E{Key: "commitQuorum", Value: n})
+		} else {
+			fields = append(fields, bson.E{Key: "commitQuorum", Value: o.CommitQuorum})
+		}
+	}
+	if o.MaxTime > 0 {
+		fields = append(fields, bson.E{Key: "maxTimeMS", Value: o.MaxTime.Milliseconds()})
+	}
+	return fields
+}
+
+// CanaryOptions designate the shadow database, e.g. restored from a snapshot
+// of the target, that apply runs the migrations against first.
+type CanaryOptions struct {
+	MongoURI     string
+	DatabaseName string
+	// MaxDuration fails the canary when the migrations take longer; zero
+	// means no limit.
+	MaxDuration time.Duration
+}
+
 func ApplyMigrations(
 	ctx context.Context,
 	logger *slog.Logger,
+	settings Settings,
 	mongoURI, databaseName string,
 	migrationDir string,
+	applyOptions ApplyOptions,
 ) error {
+	compiled, err := settings.compile()
+	if err != nil {
+		return err
+	}
+	if err := checkMigrationDir(migrationDir); err != nil {
+		return err
+	}
+	return applyMigrations(ctx, logger, compiled, mongoURI, databaseName, dirSource(migrationDir), applyOptions)
+}
+
+// ApplyMigrationsFS applies the migrations at the root of the file system,
+// such as one embedded in the program with go:embed, as ApplyMigrations
+// applies those of a directory.
+func ApplyMigrationsFS(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+	migrations fs.FS,
+	applyOptions ApplyOptions,
+) error {
+	compiled, err := settings.compile()
+	if err != nil {
+		return err
+	}
+	return applyMigrations(ctx, logger, compiled, mongoURI, databaseName, migrationSource{fsys: migrations}, applyOptions)
+}
+
+func applyMigrations(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings compiledSettings,
+	mongoURI, databaseName string,
+	migrations migrationSource,
+	applyOptions ApplyOptions,
+) error {
+	if canary := applyOptions.Canary; canary != nil {
+		if err := applyCanary(ctx, logger, settings, *canary, migrations, applyOptions); err != nil {
+			return err
+		}
+	}
+
 	logger.Debug("Connecting to MongoDB")
-	client, err := db.ConnectToMongoDB(ctx, mongoURI)
+	client, err := settings.connect(ctx, mongoURI)
 	if err != nil {
 		return fmt.Errorf("failed to connect to MongoDB: %w", err)
 	}
+	// The client is disconnected here alone, however apply ends: closing
+	// the migrator leaves it connected.
+	defer func() {
+		if err := settings.disconnect(ctx, client); err != nil {
+			logger.Error("Failed to disconnect from MongoDB", "error", err)
+		}
+	}()
+
+	sharded, err := db.IsMongos(ctx, client)
+	if err != nil {
+		return fmt.Errorf("failed to detect deployment topology: %w", err)
+	}
+
+	var shards []db.Shard
+	if sharded {
+		shards, err = db.ListShards(ctx, client)
+		if err != nil {
+			logger.Warn("Connected to mongos but shards can't be listed, skipping per-shard index verification", "error", err)
+		} else {
+			logger.Info("Connected to a sharded cluster", "shards", len(shards))
+		}
+	}
+
+	if err := checkPendingRequirements(ctx, client.Database(databaseName), migrations); err != nil {
+		return err
+	}
+
+	target, err := resolveApplyTarget(ctx, client.Database(databaseName), migrations, applyOptions)
+	if err != nil {
+		return err
+	}
+
+	if !target.down {
+		if err := checkExistingIndexes(ctx, client.Database(databaseName), migrations); err != nil {
+			return err
+		}
+	}
+
+	if len(applyOptions.Policies) > 0 || !target.down {
+		var changes []policy.Change
+		if target.down {
+			changes, err = rollbackChanges(migrations, target.from, target.version)
+		} else {
+			changes, err = pendingChanges(ctx, client.Database(databaseName), migrations)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read pending migrations: %w", err)
+		}
+		switch {
+		case applyOptions.Only != 0:
+			changes = slices.DeleteFunc(changes, func(c policy.Change) bool { return c.Version != applyOptions.Only })
+		case !target.down && !target.latest:
+			changes = slices.DeleteFunc(changes, func(c policy.Change) bool { return c.Version > target.version })
+		}
+		if !target.down {
+			if err := checkDestructive(logger, changes, applyOptions.AllowDestructive); err != nil {
+				return err
+			}
+		}
+		input := policy.Input{Phase: policy.PhaseApply, Database: databaseName, Changes: changes}
+		if err := checkPolicies(ctx, logger, applyOptions.Policies, input); err != nil {
+			return err
+		}
+	}
 
 	logger.Debug("Creating MongoDB golang-migrate driver")
 	driver, err := mongodb.WithInstance(client, &mongodb.Config{DatabaseName: databaseName})
@@ -31,25 +239,259 @@ func ApplyMigrations(
 		return fmt.Errorf("failed to create golang-migrate driver: %w", err)
 	}
 
+	var progress ProgressReporter = nopProgress{}
+	if applyOptions.Progress != nil {
+		progress = applyOptions.Progress
+	}
+
+	outOfOrder, err := db.OutOfOrderMigrations(ctx, client.Database(databaseName))
+	if err != nil {
+		return err
+	}
+
+	if err := db.EnsureLockIndex(ctx, client.Database(databaseName)); err != nil {
+		return err
+	}
+
+	commands := &commandDriver{
+		Driver:     driver,
+		ctx:        ctx,
+		logger:     logger,
+		mongoURI:   mongoURI,
+		connection: settings.connection,
+		client:     client,
+		db:         client.Database(databaseName),
+		options:    applyOptions,
+		sharded:    sharded,
+		shards:     shards,
+		progress:   progress,
+		names:      migrations.names(),
+		outOfOrder: make(map[uint64]bool, len(outOfOrder)),
+		down:       target.down,
+	}
+	for _, m := range outOfOrder {
+		commands.outOfOrder[m.Version] = true
+	}
+
+	if applyOptions.Only != 0 {
+		if applyOptions.Verify != nil {
+			logger.Warn("Not verifying the schema, which only matches once every migration is applied")
+		}
+		return applyOutOfOrder(ctx, logger, commands, migrations, applyOptions.Only)
+	}
+
 	logger.Debug("Creating MongoDB golang-migrate migrator")
-	migrator, err := migrate.NewWithDatabaseInstance(
-		fmt.Sprintf("file://%s", migrationDir),
-		"mongodb",
-		driver,
-	)
+	source, err := iofs.New(migrationFS{migrations.fsys}, ".")
+	if err != nil {
+		return fmt.Errorf("failed to read migrations: %w", err)
+	}
+	migrator, err := migrate.NewWithInstance("iofs", source, "mongodb", commands)
 	if err != nil {
 		return fmt.Errorf("failed to create migration instance: %w", err)
 	}
+	// The driver gives up waiting for the lock on its own, with who holds it.
+	migrator.LockTimeout = applyOptions.Lock.withDefaults().Timeout + time.Minute
 	defer func() {
 		if sourceErr, dbErr := migrator.Close(); sourceErr != nil || dbErr != nil {
 			logger.Error("Failed to close migration instance", "source_error", sourceErr, "database_error", dbErr)
 		}
 	}()
 
-	logger.Debug("Applying MongoDB migration files")
-	if err := migrator.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+	switch {
+	case target.down:
+		logger.Info("Rolling back migrations", "from", target.from, "to", target.version)
+		err = migrateDown(migrator, target.version)
+	case target.latest:
+		logger.Debug("Applying MongoDB migration files")
+		err = migrateUp(ctx, logger, migrator, commands, migrations, math.MaxUint64)
+	default:
+		logger.Info("Applying migrations up to version", "version", target.version)
+		err = migrateUp(ctx, logger, migrator, commands, migrations, target.version)
+	}
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
 		return fmt.Errorf("failed to apply migrations: %w", err)
 	}
 
+	if applyOptions.RemoteState {
+		if err := writeRemoteState(ctx, logger, settings, client.Database(databaseName), migrations); err != nil {
+			return err
+		}
+	}
+
+	if applyOptions.Verify != nil && !target.latest {
+		logger.Warn("Not verifying the schema, which only matches once every migration is applied")
+	} else if applyOptions.Verify != nil {
+		if err := verifySchema(ctx, logger, settings, client.Database(databaseName), *applyOptions.Verify); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyOutOfOrder runs the pending migration of the version alone and records
+// it, so golang-migrate skips it once it reaches its version.
+func applyOutOfOrder(ctx context.Context, logger *slog.Logger, d *commandDriver, migrations migrationSource, version uint64) (err error) {
+	current, dirty, err := db.MigrationVersion(ctx, d.db)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration %d failed midway, fix it before applying migrations out of order", current)
+	}
+	if current != db.NilVersion && version <= uint64(current) {
+		return fmt.Errorf("migration %d is already applied, the database is at version %d", version, current)
+	}
+	if d.outOfOrder[version] {
+		return fmt.Errorf("migration %d is already applied out of order", version)
+	}
+
+	files, err := migrations.files()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(files, func(f migrationFile) bool { return f.Version == version && f.Direction == "up" })
+	if i < 0 {
+		return fmt.Errorf("no up migration with version %d in %s", version, migrations)
+	}
+	file := files[i]
+
+	if err := d.Lock(); err != nil {
+		return fmt.Errorf("failed to lock database: %w", err)
+	}
+	defer func() {
+		if unlockErr := d.Unlock(); unlockErr != nil && err == nil {
+			err = fmt.Errorf("failed to unlock database: %w", unlockErr)
+		}
+	}()
+
+	body, err := file.read()
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", file.Path, err)
+	}
+
+	logger.Info("Applying migration out of order", "version", version, "name", file.Name)
+	d.version = version
+	if err := d.Run(bytes.NewReader(body)); err != nil {
+		return fmt.Errorf("failed to apply migration %d: %w", version, err)
+	}
+
+	if d.options.RemoteState {
+		logger.Warn("Not recording the state, which only covers migrations applied in order")
+	}
+
+	return db.RecordOutOfOrder(ctx, d.db, db.OutOfOrderMigration{
+		Version:   version,
+		Name:      file.Name,
+		AppliedAt: time.Now().UTC(),
+	})
+}
+
+// applyCanary applies the migrations to the shadow database, failing when
+// they fail or take longer than allowed there.
+func applyCanary(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings compiledSettings,
+	canary CanaryOptions,
+	migrations migrationSource,
+	applyOptions ApplyOptions,
+) error {
+	applyOptions.Canary = nil
+	logger = logger.With("canary", canary.DatabaseName)
+	// The canary is a deployment of its own, even when the target's client
+	// is shared.
+	settings.client = nil
+
+	logger.Info("Applying migrations to canary database")
+	start := time.Now()
+	if err := applyMigrations(ctx, logger, settings, canary.MongoURI, canary.DatabaseName, migrations, applyOptions); err != nil {
+		return fmt.Errorf("canary failed, target left untouched: %w", err)
+	}
+	elapsed := time.Since(start)
+
+	if canary.MaxDuration > 0 && elapsed > canary.MaxDuration {
+		return fmt.Errorf("canary took %s, more than the allowed %s, target left untouched",
+			elapsed.Round(time.Second), canary.MaxDuration)
+	}
+
+	logger.Info("Canary succeeded, applying migrations to target", "duration", elapsed.Round(time.Millisecond))
 	return nil
 }
+
+// applyTarget is the version apply migrates the database to.
+type applyTarget struct {
+	// from is the version applied to the database, 0 when none is.
+	from uint64
+	// version is the version to migrate to, unless latest applies every
+	// pending migration. down rolls back to it, 0 rolling back them all.
+	version uint64
+	latest  bool
+	down    bool
+}
+
+// resolveApplyTarget turns the steps or version to migrate to into the
+// version apply migrates the database to, failing when the migration
+// directory doesn't have enough migrations or that version.
+func resolveApplyTarget(ctx context.Context, database *mongo.Database, migrations migrationSource, applyOptions ApplyOptions) (applyTarget, error) {
+	if applyOptions.Steps == 0 && applyOptions.ToVersion == nil {
+		return applyTarget{latest: true}, nil
+	}
+
+	version, _, err := db.MigrationVersion(ctx, database)
+	if err != nil {
+		return applyTarget{}, err
+	}
+	var target applyTarget
+	if version != db.NilVersion {
+		target.from = uint64(version)
+	}
+
+	files, err := migrations.files()
+	if err != nil {
+		return applyTarget{}, err
+	}
+	var applied, pending []uint64
+	for _, file := range files {
+		list := &pending
+		if file.Version <= target.from {
+			list = &applied
+		}
+		if !slices.Contains(*list, file.Version) {
+			*list = append(*list, file.Version)
+		}
+	}
+
+	switch {
+	case applyOptions.ToVersion != nil:
+		target.version = *applyOptions.ToVersion
+		target.down = target.version <= target.from
+		if target.version != 0 && !slices.Contains(applied, target.version) && !slices.Contains(pending, target.version) {
+			return applyTarget{}, fmt.Errorf("no migration with version %d in %s", target.version, migrations)
+		}
+	case applyOptions.Steps > 0:
+		if applyOptions.Steps > len(pending) {
+			return applyTarget{}, fmt.Errorf("only %d migration(s) pending, can't apply %d", len(pending), applyOptions.Steps)
+		}
+		target.version = pending[applyOptions.Steps-1]
+	default:
+		steps := -applyOptions.Steps
+		if steps > len(applied) {
+			return applyTarget{}, fmt.Errorf("only %d migration(s) applied, can't roll back %d", len(applied), steps)
+		}
+		target.down = true
+		if steps < len(applied) {
+			target.version = applied[len(applied)-steps-1]
+		}
+	}
+	return target, nil
+}
+
+// migrateDown runs the down migrations of the versions newer than the target
+// one, newest first.
+func migrateDown(migrator *migrate.Migrate, version uint64) error {
+	if version == 0 {
+		return migrator.Down()
+	}
+	return migrator.Migrate(uint(version))
+}
@@ -0,0 +1,121 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testDeployment connects to the deployment of MONDEX_TEST_MONGO_URI, which
+// the tests needing a server run against, skipping the test without one. It
+// returns the URI and a database dropped once the test ends.
+func testDeployment(t *testing.T) (string, *mongo.Database) {
+	t.Helper()
+	uri := os.Getenv("MONDEX_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("MONDEX_TEST_MONGO_URI isn't set")
+	}
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	database := client.Database(fmt.Sprintf("mondex_test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		_ = database.Drop(context.Background())
+		_ = client.Disconnect(context.Background())
+	})
+	return uri, database
+}
+
+// openConnections returns the number of connections the server has open.
+func openConnections(t *testing.T, database *mongo.Database) int32 {
+	t.Helper()
+	var status struct {
+		Connections struct {
+			Current int32 `bson:"current"`
+		} `bson:"connections"`
+	}
+	if err := database.Client().Database("admin").RunCommand(context.Background(), bson.D{{Key: "serverStatus", Value: 1}}).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status.Connections.Current
+}
+
+// checkConnectionsReleased fails unless the server is back to at most the
+// connections it had open, leaving a moment for closed ones to be counted.
+func checkConnectionsReleased(t *testing.T, database *mongo.Database, before int32) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		after := openConnections(t, database)
+		if after <= before {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections left open", after-before)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// testMigrations are three migrations creating an index each.
+var testMigrations = map[string]string{
+	"000001_a.up.json":   `[{"createIndexes": "users", "indexes": [{"key": {"a": 1}, "name": "a_1"}]}]`,
+	"000001_a.down.json": `[{"dropIndexes": "users", "index": "a_1"}]`,
+	"000002_b.up.json":   `[{"createIndexes": "users", "indexes": [{"key": {"b": 1}, "name": "b_1"}]}]`,
+	"000002_b.down.json": `[{"dropIndexes": "users", "index": "b_1"}]`,
+	"000003_c.up.json":   `[{"createIndexes": "users", "indexes": [{"key": {"c": 1}, "name": "c_1"}]}]`,
+	"000003_c.down.json": `[{"dropIndexes": "users", "index": "c_1"}]`,
+}
+
+func TestApplyOnlyReleasesConnections(t *testing.T) {
+	uri, database := testDeployment(t)
+	dir := writeMigrationDir(t, testMigrations)
+	ctx := context.Background()
+	before := openConnections(t, database)
+
+	// Out of order migrations run twice in the process, as a service
+	// embedding mondex would.
+	for _, version := range []uint64{3, 2} {
+		if err := ApplyMigrations(ctx, discardLogger(), Settings{}, uri, database.Name(), dir, ApplyOptions{Only: version}); err != nil {
+			t.Fatalf("apply --only %d: %v", version, err)
+		}
+	}
+	if err := ApplyMigrations(ctx, discardLogger(), Settings{}, uri, database.Name(), dir, ApplyOptions{Only: 3}); err == nil {
+		t.Fatal("applied migration 3 out of order twice")
+	}
+
+	checkConnectionsReleased(t, database, before)
+}
+
+func TestApplyCanaryReleasesConnections(t *testing.T) {
+	uri, database := testDeployment(t)
+	dir := writeMigrationDir(t, testMigrations)
+	ctx := context.Background()
+	canary := database.Client().Database(database.Name() + "_canary")
+	t.Cleanup(func() { _ = canary.Drop(context.Background()) })
+	before := openConnections(t, database)
+
+	// The canary fails its checks before running anything, and then runs.
+	missing := uint64(9)
+	applyOptions := ApplyOptions{
+		Canary:    &CanaryOptions{MongoURI: uri, DatabaseName: canary.Name()},
+		ToVersion: &missing,
+	}
+	if err := ApplyMigrations(ctx, discardLogger(), Settings{}, uri, database.Name(), dir, applyOptions); err == nil {
+		t.Fatal("applied up to a missing version")
+	}
+	applyOptions.ToVersion = nil
+	if err := ApplyMigrations(ctx, discardLogger(), Settings{}, uri, database.Name(), dir, applyOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	checkConnectionsReleased(t, database, before)
+}
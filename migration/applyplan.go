@@ -0,0 +1,135 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ltman/mondex/db"
+)
+
+// ApplyPlan is what apply would run against the database, without running
+// anything.
+type ApplyPlan struct {
+	// From is the version applied to the database, 0 when none is.
+	From uint64
+	// Dirty is set when the migration of From failed midway, which apply
+	// refuses to go past.
+	Dirty bool
+	// Down is set when apply would roll back rather than migrate up.
+	Down bool
+	// Steps are the migrations apply would run, in order, with the changes
+	// each makes.
+	Steps []ChangelogEntry
+	// Destructive are the destructive changes of the steps, which apply
+	// refuses unless allowed.
+	Destructive []DestructiveChange
+}
+
+// PlanApply connects to MongoDB and resolves which migrations of the
+// directory apply would run with the options, from the version recorded by
+// golang-migrate and the migrations applied out of order, and what each
+// does. Nothing is run.
+func PlanApply(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+	migrationDir string,
+	applyOptions ApplyOptions,
+) (ApplyPlan, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return ApplyPlan{}, err
+	}
+
+	if err := checkMigrationDir(migrationDir); err != nil {
+		return ApplyPlan{}, err
+	}
+	migrations := dirSource(migrationDir)
+
+	logger.Debug("Connecting to MongoDB")
+	client, err := compiled.connect(ctx, mongoURI)
+	if err != nil {
+		return ApplyPlan{}, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer func() {
+		if err := compiled.disconnect(ctx, client); err != nil {
+			logger.Error("Failed to disconnect from MongoDB", "error", err)
+		}
+	}()
+	database := client.Database(databaseName)
+
+	version, dirty, err := db.MigrationVersion(ctx, database)
+	if err != nil {
+		return ApplyPlan{}, err
+	}
+	var plan ApplyPlan
+	if version != db.NilVersion {
+		plan.From = uint64(version)
+	}
+	plan.Dirty = dirty
+
+	target, err := resolveApplyTarget(ctx, database, migrations, applyOptions)
+	if err != nil {
+		return ApplyPlan{}, err
+	}
+
+	if target.down {
+		rollback, err := PlanRollback(logger, settings, migrationDir, plan.From, target.version)
+		if err != nil {
+			return ApplyPlan{}, err
+		}
+		plan.Down, plan.Steps = true, rollback.Steps
+		return plan, nil
+	}
+
+	outOfOrder, err := db.OutOfOrderMigrations(ctx, database)
+	if err != nil {
+		return ApplyPlan{}, err
+	}
+	files, err := migrations.files()
+	if err != nil {
+		return ApplyPlan{}, err
+	}
+	pending := slices.DeleteFunc(files, func(file migrationFile) bool {
+		switch {
+		case file.Direction != "up" || (version != db.NilVersion && file.Version <= plan.From):
+			return true
+		case slices.ContainsFunc(outOfOrder, func(m db.OutOfOrderMigration) bool { return m.Version == file.Version }):
+			return true
+		case applyOptions.Only != 0:
+			return file.Version != applyOptions.Only
+		}
+		return !target.latest && file.Version > target.version
+	})
+	if applyOptions.Only != 0 && len(pending) == 0 {
+		return ApplyPlan{}, fmt.Errorf("no pending migration with version %d in %s", applyOptions.Only, migrations)
+	}
+
+	for _, file := range pending {
+		body, err := file.read()
+		if err != nil {
+			return ApplyPlan{}, fmt.Errorf("reading %s: %w", file.Path, err)
+		}
+		var commands []bson.D
+		if err := bson.UnmarshalExtJSON(body, true, &commands); err != nil {
+			return ApplyPlan{}, fmt.Errorf("unmarshaling migration commands of %s: %w", file.Path, err)
+		}
+		plan.Steps = append(plan.Steps, ChangelogEntry{
+			Version: file.Version,
+			Name:    file.Name,
+			Changes: summarizeCommands(withoutAnnotations(commands)),
+		})
+	}
+
+	changes, err := migrationChanges(pending)
+	if err != nil {
+		return ApplyPlan{}, err
+	}
+	plan.Destructive = destructiveChanges(changes)
+	return plan, nil
+}
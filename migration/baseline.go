@@ -0,0 +1,183 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/database/mongodb"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ltman/mondex/db"
+)
+
+// Baseline records the version as applied to the database without running
+// any migration, so a database whose indexes already exist adopts the
+// directory and apply only runs the newer migrations. Version 0 takes the
+// latest migration of the directory. Databases with a recorded version are
+// refused. It returns the version recorded.
+func Baseline(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+	migrationDir string,
+	version uint64,
+	lockOptions LockOptions,
+) (uint64, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := checkMigrationDir(migrationDir); err != nil {
+		return 0, err
+	}
+	migrations := dirSource(migrationDir)
+
+	version, err = baselineVersion(migrations, version)
+	if err != nil {
+		return 0, err
+	}
+
+	err = withMigrationLock(ctx, logger, compiled, mongoURI, databaseName, lockOptions, func(d *commandDriver) error {
+		current, _, err := db.MigrationVersion(ctx, d.db)
+		if err != nil {
+			return err
+		}
+		if current != db.NilVersion {
+			return fmt.Errorf("%s is already at version %d, only databases without a recorded version can be baselined",
+				databaseName, current)
+		}
+
+		logger.Info("Recording version as applied without running migrations", "version", version,
+			"name", migrations.names()[version])
+		if err := d.SetVersion(int(version), false); err != nil {
+			return fmt.Errorf("failed to record version %d: %w", version, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// withMigrationLock connects to the database and calls fn holding its
+// migration lock, so the version fn reads and records can't change under it
+// as an apply runs.
+func withMigrationLock(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings compiledSettings,
+	mongoURI, databaseName string,
+	lockOptions LockOptions,
+	fn func(d *commandDriver) error,
+) (err error) {
+	logger.Debug("Connecting to MongoDB")
+	client, err := settings.connect(ctx, mongoURI)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer func() {
+		if err := settings.disconnect(ctx, client); err != nil {
+			logger.Error("Failed to disconnect from MongoDB", "error", err)
+		}
+	}()
+	database := client.Database(databaseName)
+
+	driver, err := mongodb.WithInstance(client, &mongodb.Config{DatabaseName: databaseName})
+	if err != nil {
+		return fmt.Errorf("failed to create golang-migrate driver: %w", err)
+	}
+	if err := db.EnsureLockIndex(ctx, database); err != nil {
+		return err
+	}
+	d := &commandDriver{
+		Driver:     driver,
+		ctx:        ctx,
+		logger:     logger,
+		client:     client,
+		db:         database,
+		connection: settings.connection,
+		options:    ApplyOptions{Lock: lockOptions},
+	}
+
+	if err := d.Lock(); err != nil {
+		return fmt.Errorf("failed to lock database: %w", err)
+	}
+	defer func() {
+		if unlockErr := d.Unlock(); unlockErr != nil && err == nil {
+			err = fmt.Errorf("failed to unlock database: %w", unlockErr)
+		}
+	}()
+	return fn(d)
+}
+
+// baselineVersion returns the version of the up migration to baseline at,
+// the latest one when version is 0.
+func baselineVersion(migrations migrationSource, version uint64) (uint64, error) {
+	files, err := migrations.files()
+	if err != nil {
+		return 0, err
+	}
+
+	var latest uint64
+	for _, file := range files {
+		if file.Direction != "up" {
+			continue
+		}
+		if version != 0 && file.Version == version {
+			return version, nil
+		}
+		latest = max(latest, file.Version)
+	}
+	switch {
+	case version != 0:
+		return 0, fmt.Errorf("no up migration with version %d in %s", version, migrations)
+	case latest == 0:
+		return 0, fmt.Errorf("no migrations found in %s", migrations)
+	}
+	return latest, nil
+}
+
+// checkExistingIndexes fails when no version is recorded yet but indexes
+// the pending migrations create already exist, as in a database created
+// before adopting mondex, whose history shouldn't be replayed.
+func checkExistingIndexes(ctx context.Context, database *mongo.Database, migrations migrationSource) error {
+	version, _, err := db.MigrationVersion(ctx, database)
+	if err != nil || version != db.NilVersion {
+		return err
+	}
+
+	changes, err := pendingChanges(ctx, database, migrations)
+	if err != nil {
+		return fmt.Errorf("failed to read pending migrations: %w", err)
+	}
+	var created bool
+	for _, change := range changes {
+		created = created || change.Operation == "createIndex"
+	}
+	if !created {
+		return nil
+	}
+
+	current, err := db.ReadCurrentSchema(ctx, database, 1)
+	if err != nil {
+		return fmt.Errorf("failed to read current schema: %w", err)
+	}
+	var existing []string
+	for _, change := range changes {
+		if change.Operation == "createIndex" && findIndex(current, change.Collection, change.IndexName) != nil {
+			existing = append(existing, fmt.Sprintf("  %d_%s: %s.%s", change.Version, change.Migration,
+				change.Collection, change.IndexName))
+		}
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("no migration is recorded in %s but %d index(es) the migrations create already exist:\n%s\n"+
+		"run mondex baseline to record the migrations they come from as applied instead of replaying them",
+		database.Name(), len(existing), strings.Join(existing, "\n"))
+}
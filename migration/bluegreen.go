@@ -0,0 +1,323 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/schema"
+)
+
+// verifyIndexesCommand gates a migration on indexes being built and used.
+// apply checks it before running the migration and stops there otherwise.
+// Commands are marshalled from maps, so the name must sort before "indexes"
+// to remain the first field.
+const verifyIndexesCommand = "assertIndexesUsed"
+
+// replacementVersionRegex matches the version suffix of a replacement index
+// name, e.g. _v2 in email_1_v2.
+var replacementVersionRegex = regexp.MustCompile(`_v([0-9]+)$`)
+
+// indexRename renames a declared index.
+type indexRename struct {
+	Collection string
+	From, To   string
+}
+
+// blueGreenPlan replaces modified indexes without a window where neither the
+// old nor the new definition exists.
+type blueGreenPlan struct {
+	// Phases create the replacements, then drop the old indexes once apply
+	// verified the replacements are built and used.
+	Phases []generatedMigration
+	// Renames give the declared indexes the names of their replacements.
+	Renames []indexRename
+	// Unchanged is the declared schema with the modified indexes as they
+	// currently are, for the other changes to be migrated separately.
+	Unchanged []schema.Schema
+	// Replaced is the declared schema once the replacements are in place.
+	Replaced []schema.Schema
+}
+
+// replacementName returns the name of the index replacing the named one,
+// bumping its version suffix.
+func replacementName(name string) string {
+	if match := replacementVersionRegex.FindStringSubmatchIndex(name); match != nil {
+		version, _ := strconv.Atoi(name[match[2]:match[3]])
+		return name[:match[0]] + "_v" + strconv.Itoa(version+1)
+	}
+	return name + "_v2"
+}
+
+// planBlueGreen plans the replacement of the indexes declared with the name of
+// a current index but another definition. MongoDB can't rename indexes, so the
+// replacement keeps its new name.
+func planBlueGreen(settings compiledSettings, current, declared []schema.Schema, logger *slog.Logger) (blueGreenPlan, error) {
+	plan := blueGreenPlan{Unchanged: slices.Clone(declared), Replaced: slices.Clone(declared)}
+
+	var replacements, replaced []schema.Schema
+	for i, ds := range declared {
+		j := slices.IndexFunc(current, func(cs schema.Schema) bool { return cs.Collection == ds.Collection })
+		if j < 0 {
+			continue
+		}
+
+		unchanged := slices.Clone(ds.Indexes)
+		final := slices.Clone(ds.Indexes)
+		var news, olds []schema.Index
+		for k, index := range ds.Indexes {
+			l := slices.IndexFunc(current[j].Indexes, func(ci schema.Index) bool { return ci.Name == index.Name })
+			if l < 0 || sameIndex(settings, current[j].Indexes[l], index) {
+				continue
+			}
+			if sameSignature(current[j].Indexes[l], index) {
+				logger.Warn("Index options changed without its key, collation or filter, it can't be replaced side by side",
+					"collection", ds.Collection, "index", index.Name)
+				continue
+			}
+
+			replacement := index.WithoutAnnotations()
+			replacement.Name = replacementName(index.Name)
+			logger.Debug("Index to replace", "collection", ds.Collection, "index", index.Name, "replacement", replacement.Name)
+
+			unchanged[k] = current[j].Indexes[l]
+			final[k].Name = replacement.Name
+			news = append(news, replacement)
+			olds = append(olds, current[j].Indexes[l])
+			plan.Renames = append(plan.Renames, indexRename{Collection: ds.Collection, From: index.Name, To: replacement.Name})
+		}
+		if len(news) == 0 {
+			continue
+		}
+
+		plan.Unchanged[i].Indexes = unchanged
+		plan.Replaced[i].Indexes = final
+		replacements = append(replacements, schema.Schema{Collection: ds.Collection, Indexes: news})
+		replaced = append(replaced, schema.Schema{Collection: ds.Collection, Indexes: olds})
+	}
+	if len(replacements) == 0 {
+		return plan, nil
+	}
+
+	createUp, err := json.MarshalIndent(generateCreateIndexesCommands(replacements), "", "  ")
+	if err != nil {
+		return blueGreenPlan{}, err
+	}
+	createDown, err := json.MarshalIndent(generateDestroyIndexCommands(replacements), "", "  ")
+	if err != nil {
+		return blueGreenPlan{}, err
+	}
+	swapUp, err := json.MarshalIndent(
+		append(generateVerifyIndexesCommands(replacements), generateDestroyIndexCommands(replaced)...), "", "  ")
+	if err != nil {
+		return blueGreenPlan{}, err
+	}
+	swapDown, err := json.MarshalIndent(generateCreateIndexesCommands(replaced), "", "  ")
+	if err != nil {
+		return blueGreenPlan{}, err
+	}
+
+	plan.Phases = []generatedMigration{
+		{Suffix: "_create_replacements", Up: createUp, Down: createDown},
+		{Suffix: "_drop_replaced", Up: swapUp, Down: swapDown},
+	}
+	return plan, nil
+}
+
+// sameSignature reports whether the indexes have the same key, collation and
+// partial filter, which MongoDB refuses to create twice under different names.
+// Keys compare in order whatever the configured comparison, as the server's do.
+func sameSignature(a, b schema.Index) bool {
+	signature := func(i schema.Index) schema.Index {
+		return schema.Index{Key: i.Key, Collation: i.Collation, PartialFilterExpression: i.PartialFilterExpression}
+	}
+	return signature(a).EqualWith(signature(b), schema.DefaultComparison)
+}
+
+// generateVerifyIndexesCommands generates the commands gating a migration on
+// indexes, checked by apply before running it.
+func generateVerifyIndexesCommands(schemas []schema.Schema) []map[string]interface{} {
+	commands := make([]map[string]interface{}, 0, len(schemas))
+
+	for _, s := range schemas {
+		indexes := make([]string, 0, len(s.Indexes))
+		for _, index := range s.Indexes {
+			indexes = append(indexes, index.Name)
+		}
+
+		commands = append(commands, map[string]interface{}{
+			verifyIndexesCommand: s.Collection,
+			"indexes":            indexes,
+		})
+	}
+
+	return commands
+}
+
+// renameDeclaredIndexes gives the declared indexes the names of their
+// replacements in the schema file.
+func renameDeclaredIndexes(logger *slog.Logger, settings compiledSettings, schemaFilePath string, renames []indexRename) error {
+	declared, err := readDeclaredSchema(schemaFilePath)
+	if err != nil {
+		return fmt.Errorf("reading declared schema: %w", err)
+	}
+
+	for _, rename := range renames {
+		i := slices.IndexFunc(declared, func(s schema.Schema) bool { return s.Collection == rename.Collection })
+		if i < 0 {
+			continue
+		}
+		if j := slices.IndexFunc(declared[i].Indexes, func(index schema.Index) bool { return index.Name == rename.From }); j >= 0 {
+			declared[i].Indexes[j].Name = rename.To
+		}
+	}
+
+	schemas, err := marshalSchemas(settings, schemaFilePath, declared)
+	if err != nil {
+		return fmt.Errorf("marshalling schema: %w", err)
+	}
+
+	logger.Info("Renaming replaced indexes in schema file", "path", schemaFilePath, "indexes", len(renames))
+	if err := writeSchemaFile(settings, schemaFilePath, schemas); err != nil {
+		return fmt.Errorf("writing declared schema: %w", err)
+	}
+	return nil
+}
+
+// replacementGate is a pending migration gated on replacement indexes.
+type replacementGate struct {
+	Version uint64
+	// Previous is the version to migrate to before verifying; zero when the
+	// gate is the first migration.
+	Previous uint64
+	Checks   []bson.D
+}
+
+// nextReplacementGate finds the first pending migration gated on replacement
+// indexes.
+func nextReplacementGate(migrations migrationSource, version int) (replacementGate, bool, error) {
+	files, err := migrations.files()
+	if err != nil {
+		return replacementGate{}, false, err
+	}
+
+	var previous uint64
+	if version != db.NilVersion {
+		previous = uint64(version)
+	}
+	for _, file := range files {
+		if file.Direction != "up" || (version != db.NilVersion && file.Version <= uint64(version)) {
+			continue
+		}
+
+		var checks []bson.D
+		if file.Extension == "json" {
+			body, err := file.read()
+			if err != nil {
+				return replacementGate{}, false, fmt.Errorf("reading %s: %w", file.Path, err)
+			}
+			var commands []bson.D
+			if err := bson.UnmarshalExtJSON(body, true, &commands); err == nil {
+				for _, command := range commands {
+					if len(command) > 0 && command[0].Key == verifyIndexesCommand {
+						checks = append(checks, command)
+					}
+				}
+			}
+		}
+		if len(checks) > 0 {
+			return replacementGate{Version: file.Version, Previous: previous, Checks: checks}, true, nil
+		}
+		previous = file.Version
+	}
+	return replacementGate{}, false, nil
+}
+
+// migrateUp applies the pending migrations up to the version, math.MaxUint64
+// applying them all, stopping before a migration gated on replacement indexes
+// until they are built and used.
+func migrateUp(ctx context.Context, logger *slog.Logger, migrator *migrate.Migrate, d *commandDriver, migrations migrationSource, upTo uint64) error {
+	for {
+		version, _, err := db.MigrationVersion(ctx, d.db)
+		if err != nil {
+			return err
+		}
+		gate, ok, err := nextReplacementGate(migrations, version)
+		if err != nil {
+			return err
+		}
+		if !ok || gate.Version > upTo {
+			if upTo == math.MaxUint64 {
+				return migrator.Up()
+			}
+			return migrator.Migrate(uint(upTo))
+		}
+
+		if gate.Previous > 0 && (version == db.NilVersion || gate.Previous > uint64(version)) {
+			if err := migrator.Migrate(uint(gate.Previous)); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+				return err
+			}
+		}
+
+		if err := d.verifyReplacements(gate.Checks); err != nil {
+			logger.Warn("Stopping before migration dropping replaced indexes, apply again later",
+				"version", gate.Version, "reason", err)
+			return nil
+		}
+
+		if err := migrator.Migrate(uint(gate.Version)); err != nil {
+			return err
+		}
+	}
+}
+
+// verifyReplacements checks that the indexes of the gate's commands exist,
+// finished building and served queries.
+func (d *commandDriver) verifyReplacements(checks []bson.D) error {
+	builds, err := db.CurrentIndexBuilds(d.ctx, d.client, d.db.Name())
+	if err != nil {
+		return err
+	}
+
+	for _, check := range checks {
+		collection, _ := check[0].Value.(string)
+		var body struct {
+			Indexes []string `bson:"indexes"`
+		}
+		if err := decodeCommand(check, &body); err != nil {
+			return err
+		}
+
+		usage, err := db.ReadIndexUsage(d.ctx, d.db, collection)
+		if err != nil {
+			return err
+		}
+		for _, name := range body.Indexes {
+			if slices.ContainsFunc(builds, func(b db.IndexBuild) bool {
+				return b.Collection == collection && (len(b.Indexes) == 0 || slices.Contains(b.Indexes, name))
+			}) {
+				return fmt.Errorf("index %s.%s is still building", collection, name)
+			}
+			u, ok := usage[name]
+			if !ok {
+				return fmt.Errorf("index %s.%s doesn't exist", collection, name)
+			}
+			if u.Ops == 0 {
+				return fmt.Errorf("index %s.%s hasn't served queries since %s", collection, name, u.Since.Format(time.RFC3339))
+			}
+			d.logger.Info("Replacement index verified", "collection", collection, "index", name, "ops", u.Ops)
+		}
+	}
+	return nil
+}
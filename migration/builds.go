@@ -0,0 +1,79 @@
+package migration
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/schema"
+)
+
+// indexBuilds returns the names of the indexes of the live schema still being
+// built, by collection.
+func indexBuilds(schemas []schema.Schema) map[string][]string {
+	building := make(map[string][]string)
+	for _, s := range schemas {
+		for _, index := range s.Indexes {
+			if index.Building {
+				building[s.Collection] = append(building[s.Collection], index.Name)
+			}
+		}
+	}
+	return building
+}
+
+// logIndexBuilds warns about every index still being built, with the progress
+// $currentOp reports for it when available.
+func logIndexBuilds(
+	ctx context.Context,
+	logger *slog.Logger,
+	client *mongo.Client,
+	databaseName string,
+	building map[string][]string,
+	message string,
+) {
+	if len(building) == 0 {
+		return
+	}
+
+	builds, err := db.CurrentIndexBuilds(ctx, client, databaseName)
+	if err != nil {
+		logger.Debug("Failed to read index build progress", "error", err)
+	}
+
+	for _, collection := range slices.Sorted(maps.Keys(building)) {
+		for _, name := range building[collection] {
+			attrs := []any{"collection", collection, "index", name}
+			i := slices.IndexFunc(builds, func(b db.IndexBuild) bool {
+				return b.Collection == collection && slices.Contains(b.Indexes, name)
+			})
+			if i >= 0 {
+				attrs = append(attrs, "phase", builds[i].Phase)
+				if percent := builds[i].Percent(); percent >= 0 {
+					attrs = append(attrs, "percent", int(percent))
+				}
+			}
+			logger.Warn(message, attrs...)
+		}
+	}
+}
+
+// withoutIndexes returns the schemas without the named indexes, by collection.
+func withoutIndexes(schemas []schema.Schema, names map[string][]string) []schema.Schema {
+	if len(names) == 0 {
+		return schemas
+	}
+
+	filtered := make([]schema.Schema, 0, len(schemas))
+	for _, s := range schemas {
+		s.Indexes = slices.DeleteFunc(slices.Clone(s.Indexes), func(index schema.Index) bool {
+			return slices.Contains(names[s.Collection], index.Name)
+		})
+		filtered = append(filtered, s)
+	}
+	return filtered
+}
@@ -0,0 +1,162 @@
+package migration
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ltman/mondex/db"
+)
+
+// ChangelogEntry summarizes the up migration of one version.
+type ChangelogEntry struct {
+	Version uint64
+	Name    string
+	Changes []CollectionChange
+}
+
+// CollectionChange lists what a migration does to one collection.
+type CollectionChange struct {
+	Collection string
+	Created    []string
+	Dropped    []string
+	// Commands names any other commands run against the collection.
+	Commands []string
+}
+
+// ReadChangelog summarizes the up migrations of the directory, oldest first.
+func ReadChangelog(migrationDir string) ([]ChangelogEntry, error) {
+	files, err := listMigrationFiles(migrationDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ChangelogEntry
+	for _, file := range files {
+		if file.Direction != "up" {
+			continue
+		}
+
+		body, err := file.read()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", file.Path, err)
+		}
+
+		var commands []bson.D
+		if err := bson.UnmarshalExtJSON(body, true, &commands); err != nil {
+			return nil, fmt.Errorf("unmarshaling migration commands of %s: %w", file.Path, err)
+		}
+
+		entries = append(entries, ChangelogEntry{
+			Version: file.Version,
+			Name:    file.Name,
+			Changes: summarizeCommands(withoutAnnotations(commands)),
+		})
+	}
+
+	return entries, nil
+}
+
+// summarizeCommands groups the effects of migration commands by collection.
+func summarizeCommands(commands []bson.D) []CollectionChange {
+	var changes []CollectionChange
+	change := func(collection string) *CollectionChange {
+		i := slices.IndexFunc(changes, func(c CollectionChange) bool { return c.Collection == collection })
+		if i < 0 {
+			changes = append(changes, CollectionChange{Collection: collection})
+			i = len(changes) - 1
+		}
+		return &changes[i]
+	}
+
+	for _, command := range commands {
+		if len(command) == 0 {
+			continue
+		}
+		name := command[0].Key
+		collection, _ := command[0].Value.(string)
+
+		switch name {
+		case "createIndexes":
+			c := change(collection)
+			c.Created = append(c.Created, createdIndexNames(command)...)
+		case "dropIndexes":
+			c := change(collection)
+			c.Dropped = append(c.Dropped, droppedIndexNames(command)...)
+		default:
+			c := change(collection)
+			if !slices.Contains(c.Commands, name) {
+				c.Commands = append(c.Commands, name)
+			}
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b CollectionChange) int {
+		return cmp.Compare(a.Collection, b.Collection)
+	})
+	return changes
+}
+
+// droppedIndexNames returns the index names of a dropIndexes command.
+func droppedIndexNames(command bson.D) []string {
+	var names []string
+	for _, e := range command {
+		if e.Key != "index" {
+			continue
+		}
+		switch index := e.Value.(type) {
+		case string:
+			names = append(names, index)
+		case bson.A:
+			for _, name := range index {
+				if name, ok := name.(string); ok {
+					names = append(names, name)
+				}
+			}
+		case bson.D:
+			names = append(names, bsonKeySpec(index))
+		}
+	}
+	return names
+}
+
+// bsonKeySpec renders an index key given instead of an index name.
+func bsonKeySpec(key bson.D) string {
+	data, err := bson.MarshalExtJSON(key, false, false)
+	if err != nil {
+		return fmt.Sprint(key)
+	}
+	return string(data)
+}
+
+// ReadAppliedVersion connects to MongoDB and returns the version recorded by
+// golang-migrate, db.NilVersion when nothing was applied, and whether the last
+// migration failed midway.
+func ReadAppliedVersion(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+) (int, bool, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return 0, false, err
+	}
+
+	logger.Debug("Connecting to MongoDB")
+	client, err := compiled.connect(ctx, mongoURI)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer func() {
+		if err := compiled.disconnect(ctx, client); err != nil {
+			logger.Error("Failed to disconnect from MongoDB", "error", err)
+		}
+	}()
+
+	return db.MigrationVersion(ctx, client.Database(databaseName))
+}
@@ -0,0 +1,92 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// SchemaDifference is where the live database differs from the declared
+// schema.
+type SchemaDifference struct {
+	Collection string `json:"collection"`
+	Index      string `json:"index,omitempty"`
+	Difference string `json:"difference"`
+}
+
+func (d SchemaDifference) String() string {
+	return readOnlyDrift(d).String()
+}
+
+// CheckSchema connects to MongoDB and lists where the database differs from
+// the declared schema, as diff sees it: ignored collections, suppressed
+// differences, managed_collections_only and read-only collections are taken
+// into account. Nothing is written.
+func CheckSchema(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+	diffOptions DiffOptions,
+) ([]SchemaDifference, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	// Users and roles aren't part of the schema checked.
+	diffOptions.AccessFilePath = ""
+	diffOptions.Owner, diffOptions.Collections = "", nil
+	diffOptions.Source, diffOptions.StatePath = SourceDatabase, ""
+	plan, err := generateMigrationScripts(ctx, logger, compiled, mongoURI, databaseName, diffOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare the database with the declared schema: %w", err)
+	}
+
+	var differences []SchemaDifference
+	for _, m := range schemaMismatches(compiled, plan.Current, plan.Declared) {
+		differences = append(differences, SchemaDifference{Collection: m.Collection, Index: m.Index, Difference: m.Problem})
+	}
+	for _, ds := range plan.Declared {
+		i := slices.IndexFunc(plan.Current, func(cs schema.Schema) bool { return cs.Collection == ds.Collection })
+		switch {
+		case i < 0 && ds.HasOptions():
+			differences = append(differences, SchemaDifference{Collection: ds.Collection, Difference: "collection with options missing"})
+		case i >= 0 && !ds.OptionsMatch(plan.Current[i]):
+			differences = append(differences, SchemaDifference{Collection: ds.Collection, Difference: "options differ"})
+		}
+		var cs schema.Schema
+		if i >= 0 {
+			cs = plan.Current[i]
+		}
+		for _, index := range ds.SearchIndexes {
+			switch live := cs.FindSearchIndex(index.Name); {
+			case live == nil:
+				differences = append(differences, SchemaDifference{Collection: ds.Collection, Index: index.Name, Difference: "search index missing"})
+			case !live.Equal(index):
+				differences = append(differences, SchemaDifference{Collection: ds.Collection, Index: index.Name, Difference: "search index differs"})
+			}
+		}
+		for _, index := range cs.SearchIndexes {
+			if ds.FindSearchIndex(index.Name) == nil {
+				differences = append(differences, SchemaDifference{Collection: ds.Collection, Index: index.Name, Difference: "search index not declared"})
+			}
+		}
+		if !ds.ManagesValidation() {
+			continue
+		}
+		switch {
+		case i < 0 && ds.HasValidation():
+			differences = append(differences, SchemaDifference{Collection: ds.Collection, Difference: "validator missing"})
+		case i >= 0 && !ds.ValidationEqual(plan.Current[i]):
+			differences = append(differences, SchemaDifference{Collection: ds.Collection, Difference: "validator differs"})
+		}
+	}
+	for _, d := range plan.ReadOnlyDrift {
+		differences = append(differences, SchemaDifference(d))
+	}
+	return differences, nil
+}
@@ -0,0 +1,211 @@
+package migration
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ProblemKind is a kind of problem found in the migration directory.
+type ProblemKind string
+
+const (
+	ProblemMissingDown ProblemKind = "up migration without down migration"
+	ProblemMissingUp   ProblemKind = "down migration without up migration"
+	ProblemDuplicate   ProblemKind = "duplicate version"
+	ProblemEmpty       ProblemKind = "empty migration file"
+	// ProblemGap is informational: golang-migrate applies migrations across gaps.
+	ProblemGap ProblemKind = "gap in version numbering"
+)
+
+// sequentialVersionLimit bounds the versions checked for gaps; higher versions
+// are taken for timestamps, which have gaps by design.
+const sequentialVersionLimit = 1_000_000
+
+// emptyMigration is the content of a JSON migration running no commands.
+var emptyMigration = []byte("[]\n")
+
+// MigrationProblem is a problem found in the migration directory, as left
+// behind by aborted or concurrent generations.
+type MigrationProblem struct {
+	Kind    ProblemKind
+	Version uint64
+	// Paths are the offending files, which Delete removes.
+	Paths []string
+	// Missing is the first version of a gap and, with Version, bounds it.
+	Missing uint64
+}
+
+func (p MigrationProblem) String() string {
+	if p.Kind == ProblemGap {
+		if p.Missing == p.Version-1 {
+			return fmt.Sprintf("%s: version %d is missing", p.Kind, p.Missing)
+		}
+		return fmt.Sprintf("%s: versions %d to %d are missing", p.Kind, p.Missing, p.Version-1)
+	}
+	return fmt.Sprintf("%s: version %d: %s", p.Kind, p.Version, strings.Join(p.Paths, ", "))
+}
+
+// FixAction describes what Fix does, or is empty when the problem can only be
+// deleted or reported.
+func (p MigrationProblem) FixAction() string {
+	switch p.Kind {
+	case ProblemMissingDown:
+		return "write an empty down migration, making the migration irreversible"
+	case ProblemEmpty:
+		return "write an empty list of commands"
+	case ProblemDuplicate:
+		return "renumber to the next free version"
+	}
+	return ""
+}
+
+// CanDelete reports whether Delete applies to the problem.
+func (p MigrationProblem) CanDelete() bool {
+	return p.Kind != ProblemGap && len(p.Paths) > 0
+}
+
+// Fix repairs the problem as described by FixAction, writing files as the
+// settings set.
+func (p MigrationProblem) Fix(settings Settings) error {
+	if p.FixAction() == "" {
+		return fmt.Errorf("%s can't be fixed", p.Kind)
+	}
+	compiled, err := settings.compile()
+	if err != nil {
+		return err
+	}
+
+	switch p.Kind {
+	case ProblemMissingDown:
+		up := p.Paths[0]
+		down := strings.TrimSuffix(up, ".up.json") + ".down.json"
+		return compiled.permissions.Write(down, emptyMigration)
+	case ProblemEmpty:
+		return compiled.permissions.Write(p.Paths[0], emptyMigration)
+	default:
+		return renumberMigration(p.Paths)
+	}
+}
+
+// Delete removes the offending files.
+func (p MigrationProblem) Delete() error {
+	for _, path := range p.Paths {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckMigrationDir finds migrations missing their up or down file, versions
+// used by several migrations, empty files and gaps in sequential numbering.
+func CheckMigrationDir(migrationDir string) ([]MigrationProblem, error) {
+	files, err := listMigrationFiles(migrationDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []MigrationProblem
+	var versions []uint64
+	for i := 0; i < len(files); {
+		version := files[i].Version
+		end := i
+		for end < len(files) && files[end].Version == version {
+			end++
+		}
+		problems = append(problems, versionProblems(files[i:end])...)
+		versions = append(versions, version)
+		i = end
+	}
+
+	for _, file := range files {
+		if info, err := os.Stat(file.Path); err == nil && info.Size() == 0 {
+			problems = append(problems, MigrationProblem{Kind: ProblemEmpty, Version: file.Version, Paths: []string{file.Path}})
+		}
+	}
+
+	if len(versions) > 0 && versions[len(versions)-1] < sequentialVersionLimit {
+		previous := uint64(0)
+		for _, version := range versions {
+			if version > previous+1 {
+				problems = append(problems, MigrationProblem{Kind: ProblemGap, Version: version, Missing: previous + 1})
+			}
+			previous = version
+		}
+	}
+
+	slices.SortStableFunc(problems, func(a, b MigrationProblem) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return problems, nil
+}
+
+// versionProblems checks the files sharing a version. The first migration by
+// name keeps the version; the others are duplicates.
+func versionProblems(files []migrationFile) []MigrationProblem {
+	var problems []MigrationProblem
+
+	var migrations []string
+	for _, file := range files {
+		migration := file.Name + "." + file.Extension
+		if !slices.Contains(migrations, migration) {
+			migrations = append(migrations, migration)
+		}
+	}
+	slices.Sort(migrations)
+
+	for i, migration := range migrations {
+		var paths []string
+		var up, down string
+		for _, file := range files {
+			if file.Name+"."+file.Extension != migration {
+				continue
+			}
+			paths = append(paths, file.Path)
+			if file.Direction == "up" {
+				up = file.Path
+			} else {
+				down = file.Path
+			}
+		}
+
+		version := files[0].Version
+		switch {
+		case down == "":
+			problems = append(problems, MigrationProblem{Kind: ProblemMissingDown, Version: version, Paths: []string{up}})
+		case up == "":
+			problems = append(problems, MigrationProblem{Kind: ProblemMissingUp, Version: version, Paths: []string{down}})
+		}
+		if i > 0 {
+			problems = append(problems, MigrationProblem{Kind: ProblemDuplicate, Version: version, Paths: paths})
+		}
+	}
+	return problems
+}
+
+// renumberMigration moves the files of a migration to the version after the
+// highest one of their directory.
+func renumberMigration(paths []string) error {
+	dir := filepath.Dir(paths[0])
+	files, err := listMigrationFiles(dir)
+	if err != nil {
+		return err
+	}
+	version := files[len(files)-1].Version + 1
+
+	for _, path := range paths {
+		match := migrationFileRegex.FindStringSubmatch(filepath.Base(path))
+		if match == nil {
+			return fmt.Errorf("%s is not a migration file", path)
+		}
+		renamed := filepath.Join(dir, fmt.Sprintf("%06d_%s.%s.%s", version, match[2], match[3], match[4]))
+		if err := os.Rename(path, renamed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
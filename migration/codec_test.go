@@ -0,0 +1,68 @@
+package migration
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ltman/mondex/schema"
+)
+
+func TestFormatRegisteredCodec(t *testing.T) {
+	schema.RegisterCodec(schema.Codec{
+		Name:       "base64",
+		Extensions: []string{".b64"},
+		ToJSON: func(data []byte) ([]byte, error) {
+			return base64.StdEncoding.AppendDecode(nil, data)
+		},
+		FromJSON: func(data []byte, _ int) ([]byte, error) {
+			return base64.StdEncoding.AppendEncode(nil, data), nil
+		},
+	})
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "schema.b64")
+	declared := `[{"collection": "users", "indexes": [{"name": "email_1", "key": {"email": 1}}]}]`
+	if err := os.WriteFile(path, base64.StdEncoding.AppendEncode(nil, []byte(declared)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Formatting writes back in the format of the file.
+	if err := FormatSchemaFile(context.Background(), discardLogger(), Settings{}, path, FormatOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted, err := base64.StdEncoding.AppendDecode(nil, data)
+	if err != nil {
+		t.Fatalf("formatted file isn't in the format of its extension: %v", err)
+	}
+	if !strings.Contains(string(formatted), `"email_1"`) {
+		t.Errorf("formatted schema lost the index:\n%s", formatted)
+	}
+
+	// --to takes the codec names, and the converted file its extension.
+	if err := FormatSchemaFile(context.Background(), discardLogger(), Settings{}, path, FormatOptions{To: "json"}); err != nil {
+		t.Fatal(err)
+	}
+	schemas, err := readDeclaredSchema(filepath.Join(dir, "schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schemas) != 1 || schemas[0].Collection != "users" {
+		t.Errorf("converted schema = %+v", schemas)
+	}
+	if err := FormatSchemaFile(context.Background(), discardLogger(), Settings{}, filepath.Join(dir, "schema.json"), FormatOptions{To: "base64"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := FormatSchemaFile(context.Background(), discardLogger(), Settings{}, path, FormatOptions{To: "toml"}); err == nil ||
+		!strings.Contains(err.Error(), "base64, hcl, json, yaml or dir") {
+		t.Errorf("unknown format: got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package migration
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// indexName is the name an index is matched by: its own, or the one the
+// server gives it when it's left out.
+func indexName(index schema.Index) string {
+	return cmp.Or(index.Name, schema.DefaultIndexName(index.Key))
+}
+
+// indexesDifference returns the indexes of i1 that i2 has none of the same
+// name of.
+func indexesDifference(i1, i2 []schema.Index) []schema.Index {
+	diff := make([]schema.Index, 0)
+	for _, i := range i1 {
+		if !slices.ContainsFunc(i2, func(si schema.Index) bool {
+			return indexName(si) == indexName(i)
+		}) {
+			diff = append(diff, i)
+		}
+	}
+	return diff
+}
+
+// modifiedIndexes returns the indexes of the current collection declared with
+// the same name but another definition, as they currently are and as
+// declared. Options the server fills in aren't differences.
+func modifiedIndexes(settings compiledSettings, current, declared schema.Schema) (olds, news []schema.Index) {
+	for _, index := range declared.Indexes {
+		live := findIndex([]schema.Schema{current}, current.Collection, indexName(index))
+		if live == nil || matchesDeclared(settings, index, *live) {
+			continue
+		}
+		olds = append(olds, *live)
+		news = append(news, index)
+	}
+	return olds, news
+}
+
+// matchesDeclared reports whether the live index is the declared one, once
+// both are canonicalized and the declared one has the options the server
+// fills in.
+func matchesDeclared(settings compiledSettings, declared, live schema.Index) bool {
+	return sameIndex(settings, live, withServerDefaults(declared, live))
+}
+
+// sameIndex reports whether the indexes are the same once canonicalized,
+// compared as the settings set.
+func sameIndex(settings compiledSettings, a, b schema.Index) bool {
+	return a.EqualWith(b, settings.comparison)
+}
+
+// withServerDefaults completes the declared index with the options the server
+// fills in when they aren't given, as reported for the live index.
+func withServerDefaults(declared, live schema.Index) schema.Index {
+	if len(live.Weights) > 0 {
+		declared.Key = live.Key
+		if len(declared.Weights) == 0 {
+			declared.Weights = live.Weights
+		}
+		if declared.DefaultLanguage == "" {
+			declared.DefaultLanguage = live.DefaultLanguage
+		}
+		if declared.LanguageOverride == "" {
+			declared.LanguageOverride = live.LanguageOverride
+		}
+		if declared.TextIndexVersion == 0 {
+			declared.TextIndexVersion = live.TextIndexVersion
+		}
+	}
+	if declared.SphereIndexVersion == 0 {
+		declared.SphereIndexVersion = live.SphereIndexVersion
+	}
+	if declared.Name == "" {
+		declared.Name = live.Name
+	}
+	return declared
+}
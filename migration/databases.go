@@ -0,0 +1,201 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/schema"
+)
+
+// DefaultExcludedDatabases are the databases of the server itself, left out
+// of cluster-wide inspection.
+var DefaultExcludedDatabases = []string{"admin", "config", "local"}
+
+// InspectAllDatabases inspects every database of the deployment but those
+// matching the exclude patterns, as those of ignore, and writes them as a
+// multi-database schema file: an object of the collection schemas of each
+// database, by name.
+func InspectAllDatabases(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI string,
+	readOptions db.ReadOptions,
+	schemaFilePath string,
+	exclude []string,
+	dryRun bool,
+) error {
+	compiled, err := settings.compile()
+	if err != nil {
+		return err
+	}
+
+	excluded, err := compileIgnoreRules(exclude)
+	if err != nil {
+		return fmt.Errorf("invalid database exclusion: %w", err)
+	}
+
+	logger.Debug("Connecting to MongoDB")
+	client, err := compiled.connect(ctx, mongoURI)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer func() {
+		if err := compiled.disconnect(ctx, client); err != nil {
+			logger.Error("Failed to disconnect from MongoDB", "error", err)
+		}
+	}()
+
+	names, err := db.ListDatabases(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	databases := make(map[string][]schema.Schema, len(names))
+	for _, name := range names {
+		if matchesAny(excluded, name) {
+			logger.Debug("Skipping excluded database", "database", name)
+			continue
+		}
+		logger.Info("Inspecting database", "database", name)
+		current, err := readDatabaseSchema(ctx, logger.With("database", name), compiled, client, name, readOptions)
+		if err != nil {
+			return fmt.Errorf("inspecting database %s: %w", name, err)
+		}
+		databases[name] = schema.CollapseBuckets(normalizeDeprecated(logger, current))
+	}
+
+	data, err := marshalDatabases(compiled, schemaFilePath, databases)
+	if err != nil {
+		return fmt.Errorf("encoding schemas: %w", err)
+	}
+
+	if dryRun {
+		logger.Info("Dry-run: showing schema without writing file")
+
+		fmt.Printf("Schema that would be written to %s:\n", schemaFilePath) //nolint:forbidigo
+		if _, err := os.Stdout.Write(data); err != nil {
+			return fmt.Errorf("writing current schema: %w", err)
+		}
+		return nil
+	}
+
+	logger.Info("Writing current schema to file", "path", schemaFilePath, "databases", len(databases))
+	if err := compiled.permissions.Write(schemaFilePath, data); err != nil {
+		return fmt.Errorf("writing current schema: %w", err)
+	}
+	return nil
+}
+
+// GenerateAllDatabasesMigrationScripts diffs every database of a
+// multi-database schema file against the deployment, writing the migrations
+// of each to a directory named after it in MigrationDir. Databases of the
+// deployment that aren't declared are left alone.
+func GenerateAllDatabasesMigrationScripts(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI string,
+	diffOptions DiffOptions,
+) error {
+	if diffOptions.BlueGreen {
+		return fmt.Errorf("blue_green can't rename the indexes of a multi-database schema file")
+	}
+
+	databases, err := readDeclaredDatabases(diffOptions.SchemaFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read declared schema: %w", err)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(databases)) {
+		if diffOptions.DryRun {
+			fmt.Printf("Database %s:\n", name) //nolint:forbidigo
+		}
+		options := diffOptions
+		options.DeclaredDatabase = name
+		options.MigrationDir = filepath.Join(diffOptions.MigrationDir, name)
+		options.StatePath, options.PreviewDir, options.Pager = "", "", nil
+		if err := GenerateMigrationScripts(ctx, logger.With("database", name), settings, mongoURI, name, options); err != nil {
+			return fmt.Errorf("database %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// hashDeclaredSchemaOf reads the declared schema, or with a database name,
+// the schema of that database in a multi-database schema file, and returns
+// the schema hash of the file as well.
+func hashDeclaredSchemaOf(path, database string) ([]schema.Schema, string, error) {
+	if database == "" {
+		return hashDeclaredSchema(path)
+	}
+
+	databases, hash, err := hashDeclaredDatabases(path)
+	if err != nil {
+		return nil, "", err
+	}
+	schemas, ok := databases[database]
+	if !ok {
+		return nil, "", fmt.Errorf("%s: database %s isn't declared", path, database)
+	}
+	return schemas, hash, nil
+}
+
+// readDeclaredDatabases reads a multi-database schema file.
+func readDeclaredDatabases(path string) (map[string][]schema.Schema, error) {
+	databases, _, err := hashDeclaredDatabases(path)
+	return databases, err
+}
+
+// hashDeclaredDatabases reads a multi-database schema file, like
+// readDeclaredDatabases, and returns its schema hash as well.
+func hashDeclaredDatabases(path string) (map[string][]schema.Schema, string, error) {
+	data, hash, err := hashSchemaFileData(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if !strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		return nil, "", fmt.Errorf("%s isn't a multi-database schema file, written by inspect --all-databases", path)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+	databases := make(map[string][]schema.Schema, len(raw))
+	for name, value := range raw {
+		schemas, err := parseDeclaredSchema(path, value)
+		if err != nil {
+			return nil, "", fmt.Errorf("database %s: %w", name, err)
+		}
+		databases[name] = schemas
+	}
+	return databases, hash, nil
+}
+
+// marshalDatabases encodes the schemas of every database as the schema file
+// at path, in the configured style.
+func marshalDatabases(settings compiledSettings, path string, databases map[string][]schema.Schema) ([]byte, error) {
+	styled := make(map[string][]schema.Schema, len(databases))
+	for name, schemas := range databases {
+		styled[name] = styleSchemas(settings, schemas)
+	}
+
+	formatStyle := settings.style
+	data, err := json.MarshalIndent(styled, "", strings.Repeat(" ", formatStyle.Indent))
+	if err != nil {
+		return nil, err
+	}
+	if codec := schemaCodec(path); !codec.IsJSON() {
+		return codec.FromJSON(data, formatStyle.Indent)
+	}
+	return append(data, '\n'), nil
+}
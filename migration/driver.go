@@ -0,0 +1,380 @@
+package migration
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ltman/mondex/db"
+)
+
+const (
+	replicationPollInterval = 2 * time.Second
+	indexBuildPollInterval  = time.Second
+)
+
+// commandDriver wraps the golang-migrate MongoDB driver and runs the migration
+// commands itself, so mondex can decorate them before they reach the server.
+// It takes the advisory lock itself to wait for it with backoff; version
+// bookkeeping is delegated to the wrapped driver.
+type commandDriver struct {
+	database.Driver
+
+	ctx    context.Context
+	logger *slog.Logger
+	// mongoURI and connection connect to the members and shards of the
+	// deployment, to check the indexes built on each.
+	mongoURI   string
+	connection db.ConnectionOptions
+	client     *mongo.Client
+	db         *mongo.Database
+	options    ApplyOptions
+
+	// sharded is set when connected through mongos; shards lists the shards
+	// to verify index builds on and may be empty when they can't be listed.
+	sharded bool
+	shards  []db.Shard
+
+	progress ProgressReporter
+	names    map[uint64]string
+	// version is the migration whose commands run next, as announced by
+	// golang-migrate marking it dirty right before calling Run.
+	version uint64
+	// outOfOrder holds the versions applied with apply --only, which are
+	// skipped when golang-migrate reaches them.
+	outOfOrder map[uint64]bool
+	// down is set when rolling back, golang-migrate then announcing the
+	// version preceding the migration whose down commands run next.
+	down bool
+}
+
+func (d *commandDriver) SetVersion(version int, dirty bool) error {
+	if err := d.Driver.SetVersion(version, dirty); err != nil {
+		return err
+	}
+	switch {
+	case dirty && d.down:
+		d.version = d.versionAfter(version)
+	case dirty && version >= 0:
+		d.version = uint64(version)
+	}
+	return nil
+}
+
+// Close leaves the client connected, unlike the wrapped driver: whoever
+// connected it disconnects it, once, on every path.
+func (d *commandDriver) Close() error {
+	return nil
+}
+
+// versionAfter returns the first version of the migration directory after the
+// given one, db.NilVersion coming before them all.
+func (d *commandDriver) versionAfter(version int) uint64 {
+	var next uint64
+	for v := range d.names {
+		if (version < 0 || v > uint64(version)) && (next == 0 || v < next) {
+			next = v
+		}
+	}
+	return next
+}
+
+func (d *commandDriver) Run(migration io.Reader) (err error) {
+	if d.outOfOrder[d.version] && !d.down {
+		d.logger.Info("Skipping migration already applied out of order", "version", d.version)
+		delete(d.outOfOrder, d.version)
+		return db.ForgetOutOfOrder(d.ctx, d.db, d.version)
+	}
+
+	run := db.MigrationRun{
+		Version:   d.version,
+		Name:      d.names[d.version],
+		Down:      d.down,
+		StartedAt: time.Now().UTC(),
+		AppliedBy: applierIdentity(),
+	}
+	d.progress.MigrationStarted(d.version, d.names[d.version])
+	defer func() {
+		d.progress.MigrationFinished(err)
+		d.recordRun(run, err)
+	}()
+
+	body, err := io.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+
+	var commands []bson.D
+	if err := bson.UnmarshalExtJSON(body, true, &commands); err != nil {
+		return fmt.Errorf("unmarshaling migration commands: %w", err)
+	}
+	if err := checkRequirements(commands); err != nil {
+		return err
+	}
+
+	for _, command := range commands {
+		started := time.Now()
+		err := d.runCommand(command)
+		if len(command) > 0 && !isAnnotation(command) {
+			collection, _ := command[0].Value.(string)
+			commandRun := db.CommandRun{
+				Command:    command[0].Key,
+				Collection: collection,
+				Indexes:    createdIndexNames(command),
+				StartedAt:  started.UTC(),
+				DurationMS: time.Since(started).Milliseconds(),
+			}
+			if err != nil {
+				commandRun.Error = err.Error()
+			}
+			run.Commands = append(run.Commands, commandRun)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordRun adds the migration run to the history. Failing to record it
+// doesn't fail the migration.
+func (d *commandDriver) recordRun(run db.MigrationRun, err error) {
+	run.FinishedAt = time.Now().UTC()
+	run.DurationMS = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	d.logger.Info("Migration finished", "version", run.Version, "name", run.Name,
+		"duration", time.Duration(run.DurationMS)*time.Millisecond, "failed", err != nil)
+	if err := db.RecordMigrationRun(d.ctx, d.db, run); err != nil {
+		d.logger.Warn("Failed to record migration run", "version", run.Version, "error", err)
+	}
+}
+
+func (d *commandDriver) runCommand(command bson.D) (err error) {
+	if len(command) == 0 {
+		return nil
+	}
+
+	name := command[0].Key
+	if isAnnotation(command) {
+		if name == lossyDownCommand {
+			d.logger.Warn("Down migration is lossy", "version", d.version, "reason", command[0].Value)
+		}
+		return nil
+	}
+
+	collection, _ := command[0].Value.(string)
+	d.progress.CommandStarted(name, collection, createdIndexNames(command))
+	defer func() {
+		d.progress.CommandFinished(err)
+	}()
+
+	if name == verifyIndexesCommand {
+		// Checked by apply before starting the migration.
+		return nil
+	}
+
+	if d.options.Atlas != nil && slices.Contains(searchIndexCommands, name) {
+		if err := d.runSearchCommand(command); err != nil {
+			return &database.Error{OrigErr: err, Err: fmt.Sprintf("failed to execute command: %v", command)}
+		}
+		return nil
+	}
+
+	writeConcern := d.options.WriteConcern.Document()
+	if len(writeConcern) > 0 && !hasField(command, "writeConcern") {
+		command = append(command, bson.E{Key: "writeConcern", Value: writeConcern})
+	}
+
+	stopWatching := func() {}
+	if name == "createIndexes" {
+		for _, field := range d.options.IndexBuilds.fields() {
+			if !hasField(command, field.Key) {
+				command = append(command, field)
+			}
+		}
+		stopWatching = d.watchIndexBuilds(collection)
+	}
+	response, err := d.db.RunCommand(d.ctx, command).Raw()
+	stopWatching()
+	if err != nil {
+		var commandErr mongo.CommandError
+		if d.sharded && errors.As(err, &commandErr) {
+			if shardErr := db.ShardFailures(commandErr.Raw); shardErr != nil {
+				err = shardErr
+			}
+		}
+		return &database.Error{OrigErr: err, Err: fmt.Sprintf("failed to execute command: %v", command)}
+	}
+
+	if d.sharded {
+		if err := d.verifyShards(command, response); err != nil {
+			return &database.Error{OrigErr: err, Err: fmt.Sprintf("command did not complete on every shard: %v", command)}
+		}
+	}
+
+	if d.options.WaitForSecondaries && name == "createIndexes" {
+		if err := d.waitForSecondaries(command); err != nil {
+			return &database.Error{OrigErr: err, Err: "indexes did not become ready on all members"}
+		}
+	}
+
+	return nil
+}
+
+// watchIndexBuilds polls $currentOp and reports the builds running on the
+// collection until the returned function is called. Without a progress
+// reporter the builds are logged every LogInterval instead.
+func (d *commandDriver) watchIndexBuilds(collection string) (stop func()) {
+	interval := indexBuildPollInterval
+	_, logged := d.progress.(nopProgress)
+	if logged {
+		interval = cmp.Or(d.options.IndexBuilds.LogInterval, DefaultIndexBuildLogInterval)
+	}
+
+	ctx, cancel := context.WithCancel(d.ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			builds, err := db.CurrentIndexBuilds(ctx, d.client, d.db.Name())
+			if err != nil {
+				d.logger.Debug("Failed to poll index builds", "error", err)
+				continue
+			}
+			builds = slices.DeleteFunc(builds, func(b db.IndexBuild) bool {
+				return b.Collection != collection
+			})
+			if logged {
+				d.logIndexBuildProgress(builds)
+			} else {
+				d.progress.IndexBuildsProgressed(builds)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// logIndexBuildProgress logs the progress of each index build, for runs
+// without a terminal display.
+func (d *commandDriver) logIndexBuildProgress(builds []db.IndexBuild) {
+	for _, build := range builds {
+		attrs := []any{"version", d.version, "collection", build.Collection, "indexes", build.Indexes,
+			"phase", build.Phase, "elapsed", build.Elapsed.Round(time.Second)}
+		if percent := build.Percent(); percent >= 0 {
+			attrs = append(attrs, "percent", math.Round(percent*10)/10, "done", build.Done, "total", build.Total)
+		}
+		if eta := build.ETA(); eta > 0 {
+			attrs = append(attrs, "eta", eta.Round(time.Second))
+		}
+		d.logger.Info("Index build in progress", attrs...)
+	}
+}
+
+// waitForSecondaries blocks until the indexes created by the command
+// exist on every data-bearing replica set member.
+func (d *commandDriver) waitForSecondaries(command bson.D) error {
+	collection, _ := command[0].Value.(string)
+	indexNames := createdIndexNames(command)
+	if collection == "" || len(indexNames) == 0 {
+		return nil
+	}
+
+	members, err := db.ReplicaSetMembers(d.ctx, d.client)
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return nil
+	}
+
+	ctx := d.ctx
+	if d.options.WaitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.options.WaitTimeout)
+		defer cancel()
+	}
+
+	d.logger.Info("Waiting for indexes on replica set members",
+		"collection", collection, "indexes", indexNames, "members", members)
+	return db.WaitForIndexes(ctx, d.mongoURI, d.connection, members, d.db.Name(), collection, indexNames, replicationPollInterval)
+}
+
+// verifyShards fails when mongos reports a partial failure for the command,
+// and for createIndexes also checks every shard directly for the new indexes.
+func (d *commandDriver) verifyShards(command bson.D, response bson.Raw) error {
+	if shardErr := db.ShardFailures(response); shardErr != nil {
+		return shardErr
+	}
+
+	if len(d.shards) == 0 || len(command) == 0 || command[0].Key != "createIndexes" {
+		return nil
+	}
+
+	collection, _ := command[0].Value.(string)
+	indexNames := createdIndexNames(command)
+	if collection == "" || len(indexNames) == 0 {
+		return nil
+	}
+
+	d.logger.Debug("Verifying indexes on every shard", "collection", collection, "indexes", indexNames)
+	return db.VerifyShardIndexes(d.ctx, d.mongoURI, d.connection, d.shards, d.db.Name(), collection, indexNames)
+}
+
+// createdIndexNames returns the index names declared by a createIndexes command.
+func createdIndexNames(command bson.D) []string {
+	var names []string
+	for _, e := range command {
+		if e.Key != "indexes" {
+			continue
+		}
+		indexes, _ := e.Value.(bson.A)
+		for _, index := range indexes {
+			doc, _ := index.(bson.D)
+			for _, field := range doc {
+				if name, ok := field.Value.(string); ok && field.Key == "name" {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// hasField reports whether the document has a top-level field with the given key.
+func hasField(doc bson.D, key string) bool {
+	for _, e := range doc {
+		if e.Key == key {
+			return true
+		}
+	}
+	return false
+}
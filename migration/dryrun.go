@@ -0,0 +1,101 @@
+package migration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DryRunSection is a part of the dry-run output a pager can fold: the
+// commands a migration runs on a collection, the suppressed differences or
+// the drift of read-only collections.
+type DryRunSection struct {
+	Title string
+	Lines []string
+}
+
+// DryRunPager shows the dry-run output of diff instead of printing it.
+type DryRunPager func(sections []DryRunSection) error
+
+// dryRunSections splits the migrations of the plan into sections of
+// consecutive commands on the same collection.
+func dryRunSections(plan migrationPlan, migrationName string) []DryRunSection {
+	var sections []DryRunSection
+	for _, m := range plan.Migrations {
+		title := ""
+		if m.Suffix != "" {
+			title = fmt.Sprintf(" (%s%s)", migrationName, m.Suffix)
+		}
+		if m.Up != nil {
+			sections = append(sections, commandSections("Up migration"+title, m.Up)...)
+		}
+		if m.Down != nil {
+			sections = append(sections, commandSections("Down migration"+title, m.Down)...)
+		}
+	}
+
+	if len(plan.Suppressed) > 0 {
+		section := DryRunSection{Title: "Suppressed differences"}
+		for _, d := range plan.Suppressed {
+			section.Lines = append(section.Lines, d.String())
+		}
+		sections = append(sections, section)
+	}
+
+	if len(plan.ReadOnlyDrift) > 0 {
+		section := DryRunSection{Title: "Read-only collection drift"}
+		for _, d := range plan.ReadOnlyDrift {
+			section.Lines = append(section.Lines, d.String())
+		}
+		sections = append(sections, section)
+	}
+	return sections
+}
+
+// commandSections groups the commands of a migration by collection, keeping
+// a migration that isn't a JSON array of commands in a single section.
+func commandSections(title string, migration []byte) []DryRunSection {
+	var commands []json.RawMessage
+	if err := json.Unmarshal(migration, &commands); err != nil {
+		return []DryRunSection{{Title: title, Lines: strings.Split(strings.TrimRight(string(migration), "\n"), "\n")}}
+	}
+
+	var sections []DryRunSection
+	var collection string
+	var names []string
+	for _, raw := range commands {
+		name, target := commandTarget(raw)
+		if len(sections) == 0 || target != collection {
+			collection, names = target, nil
+			sections = append(sections, DryRunSection{})
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+
+		section := &sections[len(sections)-1]
+		section.Title = fmt.Sprintf("%s · %s: %s", title, collection, strings.Join(names, ", "))
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, raw, "", "  "); err != nil {
+			indented.Write(raw)
+		}
+		section.Lines = append(section.Lines, strings.Split(indented.String(), "\n")...)
+	}
+	return sections
+}
+
+// commandTarget returns the name of a command and the collection it runs on,
+// its first field.
+func commandTarget(raw json.RawMessage) (name, collection string) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return "", ""
+	}
+	key, _ := decoder.Token()
+	value, _ := decoder.Token()
+	name, _ = key.(string)
+	collection, _ = value.(string)
+	return name, collection
+}
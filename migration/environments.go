@@ -0,0 +1,161 @@
+package migration
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/schema"
+)
+
+// DeclaredColumn names the column of the declared schema in an
+// EnvironmentMatrix.
+const DeclaredColumn = "declared"
+
+// MissingVariant marks an index missing from an environment.
+const MissingVariant = "-"
+
+// Environment is a database to compare with the others.
+type Environment struct {
+	Name         string
+	MongoURI     string
+	DatabaseName string
+	ReadOptions  db.ReadOptions
+}
+
+// EnvironmentMatrix tells, for every index that isn't the same everywhere,
+// which variant of it each environment has.
+type EnvironmentMatrix struct {
+	// Columns are the declared schema, when compared, then the environments.
+	Columns []string    `json:"columns"`
+	Rows    []MatrixRow `json:"rows"`
+	Indexes int         `json:"indexes"`
+}
+
+// MatrixRow is an index that differs between environments. Cells hold, per
+// column, a letter naming its definition, the same letter for the same
+// definition, or MissingVariant.
+type MatrixRow struct {
+	Collection string   `json:"collection"`
+	Index      string   `json:"index"`
+	Cells      []string `json:"cells"`
+}
+
+// CompareEnvironments reads the live schema of every environment and compares
+// it with the others and, when schemaFilePath is set, the declared schema.
+func CompareEnvironments(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	environments []Environment,
+	schemaFilePath string,
+) (EnvironmentMatrix, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return EnvironmentMatrix{}, err
+	}
+	// Every environment is a deployment of its own, connected to by URI.
+	compiled.client = nil
+
+	var matrix EnvironmentMatrix
+	var columns [][]schema.Schema
+
+	var declared []schema.Schema
+	if schemaFilePath != "" {
+		logger.Debug("Reading declared schema from file", "path", schemaFilePath)
+		if declared, err = readDeclaredSchema(schemaFilePath); err != nil {
+			return EnvironmentMatrix{}, fmt.Errorf("failed to read declared schema: %w", err)
+		}
+		declared = prepareSchemas(compiled, schema.ExpandBuckets(declared))
+		matrix.Columns = append(matrix.Columns, DeclaredColumn)
+		columns = append(columns, declared)
+	}
+
+	for _, env := range environments {
+		logger.Info("Inspecting environment", "environment", env.Name, "database", env.DatabaseName)
+		current, err := readCurrentSchema(ctx, logger.With("environment", env.Name), compiled, env.MongoURI, env.DatabaseName, env.ReadOptions)
+		if err != nil {
+			return EnvironmentMatrix{}, fmt.Errorf("inspecting environment %s: %w", env.Name, err)
+		}
+		if declared != nil {
+			current = withoutGridFSDefaults(declared, current)
+		}
+		matrix.Columns = append(matrix.Columns, env.Name)
+		columns = append(columns, current)
+	}
+
+	type indexID struct{ collection, name string }
+	var ids []indexID
+	for _, schemas := range columns {
+		for _, s := range schemas {
+			for _, index := range s.Indexes {
+				if id := (indexID{s.Collection, index.Name}); !slices.Contains(ids, id) {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	slices.SortFunc(ids, func(a, b indexID) int {
+		return cmp.Or(cmp.Compare(a.collection, b.collection), cmp.Compare(a.name, b.name))
+	})
+	matrix.Indexes = len(ids)
+
+	for _, id := range ids {
+		indexes := make([]*schema.Index, len(columns))
+		var live *schema.Index
+		for i, schemas := range columns {
+			indexes[i] = findIndex(schemas, id.collection, id.name)
+			if indexes[i] != nil && (declared == nil || i > 0) {
+				live = cmp.Or(live, indexes[i])
+			}
+		}
+		if declared != nil && indexes[0] != nil && live != nil {
+			// Compare the declared index as the server reports it.
+			withDefaults := withServerDefaults(*indexes[0], *live)
+			indexes[0] = &withDefaults
+		}
+
+		row := MatrixRow{Collection: id.collection, Index: id.name, Cells: indexVariants(compiled, indexes)}
+		if slices.ContainsFunc(row.Cells, func(cell string) bool { return cell != row.Cells[0] }) {
+			matrix.Rows = append(matrix.Rows, row)
+		}
+	}
+
+	return matrix, nil
+}
+
+// indexVariants names the distinct definitions of an index A, B, C... in the
+// order they first appear.
+func indexVariants(settings compiledSettings, indexes []*schema.Index) []string {
+	var variants []schema.Index
+	cells := make([]string, len(indexes))
+	for i, index := range indexes {
+		if index == nil {
+			cells[i] = MissingVariant
+			continue
+		}
+		v := slices.IndexFunc(variants, func(variant schema.Index) bool { return sameIndex(settings, variant, *index) })
+		if v < 0 {
+			v = len(variants)
+			variants = append(variants, *index)
+		}
+		cells[i] = string(rune('A' + v))
+	}
+	return cells
+}
+
+// findIndex returns the index of the collection with the given name, or nil.
+func findIndex(schemas []schema.Schema, collection, name string) *schema.Index {
+	i := slices.IndexFunc(schemas, func(s schema.Schema) bool { return s.Collection == collection })
+	if i < 0 {
+		return nil
+	}
+	j := slices.IndexFunc(schemas[i].Indexes, func(index schema.Index) bool { return index.Name == name })
+	if j < 0 {
+		return nil
+	}
+	return &schemas[i].Indexes[j]
+}
@@ -0,0 +1,158 @@
+package migration
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// migrationFileRegex matches golang-migrate file names, e.g. 000001_add_user_indexes.up.json.
+var migrationFileRegex = regexp.MustCompile(`^([0-9]+)_(.*)\.(up|down)\.(.*)$`)
+
+// migrationFile is a migration file found in the migration directory.
+type migrationFile struct {
+	Version   uint64
+	Name      string
+	Direction string
+	Extension string
+	// Path locates the file for messages and, in a directory, on disk.
+	Path string
+
+	fsys fs.FS
+	name string
+}
+
+// read returns the contents of the migration file.
+func (f migrationFile) read() ([]byte, error) {
+	return fs.ReadFile(f.fsys, f.name)
+}
+
+// migrationSource is where apply reads migrations from: the migration
+// directory, or a file system such as one embedded in the program.
+type migrationSource struct {
+	fsys fs.FS
+	// dir is the migration directory the file system is, empty for any
+	// other file system.
+	dir string
+}
+
+// dirSource reads the migrations of the migration directory.
+func dirSource(migrationDir string) migrationSource {
+	return migrationSource{fsys: os.DirFS(migrationDir), dir: migrationDir}
+}
+
+func (s migrationSource) String() string {
+	if s.dir == "" {
+		return "the embedded migrations"
+	}
+	return s.dir
+}
+
+// listMigrationFiles returns the JSON migration files of the directory ordered
+// by version, with the up migration of a version before its down migration.
+func listMigrationFiles(migrationDir string) ([]migrationFile, error) {
+	return dirSource(migrationDir).files()
+}
+
+// files returns the JSON migration files of the source, the only ones apply
+// runs, as listMigrationFiles.
+func (s migrationSource) files() ([]migrationFile, error) {
+	return s.filesOf(MigrationFormatJSON)
+}
+
+// filesOf returns the migration files of the source with the extension, as
+// listMigrationFiles.
+func (s migrationSource) filesOf(extension string) ([]migrationFile, error) {
+	entries, err := fs.ReadDir(s.fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("reading migration directory %s: %w", s, err)
+	}
+
+	var files []migrationFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := migrationFileRegex.FindStringSubmatch(entry.Name())
+		if match == nil || match[4] != extension {
+			continue
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		files = append(files, migrationFile{
+			Version:   version,
+			Name:      match[2],
+			Direction: match[3],
+			Extension: match[4],
+			Path:      filepath.Join(s.dir, entry.Name()),
+			fsys:      s.fsys,
+			name:      entry.Name(),
+		})
+	}
+
+	slices.SortFunc(files, func(a, b migrationFile) int {
+		return cmp.Or(cmp.Compare(a.Version, b.Version), -cmp.Compare(a.Direction, b.Direction))
+	})
+
+	return files, nil
+}
+
+// migrationFS is the file system of a migration source as golang-migrate
+// reads it: directory listings only have JSON migrations, so files such as
+// mongosh scripts left in the directory are never applied.
+type migrationFS struct {
+	fs.FS
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (f migrationFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(f.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(entries, func(entry fs.DirEntry) bool {
+		return !entry.IsDir() && path.Ext(entry.Name()) != "."+MigrationFormatJSON
+	}), nil
+}
+
+// names maps the versions of the migration source to their names.
+func (s migrationSource) names() map[uint64]string {
+	names := make(map[uint64]string)
+
+	files, err := s.files()
+	if err != nil {
+		return names
+	}
+	for _, file := range files {
+		names[file.Version] = file.Name
+	}
+	return names
+}
+
+// checkMigrationDir fails clearly when the migration directory doesn't exist
+// or isn't a directory.
+func checkMigrationDir(migrationDir string) error {
+	info, err := os.Stat(migrationDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("migration directory %s doesn't exist", migrationDir)
+	}
+	if err != nil {
+		return fmt.Errorf("reading migration directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("migration directory %s isn't a directory", migrationDir)
+	}
+	return nil
+}
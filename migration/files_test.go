@@ -0,0 +1,150 @@
+package migration
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// recordingDriver is a golang-migrate database recording the migrations it
+// runs.
+type recordingDriver struct {
+	ran     []string
+	version int
+	dirty   bool
+}
+
+func (d *recordingDriver) Open(string) (database.Driver, error) { return d, nil }
+func (d *recordingDriver) Close() error                         { return nil }
+func (d *recordingDriver) Lock() error                          { return nil }
+func (d *recordingDriver) Unlock() error                        { return nil }
+func (d *recordingDriver) Drop() error                          { return nil }
+
+func (d *recordingDriver) Run(migration io.Reader) error {
+	body, err := io.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	d.ran = append(d.ran, string(body))
+	return nil
+}
+
+func (d *recordingDriver) SetVersion(version int, dirty bool) error {
+	d.version, d.dirty = version, dirty
+	return nil
+}
+
+func (d *recordingDriver) Version() (int, bool, error) {
+	if d.version == 0 {
+		return database.NilVersion, d.dirty, nil
+	}
+	return d.version, d.dirty, nil
+}
+
+// writeMigrationDir writes the files, by name, to a new migration directory.
+func writeMigrationDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// A directory written before mongosh scripts got their own, with a script
+// pair using the version after the JSON migration.
+var mixedMigrationDir = map[string]string{
+	"000001_users.up.json":   `[{"createIndexes": "users"}]`,
+	"000001_users.down.json": `[{"dropIndexes": "users"}]`,
+	"000002_orders.up.js":    `db.getCollection("orders").createIndex({"at":1});`,
+	"000002_orders.down.js":  `db.getCollection("orders").dropIndex("at_1");`,
+}
+
+func TestApplyOnlyRunsJSONMigrations(t *testing.T) {
+	dir := writeMigrationDir(t, mixedMigrationDir)
+
+	source, err := iofs.New(migrationFS{os.DirFS(dir)}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver := &recordingDriver{}
+	migrator, err := migrate.NewWithInstance("iofs", source, "recording", driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{mixedMigrationDir["000001_users.up.json"]}; !slices.Equal(driver.ran, want) {
+		t.Errorf("ran %q, want %q", driver.ran, want)
+	}
+	if driver.version != 1 {
+		t.Errorf("migrated to version %d, want 1", driver.version)
+	}
+}
+
+func TestMigrationFilesAreJSON(t *testing.T) {
+	dir := writeMigrationDir(t, mixedMigrationDir)
+
+	files, err := listMigrationFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, filepath.Base(file.Path))
+	}
+	if want := []string{"000001_users.up.json", "000001_users.down.json"}; !slices.Equal(names, want) {
+		t.Errorf("listed %v, want %v", names, want)
+	}
+
+	problems, err := CheckMigrationDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("scripts reported as problems: %v", problems)
+	}
+
+	if version, err := getNextVersion(dir, MigrationFormatJSON); err != nil || version != 2 {
+		t.Errorf("next JSON version %d, %v, want 2", version, err)
+	}
+}
+
+func TestMongoshScriptsHaveTheirOwnDirectory(t *testing.T) {
+	dir := writeMigrationDir(t, mixedMigrationDir)
+	scriptDir := migrationOutputDir(MigrationFormatJS, dir, "")
+
+	files, err := writeMigration(context.Background(), discardLogger(), defaultSettings,
+		[]byte(`[{"createIndexes": "users"}]`), []byte(`[{"dropIndexes": "users"}]`),
+		newMigrationHeader("", "app"), MigrationFormatJS, scriptDir, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if filepath.Dir(file) != scriptDir {
+			t.Errorf("script %s written outside of %s", file, scriptDir)
+		}
+	}
+	if want := filepath.Join(scriptDir, "000001_users.up.js"); files[0] != want {
+		t.Errorf("wrote %s, want %s", files[0], want)
+	}
+
+	// The JSON migrations don't see the scripts, nor their versions.
+	if version, err := getNextVersion(dir, MigrationFormatJSON); err != nil || version != 2 {
+		t.Errorf("next JSON version %d, %v, want 2", version, err)
+	}
+	if got := migrationOutputDir(MigrationFormatJSON, dir, "scripts"); got != dir {
+		t.Errorf("JSON migrations written to %s, want %s", got, dir)
+	}
+}
@@ -1,67 +1,272 @@
 package migration
 
 import (
+	"bytes"
 	"cmp"
 	"context"
-	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"slices"
+	"strings"
 
 	"github.com/ltman/mondex/schema"
 )
 
+// FormatOptions tune how format reads the schema file and what it writes.
+type FormatOptions struct {
+	// Strict refuses fields that aren't part of the format and invalid
+	// index keys.
+	Strict bool
+	// Validate checks the file against the JSON Schema of the format first.
+	Validate bool
+	// Check writes nothing and fails unless the file is formatted.
+	Check bool
+	// To converts the file to another format, or a directory of collection
+	// files, written next to the original; empty keeps the format.
+	To string
+	// DryRun prints the formatted schema instead of writing it.
+	DryRun bool
+}
+
 func FormatSchemaFile(
 	_ context.Context,
 	logger *slog.Logger,
+	settings Settings,
 	schemaFilePath string,
-	dryRun bool,
+	formatOptions FormatOptions,
 ) error {
-	declared, err := readDeclaredSchema(schemaFilePath)
+	compiled, err := settings.compile()
+	if err != nil {
+		return err
+	}
+
+	if formatOptions.Validate {
+		data, err := readSchemaFile(schemaFilePath)
+		if err != nil {
+			return fmt.Errorf("reading declared schema: %w", err)
+		}
+		if err := schema.Validate(schemaFilePath, data); err != nil {
+			return fmt.Errorf("validating declared schema: %w", err)
+		}
+	}
+
+	read := readDeclaredSchema
+	if formatOptions.Strict {
+		read = readDeclaredSchemaStrict
+	}
+
+	declared, err := read(schemaFilePath)
 	if err != nil {
 		return fmt.Errorf("reading declared schema: %w", err)
 	}
 
-	schemas, err := json.MarshalIndent(prepareSchemas(declared), "", "  ")
+	declared = normalizeDeprecated(logger, declared)
+
+	if formatOptions.Strict {
+		if err := checkIndexKeys(declared); err != nil {
+			return fmt.Errorf("checking declared schema: %w", err)
+		}
+	}
+
+	target, err := convertedPath(schemaFilePath, formatOptions.To)
 	if err != nil {
-		return fmt.Errorf("marshalling schema: %w", err)
+		return err
 	}
 
-	if dryRun {
+	if formatOptions.Check {
+		schemas, err := marshalSchemas(compiled, target, declared)
+		if err != nil {
+			return fmt.Errorf("marshalling schema: %w", err)
+		}
+		formatted, err := schemaDirFormatted(compiled, schemaFilePath, schemas)
+		if !isSchemaDir(schemaFilePath) {
+			var data []byte
+			data, err = readFile(schemaFilePath)
+			formatted = bytes.Equal(data, schemas)
+		}
+		if err != nil {
+			return fmt.Errorf("reading declared schema: %w", err)
+		}
+		if !formatted {
+			return fmt.Errorf("schema file %s is not formatted, run mondex format", schemaFilePath)
+		}
+		logger.Info("Schema file is formatted", "path", schemaFilePath)
+		return nil
+	}
+
+	if formatOptions.DryRun {
 		logger.Info("Dry-run: showing schema without writing file")
 
-		fmt.Printf("Schema that would be written to %s:\n", schemaFilePath) //nolint:forbidigo
-		if _, err := os.Stdout.Write(schemas); err != nil {
+		fmt.Printf("Schema that would be written to %s:\n", target) //nolint:forbidigo
+		if err := writeSchemas(compiled, os.Stdout, target, declared); err != nil {
 			return fmt.Errorf("writing declared schema: %w", err)
 		}
 
 		return nil
 	}
 
-	logger.Info("Writing current schema to file", "path", schemaFilePath)
-	if err := os.WriteFile(schemaFilePath, schemas, 0600); err != nil {
+	if target == StdinPath {
+		if err := writeSchemas(compiled, os.Stdout, target, declared); err != nil {
+			return fmt.Errorf("writing declared schema: %w", err)
+		}
+		return nil
+	}
+
+	logger.Info("Writing current schema to file", "path", target)
+	if isSchemaDir(target) {
+		schemas, err := marshalSchemas(compiled, target, declared)
+		if err != nil {
+			return fmt.Errorf("marshalling schema: %w", err)
+		}
+		if err := writeSchemaFile(compiled, target, schemas); err != nil {
+			return fmt.Errorf("writing declared schema: %w", err)
+		}
+	} else if err := compiled.permissions.WriteStream(target, func(w io.Writer) error { return writeSchemas(compiled, w, target, declared) }); err != nil {
 		return fmt.Errorf("writing declared schema: %w", err)
 	}
+	if target != schemaFilePath {
+		logger.Warn("Converted schema file, set schema_file_path to it and remove the original", "from", schemaFilePath, "to", target)
+	}
+
+	return nil
+}
+
+// LintSchemaFile checks the schema file against the JSON Schema of the format,
+// and for fields that aren't part of it and invalid index keys, without
+// writing it.
+func LintSchemaFile(logger *slog.Logger, schemaFilePath string) error {
+	data, err := readSchemaFile(schemaFilePath)
+	if err != nil {
+		return fmt.Errorf("reading declared schema: %w", err)
+	}
+	if err := schema.Validate(schemaFilePath, data); err != nil {
+		return fmt.Errorf("validating declared schema: %w", err)
+	}
+
+	declared, err := readDeclaredSchemaStrict(schemaFilePath)
+	if err != nil {
+		return fmt.Errorf("reading declared schema: %w", err)
+	}
+	if err := checkIndexKeys(declared); err != nil {
+		return fmt.Errorf("checking declared schema: %w", err)
+	}
 
+	logger.Info("Schema file is valid", "path", schemaFilePath)
 	return nil
 }
 
-func prepareSchemas(schemas []schema.Schema) []schema.Schema {
+// convertedPath returns the path of the schema file converted to the given
+// format, the name of a codec or dir for a schema directory, replacing its
+// extension; empty keeps the file.
+func convertedPath(path, to string) (string, error) {
+	if path == StdinPath && to != "" {
+		return "", fmt.Errorf("can't convert the schema read from the standard input")
+	}
+
+	if to == "" {
+		return path, nil
+	}
+	dir := isSchemaDir(path)
+	if dir {
+		path = strings.TrimRight(path, "/"+string(filepath.Separator))
+	}
+
+	var ext string
+	if to == "dir" {
+		if dir {
+			return path + string(filepath.Separator), nil
+		}
+		ext = string(filepath.Separator)
+	} else {
+		codec, ok := schema.CodecNamed(to)
+		if !ok {
+			return "", fmt.Errorf("invalid schema format %q, want %s or dir", to, strings.Join(schema.CodecNames(), ", "))
+		}
+		if schema.CodecFor(path).Name == codec.Name && !dir {
+			return path, nil
+		}
+		ext = codec.Extensions[0]
+	}
+	if dir {
+		return path + ext, nil
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext, nil
+}
+
+func prepareSchemas(settings compiledSettings, schemas []schema.Schema) []schema.Schema {
+	// Indexes are ignored by the name they are matched by, and then get it,
+	// on a copy so the schema file is written as it was declared.
+	schemas = slices.Clone(schemas)
 	for i, sc := range schemas {
-		sc.Indexes = slices.DeleteFunc(sc.Indexes, func(i schema.Index) bool {
-			return slices.Contains(indexesToIgnore, i.Name)
+		sc.Indexes = slices.DeleteFunc(slices.Clone(sc.Indexes), func(i schema.Index) bool {
+			return settings.ignoredIndex(indexName(i))
 		})
+		for j, index := range sc.Indexes {
+			sc.Indexes[j].Name = indexName(index)
+		}
 		slices.SortFunc(sc.Indexes, func(a, b schema.Index) int {
 			return cmp.Compare(a.Name, b.Name)
 		})
+		sc.SearchIndexes = slices.Clone(sc.SearchIndexes)
+		slices.SortFunc(sc.SearchIndexes, func(a, b schema.SearchIndex) int {
+			return cmp.Compare(a.Name, b.Name)
+		})
 		schemas[i] = sc
 	}
-	schemas = slices.DeleteFunc(slices.Clone(schemas), func(s schema.Schema) bool {
-		return slices.Contains(collectionsToIgnore, s.Collection) || len(s.Indexes) == 0
+	schemas = slices.DeleteFunc(schemas, func(s schema.Schema) bool {
+		return settings.ignoredCollection(s.Collection) || (len(s.Indexes) == 0 && !s.GridFS && !s.ManagesValidation() && !s.HasOptions() && len(s.SearchIndexes) == 0)
 	})
 	slices.SortFunc(schemas, func(a, b schema.Schema) int {
 		return cmp.Compare(a.Collection, b.Collection)
 	})
 	return schemas
 }
+
+// normalizeDeprecated strips or translates deprecated index options, logging a
+// warning for every change.
+func normalizeDeprecated(logger *slog.Logger, schemas []schema.Schema) []schema.Schema {
+	for _, s := range schemas {
+		for i, index := range s.Indexes {
+			normalized, changes := index.NormalizeDeprecated()
+			for _, change := range changes {
+				logger.Warn("Normalized deprecated index option", "collection", s.Collection, "index", index.Name, "change", change)
+			}
+			s.Indexes[i] = normalized
+		}
+	}
+	return schemas
+}
+
+// checkDefaultIndexNames fails when indexes declared without a name in a
+// collection get the same default name, which the server would refuse.
+func checkDefaultIndexNames(schemas []schema.Schema) error {
+	for _, s := range schemas {
+		unnamed := make(map[string]bool)
+		for _, index := range s.Indexes {
+			if index.Name != "" {
+				continue
+			}
+			name := schema.DefaultIndexName(index.Key)
+			if unnamed[name] {
+				return fmt.Errorf("collection %s: indexes declared without a name both get the name %s, name them", s.Collection, name)
+			}
+			unnamed[name] = true
+		}
+	}
+	return nil
+}
+
+// checkIndexKeys type-checks the keys of every index.
+func checkIndexKeys(schemas []schema.Schema) error {
+	for _, s := range schemas {
+		for _, index := range s.Indexes {
+			if err := index.CheckKey(); err != nil {
+				return fmt.Errorf("collection %s, index %s: %w", s.Collection, index.Name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package migration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatKeepsIndexesUnnamed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	declared := `[{"collection": "users", "indexes": [
+		{"key": {"user_id": 1, "created_at": -1}},
+		{"key": {"email": "hashed"}},
+		{"name": "bio_text", "key": {"bio": "text"}}
+	]}]`
+	if err := os.WriteFile(path, []byte(declared), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := Settings{IgnoredIndexes: []string{"*_hashed"}}
+	for range 2 {
+		if err := FormatSchemaFile(context.Background(), discardLogger(), settings, path, FormatOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted := string(data)
+	if strings.Contains(formatted, `"user_id_1_created_at_-1"`) {
+		t.Errorf("unnamed index got its default name:\n%s", formatted)
+	}
+	if !strings.Contains(formatted, `"user_id"`) || !strings.Contains(formatted, `"bio_text"`) {
+		t.Errorf("index lost:\n%s", formatted)
+	}
+	// Patterns match the name the server would give an unnamed index.
+	if strings.Contains(formatted, `"hashed"`) {
+		t.Errorf("ignored unnamed index kept:\n%s", formatted)
+	}
+
+	schemas, _, err := hashDeclaredSchema(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prepared := prepareSchemas(mustCompileSettings(settings), schemas)
+	if name := prepared[0].Indexes[1].Name; name != "user_id_1_created_at_-1" {
+		t.Errorf("prepared index named %q, want its default name", name)
+	}
+	for _, index := range schemas[0].Indexes {
+		if index.Name == "user_id_1_created_at_-1" {
+			t.Error("preparing named the declared index")
+		}
+	}
+}
+
+func TestUnnamedIndexesWithTheSameDefaultName(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	declared := `[{"collection": "users", "indexes": [
+		{"key": {"email": 1}},
+		{"key": {"email": 1}, "collation": {"locale": "fr"}}
+	]}]`
+	if err := os.WriteFile(path, []byte(declared), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := hashDeclaredSchema(path)
+	if err == nil || !strings.Contains(err.Error(), "email_1") {
+		t.Fatalf("want an error naming email_1, got %v", err)
+	}
+	if err := FormatSchemaFile(context.Background(), discardLogger(), Settings{}, path, FormatOptions{}); err == nil {
+		t.Error("formatted a schema with two indexes of the same default name")
+	}
+}
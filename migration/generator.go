@@ -1,138 +1,813 @@
 package migration
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ltman/mondex/atomicfile"
 	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/policy"
 	"github.com/ltman/mondex/schema"
 )
 
-var (
-	collectionsToIgnore = []string{"migrate_advisory_lock", "schema_migrations"}
-	indexesToIgnore     = []string{"_id_"}
+// CurrentSource is where diff reads the schema the declared one is compared to.
+type CurrentSource int
+
+const (
+	// SourceDatabase reads the indexes of the live database.
+	SourceDatabase CurrentSource = iota
+	// SourceStateFile reads the state file written by diff.
+	SourceStateFile
+	// SourceRemoteState reads the state collection written by apply.
+	SourceRemoteState
 )
 
+// DiffOptions tune how diff compares the declared schema to the current one
+// and what it writes.
+type DiffOptions struct {
+	// SchemaFilePath is the declared schema, a file or a directory of
+	// collection files.
+	SchemaFilePath string
+	// ReadOptions tune how the current schema is read from the database.
+	ReadOptions db.ReadOptions
+	// MigrationDir is where the migrations are written, named after
+	// MigrationName.
+	MigrationDir, MigrationName string
+	// Owner and Collections scope the diff to the collections declared with
+	// the owner and to those named; empty diffs every collection.
+	Owner       string
+	Collections []string
+	// Source is where the current schema is read from. StatePath is the
+	// state file read with SourceStateFile and written along the migrations;
+	// empty writes none.
+	Source    CurrentSource
+	StatePath string
+	// Policies are evaluated against the changes of the up migrations.
+	Policies []string
+	// DryRun writes nothing: the migrations are shown with Pager, or printed
+	// when it is nil, or written without versions to PreviewDir when set.
+	DryRun     bool
+	PreviewDir string
+	Pager      DryRunPager
+	// ManagedCollectionsOnly ignores collections of the current schema that
+	// aren't declared, instead of dropping their indexes.
+	ManagedCollectionsOnly bool
+	// DropRemovedCollections drops undeclared collections of the current
+	// schema, documents included, instead of only dropping their indexes.
+	DropRemovedCollections bool
+	// ConfirmDrop is asked before generating the drop of collections; nil
+	// refuses.
+	ConfirmDrop func(collections []string) bool
+	// BlueGreen replaces modified indexes in two migrations instead of
+	// dropping and recreating them: the first creates the new definition under a
+	// new name, the second drops the old index once the new one is in use.
+	BlueGreen bool
+	// UpOnly generates no down migrations, where rollbacks are forbidden or
+	// written by hand.
+	UpOnly bool
+	// DownOnly generates no up migrations, leaving them to be written by hand.
+	DownOnly bool
+	// Split generates a migration per changed collection, named after it,
+	// instead of a single one, so each can be applied and rolled back alone.
+	Split bool
+	// AllowEmpty generates an empty migration pair when nothing changed, as
+	// a checkpoint, instead of nothing.
+	AllowEmpty bool
+	// AccessFilePath declares the users and roles to manage, in a migration
+	// of their own after the index migration. Empty leaves them alone.
+	AccessFilePath string
+	// Suppressions hide known differences, which are reported but generate
+	// no commands.
+	Suppressions []SuppressionRule
+	// DeclaredDatabase reads the declared schema of this database from a
+	// multi-database schema file.
+	DeclaredDatabase string
+	// AllowDestructive writes up migrations dropping indexes, collections or
+	// privileges, which are refused otherwise. Dry runs only show them.
+	AllowDestructive bool
+	// MigrationFormat is MigrationFormatJSON, the default, or
+	// MigrationFormatJS to write mongosh scripts apply doesn't run.
+	MigrationFormat string
+	// ScriptDir is where mongosh scripts are written, numbered apart from
+	// the migrations; the mongosh directory of the migration directory when
+	// empty.
+	ScriptDir string
+	// Report, when set, receives what diff generated instead of dry runs
+	// printing the migrations.
+	Report func(DiffReport) error
+}
+
+// migrationPlan is what diff generates: the migrations to write in order and
+// the schema once they are applied.
+type migrationPlan struct {
+	Migrations []generatedMigration
+	State      []schema.Schema
+	// Renames are the declared indexes to rename in the schema file.
+	Renames []indexRename
+	// Suppressed are the differences suppression rules left out.
+	Suppressed []suppressedDifference
+	// ReadOnlyDrift are the differences of the read-only collections, which
+	// generate no commands.
+	ReadOnlyDrift []readOnlyDrift
+	// Declared and Current are the schemas compared, once scoped.
+	Declared, Current []schema.Schema
+	// SchemaHash is the hash of the schema file the declared schemas were
+	// read from, recorded in the header of the migrations.
+	SchemaHash string
+}
+
+// generatedMigration is a migration pair named after the migration name
+// followed by Suffix, if any.
+type generatedMigration struct {
+	Suffix   string
+	Up, Down []byte
+}
+
 func GenerateMigrationScripts(
 	ctx context.Context,
 	logger *slog.Logger,
+	settings Settings,
 	mongoURI, databaseName string,
-	schemaFilePath string,
-	migrationDir, migrationName string,
-	dryRun bool,
+	diffOptions DiffOptions,
 ) error {
-	upCommand, downCommand, err := generateMigrationScripts(ctx, logger, mongoURI, databaseName, schemaFilePath)
+	compiled, err := settings.compile()
+	if err != nil {
+		return err
+	}
+
+	dryRun, previewDir := diffOptions.DryRun, diffOptions.PreviewDir
+	migrationDir, migrationName := diffOptions.MigrationDir, diffOptions.MigrationName
+	plan, err := generateMigrationScripts(ctx, logger, compiled, mongoURI, databaseName, diffOptions)
 	if err != nil {
 		return fmt.Errorf("failed to generate migration scripts: %w", err)
 	}
 
-	if upCommand == nil && downCommand == nil {
+	if len(plan.Migrations) == 0 && diffOptions.AllowEmpty {
+		logger.Info("No changes detected, generating an empty migration")
+		plan.Migrations = []generatedMigration{{Up: []byte("[]"), Down: []byte("[]")}}
+	}
+
+	if len(plan.Migrations) == 0 {
 		logger.Info("No changes detected, skipping migration generation")
+		if diffOptions.Report != nil {
+			report, err := newDiffReport(plan, databaseName, dryRun)
+			if err != nil {
+				return err
+			}
+			return diffOptions.Report(report)
+		}
+		if dryRun && previewDir == "" {
+			printUnmigrated(plan, false)
+		}
 		return nil
 	}
 
+	if err := checkPlanPolicies(ctx, logger, diffOptions.Policies, databaseName, plan); err != nil {
+		return err
+	}
+
+	if !dryRun && !diffOptions.DownOnly {
+		changes, err := planChanges(plan)
+		if err != nil {
+			return err
+		}
+		if err := checkDestructive(logger, changes, diffOptions.AllowDestructive); err != nil {
+			return err
+		}
+	}
+
+	report, err := newDiffReport(plan, databaseName, dryRun)
+	if err != nil {
+		return err
+	}
+
+	for i := range plan.Migrations {
+		if diffOptions.UpOnly {
+			plan.Migrations[i].Down = nil
+		}
+		if diffOptions.DownOnly {
+			plan.Migrations[i].Up = nil
+		}
+	}
+
+	header := newMigrationHeader(plan.SchemaHash, databaseName)
+	format := cmp.Or(diffOptions.MigrationFormat, MigrationFormatJSON)
+
+	if dryRun && previewDir != "" {
+		report.Files, err = writePreview(logger, compiled, plan.Migrations, header, format, previewDir, cmp.Or(migrationName, "preview"))
+		if err != nil || diffOptions.Report == nil {
+			return err
+		}
+		return diffOptions.Report(report)
+	}
+
+	if dryRun && diffOptions.Report != nil {
+		logger.Info("Dry-run: reporting migrations without writing file")
+		if migrationDir != "" && migrationName != "" {
+			outputDir := migrationOutputDir(format, migrationDir, diffOptions.ScriptDir)
+			if report.Files, err = plannedFiles(plan.Migrations, format, outputDir, migrationName); err != nil {
+				return err
+			}
+		}
+		return diffOptions.Report(report)
+	}
+
 	if dryRun {
 		logger.Info("Dry-run: showing migrations without writing file")
 
-		fmt.Println("Up migration:") //nolint:forbidigo
-		if _, err := os.Stdout.Write(upCommand); err != nil {
-			return fmt.Errorf("writing up migration to stdout: %w", err)
+		if format == MigrationFormatJS {
+			for i, m := range plan.Migrations {
+				for _, commands := range []*[]byte{&plan.Migrations[i].Up, &plan.Migrations[i].Down} {
+					if *commands == nil {
+						continue
+					}
+					if *commands, err = mongoshScript(*commands, nil); err != nil {
+						return fmt.Errorf("translating migration%s to mongosh: %w", m.Suffix, err)
+					}
+				}
+			}
+		}
+
+		if diffOptions.Pager != nil {
+			return diffOptions.Pager(dryRunSections(plan, migrationName))
 		}
 
-		fmt.Println("\nDown migration:") //nolint:forbidigo
-		if _, err := os.Stdout.Write(downCommand); err != nil {
-			return fmt.Errorf("writing down migration to stdout: %w", err)
+		for i, m := range plan.Migrations {
+			title := ""
+			if m.Suffix != "" {
+				title = fmt.Sprintf(" (%s%s)", migrationName, m.Suffix)
+			}
+			if i > 0 {
+				fmt.Println() //nolint:forbidigo
+			}
+
+			if m.Up != nil {
+				fmt.Printf("Up migration%s:\n", title) //nolint:forbidigo
+				if _, err := os.Stdout.Write(m.Up); err != nil {
+					return fmt.Errorf("writing up migration to stdout: %w", err)
+				}
+			}
+
+			if m.Down != nil {
+				if m.Up != nil {
+					fmt.Println() //nolint:forbidigo
+				}
+				fmt.Printf("Down migration%s:\n", title) //nolint:forbidigo
+				if _, err := os.Stdout.Write(m.Down); err != nil {
+					return fmt.Errorf("writing down migration to stdout: %w", err)
+				}
+			}
 		}
+		printUnmigrated(plan, true)
 
 		return nil
 	}
 
-	logger.Debug("Writing migration commands to files", "migrationDir", migrationDir)
-	if err := writeMigrationCommands(upCommand, downCommand, migrationDir, migrationName); err != nil {
-		return fmt.Errorf("failed to write migration commands: %w", err)
+	outputDir := migrationOutputDir(format, migrationDir, diffOptions.ScriptDir)
+	logger.Debug("Writing migration commands to files", "migrationDir", outputDir)
+	for _, m := range plan.Migrations {
+		files, err := writeMigration(ctx, logger, compiled, m.Up, m.Down, header, format, outputDir, migrationName+m.Suffix)
+		if err != nil {
+			return fmt.Errorf("failed to write migration commands: %w", err)
+		}
+		report.Files = append(report.Files, files...)
 	}
 
+	if len(plan.Renames) > 0 {
+		if err := renameDeclaredIndexes(logger, compiled, diffOptions.SchemaFilePath, plan.Renames); err != nil {
+			return err
+		}
+	}
+
+	if diffOptions.StatePath != "" {
+		if err := writeStateFile(logger, compiled, diffOptions.StatePath, plan.State); err != nil {
+			return err
+		}
+	}
+
+	if diffOptions.Report != nil {
+		return diffOptions.Report(report)
+	}
 	return nil
 }
 
+// printUnmigrated lists the differences that generate no commands after the
+// dry-run migrations: those suppressed and those of read-only collections.
+func printUnmigrated(plan migrationPlan, afterMigrations bool) {
+	first := !afterMigrations
+	printList := func(title string, differences []fmt.Stringer) {
+		if len(differences) == 0 {
+			return
+		}
+		if !first {
+			fmt.Println() //nolint:forbidigo
+		}
+		first = false
+		fmt.Printf("%s:\n", title) //nolint:forbidigo
+		for _, d := range differences {
+			fmt.Printf("  %s\n", d) //nolint:forbidigo
+		}
+	}
+	printList("Suppressed differences", stringers(plan.Suppressed))
+	printList("Read-only collection drift", stringers(plan.ReadOnlyDrift))
+}
+
+// stringers converts a slice to a slice of fmt.Stringer.
+func stringers[T fmt.Stringer](values []T) []fmt.Stringer {
+	result := make([]fmt.Stringer, len(values))
+	for i, v := range values {
+		result[i] = v
+	}
+	return result
+}
+
+// checkPlanPolicies evaluates the policies against the changes of the up
+// migrations diff generates.
+func checkPlanPolicies(ctx context.Context, logger *slog.Logger, policies []string, databaseName string, plan migrationPlan) error {
+	if len(policies) == 0 {
+		return nil
+	}
+
+	changes, err := planChanges(plan)
+	if err != nil {
+		return err
+	}
+	input := policy.Input{Phase: policy.PhaseDiff, Database: databaseName, Changes: changes}
+	return checkPolicies(ctx, logger, policies, input)
+}
+
+// planChanges returns the changes of the up migrations diff generates.
+func planChanges(plan migrationPlan) ([]policy.Change, error) {
+	var changes []policy.Change
+	for _, m := range plan.Migrations {
+		var commands []bson.D
+		if err := bson.UnmarshalExtJSON(m.Up, true, &commands); err != nil {
+			return nil, fmt.Errorf("failed to read generated commands: %w", err)
+		}
+		changes = append(changes, commandChanges(commands)...)
+	}
+	return changes, nil
+}
+
 func generateMigrationScripts(
 	ctx context.Context,
 	logger *slog.Logger,
+	settings compiledSettings,
 	mongoURI, databaseName string,
-	schemaFilePath string,
-) (upMigration, downMigration []byte, err error) {
-	logger.Debug("Connecting to MongoDB")
-	client, err := db.ConnectToMongoDB(ctx, mongoURI)
+	diffOptions DiffOptions,
+) (plan migrationPlan, err error) {
+	owner, collections, source := diffOptions.Owner, diffOptions.Collections, diffOptions.Source
+	readOptions, schemaFilePath := diffOptions.ReadOptions, diffOptions.SchemaFilePath
+	var client *mongo.Client
+	var current []schema.Schema
+	if source == SourceStateFile {
+		logger.Debug("Reading current schema from state file", "path", diffOptions.StatePath)
+		current, err = readStateFile(logger, diffOptions.StatePath)
+		if err != nil {
+			return migrationPlan{}, err
+		}
+	} else {
+		logger.Debug("Connecting to MongoDB")
+		client, err = settings.connect(ctx, mongoURI)
+		if err != nil {
+			return migrationPlan{}, fmt.Errorf("failed to connect to MongoDB: %w", err)
+		}
+		defer func() {
+			if err := settings.disconnect(ctx, client); err != nil {
+				logger.Error("Failed to disconnect from MongoDB", "error", err)
+			}
+		}()
+
+		database, err := db.OpenDatabase(client, databaseName, readOptions)
+		if err != nil {
+			return migrationPlan{}, err
+		}
+
+		logger.Debug("Reading current schema from MongoDB",
+			"readPreference", readOptions.Preference, "concurrency", max(readOptions.Concurrency, 1))
+		current, err = db.ReadCurrentSchema(ctx, database, readOptions.Concurrency)
+		if err != nil {
+			return migrationPlan{}, fmt.Errorf("failed to read current schema: %w", err)
+		}
+		if readOptions.SearchIndexes {
+			logger.Debug("Reading search indexes from MongoDB")
+			if current, err = db.ReadSearchIndexes(ctx, database, current); err != nil {
+				return migrationPlan{}, err
+			}
+		}
+
+		if source == SourceRemoteState {
+			logger.Debug("Reading current schema from the state collection", "collection", db.StateCollection)
+			current, err = readRemoteState(ctx, logger, settings, database, current)
+			if err != nil {
+				return migrationPlan{}, err
+			}
+		}
+	}
+
+	logger.Debug("Filter current schemas by removing ignored collections", "collections", settings.collectionsToIgnore)
+	current = prepareSchemas(settings, current)
+
+	logger.Debug("Reading declared schema from file", "path", schemaFilePath)
+	declared, hash, err := hashDeclaredSchemaOf(schemaFilePath, diffOptions.DeclaredDatabase)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+		return migrationPlan{}, fmt.Errorf("failed to read declared schema: %w", err)
+	}
+	plan.SchemaHash = hash
+
+	logger.Debug("Filter declared schemas by removing ignored collections", "collections", settings.collectionsToIgnore)
+	declared = prepareSchemas(settings, schema.ExpandBuckets(declared))
+
+	if !readOptions.SearchIndexes {
+		// Search indexes are only compared when enabled, as most
+		// deployments can't list or create them.
+		declared, current = withoutSearchIndexes(declared), withoutSearchIndexes(current)
 	}
-	defer func() {
-		if err := client.Disconnect(context.Background()); err != nil {
-			logger.Error("Failed to disconnect from MongoDB", "error", err)
+
+	scopedDeclared, scopedCurrent := declared, withoutGridFSDefaults(declared, current)
+	if diffOptions.ManagedCollectionsOnly {
+		scopedCurrent = managedSchemas(declared, scopedCurrent, logger)
+	}
+
+	if owner != "" {
+		logger.Debug("Scoping schemas to owner", "owner", owner)
+		scopedDeclared, scopedCurrent = ownedSchemas(scopedDeclared, scopedCurrent, owner)
+	}
+
+	if len(collections) > 0 {
+		logger.Debug("Scoping schemas to collections", "collections", collections)
+		scopedDeclared, scopedCurrent, err = collectionSchemas(scopedDeclared, scopedCurrent, collections)
+		if err != nil {
+			return migrationPlan{}, err
 		}
-	}()
+	}
 
-	logger.Debug("Reading current schema from MongoDB")
-	current, err := db.ReadCurrentSchema(ctx, client.Database(databaseName))
+	if columnstore := newColumnstoreIndexes(scopedDeclared, scopedCurrent); len(columnstore) > 0 {
+		if client == nil {
+			logger.Warn("Can't check columnstore index support without a database connection", "indexes", columnstore)
+		} else {
+			logger.Debug("Checking columnstore index support", "indexes", columnstore)
+			if !db.ColumnstoreSupported(ctx, client) {
+				return migrationPlan{}, fmt.Errorf("columnstore indexes %s aren't available on this cluster", strings.Join(columnstore, ", "))
+			}
+		}
+	}
+
+	scopedDeclared, plan.Suppressed, err = suppressDifferences(logger, settings, scopedCurrent, scopedDeclared, diffOptions.Suppressions, time.Now())
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read current schema: %w", err)
+		return migrationPlan{}, err
+	}
+	scopedDeclared, plan.ReadOnlyDrift = assertReadOnly(logger, settings, scopedCurrent, scopedDeclared)
+	plan.Declared, plan.Current = scopedDeclared, scopedCurrent
+
+	var dropped []string
+	if diffOptions.DropRemovedCollections {
+		dropped = removedCollections(scopedDeclared, scopedCurrent)
+		if len(dropped) > 0 && (diffOptions.ConfirmDrop == nil || !diffOptions.ConfirmDrop(dropped)) {
+			return migrationPlan{}, fmt.Errorf("dropping collections %s wasn't confirmed", strings.Join(dropped, ", "))
+		}
 	}
 
-	logger.Debug("Filter current schemas by removing migration-related collections", "collections", collectionsToIgnore)
-	current = prepareSchemas(current)
+	// An index still being built is neither present nor missing yet: it is
+	// left out of the migration, and the state records it as declared.
+	building := indexBuilds(scopedCurrent)
+	logIndexBuilds(ctx, logger, client, databaseName, building, "Index build in progress, leaving it out of the migration")
+	diffCurrent, diffDeclared := withoutIndexes(scopedCurrent, building), withoutIndexes(scopedDeclared, building)
 
-	logger.Debug("Reading declared schema from file", "path", schemaFilePath)
+	var phases []generatedMigration
+	migrated, final := diffDeclared, scopedDeclared
+	if diffOptions.BlueGreen {
+		logger.Debug("Planning blue/green replacement of modified indexes")
+		var replacements blueGreenPlan
+		if replacements, err = planBlueGreen(settings, diffCurrent, diffDeclared, logger); err != nil {
+			return migrationPlan{}, fmt.Errorf("failed to plan index replacements: %w", err)
+		}
+		phases, plan.Renames = replacements.Phases, replacements.Renames
+		migrated, final = replacements.Unchanged, replacements.Replaced
+	}
+
+	logger.Debug("Generating migration commands")
+	if diffOptions.Split {
+		migrations, err := generateSplitMigrations(settings, diffCurrent, migrated, dropped, source != SourceDatabase, logger)
+		if err != nil {
+			return migrationPlan{}, fmt.Errorf("failed to generate migration commands: %w", err)
+		}
+		plan.Migrations = append(plan.Migrations, migrations...)
+	} else {
+		upCommand, downCommand, err := generateMigrationCommands(settings, diffCurrent, migrated, dropped, source != SourceDatabase, logger)
+		if err != nil {
+			return migrationPlan{}, fmt.Errorf("failed to generate migration commands: %w", err)
+		}
+
+		if upCommand != nil || downCommand != nil {
+			plan.Migrations = append(plan.Migrations, generatedMigration{Up: upCommand, Down: downCommand})
+		}
+	}
+
+	if diffOptions.AccessFilePath != "" {
+		if client == nil {
+			logger.Warn("Users and roles are only diffed against the live database, skipping them")
+		} else {
+			access, changed, err := diffAccess(ctx, logger, client, databaseName, readOptions, diffOptions.AccessFilePath)
+			if err != nil {
+				return migrationPlan{}, err
+			}
+			if changed {
+				plan.Migrations = append(plan.Migrations, access)
+			}
+		}
+	}
+	plan.Migrations = append(plan.Migrations, phases...)
+	plan.State = nextState(current, scopedCurrent, final)
+	return plan, nil
+}
+
+// generateIndexCollModCommands generates the collMod MongoDB commands
+// changing the TTL or hidden flag of the live index to the declared ones and
+// back, when nothing else differs. collMod can't make an index a TTL index or
+// stop it being one, so those are rebuilt.
+func generateIndexCollModCommands(settings compiledSettings, collection string, live, declared schema.Index) (up, down map[string]interface{}, ok bool) {
+	ttlChanged := !equalTTL(live, declared)
+	if ttlChanged && (live.ExpireAfterSeconds == nil || declared.ExpireAfterSeconds == nil) {
+		return nil, nil, false
+	}
+	rest := declared
+	rest.ExpireAfterSeconds, rest.Hidden = live.ExpireAfterSeconds, live.Hidden
+	if !matchesDeclared(settings, rest, live) {
+		return nil, nil, false
+	}
+
+	upIndex := map[string]interface{}{"name": declared.Name}
+	downIndex := map[string]interface{}{"name": declared.Name}
+	if ttlChanged {
+		upIndex["expireAfterSeconds"], downIndex["expireAfterSeconds"] = *declared.ExpireAfterSeconds, *live.ExpireAfterSeconds
+	}
+	if live.Hidden != declared.Hidden {
+		upIndex["hidden"], downIndex["hidden"] = declared.Hidden, live.Hidden
+	}
+	return map[string]interface{}{"collMod": collection, "index": upIndex},
+		map[string]interface{}{"collMod": collection, "index": downIndex}, true
+}
+
+// equalTTL reports whether the indexes expire documents after the same time,
+// or both don't.
+func equalTTL(a, b schema.Index) bool {
+	if a.ExpireAfterSeconds == nil || b.ExpireAfterSeconds == nil {
+		return a.ExpireAfterSeconds == b.ExpireAfterSeconds
+	}
+	return *a.ExpireAfterSeconds == *b.ExpireAfterSeconds
+}
+
+// newColumnstoreIndexes returns the declared columnstore indexes missing from
+// the current schema, as collection.index names.
+func newColumnstoreIndexes(declared, current []schema.Schema) []string {
+	var names []string
+	for _, ds := range declared {
+		var currentIndexes []schema.Index
+		if i := slices.IndexFunc(current, func(cs schema.Schema) bool { return cs.Collection == ds.Collection }); i >= 0 {
+			currentIndexes = current[i].Indexes
+		}
+		for _, index := range indexesDifference(ds.Indexes, currentIndexes) {
+			if index.IsColumnstore() {
+				names = append(names, ds.Collection+"."+index.Name)
+			}
+		}
+	}
+	return names
+}
+
+// withoutGridFSDefaults removes the standard indexes of GridFS buckets the
+// declared schema doesn't manage, as drivers create them on first use.
+func withoutGridFSDefaults(declared, current []schema.Schema) []schema.Schema {
+	result := make([]schema.Schema, 0, len(current))
+	for _, cs := range current {
+		var declaredIndexes []schema.Index
+		if i := slices.IndexFunc(declared, func(ds schema.Schema) bool { return ds.Collection == cs.Collection }); i >= 0 {
+			declaredIndexes = declared[i].Indexes
+		}
+		cs.Indexes = slices.DeleteFunc(slices.Clone(cs.Indexes), func(index schema.Index) bool {
+			return schema.IsGridFSDefault(cs.Collection, index) &&
+				!slices.ContainsFunc(declaredIndexes, func(di schema.Index) bool { return di.Name == index.Name })
+		})
+		if len(cs.Indexes) > 0 || cs.ManagesValidation() || cs.HasOptions() || len(cs.SearchIndexes) > 0 {
+			result = append(result, cs)
+		}
+	}
+	return result
+}
+
+// withoutSearchIndexes removes the search indexes of the schemas.
+func withoutSearchIndexes(schemas []schema.Schema) []schema.Schema {
+	result := make([]schema.Schema, 0, len(schemas))
+	for _, s := range schemas {
+		s.SearchIndexes = nil
+		result = append(result, s)
+	}
+	return result
+}
+
+// managedSchemas drops the collections of the current schema that aren't
+// declared, so mondex leaves them alone on databases shared with other tools.
+func managedSchemas(declared, current []schema.Schema, logger *slog.Logger) []schema.Schema {
+	return slices.DeleteFunc(slices.Clone(current), func(cs schema.Schema) bool {
+		if slices.ContainsFunc(declared, func(ds schema.Schema) bool { return ds.Collection == cs.Collection }) {
+			return false
+		}
+		logger.Debug("Ignoring undeclared collection", "collection", cs.Collection)
+		return true
+	})
+}
+
+// removedCollections returns the collections of the current schema that
+// aren't declared.
+func removedCollections(declared, current []schema.Schema) []string {
+	var removed []string
+	for _, cs := range current {
+		if !slices.ContainsFunc(declared, func(ds schema.Schema) bool { return ds.Collection == cs.Collection }) {
+			removed = append(removed, cs.Collection)
+		}
+	}
+	return removed
+}
+
+// ownedSchemas restricts both schemas to the collections declared with the owner,
+// so collections of other teams are neither created nor dropped.
+func ownedSchemas(declared, current []schema.Schema, owner string) (ownedDeclared, ownedCurrent []schema.Schema) {
+	ownedDeclared = slices.DeleteFunc(slices.Clone(declared), func(s schema.Schema) bool {
+		return s.Owner != owner
+	})
+	ownedCurrent = slices.DeleteFunc(slices.Clone(current), func(cs schema.Schema) bool {
+		return !slices.ContainsFunc(ownedDeclared, func(ds schema.Schema) bool {
+			return ds.Collection == cs.Collection
+		})
+	})
+	return ownedDeclared, ownedCurrent
+}
+
+// collectionSchemas restricts both schemas to the named collections, failing
+// for a name found in neither.
+func collectionSchemas(declared, current []schema.Schema, collections []string) (scopedDeclared, scopedCurrent []schema.Schema, err error) {
+	for _, collection := range collections {
+		isCollection := func(s schema.Schema) bool { return s.Collection == collection }
+		if !slices.ContainsFunc(declared, isCollection) && !slices.ContainsFunc(current, isCollection) {
+			return nil, nil, fmt.Errorf("collection %s is neither declared nor in the database", collection)
+		}
+	}
+
+	notNamed := func(s schema.Schema) bool { return !slices.Contains(collections, s.Collection) }
+	scopedDeclared = slices.DeleteFunc(slices.Clone(declared), notNamed)
+	scopedCurrent = slices.DeleteFunc(slices.Clone(current), notNamed)
+	return scopedDeclared, scopedCurrent, nil
+}
+
+// ReadDeclaredSchema reads the schema file, filtered and ordered the same way as the current schema.
+func ReadDeclaredSchema(settings Settings, schemaFilePath string) ([]schema.Schema, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return nil, err
+	}
 	declared, err := readDeclaredSchema(schemaFilePath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read declared schema: %w", err)
+		return nil, err
 	}
+	return prepareSchemas(compiled, schema.ExpandBuckets(declared)), nil
+}
 
-	logger.Debug("Filter declared schemas by removing migration-related collections", "collections", collectionsToIgnore)
-	declared = prepareSchemas(declared)
+// DeclaredCollections returns the names of the collections declared in the schema file.
+func DeclaredCollections(settings Settings, schemaFilePath string) ([]string, error) {
+	declared, err := ReadDeclaredSchema(settings, schemaFilePath)
+	if err != nil {
+		return nil, err
+	}
 
-	logger.Debug("Generating migration commands")
-	upCommand, downCommand, err := generateMigrationCommands(current, declared, logger)
+	collections := make([]string, 0, len(declared))
+	for _, s := range declared {
+		collections = append(collections, s.Collection)
+	}
+	return collections, nil
+}
+
+// readSchemaFile reads a schema file as JSON, converting it with the codec
+// of its format.
+func readSchemaFile(path string) ([]byte, error) {
+	data, _, err := hashSchemaFileData(path)
+	return data, err
+}
+
+// hashSchemaFileData reads a schema file as JSON, like readSchemaFile, and
+// returns the schema hash of its contents as well.
+func hashSchemaFileData(path string) ([]byte, string, error) {
+	data, err := readFile(path)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate migration commands: %w", err)
+		return nil, "", err
+	}
+	hash := schemaHash(data)
+	codec := schemaCodec(path)
+	if codec.IsJSON() {
+		return data, hash, nil
 	}
 
-	return upCommand, downCommand, nil
+	data, err = codec.ToJSON(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+	return data, hash, nil
+}
+
+// readDeclaredSchema reads the declared schema from a file. JSON files are
+// decoded as they are read, so large ones aren't held in memory twice.
+func readDeclaredSchema(path string) ([]schema.Schema, error) {
+	schemas, _, err := hashDeclaredSchema(path)
+	return schemas, err
 }
 
-// indexesDifference calculate index diff between i1 and i2
-func indexesDifference(i1, i2 []schema.Index) []schema.Index {
-	diff := make([]schema.Index, 0)
-	for _, i := range i1 {
-		if !slices.ContainsFunc(i2, func(si schema.Index) bool {
-			return si.Name == i.Name
-		}) {
-			diff = append(diff, i)
+// hashDeclaredSchema reads the declared schema from a file, like
+// readDeclaredSchema, and returns the schema hash of the file as well. JSON
+// files are hashed as they are decoded, so they're read only once.
+func hashDeclaredSchema(path string) ([]schema.Schema, string, error) {
+	if path != StdinPath && schema.CodecFor(path).IsJSON() && !isSchemaDir(path) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, "", err
+		}
+		h := sha256.New()
+		schemas, err := schema.Decode(io.TeeReader(f, h))
+		f.Close()
+		if err == nil {
+			if err := checkDefaultIndexNames(schemas); err != nil {
+				return nil, "", fmt.Errorf("%s: %w", path, err)
+			}
+			if schemas == nil {
+				schemas = make([]schema.Schema, 0)
+			}
+			return schemas, formatSchemaHash(h.Sum(nil)), nil
 		}
+		// Parse the whole file again to locate the error.
+	}
+
+	data, hash, err := hashSchemaFileData(path)
+	if err != nil {
+		return nil, "", err
 	}
-	return diff
+
+	schemas, err := parseDeclaredSchema(path, data)
+	if err != nil {
+		return nil, "", err
+	}
+	return schemas, hash, nil
 }
 
-// readDeclaredSchema reads the declared schema from a file
-func readDeclaredSchema(path string) ([]schema.Schema, error) {
-	f, err := os.Open(path)
+// readDeclaredSchemaStrict reads the declared schema from a file, rejecting
+// fields that aren't part of the schema format instead of dropping them.
+func readDeclaredSchemaStrict(path string) ([]schema.Schema, error) {
+	data, err := readSchemaFile(path)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
-	var schemas []schema.Schema
+	schemas, err := parseDeclaredSchema(path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := schema.CheckUnknownFields(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
 
-	if err := json.NewDecoder(f).Decode(&schemas); err != nil {
+	return schemas, nil
+}
+
+func parseDeclaredSchema(path string, data []byte) ([]schema.Schema, error) {
+	schemas, err := schema.Parse(path, data)
+	var parseErr *schema.ParseError
+	if errors.As(err, &parseErr) && !schemaCodec(path).IsJSON() {
+		// The location is in the JSON the file converts to, not in the file.
+		return nil, fmt.Errorf("%s: %s", path, parseErr.Msg)
+	}
+	if err != nil {
 		return nil, err
 	}
+	if err := checkDefaultIndexNames(schemas); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
 
 	if schemas == nil {
 		schemas = make([]schema.Schema, 0)
@@ -141,9 +816,21 @@ func readDeclaredSchema(path string) ([]schema.Schema, error) {
 	return schemas, nil
 }
 
-// generateMigrationCommands generates up and down migration commands
-func generateMigrationCommands(current, declared []schema.Schema, logger *slog.Logger) (upCommand, downCommand []byte, err error) {
+// generateMigrationCommands generates the migration from current to declared.
+// The dropped collections are dropped entirely rather than only their indexes.
+// recorded is set when current is a recorded state rather than the live
+// database.
+func generateMigrationCommands(
+	settings compiledSettings,
+	current, declared []schema.Schema,
+	dropped []string,
+	recorded bool,
+	logger *slog.Logger,
+) (upCommand, downCommand []byte, err error) {
 	toCreate := make([]schema.Schema, 0)
+	var toReplace, replacements, retimed, createdWithOptions []schema.Schema
+	var created []any
+	var validate, restore, modify, unmodify []map[string]interface{}
 	for _, ds := range declared {
 		csIdx := slices.IndexFunc(current, func(cs schema.Schema) bool {
 			return cs.Collection == ds.Collection
@@ -151,21 +838,70 @@ func generateMigrationCommands(current, declared []schema.Schema, logger *slog.L
 		if csIdx < 0 {
 			toCreate = append(toCreate, ds)
 			logger.Debug("New collection to create", "collection", ds.Collection)
+			if ds.HasValidation() || ds.HasOptions() {
+				command, err := generateCreateCollectionCommand(ds)
+				if err != nil {
+					return nil, nil, err
+				}
+				created = append(created, command)
+			}
+			if ds.HasValidation() {
+				restore = append(restore, generateCollModCommand(schema.Schema{Collection: ds.Collection, Validator: map[string]any{}}))
+			}
+			if ds.HasOptions() {
+				createdWithOptions = append(createdWithOptions, ds)
+			}
 			continue
 		}
 
+		if !ds.OptionsMatch(current[csIdx]) {
+			logger.Warn("Collection options differ from their declaration, they can't change once it exists",
+				"collection", ds.Collection)
+		}
+
+		if ds.ManagesValidation() && !ds.ValidationEqual(current[csIdx]) {
+			validate = append(validate, generateCollModCommand(ds))
+			restore = append(restore, generateCollModCommand(current[csIdx]))
+			logger.Debug("Validator to change", "collection", ds.Collection)
+		}
+
 		diff := indexesDifference(ds.Indexes, current[csIdx].Indexes)
 		if len(diff) > 0 {
 			toCreate = append(toCreate, schema.Schema{Collection: ds.Collection, Indexes: diff})
 			logger.Debug("Indexes to create", "collection", ds.Collection, "indexCount", len(diff))
 		}
+
+		olds, news := modifiedIndexes(settings, current[csIdx], ds)
+		var rebuiltOlds, rebuiltNews []schema.Index
+		for k, index := range news {
+			if modUp, modDown, ok := generateIndexCollModCommands(settings, ds.Collection, olds[k], index); ok {
+				logger.Debug("Index to modify in place", "collection", ds.Collection, "index", index.Name)
+				modify, unmodify = append(modify, modUp), append(unmodify, modDown)
+				if !equalTTL(olds[k], index) {
+					retimed = append(retimed, schema.Schema{Collection: ds.Collection, Indexes: []schema.Index{index}})
+				}
+				continue
+			}
+			logger.Warn("Index definition changed, it is dropped and recreated", "collection", ds.Collection, "index", index.Name)
+			rebuiltOlds, rebuiltNews = append(rebuiltOlds, olds[k]), append(rebuiltNews, index)
+		}
+		if len(rebuiltNews) > 0 {
+			toReplace = append(toReplace, schema.Schema{Collection: ds.Collection, Indexes: rebuiltOlds})
+			replacements = append(replacements, schema.Schema{Collection: ds.Collection, Indexes: rebuiltNews})
+		}
 	}
 
 	toDrop := make([]schema.Schema, 0)
+	collectionsToDrop := make([]schema.Schema, 0)
 	for _, cs := range current {
 		dsIdx := slices.IndexFunc(declared, func(ds schema.Schema) bool {
 			return ds.Collection == cs.Collection
 		})
+		if dsIdx < 0 && slices.Contains(dropped, cs.Collection) {
+			collectionsToDrop = append(collectionsToDrop, cs)
+			logger.Warn("Collection and its documents to drop", "collection", cs.Collection)
+			continue
+		}
 		if dsIdx < 0 {
 			toDrop = append(toDrop, cs)
 			logger.Debug("Collection to drop", "collection", cs.Collection)
@@ -179,16 +915,50 @@ func generateMigrationCommands(current, declared []schema.Schema, logger *slog.L
 		}
 	}
 
-	if len(toCreate) == 0 && len(toDrop) == 0 {
+	// Collections are created first with their options and validators,
+	// before any index creates them. Indexes that can't be modified in place
+	// are dropped before their new definitions take their names. Search
+	// indexes come last, once their collections exist.
+	up := append(validate, modify...)
+	up = append(up, generateDestroyIndexCommands(toReplace)...)
+	up = append(up, generateCreateIndexesCommands(replacements)...)
+	up = append(up, generateCreateIndexesCommands(toCreate)...)
+	up = append(up, generateDestroyIndexCommands(toDrop)...)
+	up = append(up, generateDropCollectionCommands(collectionsToDrop)...)
+	searchUp, searchDown := generateSearchIndexCommands(current, declared, dropped)
+	if len(created) == 0 && len(up) == 0 && len(searchUp) == 0 {
 		return nil, nil, nil
 	}
-
-	upCommand, err = json.MarshalIndent(append(generateCreateIndexesCommands(toCreate), generateDestroyIndexCommands(toDrop)...), "", "  ")
+	upCommand, err = json.MarshalIndent(slices.Concat(created, commandList(up), searchUp), "", "  ")
 	if err != nil {
 		return nil, nil, err
 	}
 
-	downCommand, err = json.MarshalIndent(append(generateDestroyIndexCommands(toCreate), generateCreateIndexesCommands(toDrop)...), "", "  ")
+	// The down migration recreates dropped collections with their indexes,
+	// options and validators, but not their documents; it starts with the
+	// ways it is lossy.
+	down := generateLossyDownCommands(logger, lossyDownWarnings(
+		slices.Concat(toCreate, replacements, retimed), append(slices.Clone(toDrop), toReplace...), collectionsToDrop,
+		createdWithOptions, recorded))
+	down = append(down, restore...)
+	down = append(down, unmodify...)
+	down = append(down, generateDestroyIndexCommands(toCreate)...)
+	down = append(down, generateCreateIndexesCommands(toDrop)...)
+	down = append(down, generateDestroyIndexCommands(replacements)...)
+	down = append(down, generateCreateIndexesCommands(toReplace)...)
+	var recreated []any
+	for _, cs := range collectionsToDrop {
+		if cs.HasValidation() || cs.HasOptions() {
+			command, err := generateCreateCollectionCommand(cs)
+			if err != nil {
+				return nil, nil, err
+			}
+			recreated = append(recreated, command)
+		}
+	}
+	downCommand, err = json.MarshalIndent(
+		slices.Concat(commandList(down), recreated, commandList(generateCreateIndexesCommands(collectionsToDrop)), searchDown),
+		"", "  ")
 	if err != nil {
 		return nil, nil, err
 	}
@@ -196,14 +966,73 @@ func generateMigrationCommands(current, declared []schema.Schema, logger *slog.L
 	return upCommand, downCommand, nil
 }
 
+// generateSplitMigrations generates a migration pair per changed collection,
+// in the order of their names, each named after its collection.
+func generateSplitMigrations(
+	settings compiledSettings,
+	current, declared []schema.Schema,
+	dropped []string,
+	recorded bool,
+	logger *slog.Logger,
+) ([]generatedMigration, error) {
+	var collections []string
+	for _, schemas := range [][]schema.Schema{current, declared} {
+		for _, s := range schemas {
+			if !slices.Contains(collections, s.Collection) {
+				collections = append(collections, s.Collection)
+			}
+		}
+	}
+	slices.Sort(collections)
+
+	var migrations []generatedMigration
+	for _, collection := range collections {
+		other := func(s schema.Schema) bool { return s.Collection != collection }
+		upCommand, downCommand, err := generateMigrationCommands(
+			settings,
+			slices.DeleteFunc(slices.Clone(current), other),
+			slices.DeleteFunc(slices.Clone(declared), other),
+			dropped, recorded, logger,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if upCommand != nil || downCommand != nil {
+			migrations = append(migrations, generatedMigration{
+				Suffix: "_" + fileNamePart(collection), Up: upCommand, Down: downCommand,
+			})
+		}
+	}
+	return migrations, nil
+}
+
+// fileNamePart replaces the characters of name that don't belong in a file
+// name by underscores.
+func fileNamePart(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
 // generateCreateIndexesCommands generates createIndexes MongoDB commands
 func generateCreateIndexesCommands(schemas []schema.Schema) []map[string]interface{} {
 	commands := make([]map[string]interface{}, 0, len(schemas))
 
 	for _, s := range schemas {
+		if len(s.Indexes) == 0 {
+			continue
+		}
+		indexes := make([]schema.Index, 0, len(s.Indexes))
+		for _, index := range s.Indexes {
+			indexes = append(indexes, index.WithoutAnnotations())
+		}
+
 		commands = append(commands, map[string]interface{}{
 			"createIndexes": s.Collection,
-			"indexes":       s.Indexes,
+			"indexes":       indexes,
 		})
 	}
 
@@ -231,33 +1060,250 @@ func generateDestroyIndexCommands(schemas []schema.Schema) []map[string]interfac
 	return commands
 }
 
-// writeMigrationCommands writes the migration commands to files
-func writeMigrationCommands(upCommand, downCommand []byte, migrationDir, migrationName string) error {
-	if err := os.MkdirAll(migrationDir, os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+// namedCommand is a MongoDB command encoded with its name first, as the
+// server requires, for the commands whose other fields may sort before it,
+// e.g. capped or definition.
+type namedCommand struct {
+	name, collection string
+	fields           map[string]interface{}
+}
+
+func (c namedCommand) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	name, err := json.Marshal(c.name)
+	if err != nil {
+		return nil, err
+	}
+	collection, err := json.Marshal(c.collection)
+	if err != nil {
+		return nil, err
+	}
+	b.WriteByte('{')
+	b.Write(name)
+	b.WriteByte(':')
+	b.Write(collection)
+	for _, key := range slices.Sorted(maps.Keys(c.fields)) {
+		field, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(c.fields[key])
+		if err != nil {
+			return nil, err
+		}
+		b.WriteByte(',')
+		b.Write(field)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// commandList widens commands to be listed along create commands.
+func commandList(commands []map[string]interface{}) []any {
+	list := make([]any, 0, len(commands))
+	for _, command := range commands {
+		list = append(list, command)
+	}
+	return list
+}
+
+// generateCreateCollectionCommand generates the create MongoDB command of a
+// collection with its options and validator.
+func generateCreateCollectionCommand(s schema.Schema) (namedCommand, error) {
+	command := namedCommand{name: "create", collection: s.Collection, fields: map[string]interface{}{}}
+	if s.Options != nil {
+		data, err := json.Marshal(s.Options)
+		if err != nil {
+			return namedCommand{}, fmt.Errorf("encoding options of %s: %w", s.Collection, err)
+		}
+		var options map[string]json.RawMessage
+		if err := json.Unmarshal(data, &options); err != nil {
+			return namedCommand{}, fmt.Errorf("encoding options of %s: %w", s.Collection, err)
+		}
+		for key, value := range options {
+			command.fields[key] = value
+		}
+	}
+	if s.HasValidation() {
+		command.fields["validator"] = s.Validator
+	}
+	if s.ValidationLevel != "" {
+		command.fields["validationLevel"] = s.ValidationLevel
+	}
+	if s.ValidationAction != "" {
+		command.fields["validationAction"] = s.ValidationAction
+	}
+	return command, nil
+}
+
+// generateCollModCommand generates the collMod MongoDB command setting the
+// validator of a collection, an empty one removing it.
+func generateCollModCommand(s schema.Schema) map[string]interface{} {
+	validator := s.Validator
+	if validator == nil {
+		validator = map[string]any{}
+	}
+	return map[string]interface{}{
+		"collMod":          s.Collection,
+		"validator":        validator,
+		"validationLevel":  cmp.Or(s.ValidationLevel, schema.DefaultValidationLevel),
+		"validationAction": cmp.Or(s.ValidationAction, schema.DefaultValidationAction),
+	}
+}
+
+// generateDropCollectionCommands generates drop MongoDB commands
+func generateDropCollectionCommands(schemas []schema.Schema) []map[string]interface{} {
+	commands := make([]map[string]interface{}, 0, len(schemas))
+
+	for _, s := range schemas {
+		commands = append(commands, map[string]interface{}{
+			"drop": s.Collection,
+		})
+	}
+
+	return commands
+}
+
+// writeMigrationCommands writes the migration commands to JSON files.
+func writeMigrationCommands(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings compiledSettings,
+	upCommand, downCommand []byte,
+	header migrationHeader,
+	migrationDir, migrationName string,
+) error {
+	_, err := writeMigration(ctx, logger, settings, upCommand, downCommand, header, MigrationFormatJSON, migrationDir, migrationName)
+	return err
+}
+
+// writeMigration writes the migration commands to files in the format. The
+// migration directory is locked from picking the version until the files are
+// written, so concurrent runs can't claim the same version. It returns the
+// paths of the files written.
+func writeMigration(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings compiledSettings,
+	upCommand, downCommand []byte,
+	header migrationHeader,
+	format string,
+	migrationDir, migrationName string,
+) ([]string, error) {
+	unlock, err := lockMigrationDir(ctx, logger, migrationDir)
+	if err != nil {
+		return nil, err
 	}
+	defer unlock()
 
-	version, err := getNextVersion(migrationDir)
+	version, err := getNextVersion(migrationDir, format)
 	if err != nil {
-		return fmt.Errorf("failed to determine next version: %w", err)
+		return nil, fmt.Errorf("failed to determine next version: %w", err)
+	}
+
+	if err := checkVersionUnused(migrationDir, version, format); err != nil {
+		return nil, err
+	}
+
+	for _, commands := range []*[]byte{&upCommand, &downCommand} {
+		if *commands == nil {
+			continue
+		}
+		if *commands, err = encodeMigration(*commands, header, format); err != nil {
+			return nil, err
+		}
 	}
 
-	upCommandFilePath := filepath.Join(migrationDir, fmt.Sprintf("%06d_%s.up.json", version, migrationName))
-	if err := os.WriteFile(upCommandFilePath, upCommand, 0600); err != nil {
-		return fmt.Errorf("failed to write up command: %w", err)
+	// The pair is written together so an interrupted run never leaves an up
+	// migration without its down migration. A nil side isn't written.
+	var files []atomicfile.File
+	if upCommand != nil {
+		files = append(files, atomicfile.File{
+			Path: filepath.Join(migrationDir, fmt.Sprintf("%06d_%s.up.%s", version, migrationName, format)), Data: upCommand,
+		})
+	}
+	if downCommand != nil {
+		files = append(files, atomicfile.File{
+			Path: filepath.Join(migrationDir, fmt.Sprintf("%06d_%s.down.%s", version, migrationName, format)), Data: downCommand,
+		})
 	}
+	if err := settings.permissions.WriteAll(files); err != nil {
+		return nil, fmt.Errorf("failed to write migration: %w", err)
+	}
+
+	return filePaths(files), nil
+}
 
-	downCommandFilePath := filepath.Join(migrationDir, fmt.Sprintf("%06d_%s.down.json", version, migrationName))
-	if err := os.WriteFile(downCommandFilePath, downCommand, 0600); err != nil {
-		return fmt.Errorf("failed to write down command: %w", err)
+// writePreview writes the migrations a dry-run would generate to dir, named
+// without a version so none is used up, and returns their paths.
+func writePreview(
+	logger *slog.Logger,
+	settings compiledSettings,
+	migrations []generatedMigration,
+	header migrationHeader,
+	format string,
+	dir, migrationName string,
+) ([]string, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("creating preview directory: %w", err)
 	}
 
+	var files []atomicfile.File
+	for _, m := range migrations {
+		for _, side := range []struct {
+			direction string
+			commands  []byte
+		}{{"up", m.Up}, {"down", m.Down}} {
+			if side.commands == nil {
+				continue
+			}
+			data, err := encodeMigration(side.commands, header, format)
+			if err != nil {
+				return nil, err
+			}
+			path := filepath.Join(dir, fmt.Sprintf("%s%s.%s.%s", migrationName, m.Suffix, side.direction, format))
+			files = append(files, atomicfile.File{Path: path, Data: data})
+		}
+	}
+
+	logger.Info("Dry-run: writing migrations to preview directory", "path", dir, "files", len(files))
+	if err := settings.permissions.WriteAll(files); err != nil {
+		return nil, fmt.Errorf("failed to write preview: %w", err)
+	}
+	return filePaths(files), nil
+}
+
+// filePaths returns the paths of the files.
+func filePaths(files []atomicfile.File) []string {
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	return paths
+}
+
+// checkVersionUnused fails if a migration file of the format already has the
+// version.
+func checkVersionUnused(migrationDir string, version uint64, format string) error {
+	files, err := dirSource(migrationDir).filesOf(format)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.Version == version {
+			return fmt.Errorf("migration version %d is already used by %s", version, file.Path)
+		}
+	}
 	return nil
 }
 
-// getNextVersion determines the next version number for a migration file.
-func getNextVersion(migrationDir string) (uint64, error) {
-	matches, err := filepath.Glob(filepath.Join(migrationDir, "*.json"))
+// getNextVersion determines the next version number for a migration file of
+// the format. Mongosh scripts are numbered apart from JSON migrations, which
+// alone apply reads.
+func getNextVersion(migrationDir, format string) (uint64, error) {
+	matches, err := filepath.Glob(filepath.Join(migrationDir, "*."+format))
 	if err != nil {
 		return 0, fmt.Errorf("failed to match migration files: %w", err)
 	}
@@ -287,3 +1333,52 @@ func getNextVersion(migrationDir string) (uint64, error) {
 
 	return maxVersion + 1, nil
 }
+
+// Drift is what CheckDrift found.
+type Drift struct {
+	// Migrations is the number of migrations diff would generate.
+	Migrations int
+	// ReadOnly lists the differences of read-only collections.
+	ReadOnly []string
+}
+
+// CheckDrift generates the migrations diff would and reports how many there
+// are, i.e. whether the current schema drifted from the declared one, along
+// with the drift of read-only collections. With a PreviewDir, the migrations
+// are written there as with diff --dry_run --out-dir.
+func CheckDrift(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+	diffOptions DiffOptions,
+) (Drift, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return Drift{}, err
+	}
+
+	planDir := diffOptions.PreviewDir
+	plan, err := generateMigrationScripts(ctx, logger, compiled, mongoURI, databaseName, diffOptions)
+	if err != nil {
+		return Drift{}, fmt.Errorf("failed to generate migration scripts: %w", err)
+	}
+
+	if err := checkPlanPolicies(ctx, logger, diffOptions.Policies, databaseName, plan); err != nil {
+		return Drift{}, err
+	}
+
+	drift := Drift{Migrations: len(plan.Migrations)}
+	for _, d := range plan.ReadOnlyDrift {
+		drift.ReadOnly = append(drift.ReadOnly, d.String())
+	}
+	if planDir == "" || len(plan.Migrations) == 0 {
+		return drift, nil
+	}
+
+	header := newMigrationHeader(plan.SchemaHash, databaseName)
+	if _, err := writePreview(logger, compiled, plan.Migrations, header, MigrationFormatJSON, planDir, "plan"); err != nil {
+		return Drift{}, err
+	}
+	return drift, nil
+}
@@ -0,0 +1,204 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/version"
+)
+
+// headerCommand is the first entry of generated migrations, recording how
+// they came to exist. apply skips it.
+const headerCommand = "mondexMigration"
+
+// annotationCommands are the entries of migrations that document them and
+// aren't run.
+var annotationCommands = []string{headerCommand, lossyDownCommand}
+
+// interpretedCommands are the migration entries mondex handles itself instead
+// of sending them to the server. A binary that doesn't know one would send it
+// to the server, so generated migrations list those they use in their header,
+// and apply refuses migrations requiring entries it doesn't know.
+var interpretedCommands = []string{lossyDownCommand, verifyIndexesCommand}
+
+// migrationHeader is the provenance of a generated migration.
+type migrationHeader struct {
+	MondexVersion string    `json:"mondexVersion"`
+	GeneratedAt   time.Time `json:"generatedAt"`
+	// SchemaHash is the SHA-256 of the schema file the migration was
+	// generated from.
+	SchemaHash string `json:"schemaHash,omitempty"`
+	Database   string `json:"database,omitempty"`
+	// Requires lists the interpreted commands the migration uses.
+	Requires []string `json:"requires,omitempty"`
+}
+
+// newMigrationHeader returns the header of migrations generated now for the
+// database, which may be unknown, from the schema file with the hash
+// schemaHash returns. Migrations generated without a schema file, such as
+// baselines, have no schema hash.
+func newMigrationHeader(schemaHash, databaseName string) migrationHeader {
+	return migrationHeader{
+		MondexVersion: version.String(),
+		GeneratedAt:   time.Now().UTC().Truncate(time.Second),
+		SchemaHash:    schemaHash,
+		Database:      databaseName,
+	}
+}
+
+// schemaHash returns the schema hash of headers for the schema file contents.
+func schemaHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return formatSchemaHash(sum[:])
+}
+
+// hashSchemaFile returns the schema hash of the schema file at path, reading
+// it as it's hashed.
+func hashSchemaFile(path string) (string, error) {
+	if path == StdinPath || isSchemaDir(path) {
+		data, err := readFile(path)
+		if err != nil {
+			return "", err
+		}
+		return schemaHash(data), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return formatSchemaHash(h.Sum(nil)), nil
+}
+
+// formatSchemaHash formats a SHA-256 sum as the schema hash of headers.
+func formatSchemaHash(sum []byte) string {
+	return "sha256:" + hex.EncodeToString(sum)
+}
+
+// withHeader prepends the header to the commands of a migration file.
+func withHeader(commands []byte, header migrationHeader) ([]byte, error) {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(commands, &entries); err != nil {
+		return nil, fmt.Errorf("reading migration commands: %w", err)
+	}
+
+	header.Requires = nil
+	for _, entry := range entries {
+		name := firstKey(entry)
+		if slices.Contains(interpretedCommands, name) && !slices.Contains(header.Requires, name) {
+			header.Requires = append(header.Requires, name)
+		}
+	}
+	slices.Sort(header.Requires)
+
+	entry, err := json.Marshal(map[string]migrationHeader{headerCommand: header})
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(append([]json.RawMessage{entry}, entries...), "", "  ")
+}
+
+// firstKey returns the name of the command of a migration entry.
+func firstKey(entry json.RawMessage) string {
+	dec := json.NewDecoder(bytes.NewReader(entry))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return ""
+	}
+	tok, _ := dec.Token()
+	name, _ := tok.(string)
+	return name
+}
+
+// checkRequirements fails if the migration was generated by a mondex using
+// interpreted commands this binary doesn't know.
+func checkRequirements(commands []bson.D) error {
+	if len(commands) == 0 || len(commands[0]) == 0 || commands[0][0].Key != headerCommand {
+		return nil
+	}
+
+	var body struct {
+		Header struct {
+			MondexVersion string   `bson:"mondexVersion"`
+			Requires      []string `bson:"requires"`
+		} `bson:"mondexMigration"`
+	}
+	if err := decodeCommand(commands[0], &body); err != nil {
+		return err
+	}
+
+	var unknown []string
+	for _, name := range body.Header.Requires {
+		if !slices.Contains(interpretedCommands, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("generated by mondex %s, requires %s unknown to mondex %s, upgrade mondex to apply it",
+			body.Header.MondexVersion, strings.Join(unknown, ", "), version.String())
+	}
+	return nil
+}
+
+// checkPendingRequirements checks the requirements of the up migrations newer
+// than the version recorded in the database, before any of them is applied.
+func checkPendingRequirements(ctx context.Context, database *mongo.Database, migrations migrationSource) error {
+	applied, _, err := db.MigrationVersion(ctx, database)
+	if err != nil {
+		return err
+	}
+
+	files, err := migrations.files()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.Direction != "up" || (applied != db.NilVersion && file.Version <= uint64(applied)) {
+			continue
+		}
+
+		body, err := file.read()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", file.Path, err)
+		}
+
+		var commands []bson.D
+		if err := bson.UnmarshalExtJSON(body, true, &commands); err != nil {
+			return fmt.Errorf("unmarshaling migration commands of %s: %w", file.Path, err)
+		}
+		if err := checkRequirements(commands); err != nil {
+			return fmt.Errorf("migration %s: %w", filepath.Base(file.Path), err)
+		}
+	}
+	return nil
+}
+
+// isAnnotation reports whether the migration entry documents the migration
+// rather than being a command.
+func isAnnotation(command bson.D) bool {
+	return len(command) > 0 && slices.Contains(annotationCommands, command[0].Key)
+}
+
+// withoutAnnotations returns the commands of a migration file.
+func withoutAnnotations(commands []bson.D) []bson.D {
+	return slices.DeleteFunc(commands, isAnnotation)
+}
@@ -0,0 +1,69 @@
+package migration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ltman/mondex/version"
+)
+
+func TestBaselineMigrationHasHeader(t *testing.T) {
+	dir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := WriteBaselineMigration(logger, Settings{}, dir, 42); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, direction := range []string{"up", "down"} {
+		data, err := os.ReadFile(filepath.Join(dir, "000042_baseline."+direction+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var entries []map[string]migrationHeader
+		if err := json.Unmarshal(data, &entries); err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("%s: want only the header, got %s", direction, data)
+		}
+		header, ok := entries[0][headerCommand]
+		if !ok || header.MondexVersion != version.String() || header.GeneratedAt.IsZero() {
+			t.Errorf("%s: want a header with mondex %s, got %s", direction, version.String(), data)
+		}
+		if header.SchemaHash != "" {
+			t.Errorf("%s: baseline has a schema hash: %s", direction, header.SchemaHash)
+		}
+	}
+}
+
+func TestDeclaredSchemaHashIsFileHash(t *testing.T) {
+	for name, data := range map[string]string{
+		"schema.json": `[{"collection": "users", "indexes": [{"name": "a_1", "key": {"a": 1}}]}]` + "\n",
+		"schema.yml":  "- collection: users\n  indexes:\n    - name: a_1\n      key: {a: 1}\n",
+	} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		schemas, hash, err := hashDeclaredSchema(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(schemas) != 1 {
+			t.Errorf("%s: got %d collections, want 1", name, len(schemas))
+		}
+		sum := sha256.Sum256([]byte(data))
+		if want := "sha256:" + hex.EncodeToString(sum[:]); hash != want {
+			t.Errorf("%s: hash %s, want %s", name, hash, want)
+		}
+		if fileHash, err := hashSchemaFile(path); err != nil || fileHash != hash {
+			t.Errorf("%s: hashSchemaFile = %s, %v, want %s", name, fileHash, err, hash)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+
+	"github.com/ltman/mondex/db"
+)
+
+// applierIdentity identifies who runs apply in the history, as user@host.
+func applierIdentity() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	return name
+}
+
+// ReadHistory connects to MongoDB and returns the migration runs recorded by
+// apply, oldest first.
+func ReadHistory(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+) ([]db.MigrationRun, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Connecting to MongoDB")
+	client, err := compiled.connect(ctx, mongoURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer func() {
+		if err := compiled.disconnect(ctx, client); err != nil {
+			logger.Error("Failed to disconnect from MongoDB", "error", err)
+		}
+	}()
+
+	return db.MigrationRuns(ctx, client.Database(databaseName))
+}
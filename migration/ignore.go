@@ -0,0 +1,87 @@
+package migration
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ltman/mondex/db"
+)
+
+// internalCollections hold the bookkeeping of golang-migrate and mondex and
+// are always ignored.
+var internalCollections = []string{db.LockCollection, db.MigrationsCollection, db.StateCollection, db.OutOfOrderCollection, db.HistoryCollection}
+
+// DefaultIgnoredCollections are the collection patterns ignored unless
+// configured otherwise: system collections, client-side and queryable
+// encryption metadata, and the changelogs of other migration tools.
+var DefaultIgnoredCollections = []string{
+	"system.*",
+	"__keyVault",
+	"enxcol_.*",
+	"mongockChangeLog",
+	"mongockLock",
+	"DATABASECHANGELOG",
+	"DATABASECHANGELOGLOCK",
+}
+
+// DefaultIgnoredIndexes are the index patterns ignored unless configured
+// otherwise.
+var DefaultIgnoredIndexes = []string{"_id_"}
+
+// ignoreRule matches names against a glob or, written between slashes, a
+// regular expression.
+type ignoreRule struct {
+	pattern string
+	regexp  *regexp.Regexp
+}
+
+func (r ignoreRule) String() string {
+	return r.pattern
+}
+
+func (r ignoreRule) match(name string) bool {
+	if r.regexp != nil {
+		return r.regexp.MatchString(name)
+	}
+	matched, _ := path.Match(r.pattern, name)
+	return matched
+}
+
+// compileIgnoreRules parses patterns; regular expressions, e.g. /backup_\d+/,
+// must match whole names like globs do.
+func compileIgnoreRules(patterns []string) ([]ignoreRule, error) {
+	rules := make([]ignoreRule, 0, len(patterns))
+	for _, pattern := range patterns {
+		rule := ignoreRule{pattern: pattern}
+		if expr, ok := strings.CutPrefix(pattern, "/"); ok && len(expr) > 0 && strings.HasSuffix(expr, "/") {
+			re, err := regexp.Compile("^(?:" + strings.TrimSuffix(expr, "/") + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+			}
+			rule.regexp = re
+		} else if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ignoredCollection reports whether the collection is left out of schemas.
+func (s compiledSettings) ignoredCollection(name string) bool {
+	return slices.Contains(internalCollections, name) || matchesAny(s.collectionsToIgnore, name)
+}
+
+// ignoredIndex reports whether the index is left out of schemas. Indexes
+// declared without a name are matched by the name the server gives them, as
+// indexName returns it.
+func (s compiledSettings) ignoredIndex(name string) bool {
+	return matchesAny(s.indexesToIgnore, name)
+}
+
+func matchesAny(rules []ignoreRule, name string) bool {
+	return slices.ContainsFunc(rules, func(rule ignoreRule) bool { return rule.match(name) })
+}
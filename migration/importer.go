@@ -0,0 +1,88 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// MergeIntoSchemaFile adds imported collections and indexes to the schema file,
+// replacing declared indexes of the same name and keeping everything else.
+// A missing schema file is created.
+func MergeIntoSchemaFile(
+	_ context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	schemaFilePath string,
+	imported []schema.Schema,
+	dryRun bool,
+) error {
+	compiled, err := settings.compile()
+	if err != nil {
+		return err
+	}
+
+	declared, err := readDeclaredSchema(schemaFilePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		declared, err = []schema.Schema{}, nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading declared schema: %w", err)
+	}
+
+	merged := mergeSchemas(declared, imported)
+
+	schemas, err := marshalSchemas(compiled, schemaFilePath, merged)
+	if err != nil {
+		return fmt.Errorf("marshalling schema: %w", err)
+	}
+
+	if dryRun {
+		logger.Info("Dry-run: showing schema without writing file")
+
+		fmt.Printf("Schema that would be written to %s:\n", schemaFilePath) //nolint:forbidigo
+		if _, err := os.Stdout.Write(schemas); err != nil {
+			return fmt.Errorf("writing declared schema: %w", err)
+		}
+
+		return nil
+	}
+
+	logger.Info("Writing merged schema to file", "path", schemaFilePath)
+	if err := writeSchemaFile(compiled, schemaFilePath, schemas); err != nil {
+		return fmt.Errorf("writing declared schema: %w", err)
+	}
+
+	return nil
+}
+
+// mergeSchemas upserts the imported indexes into the declared schemas by
+// collection and index name.
+func mergeSchemas(declared, imported []schema.Schema) []schema.Schema {
+	merged := slices.Clone(declared)
+	for _, is := range imported {
+		i := slices.IndexFunc(merged, func(s schema.Schema) bool { return s.Collection == is.Collection })
+		if i < 0 {
+			merged = append(merged, is)
+			continue
+		}
+
+		indexes := slices.Clone(merged[i].Indexes)
+		for _, index := range is.Indexes {
+			j := slices.IndexFunc(indexes, func(existing schema.Index) bool { return existing.Name == index.Name })
+			if j < 0 {
+				indexes = append(indexes, index)
+			} else {
+				indexes[j] = index
+			}
+		}
+		merged[i].Indexes = indexes
+	}
+	return merged
+}
@@ -2,22 +2,36 @@ package migration
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/query"
+	"github.com/ltman/mondex/schema"
 )
 
 func InspectCurrentSchema(
 	ctx context.Context,
 	logger *slog.Logger,
+	settings Settings,
 	mongoURI, databaseName string,
+	readOptions db.ReadOptions,
 	schemaFilePath string,
 	dryRun bool,
+	anonymize bool,
 ) error {
-	schemas, err := inspectCurrentSchema(ctx, logger, mongoURI, databaseName)
+	compiled, err := settings.compile()
+	if err != nil {
+		return err
+	}
+
+	schemas, err := inspectCurrentSchema(ctx, logger, compiled, mongoURI, databaseName, readOptions, schemaFilePath, anonymize)
 	if err != nil {
 		return fmt.Errorf("inspecting current schema: %w", err)
 	}
@@ -34,34 +48,257 @@ func InspectCurrentSchema(
 	}
 
 	logger.Info("Writing current schema to file", "path", schemaFilePath)
-	if err := os.WriteFile(schemaFilePath, schemas, 0600); err != nil {
+	if err := writeSchemaFile(compiled, schemaFilePath, schemas); err != nil {
 		return fmt.Errorf("writing current schema: %w", err)
 	}
 
 	return nil
 }
 
+// WriteCurrentSchema connects to MongoDB and writes the current schema of the
+// database to w as a JSON schema file would hold it.
+func WriteCurrentSchema(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	w io.Writer,
+	mongoURI, databaseName string,
+	readOptions db.ReadOptions,
+	anonymize bool,
+) error {
+	compiled, err := settings.compile()
+	if err != nil {
+		return err
+	}
+
+	schemas, err := inspectCurrentSchema(ctx, logger, compiled, mongoURI, databaseName, readOptions, "", anonymize)
+	if err != nil {
+		return fmt.Errorf("inspecting current schema: %w", err)
+	}
+	if _, err := w.Write(schemas); err != nil {
+		return fmt.Errorf("writing current schema: %w", err)
+	}
+	return nil
+}
+
 func inspectCurrentSchema(
 	ctx context.Context,
 	logger *slog.Logger,
+	settings compiledSettings,
 	mongoURI, databaseName string,
+	readOptions db.ReadOptions,
+	schemaFilePath string,
+	anonymize bool,
 ) ([]byte, error) {
+	current, err := readCurrentSchema(ctx, logger, settings, mongoURI, databaseName, readOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	current = schema.CollapseBuckets(normalizeDeprecated(logger, current))
+	if anonymize {
+		logger.Info("Anonymizing collection, field and index names")
+		current = schema.Anonymize(current)
+	}
+	return marshalSchemas(settings, schemaFilePath, current)
+}
+
+// ReadCurrentSchema connects to MongoDB and returns the current schema of the
+// database, filtered and ordered the same way as the declared schema.
+func ReadCurrentSchema(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+	readOptions db.ReadOptions,
+) ([]schema.Schema, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return nil, err
+	}
+	return readCurrentSchema(ctx, logger, compiled, mongoURI, databaseName, readOptions)
+}
+
+// readCurrentSchema is ReadCurrentSchema with compiled settings.
+func readCurrentSchema(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings compiledSettings,
+	mongoURI, databaseName string,
+	readOptions db.ReadOptions,
+) ([]schema.Schema, error) {
 	logger.Debug("Connecting to MongoDB")
-	client, err := db.ConnectToMongoDB(ctx, mongoURI)
+	client, err := settings.connect(ctx, mongoURI)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
 	}
 	defer func() {
-		if err := client.Disconnect(context.Background()); err != nil {
+		if err := settings.disconnect(ctx, client); err != nil {
 			logger.Error("Failed to disconnect from MongoDB", "error", err)
 		}
 	}()
 
-	logger.Debug("Reading current schema from MongoDB")
-	current, err := db.ReadCurrentSchema(ctx, client.Database(databaseName))
+	return readDatabaseSchema(ctx, logger, settings, client, databaseName, readOptions)
+}
+
+// readDatabaseSchema returns the current schema of a database of the
+// connected deployment, like ReadCurrentSchema.
+func readDatabaseSchema(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings compiledSettings,
+	client *mongo.Client,
+	databaseName string,
+	readOptions db.ReadOptions,
+) ([]schema.Schema, error) {
+	database, err := db.OpenDatabase(client, databaseName, readOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Reading current schema from MongoDB",
+		"readPreference", readOptions.Preference, "concurrency", max(readOptions.Concurrency, 1))
+	current, err := db.ReadCurrentSchema(ctx, database, readOptions.Concurrency)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read current schema: %w", err)
 	}
+	if readOptions.SearchIndexes {
+		logger.Debug("Reading search indexes from MongoDB")
+		if current, err = db.ReadSearchIndexes(ctx, database, current); err != nil {
+			return nil, err
+		}
+	}
+	logIndexBuilds(ctx, logger, client, databaseName, indexBuilds(current), "Index build in progress")
+
+	return prepareSchemas(settings, current), nil
+}
+
+// ReadIndexSizes connects to MongoDB and returns the size in bytes of every
+// index of the given collections, keyed by collection and index name.
+func ReadIndexSizes(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+	readOptions db.ReadOptions,
+	collections []string,
+) (map[string]map[string]int64, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Connecting to MongoDB")
+	client, err := compiled.connect(ctx, mongoURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer func() {
+		if err := compiled.disconnect(ctx, client); err != nil {
+			logger.Error("Failed to disconnect from MongoDB", "error", err)
+		}
+	}()
+
+	database, err := db.OpenDatabase(client, databaseName, readOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]map[string]int64, len(collections))
+	for _, collection := range collections {
+		logger.Debug("Reading index sizes", "collection", collection)
+		collectionSizes, err := db.IndexSizes(ctx, database, collection)
+		if err != nil {
+			return nil, fmt.Errorf("reading index sizes of %s: %w", collection, err)
+		}
+		sizes[collection] = collectionSizes
+	}
+
+	return sizes, nil
+}
+
+// CollectionDetails describes one collection of the live database.
+type CollectionDetails struct {
+	Schema  schema.Schema
+	Type    string
+	Options bson.D
+	Stats   db.CollectionStats
+	Usage   map[string]db.IndexUsage
+}
+
+// ReadCollectionDetails connects to MongoDB and returns the indexes, options,
+// storage statistics and index usage counters of a single collection.
+func ReadCollectionDetails(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+	readOptions db.ReadOptions,
+	collection string,
+) (CollectionDetails, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return CollectionDetails{}, err
+	}
+
+	current, err := readCurrentSchema(ctx, logger, compiled, mongoURI, databaseName, readOptions)
+	if err != nil {
+		return CollectionDetails{}, err
+	}
+
+	details := CollectionDetails{Schema: schema.Schema{Collection: collection}}
+	if i := slices.IndexFunc(current, func(s schema.Schema) bool { return s.Collection == collection }); i >= 0 {
+		details.Schema = current[i]
+	}
+
+	logger.Debug("Connecting to MongoDB")
+	client, err := compiled.connect(ctx, mongoURI)
+	if err != nil {
+		return CollectionDetails{}, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer func() {
+		if err := compiled.disconnect(ctx, client); err != nil {
+			logger.Error("Failed to disconnect from MongoDB", "error", err)
+		}
+	}()
+
+	database, err := db.OpenDatabase(client, databaseName, readOptions)
+	if err != nil {
+		return CollectionDetails{}, err
+	}
+
+	if details.Type, details.Options, err = db.ReadCollectionOptions(ctx, database, collection); err != nil {
+		return CollectionDetails{}, err
+	}
+	if details.Stats, err = db.ReadCollectionStats(ctx, database, collection); err != nil {
+		return CollectionDetails{}, err
+	}
+	if details.Usage, err = db.ReadIndexUsage(ctx, database, collection); err != nil {
+		return CollectionDetails{}, err
+	}
+
+	return details, nil
+}
+
+// QueryCurrentSchema connects to MongoDB and evaluates the path against the
+// current schema, returning the matches as extended JSON.
+func QueryCurrentSchema(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+	readOptions db.ReadOptions,
+	path *query.Path,
+) ([]byte, error) {
+	current, err := ReadCurrentSchema(ctx, logger, settings, mongoURI, databaseName, readOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := query.Document(current)
+	if err != nil {
+		return nil, fmt.Errorf("converting schema for query: %w", err)
+	}
 
-	return json.MarshalIndent(prepareSchemas(current), "", "  ")
+	return query.MarshalJSON(path.Evaluate(doc))
 }
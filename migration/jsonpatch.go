@@ -0,0 +1,166 @@
+package migration
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// jsonPatchOperation is an operation of a JSON Patch (RFC 6902).
+type jsonPatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+// declaredEntry locates a collection in the schema file: its position and
+// the positions of its indexes.
+type declaredEntry struct {
+	position int
+	indexes  map[string]int
+}
+
+// GenerateJSONPatch compares the schemas as diff does and returns the
+// differences as a JSON Patch (RFC 6902) against the declared schema file:
+// applied to it, the patch yields the current schema. Indexes to create are
+// removed, indexes to drop added and modified indexes replaced by their
+// current definition, keeping their annotations.
+func GenerateJSONPatch(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+	diffOptions DiffOptions,
+) ([]byte, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the index differences make the patch.
+	diffOptions.AccessFilePath = ""
+	diffOptions.ConfirmDrop = func([]string) bool { return true }
+
+	plan, err := generateMigrationScripts(ctx, logger, compiled, mongoURI, databaseName, diffOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare schemas: %w", err)
+	}
+
+	file, err := readDeclaredSchema(diffOptions.SchemaFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read declared schema: %w", err)
+	}
+
+	patch, err := json.MarshalIndent(jsonPatch(compiled, file, plan.Declared, plan.Current), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding JSON patch: %w", err)
+	}
+	return patch, nil
+}
+
+// jsonPatch returns the operations turning the schema file into the current
+// schema. Replacements come first and removals last to first, so every path
+// refers to the file as written; additions go at the end of the arrays.
+func jsonPatch(settings compiledSettings, file, declared, current []schema.Schema) []jsonPatchOperation {
+	entries := make(map[string]declaredEntry, len(file))
+	for i, s := range file {
+		entry := declaredEntry{position: i, indexes: make(map[string]int, len(s.Indexes))}
+		for j, index := range s.Indexes {
+			entry.indexes[index.Name] = j
+		}
+		collection := s.Collection
+		if s.GridFS {
+			// The indexes of a bucket are those of its files collection.
+			collection += ".files"
+		}
+		entries[collection] = entry
+	}
+
+	var collections []string
+	for _, schemas := range [][]schema.Schema{declared, current} {
+		for _, s := range schemas {
+			if !slices.Contains(collections, s.Collection) {
+				collections = append(collections, s.Collection)
+			}
+		}
+	}
+	slices.Sort(collections)
+
+	type removal struct{ collection, index int }
+	var replacements, additions []jsonPatchOperation
+	var removals []removal
+	for _, collection := range collections {
+		entry, inFile := entries[collection]
+		var declaredIndexes, currentIndexes []schema.Index
+		if i := slices.IndexFunc(declared, func(s schema.Schema) bool { return s.Collection == collection }); i >= 0 {
+			declaredIndexes = declared[i].Indexes
+		}
+		if i := slices.IndexFunc(current, func(s schema.Schema) bool { return s.Collection == collection }); i >= 0 {
+			currentIndexes = current[i].Indexes
+		}
+
+		for _, index := range declaredIndexes {
+			j, ok := entry.indexes[index.Name]
+			if !inFile || !ok {
+				// Implied by the file, such as the indexes of GridFS buckets.
+				continue
+			}
+			live := findIndex(current, collection, index.Name)
+			switch {
+			case live == nil:
+				removals = append(removals, removal{entry.position, j})
+			case !matchesDeclared(settings, index, *live):
+				replaced := live.WithoutAnnotations()
+				replaced.Description, replaced.Meta = index.Description, index.Meta
+				replacements = append(replacements, jsonPatchOperation{
+					Op: "replace", Path: indexPointer(entry.position, j), Value: replaced,
+				})
+			}
+		}
+
+		var added []schema.Index
+		for _, index := range currentIndexes {
+			if findIndex(declared, collection, index.Name) == nil {
+				added = append(added, index.WithoutAnnotations())
+			}
+		}
+		switch {
+		case len(added) == 0:
+		case !inFile:
+			additions = append(additions, jsonPatchOperation{
+				Op: "add", Path: "/-", Value: schema.Schema{Collection: collection, Indexes: added},
+			})
+		case len(entry.indexes) == 0:
+			additions = append(additions, jsonPatchOperation{
+				Op: "add", Path: "/" + strconv.Itoa(entry.position) + "/indexes", Value: added,
+			})
+		default:
+			for _, index := range added {
+				additions = append(additions, jsonPatchOperation{
+					Op: "add", Path: "/" + strconv.Itoa(entry.position) + "/indexes/-", Value: index,
+				})
+			}
+		}
+	}
+
+	slices.SortFunc(removals, func(a, b removal) int {
+		return cmp.Or(cmp.Compare(b.collection, a.collection), cmp.Compare(b.index, a.index))
+	})
+	operations := make([]jsonPatchOperation, 0, len(replacements)+len(removals)+len(additions))
+	operations = append(operations, replacements...)
+	for _, r := range removals {
+		operations = append(operations, jsonPatchOperation{Op: "remove", Path: indexPointer(r.collection, r.index)})
+	}
+	return append(operations, additions...)
+}
+
+// indexPointer is the JSON Pointer of an index of the schema file.
+func indexPointer(collection, index int) string {
+	return fmt.Sprintf("/%d/indexes/%d", collection, index)
+}
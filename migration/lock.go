@@ -0,0 +1,146 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/golang-migrate/migrate/v4/database"
+
+	"github.com/ltman/mondex/db"
+)
+
+// lockFileName is the lock file in the migration directory that serializes
+// concurrent generations. Migration sources skip it as it isn't a migration.
+const lockFileName = ".mondex.lock"
+
+// lockRetryDelay is how often a locked migration directory is retried.
+const lockRetryDelay = 100 * time.Millisecond
+
+// lockMigrationDir takes an exclusive lock on the migration directory, waiting
+// for other mondex processes holding it until ctx is done. The directory is
+// created if needed.
+func lockMigrationDir(ctx context.Context, logger *slog.Logger, migrationDir string) (unlock func(), err error) {
+	if err := os.MkdirAll(migrationDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	lock := flock.New(filepath.Join(migrationDir, lockFileName))
+	locked, err := lock.TryLock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock migration directory: %w", err)
+	}
+	if !locked {
+		logger.Info("Waiting for another mondex process to release the migration directory", "lock", lock.Path())
+		if _, err := lock.TryLockContext(ctx, lockRetryDelay); err != nil {
+			return nil, fmt.Errorf("failed to lock migration directory: %w", err)
+		}
+	}
+
+	return func() {
+		if err := lock.Unlock(); err != nil {
+			logger.Error("Failed to unlock migration directory", "error", err)
+		}
+	}, nil
+}
+
+// Defaults of LockOptions.
+const (
+	DefaultLockTimeout         = 15 * time.Minute
+	DefaultLockInitialInterval = time.Second
+	DefaultLockMaxInterval     = 30 * time.Second
+)
+
+// lockReleaseTimeout bounds how long releasing the database lock may take.
+const lockReleaseTimeout = 10 * time.Second
+
+// LockOptions tunes how apply waits for the database lock held by another
+// process, e.g. when many replicas of an application run apply at startup.
+// Zero values take the defaults.
+type LockOptions struct {
+	// Timeout bounds how long to wait for the lock.
+	Timeout time.Duration
+	// InitialInterval is the wait before the first retry, doubled after
+	// every attempt up to MaxInterval. Each wait is jittered so waiting
+	// processes don't retry in lockstep.
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+}
+
+func (o LockOptions) withDefaults() LockOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultLockTimeout
+	}
+	if o.InitialInterval <= 0 {
+		o.InitialInterval = DefaultLockInitialInterval
+	}
+	if o.MaxInterval <= 0 {
+		o.MaxInterval = DefaultLockMaxInterval
+	}
+	o.MaxInterval = max(o.MaxInterval, o.InitialInterval)
+	return o
+}
+
+// Lock takes the advisory lock of the database, retrying with exponential
+// backoff and jitter while another process holds it.
+func (d *commandDriver) Lock() error {
+	options := d.options.Lock.withDefaults()
+	host, _ := os.Hostname()
+	lock := db.MigrationLock{Pid: os.Getpid(), Hostname: host, Holder: applierIdentity()}
+
+	deadline := time.Now().Add(options.Timeout)
+	interval := options.InitialInterval
+	var holder *db.MigrationLock
+	for {
+		lock.CreatedAt = time.Now().UTC()
+		locked, err := db.TryLock(d.ctx, d.db, lock)
+		if err != nil {
+			return err
+		}
+		if locked {
+			if holder != nil {
+				d.logger.Info("Took the migration lock", "previous_holder", holder.String())
+			}
+			return nil
+		}
+
+		current, err := db.LockHolder(d.ctx, d.db)
+		if err != nil {
+			d.logger.Debug("Failed to read the migration lock", "error", err)
+		} else if current != nil && (holder == nil || *current != *holder) {
+			d.logger.Info("Waiting for the migration lock", "holder", current.String(),
+				"since", current.CreatedAt.Local().Format(time.RFC3339))
+			holder = current
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if holder != nil {
+				return fmt.Errorf("%w: held by %s since %s, gave up after %s",
+					database.ErrLocked, holder, holder.CreatedAt.Local().Format(time.RFC3339), options.Timeout)
+			}
+			return fmt.Errorf("%w: gave up after %s", database.ErrLocked, options.Timeout)
+		}
+
+		// Full jitter: a random wait up to the current interval.
+		wait := min(rand.N(interval)+1, remaining)
+		select {
+		case <-d.ctx.Done():
+			return d.ctx.Err()
+		case <-time.After(wait):
+		}
+		interval = min(interval*2, options.MaxInterval)
+	}
+}
+
+// Unlock releases the advisory lock of the database, even once ctx is done.
+func (d *commandDriver) Unlock() error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(d.ctx), lockReleaseTimeout)
+	defer cancel()
+	return db.Unlock(ctx, d.db)
+}
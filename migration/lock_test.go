@@ -0,0 +1,85 @@
+package migration
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// chdir makes dir the working directory for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestLockMigrationDirPaths(t *testing.T) {
+	root := t.TempDir()
+	chdir(t, root)
+
+	for _, dir := range []string{
+		filepath.Join(root, "absolute"),
+		"relative",
+		"with spaces",
+		filepath.Join("nested", "..", "dotdot"),
+		filepath.Join("created", "on", "demand"),
+	} {
+		t.Run(dir, func(t *testing.T) {
+			unlock, err := lockMigrationDir(context.Background(), discardLogger(), dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer unlock()
+			if _, err := os.Stat(filepath.Join(dir, lockFileName)); err != nil {
+				t.Errorf("lock file: %v", err)
+			}
+
+			// The lock file is skipped when listing migrations.
+			files, err := listMigrationFiles(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 0 {
+				t.Errorf("listed %v, want no migrations", files)
+			}
+		})
+	}
+}
+
+func TestLockMigrationDirExcludes(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "migrations dir")
+	unlock, err := lockMigrationDir(context.Background(), discardLogger(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*lockRetryDelay)
+	defer cancel()
+	if second, err := lockMigrationDir(ctx, discardLogger(), dir); err == nil {
+		second()
+		t.Fatal("locked a directory locked already")
+	}
+
+	unlock()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	second, err := lockMigrationDir(ctx, discardLogger(), dir)
+	if err != nil {
+		t.Fatalf("locking a released directory: %v", err)
+	}
+	second()
+}
@@ -0,0 +1,61 @@
+package migration
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// lossyDownCommand annotates a down migration with a way it doesn't undo its
+// up migration. apply logs it instead of running it.
+const lossyDownCommand = "lossyDownWarning"
+
+// lossyDownWarnings lists the ways the down migration of a change doesn't
+// restore the schema and data as they were. recorded is set when the current
+// schema comes from a recorded state rather than the live database, so
+// dropped indexes are recreated from definitions that may be stale.
+// createdWithOptions are the collections created with options, which the
+// down migration leaves in place.
+func lossyDownWarnings(created, droppedIndexes, droppedCollections, createdWithOptions []schema.Schema, recorded bool) []string {
+	var warnings []string
+	for _, s := range created {
+		for _, index := range s.Indexes {
+			if index.ExpireAfterSeconds != nil {
+				warnings = append(warnings, fmt.Sprintf(
+					"documents removed by TTL index %s.%s aren't restored", s.Collection, index.Name))
+			}
+		}
+	}
+	for _, s := range droppedIndexes {
+		for _, index := range s.Indexes {
+			if index.Unique {
+				warnings = append(warnings, fmt.Sprintf(
+					"recreating unique index %s.%s fails if duplicates were written since it was dropped", s.Collection, index.Name))
+			}
+			if recorded {
+				warnings = append(warnings, fmt.Sprintf(
+					"index %s.%s is recreated as recorded in the state, which may differ from the live database", s.Collection, index.Name))
+			}
+		}
+	}
+	for _, s := range droppedCollections {
+		warnings = append(warnings, fmt.Sprintf("documents of dropped collection %s aren't restored", s.Collection))
+	}
+	for _, s := range createdWithOptions {
+		warnings = append(warnings, fmt.Sprintf(
+			"collection %s keeps the options it was created with, which only dropping it undoes", s.Collection))
+	}
+	return warnings
+}
+
+// generateLossyDownCommands annotates a down migration with its warnings,
+// logging each one for the reviewer.
+func generateLossyDownCommands(logger *slog.Logger, warnings []string) []map[string]interface{} {
+	commands := make([]map[string]interface{}, 0, len(warnings))
+	for _, warning := range warnings {
+		logger.Warn("Down migration is lossy", "reason", warning)
+		commands = append(commands, map[string]interface{}{lossyDownCommand: warning})
+	}
+	return commands
+}
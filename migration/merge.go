@@ -0,0 +1,359 @@
+package migration
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/schema"
+)
+
+// Resolution is how a merge handles an index the live database drifted on.
+type Resolution int
+
+const (
+	// ResolveRevert keeps the declared index, so the migration undoes the drift.
+	ResolveRevert Resolution = iota
+	// ResolveAdopt copies the live index into the schema file.
+	ResolveAdopt
+	// ResolveDefer leaves the index out of the migration, keeping the drift
+	// and the declared change for a later one.
+	ResolveDefer
+)
+
+func (r Resolution) String() string {
+	switch r {
+	case ResolveAdopt:
+		return "adopt"
+	case ResolveDefer:
+		return "defer"
+	default:
+		return "revert"
+	}
+}
+
+// MergeEntry is one index as recorded in the base state, found in the live
+// database and declared in the schema file. A nil index is absent there.
+type MergeEntry struct {
+	Collection string
+	Name       string
+	Base       *schema.Index
+	Live       *schema.Index
+	Declared   *schema.Index
+	Resolution Resolution
+
+	// comparison is how the indexes compare, as set for the merge.
+	comparison schema.Comparison
+}
+
+// Drifted reports whether the live index changed since the base state.
+func (e MergeEntry) Drifted() bool {
+	return !e.same(e.Base, e.Live)
+}
+
+// Status summarizes where the index changed since the base state.
+func (e MergeEntry) Status() string {
+	changed := !e.same(e.Base, e.Declared)
+	switch {
+	case e.Drifted() && changed && !e.same(e.Live, e.Declared):
+		return "conflict"
+	case e.Drifted() && changed:
+		return "same change"
+	case e.Drifted():
+		return "drift"
+	default:
+		return "declared change"
+	}
+}
+
+// same reports whether two of the indexes of the entry are the same, or both
+// absent.
+func (e MergeEntry) same(a, b *schema.Index) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.EqualWith(*b, e.comparison)
+}
+
+// Merge holds the three schemas of a three-way merge and the indexes they
+// disagree on.
+type Merge struct {
+	Database string
+	Base     []schema.Schema
+	Live     []schema.Schema
+	Declared []schema.Schema
+	Entries  []MergeEntry
+
+	// building lists the live indexes still being built, by collection,
+	// which are left out of the entries and the migration.
+	building map[string][]string
+	// settings are those the merge was read with, which Resolve writes with.
+	settings compiledSettings
+}
+
+// Drifted returns the entries the live database drifted on, which need a
+// resolution.
+func (m *Merge) Drifted() []*MergeEntry {
+	var drifted []*MergeEntry
+	for i := range m.Entries {
+		if m.Entries[i].Drifted() {
+			drifted = append(drifted, &m.Entries[i])
+		}
+	}
+	return drifted
+}
+
+// ReadMerge reads the base state, from the state file or the state collection
+// written by apply, the live schema and the declared schema, and lists the
+// indexes they disagree on.
+func ReadMerge(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+	readOptions db.ReadOptions,
+	schemaFilePath string,
+	statePath string,
+	source CurrentSource,
+) (*Merge, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Connecting to MongoDB")
+	client, err := compiled.connect(ctx, mongoURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer func() {
+		if err := compiled.disconnect(ctx, client); err != nil {
+			logger.Error("Failed to disconnect from MongoDB", "error", err)
+		}
+	}()
+
+	database, err := db.OpenDatabase(client, databaseName, readOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Reading current schema from MongoDB", "readPreference", readOptions.Preference)
+	live, err := db.ReadCurrentSchema(ctx, database, readOptions.Concurrency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current schema: %w", err)
+	}
+
+	var base []schema.Schema
+	if source == SourceRemoteState {
+		logger.Debug("Reading base schema from the state collection", "collection", db.StateCollection)
+		state, ok, err := db.ReadState(ctx, database)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("no state recorded in %s, apply migrations with remote_state enabled first", db.StateCollection)
+		}
+		base = state.Schema
+	} else {
+		logger.Debug("Reading base schema from state file", "path", statePath)
+		if base, err = readStateFile(logger, statePath); err != nil {
+			return nil, err
+		}
+	}
+
+	logger.Debug("Reading declared schema from file", "path", schemaFilePath)
+	declared, err := readDeclaredSchema(schemaFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read declared schema: %w", err)
+	}
+
+	// Indexes still being built can be neither adopted nor reverted yet.
+	building := indexBuilds(live)
+	logIndexBuilds(ctx, logger, client, databaseName, building, "Index build in progress, leaving it out of the merge")
+
+	m := &Merge{
+		Database: databaseName,
+		Base:     prepareSchemas(compiled, base),
+		Live:     prepareSchemas(compiled, live),
+		Declared: prepareSchemas(compiled, schema.ExpandBuckets(declared)),
+		building: building,
+		settings: compiled,
+	}
+	m.Entries = mergeEntries(compiled.comparison, withoutIndexes(m.Base, building), withoutIndexes(m.Live, building), withoutIndexes(m.Declared, building))
+	return m, nil
+}
+
+// mergeEntries lists the indexes the three schemas don't all agree on, by
+// collection and name, compared as c sets.
+func mergeEntries(c schema.Comparison, base, live, declared []schema.Schema) []MergeEntry {
+	find := func(schemas []schema.Schema, collection, name string) *schema.Index {
+		i := slices.IndexFunc(schemas, func(s schema.Schema) bool { return s.Collection == collection })
+		if i < 0 {
+			return nil
+		}
+		j := slices.IndexFunc(schemas[i].Indexes, func(index schema.Index) bool { return index.Name == name })
+		if j < 0 {
+			return nil
+		}
+		return &schemas[i].Indexes[j]
+	}
+
+	var entries []MergeEntry
+	for _, schemas := range [][]schema.Schema{base, live, declared} {
+		for _, s := range schemas {
+			for _, index := range s.Indexes {
+				if slices.ContainsFunc(entries, func(e MergeEntry) bool {
+					return e.Collection == s.Collection && e.Name == index.Name
+				}) {
+					continue
+				}
+				entry := MergeEntry{
+					Collection: s.Collection,
+					Name:       index.Name,
+					Base:       find(base, s.Collection, index.Name),
+					Live:       find(live, s.Collection, index.Name),
+					Declared:   find(declared, s.Collection, index.Name),
+					comparison: c,
+				}
+				if entry.same(entry.Base, entry.Live) && entry.same(entry.Base, entry.Declared) {
+					continue
+				}
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b MergeEntry) int {
+		return cmp.Or(cmp.Compare(a.Collection, b.Collection), cmp.Compare(a.Name, b.Name))
+	})
+	return entries
+}
+
+// Resolve applies the resolutions of the drifted entries: adopted indexes are
+// written to the schema file, and a migration from the live schema is written
+// for everything else except the deferred indexes.
+func (m *Merge) Resolve(
+	ctx context.Context,
+	logger *slog.Logger,
+	schemaFilePath string,
+	migrationDir, migrationName string,
+	statePath string,
+	dryRun bool,
+) error {
+	declared, err := readDeclaredSchema(schemaFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read declared schema: %w", err)
+	}
+
+	// Deferred drift stays recorded as in the base state, to be resolved later.
+	target, state := slices.Clone(m.Declared), slices.Clone(m.Declared)
+	var adopted bool
+	for _, e := range m.Drifted() {
+		switch e.Resolution {
+		case ResolveAdopt:
+			declared = withIndex(declared, e.Collection, e.Name, e.Live)
+			target = withIndex(target, e.Collection, e.Name, e.Live)
+			state = withIndex(state, e.Collection, e.Name, e.Live)
+			adopted = true
+			logger.Debug("Adopting live index", "collection", e.Collection, "index", e.Name)
+		case ResolveDefer:
+			target = withIndex(target, e.Collection, e.Name, e.Live)
+			state = withIndex(state, e.Collection, e.Name, e.Base)
+			logger.Debug("Deferring index", "collection", e.Collection, "index", e.Name)
+		case ResolveRevert:
+			logger.Debug("Reverting live index", "collection", e.Collection, "index", e.Name)
+		}
+	}
+	target = prepareSchemas(m.settings, target)
+
+	var schemas []byte
+	if adopted {
+		if schemas, err = marshalSchemas(m.settings, schemaFilePath, declared); err != nil {
+			return fmt.Errorf("marshalling schema: %w", err)
+		}
+	}
+
+	upCommand, downCommand, err := generateMigrationCommands(m.settings, withoutIndexes(m.Live, m.building), withoutIndexes(target, m.building), nil, false, logger)
+	if err != nil {
+		return fmt.Errorf("failed to generate migration commands: %w", err)
+	}
+
+	if dryRun {
+		logger.Info("Dry-run: showing resolution without writing files")
+
+		if upCommand != nil {
+			fmt.Println("Up migration:") //nolint:forbidigo
+			if _, err := os.Stdout.Write(upCommand); err != nil {
+				return fmt.Errorf("writing up migration to stdout: %w", err)
+			}
+			fmt.Println("\nDown migration:") //nolint:forbidigo
+			if _, err := os.Stdout.Write(downCommand); err != nil {
+				return fmt.Errorf("writing down migration to stdout: %w", err)
+			}
+		}
+		if schemas != nil {
+			fmt.Printf("\nSchema that would be written to %s:\n", schemaFilePath) //nolint:forbidigo
+			if _, err := os.Stdout.Write(schemas); err != nil {
+				return fmt.Errorf("writing declared schema: %w", err)
+			}
+		}
+
+		return nil
+	}
+
+	if schemas != nil {
+		logger.Info("Writing adopted indexes to schema file", "path", schemaFilePath)
+		if err := writeSchemaFile(m.settings, schemaFilePath, schemas); err != nil {
+			return fmt.Errorf("writing declared schema: %w", err)
+		}
+	}
+
+	if upCommand == nil && downCommand == nil {
+		logger.Info("No changes left to migrate, skipping migration generation")
+	} else {
+		hash, err := hashSchemaFile(schemaFilePath)
+		if err != nil {
+			return fmt.Errorf("reading declared schema: %w", err)
+		}
+
+		logger.Debug("Writing migration commands to files", "migrationDir", migrationDir)
+		header := newMigrationHeader(hash, m.Database)
+		if err := writeMigrationCommands(ctx, logger, m.settings, upCommand, downCommand, header, migrationDir, migrationName); err != nil {
+			return fmt.Errorf("failed to write migration commands: %w", err)
+		}
+	}
+
+	if statePath != "" {
+		if err := writeStateFile(logger, m.settings, statePath, state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// withIndex returns the schemas with the named index replaced by index, or
+// removed when index is nil.
+func withIndex(schemas []schema.Schema, collection, name string, index *schema.Index) []schema.Schema {
+	schemas = slices.Clone(schemas)
+	i := slices.IndexFunc(schemas, func(s schema.Schema) bool { return s.Collection == collection })
+	if i < 0 {
+		if index == nil {
+			return schemas
+		}
+		return append(schemas, schema.Schema{Collection: collection, Indexes: []schema.Index{*index}})
+	}
+
+	indexes := slices.DeleteFunc(slices.Clone(schemas[i].Indexes), func(existing schema.Index) bool {
+		return existing.Name == name
+	})
+	if index != nil {
+		indexes = append(indexes, *index)
+	}
+	schemas[i].Indexes = indexes
+	return schemas
+}
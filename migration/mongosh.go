@@ -0,0 +1,174 @@
+package migration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Formats of the migrations diff generates.
+const (
+	// MigrationFormatJSON writes the commands as JSON, which apply runs.
+	MigrationFormatJSON = "json"
+	// MigrationFormatJS writes mongosh scripts, for review or to run with
+	// mongosh instead of apply.
+	MigrationFormatJS = "js"
+)
+
+// scriptDirName is the directory of the migration directory mongosh scripts
+// are written to by default, out of the way of apply, with versions of their
+// own.
+const scriptDirName = "mongosh"
+
+// migrationOutputDir returns the directory migrations of the format are
+// written to: mongosh scripts go to the script directory, the mongosh
+// directory of the migration directory when empty.
+func migrationOutputDir(format, migrationDir, scriptDir string) string {
+	if format != MigrationFormatJS {
+		return migrationDir
+	}
+	if scriptDir != "" {
+		return scriptDir
+	}
+	return filepath.Join(migrationDir, scriptDirName)
+}
+
+// extendedJSONType matches the extended JSON wrappers of values plain
+// JavaScript objects don't have, e.g. {"$date": ...}.
+var extendedJSONType = regexp.MustCompile(`"\$(date|numberLong|numberDecimal|numberDouble|numberInt|oid|binary|uuid|regularExpression|timestamp|minKey|maxKey|code|symbol|dbPointer)"`)
+
+// encodeMigration encodes the commands of a migration file in the format,
+// with the header.
+func encodeMigration(commands []byte, header migrationHeader, format string) ([]byte, error) {
+	if format == MigrationFormatJS {
+		return mongoshScript(commands, &header)
+	}
+	return withHeader(commands, header)
+}
+
+// mongoshScript translates the JSON commands of a migration into a mongosh
+// script: index commands become createIndex and dropIndex calls, other
+// commands runCommand calls, and annotations comments. A nil header is left
+// out.
+func mongoshScript(commands []byte, header *migrationHeader) ([]byte, error) {
+	var parsed []bson.D
+	if err := bson.UnmarshalExtJSON(commands, false, &parsed); err != nil {
+		return nil, fmt.Errorf("reading migration commands: %w", err)
+	}
+
+	var b bytes.Buffer
+	if header != nil {
+		fmt.Fprintf(&b, "// Generated by mondex %s at %s from schema %s.\n",
+			header.MondexVersion, header.GeneratedAt.Format("2006-01-02T15:04:05Z"), header.SchemaHash)
+		if header.Database != "" {
+			fmt.Fprintf(&b, "// Run against database %s, e.g. mongosh \"$MONGO_URI/%s\" --file <this file>.\n",
+				header.Database, header.Database)
+		}
+		b.WriteString("\n")
+	}
+	for _, command := range parsed {
+		if len(command) == 0 || command[0].Key == headerCommand {
+			continue
+		}
+		line, err := mongoshCommand(command)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.Bytes(), nil
+}
+
+// mongoshCommand translates one migration command into mongosh statements.
+func mongoshCommand(command bson.D) (string, error) {
+	name := command[0].Key
+	collection, _ := command[0].Value.(string)
+	target := fmt.Sprintf("db.getCollection(%s)", jsString(collection))
+
+	switch {
+	case name == lossyDownCommand:
+		return fmt.Sprintf("// Lossy: %v", command[0].Value), nil
+	case slices.Contains(interpretedCommands, name):
+		document, err := jsDocument(command)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("// mondex checks %s here when applying; check it by hand before going on.", document), nil
+	case name == "createIndexes":
+		var body struct {
+			Indexes []bson.D `bson:"indexes"`
+		}
+		if err := decodeCommand(command, &body); err != nil {
+			return "", err
+		}
+		var lines []string
+		for _, index := range body.Indexes {
+			var key any
+			var options bson.D
+			for _, e := range index {
+				if e.Key == "key" {
+					key = e.Value
+					continue
+				}
+				options = append(options, e)
+			}
+			keyDocument, err := jsDocument(key)
+			if err != nil {
+				return "", err
+			}
+			optionsDocument, err := jsDocument(options)
+			if err != nil {
+				return "", err
+			}
+			lines = append(lines, fmt.Sprintf("%s.createIndex(%s, %s);", target, keyDocument, optionsDocument))
+		}
+		return strings.Join(lines, "\n"), nil
+	case name == "dropIndexes":
+		var lines []string
+		for _, index := range droppedIndexNames(command) {
+			if index == "*" {
+				lines = append(lines, fmt.Sprintf("%s.dropIndexes();", target))
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s.dropIndex(%s);", target, jsString(index)))
+		}
+		return strings.Join(lines, "\n"), nil
+	case name == "drop" && len(command) == 1:
+		return fmt.Sprintf("%s.drop();", target), nil
+	}
+
+	document, err := jsDocument(command)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("db.runCommand(%s);", document), nil
+}
+
+// jsDocument renders a document as a JavaScript object literal, through
+// EJSON.deserialize when it holds values only extended JSON expresses.
+func jsDocument(document any) (string, error) {
+	if document == nil {
+		document = bson.D{}
+	}
+	data, err := bson.MarshalExtJSON(document, false, false)
+	if err != nil {
+		return "", err
+	}
+	if extendedJSONType.Match(data) {
+		return fmt.Sprintf("EJSON.deserialize(%s)", data), nil
+	}
+	return string(data), nil
+}
+
+// jsString renders a string as a JavaScript string literal.
+func jsString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
@@ -0,0 +1,144 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/policy"
+	"github.com/ltman/mondex/schema"
+)
+
+// checkPolicies evaluates the policies, logs their warnings and fails when
+// any of them denies the changes.
+func checkPolicies(ctx context.Context, logger *slog.Logger, policies []string, input policy.Input) error {
+	if len(policies) == 0 {
+		return nil
+	}
+	input.Time = time.Now().UTC()
+
+	logger.Debug("Evaluating policies", "phase", input.Phase, "changes", len(input.Changes))
+	decision, err := policy.Evaluate(ctx, policies, input)
+	if err != nil {
+		return err
+	}
+	for _, warning := range decision.Warn {
+		logger.Warn("Policy warning", "phase", input.Phase, "message", warning)
+	}
+	return decision.Err()
+}
+
+// commandChanges describes the effects of migration commands for policies.
+func commandChanges(commands []bson.D) []policy.Change {
+	var changes []policy.Change
+	for _, command := range commands {
+		if len(command) == 0 || isAnnotation(command) {
+			continue
+		}
+		name := command[0].Key
+		collection, _ := command[0].Value.(string)
+
+		switch name {
+		case "createIndexes":
+			var body struct {
+				Indexes []schema.Index `bson:"indexes"`
+			}
+			if err := decodeCommand(command, &body); err == nil {
+				for _, index := range body.Indexes {
+					changes = append(changes, policy.Change{
+						Operation:  "createIndex",
+						Collection: collection,
+						IndexName:  index.Name,
+						Index:      &index,
+					})
+				}
+				continue
+			}
+		case "dropIndexes":
+			for _, name := range droppedIndexNames(command) {
+				changes = append(changes, policy.Change{Operation: "dropIndex", Collection: collection, IndexName: name})
+			}
+			continue
+		case "dropSearchIndex":
+			var body struct {
+				Name string `bson:"name"`
+			}
+			if err := decodeCommand(command, &body); err == nil {
+				changes = append(changes, policy.Change{Operation: name, Collection: collection, IndexName: body.Name})
+				continue
+			}
+		}
+		switch {
+		case slices.Contains(roleCommands, name):
+			changes = append(changes, policy.Change{Operation: name, Role: collection})
+			continue
+		case slices.Contains(userCommands, name):
+			changes = append(changes, policy.Change{Operation: name, User: collection})
+			continue
+		}
+		changes = append(changes, policy.Change{Operation: name, Collection: collection})
+	}
+	return changes
+}
+
+// pendingChanges returns the changes of the up migrations newer than the
+// version recorded in the database.
+func pendingChanges(ctx context.Context, database *mongo.Database, migrations migrationSource) ([]policy.Change, error) {
+	version, _, err := db.MigrationVersion(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := migrations.files()
+	if err != nil {
+		return nil, err
+	}
+
+	return migrationChanges(slices.DeleteFunc(files, func(file migrationFile) bool {
+		return file.Direction != "up" || (version != db.NilVersion && file.Version <= uint64(version))
+	}))
+}
+
+// rollbackChanges returns the changes of the down migrations rolling back
+// from one version to an earlier one, newest first.
+func rollbackChanges(migrations migrationSource, from, to uint64) ([]policy.Change, error) {
+	files, err := migrations.files()
+	if err != nil {
+		return nil, err
+	}
+
+	files = slices.DeleteFunc(files, func(file migrationFile) bool {
+		return file.Direction != "down" || file.Version <= to || file.Version > from
+	})
+	slices.Reverse(files)
+	return migrationChanges(files)
+}
+
+// migrationChanges returns the changes of the migration files, in order.
+func migrationChanges(files []migrationFile) ([]policy.Change, error) {
+	var changes []policy.Change
+	for _, file := range files {
+		body, err := file.read()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", file.Path, err)
+		}
+
+		var commands []bson.D
+		if err := bson.UnmarshalExtJSON(body, true, &commands); err != nil {
+			return nil, fmt.Errorf("unmarshaling migration commands of %s: %w", file.Path, err)
+		}
+
+		for _, change := range commandChanges(commands) {
+			change.Version = file.Version
+			change.Migration = file.Name
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
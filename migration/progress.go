@@ -0,0 +1,30 @@
+package migration
+
+import (
+	"github.com/ltman/mondex/db"
+)
+
+// ProgressReporter receives progress events while migrations are applied,
+// e.g. to render them in a terminal UI. Events are delivered sequentially.
+type ProgressReporter interface {
+	// MigrationStarted is called before the commands of a migration run.
+	MigrationStarted(version uint64, name string)
+	// CommandStarted is called before each command of the running migration.
+	CommandStarted(command, collection string, indexes []string)
+	// IndexBuildsProgressed reports the index builds running on the database
+	// while a createIndexes command is executing.
+	IndexBuildsProgressed(builds []db.IndexBuild)
+	// CommandFinished is called after each command, with its error if it failed.
+	CommandFinished(err error)
+	// MigrationFinished is called after the migration, with its error if it failed.
+	MigrationFinished(err error)
+}
+
+// nopProgress discards progress events.
+type nopProgress struct{}
+
+func (nopProgress) MigrationStarted(uint64, string)         {}
+func (nopProgress) CommandStarted(string, string, []string) {}
+func (nopProgress) IndexBuildsProgressed([]db.IndexBuild)   {}
+func (nopProgress) CommandFinished(error)                   {}
+func (nopProgress) MigrationFinished(error)                 {}
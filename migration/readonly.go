@@ -0,0 +1,95 @@
+package migration
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// readOnlyDrift is an index of a read-only collection that differs from its
+// declaration.
+type readOnlyDrift struct {
+	Collection, Index string
+	Difference        string
+}
+
+func (d readOnlyDrift) String() string {
+	if d.Index == "" {
+		return fmt.Sprintf("%s: %s", d.Collection, d.Difference)
+	}
+	return fmt.Sprintf("%s.%s: %s", d.Collection, d.Index, d.Difference)
+}
+
+// assertReadOnly returns the declared schema with the read-only collections
+// taken from the current schema, so diff generates nothing for them and the
+// state records them as they are, along with where they differ from their
+// declaration.
+func assertReadOnly(logger *slog.Logger, settings compiledSettings, current, declared []schema.Schema) ([]schema.Schema, []readOnlyDrift) {
+	if !slices.ContainsFunc(declared, func(s schema.Schema) bool { return s.ReadOnly }) {
+		return declared, nil
+	}
+
+	var drift []readOnlyDrift
+	record := func(collection, index, difference string) {
+		logger.Warn("Read-only collection drifted", "collection", collection, "index", index, "difference", difference)
+		drift = append(drift, readOnlyDrift{Collection: collection, Index: index, Difference: difference})
+	}
+
+	asserted := make([]schema.Schema, 0, len(declared))
+	for _, ds := range declared {
+		if !ds.ReadOnly {
+			asserted = append(asserted, ds)
+			continue
+		}
+
+		i := slices.IndexFunc(current, func(cs schema.Schema) bool { return cs.Collection == ds.Collection })
+		if i < 0 {
+			if len(ds.Indexes) > 0 || ds.HasValidation() || ds.HasOptions() || len(ds.SearchIndexes) > 0 {
+				record(ds.Collection, "", "collection not found")
+			}
+			continue
+		}
+		cs := current[i]
+
+		for _, index := range ds.Indexes {
+			live := findIndex(current, ds.Collection, index.Name)
+			switch {
+			case live == nil:
+				record(ds.Collection, index.Name, "missing")
+			case !matchesDeclared(settings, index, *live):
+				record(ds.Collection, index.Name, "differs from its declaration")
+			}
+		}
+		for _, index := range cs.Indexes {
+			if findIndex(declared, ds.Collection, index.Name) == nil {
+				record(ds.Collection, index.Name, "not declared")
+			}
+		}
+		if ds.ManagesValidation() && !ds.ValidationEqual(cs) {
+			record(ds.Collection, "", "validator differs from its declaration")
+		}
+		if !ds.OptionsMatch(cs) {
+			record(ds.Collection, "", "options differ from their declaration")
+		}
+		for _, index := range ds.SearchIndexes {
+			switch live := cs.FindSearchIndex(index.Name); {
+			case live == nil:
+				record(ds.Collection, index.Name, "search index missing")
+			case !live.Equal(index):
+				record(ds.Collection, index.Name, "search index differs from its declaration")
+			}
+		}
+		ds = ds.WithValidationOf(cs)
+		ds.Options, ds.SearchIndexes = cs.Options, cs.SearchIndexes
+
+		indexes := make([]schema.Index, 0, len(cs.Indexes))
+		for _, index := range cs.Indexes {
+			indexes = append(indexes, index.WithoutAnnotations())
+		}
+		ds.Indexes = indexes
+		asserted = append(asserted, ds)
+	}
+	return asserted, drift
+}
@@ -0,0 +1,89 @@
+package migration
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/ltman/mondex/policy"
+)
+
+// DiffReport is what diff generated, for tools wrapping mondex.
+type DiffReport struct {
+	Database string `json:"database,omitempty"`
+	DryRun   bool   `json:"dryRun"`
+	// Collections are the collections the up migrations change, in name
+	// order.
+	Collections []string `json:"collections"`
+	// Changes are the changes of the up migrations, in order, such as the
+	// indexes created and dropped.
+	Changes []policy.Change `json:"changes"`
+	// Destructive are the destructive changes among them.
+	Destructive []DestructiveChange `json:"destructive"`
+	// Files are the migration files written or, on dry runs, those that
+	// would be.
+	Files []string `json:"files"`
+	// Suppressed and ReadOnlyDrift are the differences that generate no
+	// commands.
+	Suppressed    []string `json:"suppressed"`
+	ReadOnlyDrift []string `json:"readOnlyDrift"`
+}
+
+// newDiffReport returns the report of the plan, without its files.
+func newDiffReport(plan migrationPlan, databaseName string, dryRun bool) (DiffReport, error) {
+	report := DiffReport{
+		Database:      databaseName,
+		DryRun:        dryRun,
+		Collections:   []string{},
+		Changes:       []policy.Change{},
+		Destructive:   []DestructiveChange{},
+		Files:         []string{},
+		Suppressed:    []string{},
+		ReadOnlyDrift: []string{},
+	}
+
+	changes, err := planChanges(plan)
+	if err != nil {
+		return DiffReport{}, err
+	}
+	report.Changes = append(report.Changes, changes...)
+	report.Destructive = append(report.Destructive, destructiveChanges(changes)...)
+	for _, change := range changes {
+		if change.Collection != "" && !slices.Contains(report.Collections, change.Collection) {
+			report.Collections = append(report.Collections, change.Collection)
+		}
+	}
+	slices.Sort(report.Collections)
+
+	for _, d := range plan.Suppressed {
+		report.Suppressed = append(report.Suppressed, d.String())
+	}
+	for _, d := range plan.ReadOnlyDrift {
+		report.ReadOnlyDrift = append(report.ReadOnlyDrift, d.String())
+	}
+	return report, nil
+}
+
+// plannedFiles returns the paths the migrations would be written to, from
+// the next free version of the directory.
+func plannedFiles(migrations []generatedMigration, format, migrationDir, migrationName string) ([]string, error) {
+	version, err := getNextVersion(migrationDir, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine next version: %w", err)
+	}
+
+	var files []string
+	for _, m := range migrations {
+		for _, side := range []struct {
+			direction string
+			commands  []byte
+		}{{"up", m.Up}, {"down", m.Down}} {
+			if side.commands != nil {
+				files = append(files, filepath.Join(migrationDir,
+					fmt.Sprintf("%06d_%s%s.%s.%s", version, migrationName, m.Suffix, side.direction, format)))
+			}
+		}
+		version++
+	}
+	return files, nil
+}
@@ -0,0 +1,91 @@
+package migration
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// RollbackPlan is what rolling the database back from one version to an
+// earlier one does, without running anything.
+type RollbackPlan struct {
+	From, To uint64
+	// Steps are the down migrations to run, newest first, with the changes
+	// each makes.
+	Steps []ChangelogEntry
+	// Schema is the schema expected once they ran, replayed from the up
+	// migrations up to To.
+	Schema []schema.Schema
+}
+
+// PlanRollback lists the down migrations of the directory that roll the
+// database back from the applied version to the target one, 0 rolling back
+// every migration, and the schema expected afterwards.
+func PlanRollback(logger *slog.Logger, settings Settings, migrationDir string, from, to uint64) (RollbackPlan, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return RollbackPlan{}, err
+	}
+	if to > from {
+		return RollbackPlan{}, fmt.Errorf("target version %d is newer than the applied version %d", to, from)
+	}
+
+	files, err := listMigrationFiles(migrationDir)
+	if err != nil {
+		return RollbackPlan{}, err
+	}
+	if to != 0 && !slices.ContainsFunc(files, func(f migrationFile) bool { return f.Version == to }) {
+		return RollbackPlan{}, fmt.Errorf("no migration with version %d in %s", to, migrationDir)
+	}
+
+	var versions []migrationFile
+	for _, file := range files {
+		if file.Version > to && file.Version <= from &&
+			!slices.ContainsFunc(versions, func(f migrationFile) bool { return f.Version == file.Version }) {
+			versions = append(versions, file)
+		}
+	}
+
+	plan := RollbackPlan{From: from, To: to}
+	for _, version := range slices.Backward(versions) {
+		i := slices.IndexFunc(files, func(f migrationFile) bool { return f.Version == version.Version && f.Direction == "down" })
+		if i < 0 {
+			// golang-migrate steps over the version without running anything.
+			logger.Warn("No down migration, its changes stay and the schema won't match the one expected",
+				"version", version.Version, "name", version.Name)
+			plan.Steps = append(plan.Steps, ChangelogEntry{Version: version.Version, Name: version.Name})
+			continue
+		}
+		down := files[i]
+
+		body, err := down.read()
+		if err != nil {
+			return RollbackPlan{}, fmt.Errorf("reading %s: %w", down.Path, err)
+		}
+
+		var commands []bson.D
+		if err := bson.UnmarshalExtJSON(body, true, &commands); err != nil {
+			return RollbackPlan{}, fmt.Errorf("unmarshaling migration commands of %s: %w", down.Path, err)
+		}
+
+		plan.Steps = append(plan.Steps, ChangelogEntry{
+			Version: down.Version,
+			Name:    down.Name,
+			Changes: summarizeCommands(withoutAnnotations(commands)),
+		})
+	}
+
+	state, _, err := replayMigrations(logger, compiled, dirSource(migrationDir), to)
+	if err != nil {
+		return RollbackPlan{}, fmt.Errorf("replaying migrations up to version %d: %w", to, err)
+	}
+	plan.Schema = styleSchemas(compiled, state)
+	if plan.Schema == nil {
+		plan.Schema = []schema.Schema{}
+	}
+	return plan, nil
+}
@@ -0,0 +1,115 @@
+package migration
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/ltman/mondex/policy"
+)
+
+// DestructiveChange is a change of a migration that loses indexes, documents
+// or privileges, which only runs when allowed.
+type DestructiveChange struct {
+	policy.Change
+	Reason string `json:"reason"`
+}
+
+func (c DestructiveChange) String() string {
+	var target string
+	switch {
+	case c.IndexName != "":
+		target = c.Collection + "." + c.IndexName
+	case c.Role != "":
+		target = "role " + c.Role
+	case c.User != "":
+		target = "user " + c.User
+	default:
+		target = c.Collection
+	}
+
+	s := fmt.Sprintf("%s %s: %s", c.Operation, target, c.Reason)
+	if c.Migration != "" {
+		s = fmt.Sprintf("%d_%s: %s", c.Version, c.Migration, s)
+	}
+	return s
+}
+
+// destructiveReason returns why the change is destructive, or "" when it
+// only adds to the database.
+func destructiveReason(change policy.Change) string {
+	switch change.Operation {
+	case "dropIndex":
+		return "queries using the index fall back to other plans until it is rebuilt"
+	case "drop":
+		return "the collection is dropped with its documents"
+	case "dropDatabase":
+		return "the database is dropped with its documents"
+	case "dropSearchIndex":
+		return "search queries using the index fail until it is rebuilt"
+	case "dropRole":
+		return "users granted the role lose its privileges"
+	case "revokeRolesFromUser":
+		return "the user loses the privileges of the roles"
+	}
+	return ""
+}
+
+// destructiveChanges returns the destructive changes among the changes, in
+// order.
+func destructiveChanges(changes []policy.Change) []DestructiveChange {
+	var destructive []DestructiveChange
+	for _, change := range changes {
+		if reason := destructiveReason(change); reason != "" {
+			destructive = append(destructive, DestructiveChange{Change: change, Reason: reason})
+		}
+	}
+	return destructive
+}
+
+// checkDestructive fails when the changes are destructive and that isn't
+// allowed, listing them. Allowed destructive changes are logged.
+func checkDestructive(logger *slog.Logger, changes []policy.Change, allow bool) error {
+	destructive := destructiveChanges(changes)
+	if len(destructive) == 0 {
+		return nil
+	}
+	if allow {
+		for _, c := range destructive {
+			logger.Warn("Destructive change allowed", "change", c.String())
+		}
+		return nil
+	}
+
+	lines := make([]string, 0, len(destructive))
+	for _, c := range destructive {
+		lines = append(lines, "  "+c.String())
+	}
+	return fmt.Errorf("refusing %d destructive change(s) that weren't allowed:\n%s", len(destructive), strings.Join(lines, "\n"))
+}
+
+// LintMigrations lists the destructive changes of the up migrations of the
+// directory newer than the version, for review.
+func LintMigrations(migrationDir string, since uint64) ([]DestructiveChange, error) {
+	if err := checkMigrationDir(migrationDir); err != nil {
+		return nil, err
+	}
+
+	files, err := listMigrationFiles(migrationDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var up []migrationFile
+	for _, file := range files {
+		if file.Direction == "up" && file.Version > since {
+			up = append(up, file)
+		}
+	}
+
+	changes, err := migrationChanges(up)
+	if err != nil {
+		return nil, err
+	}
+	return destructiveChanges(changes), nil
+}
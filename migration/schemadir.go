@@ -0,0 +1,174 @@
+package migration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ltman/mondex/atomicfile"
+)
+
+// schemaDirExt is the extension of the collection files of a schema directory.
+const schemaDirExt = ".json"
+
+// isSchemaDir reports whether the schema file at path is a directory holding
+// a <collection>.json file per collection: an existing directory, or a path
+// ending with a separator for inspect to create.
+func isSchemaDir(path string) bool {
+	if path == StdinPath {
+		return false
+	}
+	if strings.HasSuffix(path, "/") || strings.HasSuffix(path, string(filepath.Separator)) {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// schemaDirPaths lists the collection files of the schema directory, by name.
+func schemaDirPaths(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != schemaDirExt {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	return paths, nil
+}
+
+// readSchemaDir reads the collection files of the schema directory as a
+// single JSON schema file listing them in the order of their names.
+func readSchemaDir(dir string) ([]byte, error) {
+	paths, err := schemaDirPaths(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		// Syntax errors are reported here, where they can be located in
+		// their own file.
+		var collection any
+		if err := json.Unmarshal(data, &collection); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if _, ok := collection.(map[string]any); !ok {
+			return nil, fmt.Errorf("%s: want a single collection object", path)
+		}
+
+		if i > 0 {
+			buf.WriteString(",\n")
+		}
+		buf.Write(bytes.TrimSpace(data))
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// schemaDirFiles splits a marshaled JSON schema file into the collection files
+// of the schema directory, along with the files of the directory no
+// collection is written to anymore.
+func schemaDirFiles(settings compiledSettings, dir string, data []byte) (files []atomicfile.File, stale []string, err error) {
+	var collections []json.RawMessage
+	if err := json.Unmarshal(data, &collections); err != nil {
+		return nil, nil, err
+	}
+
+	indent := strings.Repeat(" ", settings.style.Indent)
+	for _, raw := range collections {
+		var name struct {
+			Collection string `json:"collection"`
+		}
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return nil, nil, err
+		}
+		path := filepath.Join(dir, fileNamePart(name.Collection)+schemaDirExt)
+		if slices.ContainsFunc(files, func(f atomicfile.File) bool { return f.Path == path }) {
+			return nil, nil, fmt.Errorf("collections named like %s share the file %s", name.Collection, path)
+		}
+
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, raw, "", indent); err != nil {
+			return nil, nil, err
+		}
+		buf.WriteByte('\n')
+		files = append(files, atomicfile.File{Path: path, Data: buf.Bytes()})
+	}
+
+	existing, err := schemaDirPaths(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+	for _, path := range existing {
+		if !slices.ContainsFunc(files, func(f atomicfile.File) bool { return f.Path == path }) {
+			stale = append(stale, path)
+		}
+	}
+	return files, stale, nil
+}
+
+// writeSchemaFile writes the marshaled schema to the schema file at path or,
+// for a schema directory, a file per collection, removing the files of
+// collections that no longer exist.
+func writeSchemaFile(settings compiledSettings, path string, data []byte) error {
+	if !isSchemaDir(path) {
+		return settings.permissions.Write(path, data)
+	}
+
+	files, stale, err := schemaDirFiles(settings, path, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return err
+	}
+	if err := settings.permissions.WriteAll(files); err != nil {
+		return err
+	}
+	for _, file := range stale {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaDirFormatted reports whether the collection files of the schema
+// directory are the marshaled schema, with no file left over.
+func schemaDirFormatted(settings compiledSettings, dir string, data []byte) (bool, error) {
+	files, stale, err := schemaDirFiles(settings, dir, data)
+	if err != nil || len(stale) > 0 {
+		return false, err
+	}
+	for _, file := range files {
+		existing, err := os.ReadFile(file.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(existing, file.Data) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
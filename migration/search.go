@@ -0,0 +1,197 @@
+package migration
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ltman/mondex/atlas"
+	"github.com/ltman/mondex/schema"
+)
+
+const searchIndexPollInterval = 5 * time.Second
+
+// searchIndexCommands are the commands that manage Atlas Search and Vector
+// Search indexes; they go through the Atlas Admin API when it is configured.
+var searchIndexCommands = []string{"createSearchIndexes", "updateSearchIndex", "dropSearchIndex"}
+
+// generateSearchIndexCommands generates the commands creating, updating and
+// dropping search indexes from current to declared, and those undoing them.
+// Collections dropped entirely lose their search indexes with them, which the
+// down migration recreates. An index whose type changed is dropped and
+// recreated, as updateSearchIndex only changes definitions.
+func generateSearchIndexCommands(current, declared []schema.Schema, dropped []string) (up, down []any) {
+	var drops, updates, creates, undrops, unupdates, uncreates []any
+	for _, ds := range declared {
+		var cs schema.Schema
+		if i := slices.IndexFunc(current, func(cs schema.Schema) bool { return cs.Collection == ds.Collection }); i >= 0 {
+			cs = current[i]
+		}
+		var toCreate []schema.SearchIndex
+		for _, index := range ds.SearchIndexes {
+			live := cs.FindSearchIndex(index.Name)
+			switch {
+			case live == nil:
+				toCreate = append(toCreate, index)
+			case live.Equal(index):
+			case cmp.Or(live.Type, schema.SearchIndexType) != cmp.Or(index.Type, schema.SearchIndexType):
+				drops = append(drops, generateDropSearchIndexCommand(ds.Collection, index.Name))
+				undrops = append(undrops, generateCreateSearchIndexesCommand(ds.Collection, []schema.SearchIndex{*live}))
+				toCreate = append(toCreate, index)
+			default:
+				updates = append(updates, generateUpdateSearchIndexCommand(ds.Collection, index))
+				unupdates = append(unupdates, generateUpdateSearchIndexCommand(ds.Collection, *live))
+			}
+		}
+		if len(toCreate) > 0 {
+			creates = append(creates, generateCreateSearchIndexesCommand(ds.Collection, toCreate))
+			for _, index := range toCreate {
+				uncreates = append(uncreates, generateDropSearchIndexCommand(ds.Collection, index.Name))
+			}
+		}
+
+		var toRestore []schema.SearchIndex
+		for _, index := range cs.SearchIndexes {
+			if ds.FindSearchIndex(index.Name) == nil {
+				drops = append(drops, generateDropSearchIndexCommand(ds.Collection, index.Name))
+				toRestore = append(toRestore, index)
+			}
+		}
+		if len(toRestore) > 0 {
+			undrops = append(undrops, generateCreateSearchIndexesCommand(ds.Collection, toRestore))
+		}
+	}
+
+	for _, cs := range current {
+		if len(cs.SearchIndexes) == 0 || slices.ContainsFunc(declared, func(ds schema.Schema) bool { return ds.Collection == cs.Collection }) {
+			continue
+		}
+		if !slices.Contains(dropped, cs.Collection) {
+			for _, index := range cs.SearchIndexes {
+				drops = append(drops, generateDropSearchIndexCommand(cs.Collection, index.Name))
+			}
+		}
+		undrops = append(undrops, generateCreateSearchIndexesCommand(cs.Collection, cs.SearchIndexes))
+	}
+
+	return slices.Concat(drops, updates, creates), slices.Concat(uncreates, unupdates, undrops)
+}
+
+// generateCreateSearchIndexesCommand generates the createSearchIndexes
+// MongoDB command of search indexes of a collection.
+func generateCreateSearchIndexesCommand(collection string, indexes []schema.SearchIndex) map[string]interface{} {
+	return map[string]interface{}{
+		"createSearchIndexes": collection,
+		"indexes":             indexes,
+	}
+}
+
+// generateUpdateSearchIndexCommand generates the updateSearchIndex MongoDB
+// command setting the definition of a search index.
+func generateUpdateSearchIndexCommand(collection string, index schema.SearchIndex) namedCommand {
+	return namedCommand{name: "updateSearchIndex", collection: collection, fields: map[string]interface{}{
+		"name":       index.Name,
+		"definition": index.Definition,
+	}}
+}
+
+// generateDropSearchIndexCommand generates the dropSearchIndex MongoDB
+// command of a search index.
+func generateDropSearchIndexCommand(collection, name string) map[string]interface{} {
+	return map[string]interface{}{
+		"dropSearchIndex": collection,
+		"name":            name,
+	}
+}
+
+// runSearchCommand translates a search index command into Admin API calls and
+// waits for created or updated indexes to become ready.
+func (d *commandDriver) runSearchCommand(command bson.D) error {
+	name := command[0].Key
+	collection, _ := command[0].Value.(string)
+	database := d.db.Name()
+
+	switch name {
+	case "createSearchIndexes":
+		var body struct {
+			Indexes []struct {
+				Name       string `bson:"name"`
+				Type       string `bson:"type"`
+				Definition bson.D `bson:"definition"`
+			} `bson:"indexes"`
+		}
+		if err := decodeCommand(command, &body); err != nil {
+			return err
+		}
+		for _, index := range body.Indexes {
+			definition, err := bson.MarshalExtJSON(index.Definition, false, false)
+			if err != nil {
+				return fmt.Errorf("encoding definition of search index %s: %w", index.Name, err)
+			}
+			d.logger.Info("Creating search index through the Atlas Admin API", "collection", collection, "index", index.Name)
+			if err := d.options.Atlas.CreateSearchIndex(d.ctx, atlas.SearchIndex{
+				Database:   database,
+				Collection: collection,
+				Name:       index.Name,
+				Type:       index.Type,
+				Definition: definition,
+			}); err != nil {
+				return err
+			}
+			if err := d.options.Atlas.WaitForSearchIndex(d.ctx, database, collection, index.Name, searchIndexPollInterval); err != nil {
+				return err
+			}
+		}
+	case "updateSearchIndex":
+		var body struct {
+			Name       string `bson:"name"`
+			Definition bson.D `bson:"definition"`
+		}
+		if err := decodeCommand(command, &body); err != nil {
+			return err
+		}
+		definition, err := bson.MarshalExtJSON(body.Definition, false, false)
+		if err != nil {
+			return fmt.Errorf("encoding definition of search index %s: %w", body.Name, err)
+		}
+		d.logger.Info("Updating search index through the Atlas Admin API", "collection", collection, "index", body.Name)
+		if err := d.options.Atlas.UpdateSearchIndex(d.ctx, atlas.SearchIndex{
+			Database:   database,
+			Collection: collection,
+			Name:       body.Name,
+			Definition: definition,
+		}); err != nil {
+			return err
+		}
+		return d.options.Atlas.WaitForSearchIndex(d.ctx, database, collection, body.Name, searchIndexPollInterval)
+	case "dropSearchIndex":
+		var body struct {
+			Name string `bson:"name"`
+		}
+		if err := decodeCommand(command, &body); err != nil {
+			return err
+		}
+		if body.Name == "" {
+			return fmt.Errorf("dropSearchIndex needs an index name to go through the Atlas Admin API")
+		}
+		d.logger.Info("Dropping search index through the Atlas Admin API", "collection", collection, "index", body.Name)
+		return d.options.Atlas.DeleteSearchIndex(d.ctx, database, collection, body.Name)
+	}
+
+	return nil
+}
+
+// decodeCommand decodes the fields of a command document into out.
+func decodeCommand(command bson.D, out any) error {
+	raw, err := bson.Marshal(command)
+	if err != nil {
+		return err
+	}
+	if err := bson.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("decoding %s command: %w", command[0].Key, err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ltman/mondex/atomicfile"
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/schema"
+)
+
+// Settings are how an operation connects and how it reads, compares and
+// writes schemas, which the config file sets for the CLI. The zero value
+// keeps every default.
+type Settings struct {
+	// IgnoredCollections and IgnoredIndexes are the patterns of the
+	// collections and indexes schemas leave out; nil keeps
+	// DefaultIgnoredCollections and DefaultIgnoredIndexes. Patterns are globs
+	// in path.Match syntax, e.g. "system.*", or regular expressions between
+	// slashes, e.g. "/tmp_.*/", both matched against whole names.
+	IgnoredCollections []string
+	IgnoredIndexes     []string
+	// FormatStyle is the style schema files are written in.
+	FormatStyle FormatStyle
+	// Comparison is how indexes compare.
+	Comparison schema.Comparison
+	// FilePermissions are those of the files written; nil honors the umask.
+	FilePermissions *atomicfile.Permissions
+	// Connection are the options of the connections made, to the deployment
+	// and to its members.
+	Connection db.ConnectionOptions
+	// Client, when set, is used instead of connecting to the deployment, for
+	// programs embedding mondex over a connection they own: it is never
+	// disconnected.
+	Client *mongo.Client
+}
+
+// compiledSettings are Settings ready to use, their ignore patterns compiled.
+type compiledSettings struct {
+	collectionsToIgnore []ignoreRule
+	indexesToIgnore     []ignoreRule
+	style               FormatStyle
+	comparison          schema.Comparison
+	permissions         atomicfile.Permissions
+	connection          db.ConnectionOptions
+	client              *mongo.Client
+}
+
+// defaultSettings are the settings of the zero Settings.
+var defaultSettings = mustCompileSettings(Settings{})
+
+// Check reports settings the operations would refuse.
+func (s Settings) Check() error {
+	_, err := s.compile()
+	return err
+}
+
+// connect returns the client of the settings, or connects to the deployment
+// at mongoURI.
+func (s compiledSettings) connect(ctx context.Context, mongoURI string) (*mongo.Client, error) {
+	if s.client != nil {
+		return s.client, nil
+	}
+	return db.ConnectToMongoDB(ctx, mongoURI, s.connection)
+}
+
+// disconnect disconnects the client returned by connect, unless it is the
+// client of the settings, which its owner disconnects.
+func (s compiledSettings) disconnect(ctx context.Context, client *mongo.Client) error {
+	if client == s.client {
+		return nil
+	}
+	return db.Disconnect(ctx, client)
+}
+
+func (s Settings) compile() (compiledSettings, error) {
+	collections, indexes := s.IgnoredCollections, s.IgnoredIndexes
+	if collections == nil {
+		collections = DefaultIgnoredCollections
+	}
+	if indexes == nil {
+		indexes = DefaultIgnoredIndexes
+	}
+	collectionRules, err := compileIgnoreRules(collections)
+	if err != nil {
+		return compiledSettings{}, err
+	}
+	indexRules, err := compileIgnoreRules(indexes)
+	if err != nil {
+		return compiledSettings{}, err
+	}
+
+	style, err := s.FormatStyle.withDefaults()
+	if err != nil {
+		return compiledSettings{}, err
+	}
+	if err := s.Comparison.Check(); err != nil {
+		return compiledSettings{}, err
+	}
+	permissions := atomicfile.DefaultPermissions
+	if s.FilePermissions != nil {
+		permissions = *s.FilePermissions
+	}
+
+	return compiledSettings{
+		collectionsToIgnore: collectionRules,
+		indexesToIgnore:     indexRules,
+		style:               style,
+		comparison:          s.Comparison,
+		permissions:         permissions,
+		connection:          s.Connection,
+		client:              s.Client,
+	}, nil
+}
+
+func mustCompileSettings(s Settings) compiledSettings {
+	compiled, err := s.compile()
+	if err != nil {
+		panic(fmt.Sprintf("invalid default settings: %v", err))
+	}
+	return compiled
+}
@@ -0,0 +1,236 @@
+package migration
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/schema"
+	"github.com/ltman/mondex/version"
+)
+
+// SnapshotOptions designate what WriteSnapshot bundles besides the live
+// schema and statistics.
+type SnapshotOptions struct {
+	// MigrationDir, when set, lists the migrations not applied yet.
+	MigrationDir string
+	// Config is the effective configuration, secrets redacted.
+	Config []byte
+}
+
+// snapshotManifest describes the bundle.
+type snapshotManifest struct {
+	CreatedAt time.Time    `json:"createdAt"`
+	Database  string       `json:"database"`
+	Mondex    version.Info `json:"mondex"`
+	// Errors lists the parts that couldn't be read, e.g. for lack of
+	// privileges, and are missing from the bundle.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// collectionSnapshot holds the statistics of a collection.
+type collectionSnapshot struct {
+	Count          int64                 `json:"count"`
+	Size           int64                 `json:"size"`
+	StorageSize    int64                 `json:"storageSize"`
+	TotalIndexSize int64                 `json:"totalIndexSize"`
+	Indexes        map[string]indexUsage `json:"indexes"`
+}
+
+// indexUsage holds the size and usage counters of an index.
+type indexUsage struct {
+	Size  int64     `json:"size"`
+	Ops   int64     `json:"ops"`
+	Since time.Time `json:"since"`
+}
+
+// migrationsSnapshot holds the migration state of the database.
+type migrationsSnapshot struct {
+	Version    int                      `json:"version"`
+	Dirty      bool                     `json:"dirty"`
+	Pending    []pendingMigration       `json:"pending"`
+	OutOfOrder []db.OutOfOrderMigration `json:"outOfOrder,omitempty"`
+}
+
+type pendingMigration struct {
+	Version uint64 `json:"version"`
+	Name    string `json:"name"`
+}
+
+// WriteSnapshot connects to MongoDB and writes a gzipped tar archive of the
+// live schema, collection and index statistics, server version and topology,
+// migration state and configuration to path, e.g. to attach to an incident.
+// Parts that can't be read are logged and listed in the manifest.
+func WriteSnapshot(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+	readOptions db.ReadOptions,
+	options SnapshotOptions,
+	path string,
+) error {
+	compiled, err := settings.compile()
+	if err != nil {
+		return err
+	}
+
+	manifest := snapshotManifest{CreatedAt: time.Now().UTC(), Database: databaseName, Mondex: version.Get()}
+	failed := func(part string, err error) {
+		logger.Warn("Leaving part out of the snapshot", "part", part, "error", err)
+		manifest.Errors = append(manifest.Errors, fmt.Sprintf("%s: %v", part, err))
+	}
+
+	current, err := readCurrentSchema(ctx, logger, compiled, mongoURI, databaseName, readOptions)
+	if err != nil {
+		return fmt.Errorf("inspecting current schema: %w", err)
+	}
+	schemas, err := marshalSchemas(compiled, "schema.json", schema.CollapseBuckets(normalizeDeprecated(logger, current)))
+	if err != nil {
+		return fmt.Errorf("marshalling current schema: %w", err)
+	}
+
+	logger.Debug("Connecting to MongoDB")
+	client, err := compiled.connect(ctx, mongoURI)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer func() {
+		if err := compiled.disconnect(ctx, client); err != nil {
+			logger.Error("Failed to disconnect from MongoDB", "error", err)
+		}
+	}()
+
+	database, err := db.OpenDatabase(client, databaseName, readOptions)
+	if err != nil {
+		return err
+	}
+
+	files := []snapshotFile{{Name: "schema.json", Content: schemas}}
+
+	logger.Debug("Reading server information")
+	if server, err := db.ReadServerInfo(ctx, client); err != nil {
+		failed("server.json", err)
+	} else {
+		files = append(files, snapshotFile{Name: "server.json", Content: server})
+	}
+
+	stats := make(map[string]collectionSnapshot, len(current))
+	for _, s := range current {
+		logger.Debug("Reading collection statistics", "collection", s.Collection)
+		collStats, err := db.ReadCollectionStats(ctx, database, s.Collection)
+		if err != nil {
+			failed("stats.json "+s.Collection, err)
+			continue
+		}
+		usage, err := db.ReadIndexUsage(ctx, database, s.Collection)
+		if err != nil {
+			failed("stats.json "+s.Collection+" usage", err)
+		}
+
+		snapshot := collectionSnapshot{
+			Count:          collStats.Count,
+			Size:           collStats.Size,
+			StorageSize:    collStats.StorageSize,
+			TotalIndexSize: collStats.TotalIndexSize,
+			Indexes:        make(map[string]indexUsage, len(collStats.IndexSizes)),
+		}
+		for name, size := range collStats.IndexSizes {
+			snapshot.Indexes[name] = indexUsage{Size: size, Ops: usage[name].Ops, Since: usage[name].Since}
+		}
+		stats[s.Collection] = snapshot
+	}
+	files = append(files, snapshotFile{Name: "stats.json", Content: stats})
+
+	logger.Debug("Reading migration state")
+	if migrations, err := readMigrationsSnapshot(ctx, database, options.MigrationDir); err != nil {
+		failed("migrations.json", err)
+	} else {
+		files = append(files, snapshotFile{Name: "migrations.json", Content: migrations})
+	}
+
+	if options.Config != nil {
+		files = append(files, snapshotFile{Name: "config.txt", Content: options.Config})
+	}
+	files = append([]snapshotFile{{Name: "manifest.json", Content: manifest}}, files...)
+
+	logger.Info("Writing snapshot", "path", path, "files", len(files))
+	if err := compiled.permissions.WriteStream(path, func(w io.Writer) error {
+		return writeSnapshotArchive(w, manifest.CreatedAt, files)
+	}); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	return nil
+}
+
+// readMigrationsSnapshot reads the applied version and lists the migrations
+// of the directory that aren't applied yet.
+func readMigrationsSnapshot(ctx context.Context, database *mongo.Database, migrationDir string) (migrationsSnapshot, error) {
+	var snapshot migrationsSnapshot
+	var err error
+	if snapshot.Version, snapshot.Dirty, err = db.MigrationVersion(ctx, database); err != nil {
+		return migrationsSnapshot{}, err
+	}
+	if snapshot.OutOfOrder, err = db.OutOfOrderMigrations(ctx, database); err != nil {
+		return migrationsSnapshot{}, err
+	}
+	if migrationDir == "" {
+		return snapshot, nil
+	}
+
+	files, err := listMigrationFiles(migrationDir)
+	if err != nil {
+		return migrationsSnapshot{}, err
+	}
+	snapshot.Pending = []pendingMigration{}
+	for _, file := range files {
+		if file.Direction != "up" || (snapshot.Version != db.NilVersion && file.Version <= uint64(snapshot.Version)) {
+			continue
+		}
+		snapshot.Pending = append(snapshot.Pending, pendingMigration{Version: file.Version, Name: file.Name})
+	}
+	return snapshot, nil
+}
+
+// snapshotFile is a file of the snapshot archive. Content other than bytes
+// is written as JSON.
+type snapshotFile struct {
+	Name    string
+	Content any
+}
+
+// writeSnapshotArchive writes the files as a gzipped tar archive.
+func writeSnapshotArchive(w io.Writer, modTime time.Time, files []snapshotFile) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		data, ok := file.Content.([]byte)
+		if !ok {
+			var err error
+			if data, err = json.MarshalIndent(file.Content, "", "  "); err != nil {
+				return fmt.Errorf("marshalling %s: %w", file.Name, err)
+			}
+			data = append(data, '\n')
+		}
+
+		header := &tar.Header{Name: file.Name, Mode: 0o644, Size: int64(len(data)), ModTime: modTime}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,247 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ltman/mondex/atomicfile"
+	"github.com/ltman/mondex/db"
+)
+
+// replayedCommands are the commands replayCommand turns into the schema,
+// which a squashed migration recreates.
+var replayedCommands = []string{
+	"createIndexes", "dropIndexes", "drop", "create", "collMod",
+	"createSearchIndexes", "updateSearchIndex", "dropSearchIndex", "renameCollection",
+}
+
+// SquashPlan is how squashing renumbers the migration directory.
+type SquashPlan struct {
+	// Through is the last version squashed and Version the version of the
+	// squashed migration, the first one squashed.
+	Through uint64
+	Version uint64
+	// Squashed is the number of migrations replaced by the squashed one.
+	Squashed int
+	// Renumbered maps the versions of the later migrations to their new
+	// versions.
+	Renumbered map[uint64]uint64
+}
+
+// renumbered returns the version a version from the last squashed one on
+// becomes.
+func (p SquashPlan) renumbered(version uint64) uint64 {
+	return version - (p.Through - p.Version)
+}
+
+// SquashMigrations replaces the migrations of the directory up to through
+// with a single migration pair creating the schema they produce, at the
+// version of the first one, and renumbers the later migrations to follow it.
+// Only JSON migrations whose commands make up the schema can be squashed.
+// With dryRun nothing is written.
+func SquashMigrations(ctx context.Context, logger *slog.Logger, settings Settings, migrationDir string, through uint64, dryRun bool) (SquashPlan, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return SquashPlan{}, err
+	}
+
+	if err := checkMigrationDir(migrationDir); err != nil {
+		return SquashPlan{}, err
+	}
+	unlock, err := lockMigrationDir(ctx, logger, migrationDir)
+	if err != nil {
+		return SquashPlan{}, err
+	}
+	defer unlock()
+
+	migrations := dirSource(migrationDir)
+	files, err := migrations.files()
+	if err != nil {
+		return SquashPlan{}, err
+	}
+	if !slices.ContainsFunc(files, func(f migrationFile) bool { return f.Version == through && f.Direction == "up" }) {
+		return SquashPlan{}, fmt.Errorf("no up migration with version %d in %s", through, migrations)
+	}
+
+	plan := SquashPlan{Through: through, Version: files[0].Version, Renumbered: make(map[uint64]uint64)}
+	var squashed, later []migrationFile
+	for _, file := range files {
+		if file.Version > through {
+			later = append(later, file)
+			plan.Renumbered[file.Version] = plan.renumbered(file.Version)
+			continue
+		}
+		squashed = append(squashed, file)
+		if file.Direction == "up" {
+			plan.Squashed++
+		}
+		if err := checkSquashable(file); err != nil {
+			return SquashPlan{}, err
+		}
+	}
+
+	current, _, err := replayMigrations(logger, compiled, migrations, through)
+	if err != nil {
+		return SquashPlan{}, err
+	}
+	upCommand, downCommand, err := generateMigrationCommands(compiled, nil, current, nil, false, logger)
+	if err != nil {
+		return SquashPlan{}, err
+	}
+	if upCommand == nil {
+		upCommand, downCommand = []byte("[]"), []byte("[]")
+	}
+	schemaData, err := json.Marshal(current)
+	if err != nil {
+		return SquashPlan{}, err
+	}
+	header := newMigrationHeader(schemaHash(schemaData), "")
+
+	var pair []atomicfile.File
+	for _, side := range []struct {
+		direction string
+		commands  []byte
+	}{{"up", upCommand}, {"down", downCommand}} {
+		data, err := withHeader(side.commands, header)
+		if err != nil {
+			return SquashPlan{}, err
+		}
+		name := fmt.Sprintf("%06d_squashed_through_%06d.%s.json", plan.Version, through, side.direction)
+		pair = append(pair, atomicfile.File{Path: filepath.Join(migrationDir, name), Data: append(data, '\n')})
+	}
+
+	if dryRun {
+		logger.Info("Dry-run: not squashing migrations", "squashed", plan.Squashed, "renumbered", len(plan.Renumbered))
+		return plan, nil
+	}
+
+	for _, file := range squashed {
+		if err := os.Remove(file.Path); err != nil {
+			return SquashPlan{}, fmt.Errorf("failed to remove squashed migration: %w", err)
+		}
+	}
+	logger.Info("Writing squashed migration", "version", plan.Version, "through", through, "squashed", plan.Squashed)
+	if err := compiled.permissions.WriteAll(pair); err != nil {
+		return SquashPlan{}, fmt.Errorf("failed to write squashed migration: %w", err)
+	}
+	// Versions only decrease, so renaming in order never overwrites a
+	// migration not renamed yet.
+	for _, file := range later {
+		path := filepath.Join(migrationDir,
+			fmt.Sprintf("%06d_%s.%s.%s", plan.Renumbered[file.Version], file.Name, file.Direction, file.Extension))
+		logger.Debug("Renumbering migration", "from", file.Path, "to", path)
+		if err := os.Rename(file.Path, path); err != nil {
+			return SquashPlan{}, fmt.Errorf("failed to renumber migration: %w", err)
+		}
+	}
+	return plan, nil
+}
+
+// checkSquashable fails when the migration file has commands a squashed
+// migration would lose.
+func checkSquashable(file migrationFile) error {
+	if file.Direction != "up" {
+		return nil
+	}
+
+	body, err := file.read()
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", file.Path, err)
+	}
+	var commands []bson.D
+	if err := bson.UnmarshalExtJSON(body, true, &commands); err != nil {
+		return fmt.Errorf("unmarshaling migration commands of %s: %w", file.Path, err)
+	}
+	for _, command := range withoutAnnotations(commands) {
+		if len(command) > 0 && !slices.Contains(replayedCommands, command[0].Key) {
+			return fmt.Errorf("can't squash %s, its %s command isn't part of the schema the squashed migration creates",
+				file.Path, command[0].Key)
+		}
+	}
+	return nil
+}
+
+// CheckSquashable fails when the database recorded a version the squash
+// can't renumber: one before the last squashed version, or one whose
+// migration failed midway.
+func CheckSquashable(ctx context.Context, logger *slog.Logger, settings Settings, mongoURI, databaseName string, through uint64) error {
+	version, dirty, err := ReadAppliedVersion(ctx, logger, settings, mongoURI, databaseName)
+	if err != nil {
+		return err
+	}
+	return checkSquashableVersion(databaseName, version, dirty, through)
+}
+
+// checkSquashableVersion is CheckSquashable for the version recorded.
+func checkSquashableVersion(databaseName string, version int, dirty bool, through uint64) error {
+	switch {
+	case version == db.NilVersion:
+		return nil
+	case dirty:
+		return fmt.Errorf("migration %d of %s failed midway, fix it before squashing", version, databaseName)
+	case uint64(version) < through:
+		return fmt.Errorf("%s is at version %d, apply the migrations through %d before squashing them",
+			databaseName, version, through)
+	}
+	return nil
+}
+
+// RenumberAppliedVersion rewrites the version recorded in the database, and
+// those of the migrations it applied out of order, as the squash renumbered
+// them, so the database applies the renumbered migrations it didn't reach.
+func RenumberAppliedVersion(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+	plan SquashPlan,
+	lockOptions LockOptions,
+) error {
+	compiled, err := settings.compile()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(ctx, logger, compiled, mongoURI, databaseName, lockOptions, func(d *commandDriver) error {
+		version, dirty, err := db.MigrationVersion(ctx, d.db)
+		if err != nil {
+			return err
+		}
+		if err := checkSquashableVersion(databaseName, version, dirty, plan.Through); err != nil {
+			return err
+		}
+		if version == db.NilVersion {
+			logger.Info("No version recorded, nothing to renumber", "database", databaseName)
+			return nil
+		}
+
+		outOfOrder, err := db.OutOfOrderMigrations(ctx, d.db)
+		if err != nil {
+			return err
+		}
+		for _, m := range outOfOrder {
+			renumbered := plan.renumbered(m.Version)
+			if err := db.ForgetOutOfOrder(ctx, d.db, m.Version); err != nil {
+				return err
+			}
+			m.Version = renumbered
+			if err := db.RecordOutOfOrder(ctx, d.db, m); err != nil {
+				return err
+			}
+		}
+
+		renumbered := plan.renumbered(uint64(version))
+		logger.Info("Renumbering recorded version", "database", databaseName, "from", version, "to", renumbered)
+		if err := d.SetVersion(int(renumbered), false); err != nil {
+			return fmt.Errorf("failed to record version %d: %w", renumbered, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,133 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/schema"
+)
+
+// readStateFile reads the schema recorded by the last generated migration. The
+// state file has the format of the schema file; a missing one is empty, as
+// before the first migration.
+func readStateFile(logger *slog.Logger, statePath string) ([]schema.Schema, error) {
+	state, err := readDeclaredSchema(statePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		logger.Warn("State file not found, diffing against an empty schema", "path", statePath)
+		return []schema.Schema{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading state file: %w", err)
+	}
+	return state, nil
+}
+
+// writeStateFile records the schema the migrations produce once applied.
+func writeStateFile(logger *slog.Logger, settings compiledSettings, statePath string, state []schema.Schema) error {
+	state = prepareSchemas(settings, state)
+
+	logger.Info("Writing state file", "path", statePath)
+	if err := settings.permissions.WriteStream(statePath, func(w io.Writer) error { return schema.Encode(w, state, "  ") }); err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	return nil
+}
+
+// nextState returns the schema once a migration from current to declared is
+// applied. Collections outside the diffed scope keep their current indexes.
+func nextState(current, scopedCurrent, scopedDeclared []schema.Schema) []schema.Schema {
+	inScope := func(s schema.Schema) bool {
+		isCollection := func(other schema.Schema) bool { return other.Collection == s.Collection }
+		return slices.ContainsFunc(scopedCurrent, isCollection) || slices.ContainsFunc(scopedDeclared, isCollection)
+	}
+
+	state := slices.DeleteFunc(slices.Clone(current), inScope)
+	for _, s := range scopedDeclared {
+		indexes := make([]schema.Index, 0, len(s.Indexes))
+		for _, index := range s.Indexes {
+			indexes = append(indexes, index.WithoutAnnotations())
+		}
+		recorded := schema.Schema{Collection: s.Collection, Options: s.Options, Indexes: indexes, SearchIndexes: s.SearchIndexes}.WithValidationOf(s)
+		if i := slices.IndexFunc(scopedCurrent, func(cs schema.Schema) bool { return cs.Collection == s.Collection }); i >= 0 {
+			// The validator left alone stays as it is, and existing
+			// collections keep the options they were created with.
+			if !s.ManagesValidation() {
+				recorded = recorded.WithValidationOf(scopedCurrent[i])
+			}
+			recorded.Options = scopedCurrent[i].Options
+		}
+		state = append(state, recorded)
+	}
+	return state
+}
+
+// writeRemoteState records in the state collection the schema the migrations
+// applied to the database produce, replayed from their source.
+func writeRemoteState(ctx context.Context, logger *slog.Logger, settings compiledSettings, database *mongo.Database, migrations migrationSource) error {
+	version, dirty, err := db.MigrationVersion(ctx, database)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		logger.Warn("Last migration failed midway, not recording the state", "version", version)
+		return nil
+	}
+
+	var state []schema.Schema
+	if version != db.NilVersion {
+		state, _, err = replayMigrations(logger, settings, migrations, uint64(version))
+		if err != nil {
+			return fmt.Errorf("replaying applied migrations: %w", err)
+		}
+	}
+	if state == nil {
+		state = []schema.Schema{}
+	}
+
+	logger.Info("Recording state", "collection", db.StateCollection, "version", version)
+	return db.WriteState(ctx, database, db.State{Version: version, Schema: state, UpdatedAt: time.Now().UTC()})
+}
+
+// readRemoteState reads the schema recorded by apply, reporting how the live
+// schema drifted from it since: such drift comes from changes made out of band,
+// not from declared changes pending migration.
+func readRemoteState(ctx context.Context, logger *slog.Logger, settings compiledSettings, database *mongo.Database, live []schema.Schema) ([]schema.Schema, error) {
+	state, ok, err := db.ReadState(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("no state recorded in %s, apply migrations with remote_state enabled first", db.StateCollection)
+	}
+	logger.Debug("Read state", "version", state.Version, "updatedAt", state.UpdatedAt)
+
+	recorded, live := prepareSchemas(settings, state.Schema), prepareSchemas(settings, live)
+	for _, change := range []struct {
+		msg      string
+		from, to []schema.Schema
+	}{
+		{"Index created out of band", live, recorded},
+		{"Index dropped out of band", recorded, live},
+	} {
+		for _, s := range change.from {
+			var other []schema.Index
+			if i := slices.IndexFunc(change.to, func(o schema.Schema) bool { return o.Collection == s.Collection }); i >= 0 {
+				other = change.to[i].Indexes
+			}
+			for _, index := range indexesDifference(s.Indexes, other) {
+				logger.Warn(change.msg, "collection", s.Collection, "index", index.Name)
+			}
+		}
+	}
+
+	return recorded, nil
+}
@@ -0,0 +1,130 @@
+package migration
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/ltman/mondex/db"
+)
+
+// MigrationStatus is whether a migration of the directory is applied to the
+// database.
+type MigrationStatus struct {
+	Version uint64
+	Name    string
+	Applied bool
+	// Dirty is set on the version whose migration failed midway.
+	Dirty bool
+	// OutOfOrder is set on a migration applied with apply --only.
+	OutOfOrder bool
+	// Missing is set on the applied version when the directory has no
+	// migration for it.
+	Missing bool
+	// AppliedAt is when the migration last ran, as recorded in the history;
+	// zero when it isn't applied or the history doesn't have it.
+	AppliedAt time.Time
+}
+
+// ReadStatus connects to MongoDB and returns the status of every migration of
+// the directory, by version, from the version recorded by golang-migrate, the
+// migrations applied out of order and the history of apply.
+func ReadStatus(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI, databaseName string,
+	migrationDir string,
+) ([]MigrationStatus, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := listMigrationFiles(migrationDir)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Connecting to MongoDB")
+	client, err := compiled.connect(ctx, mongoURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer func() {
+		if err := compiled.disconnect(ctx, client); err != nil {
+			logger.Error("Failed to disconnect from MongoDB", "error", err)
+		}
+	}()
+	database := client.Database(databaseName)
+
+	version, dirty, err := db.MigrationVersion(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	outOfOrder, err := db.OutOfOrderMigrations(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	runs, err := db.MigrationRuns(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrationStatuses(files, version, dirty, outOfOrder, runs), nil
+}
+
+// migrationStatuses lists the versions of the migration files with whether
+// they are applied to a database at the version.
+func migrationStatuses(
+	files []migrationFile,
+	version int,
+	dirty bool,
+	outOfOrder []db.OutOfOrderMigration,
+	runs []db.MigrationRun,
+) []MigrationStatus {
+	var statuses []MigrationStatus
+	for _, file := range files {
+		if slices.ContainsFunc(statuses, func(s MigrationStatus) bool { return s.Version == file.Version }) {
+			continue
+		}
+		status := MigrationStatus{Version: file.Version, Name: file.Name}
+		if version != db.NilVersion && file.Version <= uint64(version) {
+			status.Applied = true
+			status.Dirty = dirty && file.Version == uint64(version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	if version != db.NilVersion && !slices.ContainsFunc(statuses, func(s MigrationStatus) bool { return s.Version == uint64(version) }) {
+		statuses = append(statuses, MigrationStatus{Version: uint64(version), Applied: true, Dirty: dirty, Missing: true})
+	}
+	for _, m := range outOfOrder {
+		i := slices.IndexFunc(statuses, func(s MigrationStatus) bool { return s.Version == m.Version })
+		if i < 0 {
+			statuses = append(statuses, MigrationStatus{Version: m.Version, Name: m.Name, Missing: true})
+			i = len(statuses) - 1
+		}
+		statuses[i].Applied, statuses[i].OutOfOrder, statuses[i].AppliedAt = true, true, m.AppliedAt
+	}
+
+	// The last run of each version tells when it was applied, unless it
+	// was rolled back since.
+	for _, run := range runs {
+		i := slices.IndexFunc(statuses, func(s MigrationStatus) bool { return s.Version == run.Version })
+		if i < 0 || !statuses[i].Applied || statuses[i].OutOfOrder {
+			continue
+		}
+		if run.Down {
+			statuses[i].AppliedAt = time.Time{}
+			continue
+		}
+		statuses[i].AppliedAt = run.FinishedAt
+	}
+
+	slices.SortFunc(statuses, func(a, b MigrationStatus) int { return cmp.Compare(a.Version, b.Version) })
+	return statuses
+}
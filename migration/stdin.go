@@ -0,0 +1,47 @@
+package migration
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// StdinPath as the schema file path reads the declared schema from the
+// standard input, e.g. piped from a generator or git show.
+const StdinPath = "-"
+
+// stdin holds the standard input, read once as the schema file is read several
+// times by some commands.
+var stdin = sync.OnceValues(func() ([]byte, error) { return io.ReadAll(os.Stdin) })
+
+// readFile reads the file at path, the standard input for StdinPath, or the
+// collection files of a schema directory joined into one.
+func readFile(path string) ([]byte, error) {
+	if path == StdinPath {
+		return stdin()
+	}
+	if isSchemaDir(path) {
+		return readSchemaDir(path)
+	}
+	return os.ReadFile(path)
+}
+
+// schemaCodec returns the codec of the schema file at path, by its extension
+// or, for the standard input, YAML unless it starts like JSON does.
+func schemaCodec(path string) schema.Codec {
+	if path != StdinPath {
+		return schema.CodecFor(path)
+	}
+	data, err := stdin()
+	if err != nil {
+		return schema.JSONCodec
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] != '[' && data[0] != '{' {
+		return schema.YAMLCodec
+	}
+	return schema.JSONCodec
+}
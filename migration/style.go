@@ -0,0 +1,133 @@
+package migration
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// Index orders of FormatStyle.SortIndexes.
+const (
+	SortIndexesByName = "name"
+	SortIndexesByKey  = "key"
+	SortIndexesNone   = "none"
+)
+
+// FormatStyle is how mondex writes schema files.
+type FormatStyle struct {
+	// Indent is the number of spaces per nesting level.
+	Indent int
+	// SortIndexes orders the indexes of a collection by name, by key
+	// specification, or keeps them as declared.
+	SortIndexes string
+	// Descending reverses the order of collections and sorted indexes.
+	Descending bool
+	// KeepEmptyCollections keeps collections declared without indexes.
+	KeepEmptyCollections bool
+}
+
+// DefaultFormatStyle is the style used unless configured otherwise.
+var DefaultFormatStyle = FormatStyle{Indent: 2, SortIndexes: SortIndexesByName}
+
+// withDefaults returns the style with the defaults of the settings left
+// unset, failing when it is invalid. A zero indent or empty index order keeps
+// the default.
+func (style FormatStyle) withDefaults() (FormatStyle, error) {
+	if style.Indent == 0 {
+		style.Indent = DefaultFormatStyle.Indent
+	}
+	if style.Indent < 0 || style.Indent > 8 {
+		return FormatStyle{}, fmt.Errorf("invalid indent %d, want 1 to 8 spaces", style.Indent)
+	}
+
+	switch style.SortIndexes {
+	case "":
+		style.SortIndexes = DefaultFormatStyle.SortIndexes
+	case SortIndexesByName, SortIndexesByKey, SortIndexesNone:
+	default:
+		return FormatStyle{}, fmt.Errorf("invalid index order %q, want name, key or none", style.SortIndexes)
+	}
+	return style, nil
+}
+
+// marshalSchemas renders schemas as the schema file at path, in the format of
+// its extension and in the configured style, leaving out ignored
+// collections and indexes.
+func marshalSchemas(settings compiledSettings, path string, schemas []schema.Schema) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeSchemas(settings, &buf, path, schemas); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeSchemas streams schemas as the schema file at path, like
+// marshalSchemas. JSON is written one collection at a time.
+func writeSchemas(settings compiledSettings, w io.Writer, path string, schemas []schema.Schema) error {
+	styled := styleSchemas(settings, schemas)
+	formatStyle := settings.style
+	indent := strings.Repeat(" ", formatStyle.Indent)
+	codec := schemaCodec(path)
+	if codec.IsJSON() {
+		return schema.Encode(w, styled, indent)
+	}
+
+	data, err := json.MarshalIndent(styled, "", indent)
+	if err != nil {
+		return err
+	}
+	if data, err = codec.FromJSON(data, formatStyle.Indent); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// styleSchemas orders schemas in the configured style, leaving out ignored
+// collections and indexes.
+func styleSchemas(settings compiledSettings, schemas []schema.Schema) []schema.Schema {
+	formatStyle := settings.style
+	direction := 1
+	if formatStyle.Descending {
+		direction = -1
+	}
+
+	styled := make([]schema.Schema, 0, len(schemas))
+	for _, s := range schemas {
+		if settings.ignoredCollection(s.Collection) {
+			continue
+		}
+		s.Indexes = slices.DeleteFunc(slices.Clone(s.Indexes), func(i schema.Index) bool {
+			return settings.ignoredIndex(indexName(i))
+		})
+		if len(s.Indexes) == 0 && !s.GridFS && !s.ManagesValidation() && !s.HasOptions() && len(s.SearchIndexes) == 0 && !formatStyle.KeepEmptyCollections {
+			continue
+		}
+		if s.Indexes == nil {
+			s.Indexes = []schema.Index{}
+		}
+
+		switch formatStyle.SortIndexes {
+		case SortIndexesByName:
+			slices.SortStableFunc(s.Indexes, func(a, b schema.Index) int {
+				return direction * cmp.Compare(indexName(a), indexName(b))
+			})
+		case SortIndexesByKey:
+			slices.SortStableFunc(s.Indexes, func(a, b schema.Index) int {
+				return direction * cmp.Or(cmp.Compare(a.KeySpec(), b.KeySpec()), cmp.Compare(indexName(a), indexName(b)))
+			})
+		}
+		styled = append(styled, s)
+	}
+	slices.SortStableFunc(styled, func(a, b schema.Schema) int {
+		return direction * cmp.Compare(a.Collection, b.Collection)
+	})
+
+	return styled
+}
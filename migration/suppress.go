@@ -0,0 +1,228 @@
+package migration
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// SuppressionRule hides known differences between the current and declared
+// schemas from diff. Suppressed differences generate no commands but are
+// still reported.
+type SuppressionRule struct {
+	// Collection and Index select the indexes the rule applies to, as
+	// patterns like those of ignore; empty matches all.
+	Collection string
+	Index      string
+	// TTLTolerance suppresses TTL differences smaller than this duration.
+	TTLTolerance time.Duration
+	// IgnoreHidden suppresses differences of the hidden flag.
+	IgnoreHidden bool
+	// Until, when set, ends the rule. A rule with only Until suppresses
+	// every difference of the indexes, which are neither created, dropped
+	// nor modified until then.
+	Until time.Time
+	// Reason is reported with the suppressed differences.
+	Reason string
+}
+
+// suppressedDifference is a difference a rule suppressed.
+type suppressedDifference struct {
+	Collection, Index string
+	Difference        string
+	Reason            string
+}
+
+func (d suppressedDifference) String() string {
+	s := fmt.Sprintf("%s.%s: %s", d.Collection, d.Index, d.Difference)
+	if d.Reason != "" {
+		s += " (" + d.Reason + ")"
+	}
+	return s
+}
+
+// compiledSuppression is a rule with its patterns compiled.
+type compiledSuppression struct {
+	SuppressionRule
+	collection, index []ignoreRule
+}
+
+func (r compiledSuppression) matches(collection, index string) bool {
+	return (r.collection == nil || matchesAny(r.collection, collection)) &&
+		(r.index == nil || matchesAny(r.index, index))
+}
+
+// suppressesAll tells whether the rule suppresses every difference rather
+// than some options.
+func (r compiledSuppression) suppressesAll() bool {
+	return !r.Until.IsZero() && r.TTLTolerance <= 0 && !r.IgnoreHidden
+}
+
+// CheckSuppressionRules reports the first rule with an invalid pattern or
+// that suppresses nothing.
+func CheckSuppressionRules(rules []SuppressionRule) error {
+	_, err := compileSuppressionRules(rules)
+	return err
+}
+
+func compileSuppressionRules(rules []SuppressionRule) ([]compiledSuppression, error) {
+	compiled := make([]compiledSuppression, 0, len(rules))
+	for i, rule := range rules {
+		if rule.TTLTolerance <= 0 && !rule.IgnoreHidden && rule.Until.IsZero() {
+			return nil, fmt.Errorf("suppression rule %d: set ttl_tolerance, ignore_hidden or until", i+1)
+		}
+
+		c := compiledSuppression{SuppressionRule: rule}
+		var err error
+		if rule.Collection != "" {
+			if c.collection, err = compileIgnoreRules([]string{rule.Collection}); err != nil {
+				return nil, fmt.Errorf("suppression rule %d: %w", i+1, err)
+			}
+		}
+		if rule.Index != "" {
+			if c.index, err = compileIgnoreRules([]string{rule.Index}); err != nil {
+				return nil, fmt.Errorf("suppression rule %d: %w", i+1, err)
+			}
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// suppressDifferences returns the declared schema with the suppressed
+// differences taken from the current schema, so diff generates nothing for
+// them and the state records the indexes as they are, along with the
+// differences suppressed.
+func suppressDifferences(
+	logger *slog.Logger,
+	settings compiledSettings,
+	current, declared []schema.Schema,
+	rules []SuppressionRule,
+	now time.Time,
+) ([]schema.Schema, []suppressedDifference, error) {
+	compiled, err := compileSuppressionRules(rules)
+	if err != nil || len(compiled) == 0 {
+		return declared, nil, err
+	}
+
+	active := slices.DeleteFunc(compiled, func(r compiledSuppression) bool {
+		if !r.Until.IsZero() && !now.Before(r.Until) {
+			logger.Warn("Suppression rule expired", "collection", r.Collection, "index", r.Index,
+				"until", r.Until.Format(time.DateOnly), "reason", r.Reason)
+			return true
+		}
+		return false
+	})
+
+	declared = cloneSchemas(declared)
+	var suppressed []suppressedDifference
+	record := func(collection, index, difference, reason string) {
+		d := suppressedDifference{Collection: collection, Index: index, Difference: difference, Reason: reason}
+		logger.Info("Suppressed difference", "collection", collection, "index", index, "difference", difference, "reason", reason)
+		suppressed = append(suppressed, d)
+	}
+
+	// Indexes suppressed until a date keep their current definition, or
+	// absence, whatever is declared.
+	type indexID struct{ collection, name string }
+	var ids []indexID
+	for _, schemas := range [][]schema.Schema{current, declared} {
+		for _, s := range schemas {
+			for _, index := range s.Indexes {
+				if id := (indexID{s.Collection, index.Name}); !slices.Contains(ids, id) {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	for _, id := range ids {
+		i := slices.IndexFunc(active, func(r compiledSuppression) bool {
+			return r.suppressesAll() && r.matches(id.collection, id.name)
+		})
+		if i < 0 {
+			continue
+		}
+		rule := active[i]
+
+		live, declaredIndex := findIndex(current, id.collection, id.name), findIndex(declared, id.collection, id.name)
+		var difference string
+		switch {
+		case live == nil:
+			difference = "not created"
+			declared = removeIndex(declared, id.collection, id.name)
+		case declaredIndex == nil:
+			difference = "not dropped"
+			declared = putIndex(declared, id.collection, *live)
+		case !sameIndex(settings, *live, *declaredIndex):
+			difference = "not modified"
+			*declaredIndex = live.WithoutAnnotations()
+		default:
+			continue
+		}
+		record(id.collection, id.name, difference+" until "+rule.Until.Format(time.DateOnly), rule.Reason)
+	}
+
+	for _, ds := range declared {
+		for k := range ds.Indexes {
+			index := &ds.Indexes[k]
+			live := findIndex(current, ds.Collection, index.Name)
+			if live == nil {
+				continue
+			}
+			for _, rule := range active {
+				if !rule.matches(ds.Collection, index.Name) {
+					continue
+				}
+				if rule.TTLTolerance > 0 && live.ExpireAfterSeconds != nil && index.ExpireAfterSeconds != nil &&
+					*live.ExpireAfterSeconds != *index.ExpireAfterSeconds {
+					delta := time.Duration(*live.ExpireAfterSeconds-*index.ExpireAfterSeconds) * time.Second
+					if delta.Abs() < rule.TTLTolerance {
+						record(ds.Collection, index.Name, fmt.Sprintf("TTL %ds declared, %ds found",
+							*index.ExpireAfterSeconds, *live.ExpireAfterSeconds), rule.Reason)
+						index.ExpireAfterSeconds = live.ExpireAfterSeconds
+					}
+				}
+				if rule.IgnoreHidden && live.Hidden != index.Hidden {
+					record(ds.Collection, index.Name, fmt.Sprintf("hidden %t declared, %t found",
+						index.Hidden, live.Hidden), rule.Reason)
+					index.Hidden = live.Hidden
+				}
+			}
+		}
+	}
+
+	return declared, suppressed, nil
+}
+
+// cloneSchemas copies the schemas and their index lists, so indexes can be
+// changed without touching the original.
+func cloneSchemas(schemas []schema.Schema) []schema.Schema {
+	cloned := slices.Clone(schemas)
+	for i := range cloned {
+		cloned[i].Indexes = slices.Clone(cloned[i].Indexes)
+	}
+	return cloned
+}
+
+// removeIndex removes the index from the collection.
+func removeIndex(schemas []schema.Schema, collection, name string) []schema.Schema {
+	for i, s := range schemas {
+		if s.Collection == collection {
+			schemas[i].Indexes = slices.DeleteFunc(s.Indexes, func(index schema.Index) bool { return index.Name == name })
+		}
+	}
+	return schemas
+}
+
+// putIndex adds the index to the collection, adding the collection if needed.
+func putIndex(schemas []schema.Schema, collection string, index schema.Index) []schema.Schema {
+	index = index.WithoutAnnotations()
+	if i := slices.IndexFunc(schemas, func(s schema.Schema) bool { return s.Collection == collection }); i >= 0 {
+		schemas[i].Indexes = append(schemas[i].Indexes, index)
+		return schemas
+	}
+	return append(schemas, schema.Schema{Collection: collection, Indexes: []schema.Index{index}})
+}
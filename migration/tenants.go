@@ -0,0 +1,113 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ltman/mondex/db"
+)
+
+// TenantResult is the outcome of an operation on one tenant database.
+type TenantResult struct {
+	Database string
+	Err      error
+}
+
+// CheckTenantPatterns checks the patterns selecting tenant databases, as
+// those of ignore.
+func CheckTenantPatterns(patterns []string) error {
+	if _, err := compileIgnoreRules(patterns); err != nil {
+		return fmt.Errorf("invalid tenant database pattern: %w", err)
+	}
+	return nil
+}
+
+// listTenantDatabases lists the databases of the deployment matching the
+// patterns, by name.
+func listTenantDatabases(ctx context.Context, client *mongo.Client, patterns []string) ([]string, error) {
+	if err := CheckTenantPatterns(patterns); err != nil {
+		return nil, err
+	}
+	rules, err := compileIgnoreRules(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := db.ListDatabases(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	var tenants []string
+	for _, name := range names {
+		if !slices.Contains(DefaultExcludedDatabases, name) && matchesAny(rules, name) {
+			tenants = append(tenants, name)
+		}
+	}
+	slices.Sort(tenants)
+	return tenants, nil
+}
+
+// ForEachTenant runs fn on every database matching the patterns, at most
+// concurrency at once, over a single connection: fn gets the settings with
+// it as their Client. The outcome of each database is returned by name, fn
+// failing on one not stopping the others; the error is only about listing
+// the databases.
+func ForEachTenant(
+	ctx context.Context,
+	logger *slog.Logger,
+	settings Settings,
+	mongoURI string,
+	patterns []string,
+	concurrency int,
+	fn func(ctx context.Context, logger *slog.Logger, settings Settings, database string) error,
+) ([]TenantResult, error) {
+	compiled, err := settings.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Connecting to MongoDB")
+	client, err := compiled.connect(ctx, mongoURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer func() {
+		if err := compiled.disconnect(ctx, client); err != nil {
+			logger.Error("Failed to disconnect from MongoDB", "error", err)
+		}
+	}()
+
+	tenants, err := listTenantDatabases(ctx, client, patterns)
+	if err != nil {
+		return nil, err
+	}
+	if len(tenants) == 0 {
+		return nil, fmt.Errorf("no database matches the tenant patterns %v", patterns)
+	}
+	logger.Info("Found tenant databases", "databases", len(tenants))
+
+	// Every operation reuses the connection instead of opening its own.
+	shared := settings
+	shared.Client = client
+	results := make([]TenantResult, len(tenants))
+	slots := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, name := range tenants {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			results[i] = TenantResult{Database: name, Err: fn(ctx, logger.With("database", name), shared, name)}
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
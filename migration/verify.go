@@ -0,0 +1,110 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/schema"
+)
+
+// VerifyOptions designate the declared schema apply checks the database
+// against once the migrations ran.
+type VerifyOptions struct {
+	SchemaFilePath string
+	// ManagedCollectionsOnly ignores collections that aren't declared, as
+	// diff does with managed_collections_only.
+	ManagedCollectionsOnly bool
+}
+
+// schemaMismatch is an index the database and the declared schema disagree on.
+type schemaMismatch struct {
+	Collection, Index string
+	Problem           string
+}
+
+// verifySchema fails with a report of every mismatch when the indexes of the
+// database don't match the declared schema.
+func verifySchema(ctx context.Context, logger *slog.Logger, settings compiledSettings, database *mongo.Database, options VerifyOptions) error {
+	logger.Info("Verifying the database against the declared schema", "path", options.SchemaFilePath)
+
+	declared, err := readDeclaredSchema(options.SchemaFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read declared schema: %w", err)
+	}
+	declared = prepareSchemas(settings, schema.ExpandBuckets(declared))
+
+	current, err := db.ReadCurrentSchema(ctx, database, 1)
+	if err != nil {
+		return fmt.Errorf("failed to read current schema: %w", err)
+	}
+	current = withoutGridFSDefaults(declared, prepareSchemas(settings, current))
+	if options.ManagedCollectionsOnly {
+		current = managedSchemas(declared, current, logger)
+	}
+
+	mismatches := schemaMismatches(settings, current, declared)
+	if len(mismatches) == 0 {
+		logger.Info("Database matches the declared schema")
+		return nil
+	}
+
+	lines := make([]string, 0, len(mismatches))
+	for _, m := range mismatches {
+		lines = append(lines, fmt.Sprintf("  %s.%s: %s", m.Collection, m.Index, m.Problem))
+	}
+	return fmt.Errorf("database doesn't match the declared schema after applying migrations:\n%s", strings.Join(lines, "\n"))
+}
+
+// schemaMismatches lists the indexes missing from current, those current has
+// but aren't declared, and those that differ, by collection and name.
+func schemaMismatches(settings compiledSettings, current, declared []schema.Schema) []schemaMismatch {
+	find := func(schemas []schema.Schema, collection string) []schema.Index {
+		i := slices.IndexFunc(schemas, func(s schema.Schema) bool { return s.Collection == collection })
+		if i < 0 {
+			return nil
+		}
+		return schemas[i].Indexes
+	}
+
+	var mismatches []schemaMismatch
+	for _, ds := range declared {
+		live := find(current, ds.Collection)
+		for _, index := range ds.Indexes {
+			i := slices.IndexFunc(live, func(li schema.Index) bool { return li.Name == index.Name })
+			switch {
+			case i < 0:
+				mismatches = append(mismatches, schemaMismatch{ds.Collection, index.Name, "missing"})
+			case live[i].Building:
+				mismatches = append(mismatches, schemaMismatch{ds.Collection, index.Name, "still being built"})
+			case !matchesDeclared(settings, index, live[i]):
+				mismatches = append(mismatches, schemaMismatch{ds.Collection, index.Name, fmt.Sprintf(
+					"differs, declared %s but found %s", indexDocument(index), indexDocument(live[i]))})
+			}
+		}
+	}
+	for _, cs := range current {
+		declaredIndexes := find(declared, cs.Collection)
+		for _, index := range cs.Indexes {
+			if !slices.ContainsFunc(declaredIndexes, func(di schema.Index) bool { return di.Name == index.Name }) {
+				mismatches = append(mismatches, schemaMismatch{cs.Collection, index.Name, "not declared"})
+			}
+		}
+	}
+	return mismatches
+}
+
+// indexDocument renders the index options as relaxed extended JSON.
+func indexDocument(index schema.Index) string {
+	data, err := bson.MarshalExtJSON(index.WithoutAnnotations(), false, false)
+	if err != nil {
+		return index.KeySpec()
+	}
+	return string(data)
+}
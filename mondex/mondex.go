@@ -0,0 +1,134 @@
+// Package mondex runs mondex from Go programs, e.g. to reconcile indexes when
+// a service starts or from an operator, over a MongoDB connection the program
+// already has.
+package mondex
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"log/slog"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ltman/mondex/db"
+	"github.com/ltman/mondex/migration"
+	"github.com/ltman/mondex/schema"
+)
+
+// Options configure a Client, as the config file configures the CLI.
+type Options struct {
+	DatabaseName   string
+	SchemaFilePath string
+	MigrationDir   string
+	// MongoURI is only needed to connect to individual members of the
+	// deployment, when waiting for secondaries or verifying the indexes of
+	// every shard on apply.
+	MongoURI string
+
+	ReadOptions db.ReadOptions
+	Diff        migration.DiffOptions
+	Apply       migration.ApplyOptions
+	// Settings are how schemas are read, compared and written: the ignored
+	// collections and indexes, the style of the schema file and how indexes
+	// compare, along with the options of the connections made to individual
+	// members and the permissions of the files written. The zero value keeps
+	// the defaults. Their Client is always the client of New.
+	Settings migration.Settings
+	// Policies are evaluated against the changes of Diff and Apply, unless
+	// they set their own.
+	Policies []string
+
+	// Logger receives the logs of every operation, which are discarded
+	// when nil.
+	Logger *slog.Logger
+}
+
+// Client runs mondex operations against a database over a MongoDB client it
+// doesn't own: it is never disconnected.
+type Client struct {
+	client  *mongo.Client
+	options Options
+	logger  *slog.Logger
+}
+
+// New returns a Client using the connected MongoDB client.
+func New(client *mongo.Client, options Options) *Client {
+	logger := options.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	if options.Diff.Policies == nil {
+		options.Diff.Policies = options.Policies
+	}
+	if options.Apply.Policies == nil {
+		options.Apply.Policies = options.Policies
+	}
+	return &Client{client: client, options: options, logger: logger}
+}
+
+// settings returns the settings of the options with the client, which the
+// operations then use instead of connecting.
+func (c *Client) settings() migration.Settings {
+	settings := c.options.Settings
+	settings.Client = c.client
+	return settings
+}
+
+// diffOptions returns the options of Diff reading the schema file, the
+// database and the migration directory of the client.
+func (c *Client) diffOptions() migration.DiffOptions {
+	diffOptions := c.options.Diff
+	diffOptions.SchemaFilePath, diffOptions.MigrationDir = c.options.SchemaFilePath, c.options.MigrationDir
+	diffOptions.ReadOptions = c.options.ReadOptions
+	return diffOptions
+}
+
+// Inspect returns the current schema of the database, filtered and ordered
+// as the declared schema is.
+func (c *Client) Inspect(ctx context.Context) ([]schema.Schema, error) {
+	return migration.ReadCurrentSchema(
+		ctx, c.logger, c.settings(), c.options.MongoURI, c.options.DatabaseName, c.options.ReadOptions,
+	)
+}
+
+// Diff writes the migration named name to the migration directory, bringing
+// the database to the declared schema. Nothing is written when they match.
+func (c *Client) Diff(ctx context.Context, name string) error {
+	diffOptions := c.diffOptions()
+	diffOptions.MigrationName = name
+	return migration.GenerateMigrationScripts(ctx, c.logger, c.settings(), c.options.MongoURI, c.options.DatabaseName, diffOptions)
+}
+
+// Format rewrites the schema file in the configured style.
+func (c *Client) Format(ctx context.Context) error {
+	return migration.FormatSchemaFile(ctx, c.logger, c.settings(), c.options.SchemaFilePath, migration.FormatOptions{})
+}
+
+// Apply applies the pending migrations of the migration directory to the
+// database.
+func (c *Client) Apply(ctx context.Context) error {
+	return migration.ApplyMigrations(
+		ctx, c.logger, c.settings(), c.options.MongoURI, c.options.DatabaseName, c.options.MigrationDir, c.options.Apply,
+	)
+}
+
+// ApplyFS applies the pending migrations at the root of the file system,
+// e.g. embedded in the program with go:embed, instead of the migration
+// directory.
+func (c *Client) ApplyFS(ctx context.Context, migrations fs.FS) error {
+	return migration.ApplyMigrationsFS(
+		ctx, c.logger, c.settings(), c.options.MongoURI, c.options.DatabaseName, migrations, c.options.Apply,
+	)
+}
+
+// Check lists where the database differs from the declared schema, without
+// writing anything; none means it matches.
+func (c *Client) Check(ctx context.Context) ([]migration.SchemaDifference, error) {
+	diffOptions := c.diffOptions()
+	if diffOptions.ConfirmDrop == nil {
+		// Nothing is dropped: collections to drop are only reported.
+		diffOptions.ConfirmDrop = func([]string) bool { return true }
+	}
+	return migration.CheckSchema(ctx, c.logger, c.settings(), c.options.MongoURI, c.options.DatabaseName, diffOptions)
+}
@@ -0,0 +1,95 @@
+package mondex
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ltman/mondex/migration"
+)
+
+const testSchema = `[
+  {"collection": "users", "indexes": [{"name": "email_1", "key": {"email": 1}, "unique": true}]},
+  {"collection": "tmp_import", "indexes": [{"name": "id_1", "key": {"id": 1}}]}
+]
+`
+
+func writeTestSchema(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(testSchema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestClientFormatUsesItsOwnSettings(t *testing.T) {
+	ignoring := New(nil, Options{
+		SchemaFilePath: writeTestSchema(t),
+		Settings: migration.Settings{
+			IgnoredCollections: []string{"tmp_*"},
+			FormatStyle:        migration.FormatStyle{Indent: 4},
+		},
+	})
+	defaults := New(nil, Options{SchemaFilePath: writeTestSchema(t)})
+
+	// Clients with other settings run side by side without affecting each
+	// other.
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, client := range []*Client{ignoring, defaults} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = client.Format(context.Background())
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := readTestSchema(t, ignoring.options.SchemaFilePath)
+	if strings.Contains(got, "tmp_import") {
+		t.Errorf("ignored collection kept:\n%s", got)
+	}
+	if !strings.Contains(got, "\n    {") {
+		t.Errorf("want an indent of 4 spaces:\n%s", got)
+	}
+
+	got = readTestSchema(t, defaults.options.SchemaFilePath)
+	if !strings.Contains(got, "tmp_import") {
+		t.Errorf("collection not ignored by default dropped:\n%s", got)
+	}
+	if !strings.Contains(got, "\n  {") || strings.Contains(got, "\n    {") {
+		t.Errorf("want the default indent of 2 spaces:\n%s", got)
+	}
+}
+
+func TestClientRefusesInvalidSettings(t *testing.T) {
+	path := writeTestSchema(t)
+	client := New(nil, Options{
+		SchemaFilePath: path,
+		Settings:       migration.Settings{FormatStyle: migration.FormatStyle{Indent: 9}},
+	})
+	if err := client.Format(context.Background()); err == nil {
+		t.Fatal("Format succeeded with an indent of 9 spaces")
+	}
+	if got := readTestSchema(t, path); got != testSchema {
+		t.Errorf("schema file rewritten:\n%s", got)
+	}
+}
+
+func readTestSchema(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
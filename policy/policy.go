@@ -0,0 +1,138 @@
+// Package policy evaluates user-provided policies against the changes a diff
+// would generate or an apply would run. A policy reads an Input document as
+// JSON on stdin and prints a Decision as JSON. It is either a WebAssembly
+// module compiled for WASI, run in process and sandboxed, or an executable,
+// so rules can be written in any language, e.g. with `opa eval`.
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ltman/mondex/schema"
+)
+
+// Phases in which policies are evaluated.
+const (
+	PhaseDiff  = "diff"
+	PhaseApply = "apply"
+)
+
+// Change is a single effect of a migration command.
+type Change struct {
+	// Operation is createIndex, dropIndex or the name of any other command.
+	Operation  string        `json:"operation"`
+	Collection string        `json:"collection"`
+	IndexName  string        `json:"indexName,omitempty"`
+	Index      *schema.Index `json:"index,omitempty"`
+	// Role and User name the role or user changed by access control commands.
+	Role string `json:"role,omitempty"`
+	User string `json:"user,omitempty"`
+	// Version and Migration identify the migration during apply.
+	Version   uint64 `json:"version,omitempty"`
+	Migration string `json:"migration,omitempty"`
+}
+
+// Input is the document passed to every policy.
+type Input struct {
+	Phase    string    `json:"phase"`
+	Database string    `json:"database"`
+	Time     time.Time `json:"time"`
+	Changes  []Change  `json:"changes"`
+}
+
+// Decision is a policy's verdict. Any deny message vetoes the changes;
+// warnings annotate them.
+type Decision struct {
+	Deny []string `json:"deny"`
+	Warn []string `json:"warn"`
+}
+
+// DeniedError is returned when at least one policy denies the changes.
+type DeniedError struct {
+	Reasons []string
+}
+
+func (e *DeniedError) Error() string {
+	return "denied by policy: " + strings.Join(e.Reasons, "; ")
+}
+
+// Evaluate runs every policy and merges their decisions. Each policy is split
+// on whitespace into a module or executable and its arguments; modules are
+// the files with the .wasm extension.
+func Evaluate(ctx context.Context, policies []string, input Input) (Decision, error) {
+	var merged Decision
+	if len(policies) == 0 || len(input.Changes) == 0 {
+		return merged, nil
+	}
+
+	stdin, err := json.Marshal(input)
+	if err != nil {
+		return merged, fmt.Errorf("encoding policy input: %w", err)
+	}
+
+	var wasm *wasmRuntime
+	defer func() {
+		if wasm != nil {
+			wasm.close(ctx)
+		}
+	}()
+
+	for _, policy := range policies {
+		fields := strings.Fields(policy)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var stdout []byte
+		if isWASM(fields[0]) {
+			if wasm == nil {
+				if wasm, err = newWASMRuntime(ctx); err != nil {
+					return merged, err
+				}
+			}
+			stdout, err = wasm.run(ctx, fields[0], fields[1:], stdin)
+		} else {
+			stdout, err = runExecutable(ctx, fields[0], fields[1:], stdin)
+		}
+		if err != nil {
+			return merged, fmt.Errorf("policy %s: %w", fields[0], err)
+		}
+
+		var decision Decision
+		if err := json.Unmarshal(stdout, &decision); err != nil {
+			return merged, fmt.Errorf("policy %s: decoding decision: %w", fields[0], err)
+		}
+		merged.Deny = append(merged.Deny, decision.Deny...)
+		merged.Warn = append(merged.Warn, decision.Warn...)
+	}
+
+	return merged, nil
+}
+
+// runExecutable runs the executable with the arguments and input on stdin,
+// and returns what it prints on stdout.
+func runExecutable(ctx context.Context, name string, args []string, stdin []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...) //nolint:gosec // policies are commands the user configured
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Err returns a DeniedError when the decision denies the changes.
+func (d Decision) Err() error {
+	if len(d.Deny) == 0 {
+		return nil
+	}
+	return &DeniedError{Reasons: d.Deny}
+}
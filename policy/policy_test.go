@@ -0,0 +1,75 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// buildModule compiles the policy command of testdata to a WASI module.
+func buildModule(t *testing.T, name string) string {
+	t.Helper()
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go isn't installed to build the module")
+	}
+	module := filepath.Join(t.TempDir(), name+wasmExtension)
+	build := exec.Command(goBin, "build", "-o", module, "./testdata/"+name)
+	build.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("building %s: %v\n%s", name, err, output)
+	}
+	return module
+}
+
+func TestEvaluateWASMPolicy(t *testing.T) {
+	module := buildModule(t, "denydrops")
+	input := Input{
+		Phase:    PhaseDiff,
+		Database: "app",
+		Changes: []Change{
+			{Operation: "createIndex", Collection: "users", IndexName: "email_1"},
+			{Operation: "dropIndex", Collection: "users", IndexName: "legacy_1"},
+		},
+	}
+
+	decision, err := Evaluate(context.Background(), []string{module}, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"diff: dropIndex users.legacy_1"}; !slices.Equal(decision.Deny, want) {
+		t.Errorf("denied %q, want %q", decision.Deny, want)
+	}
+	if want := []string{"diff: createIndex users.email_1"}; !slices.Equal(decision.Warn, want) {
+		t.Errorf("warned %q, want %q", decision.Warn, want)
+	}
+	var denied *DeniedError
+	if !errors.As(decision.Err(), &denied) {
+		t.Errorf("want a DeniedError, got %v", decision.Err())
+	}
+
+	// Modules get their arguments, and run once per policy.
+	decision, err = Evaluate(context.Background(), []string{module + " first", module + " second"}, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"first: dropIndex users.legacy_1", "second: dropIndex users.legacy_1"}
+	if !slices.Equal(decision.Deny, want) {
+		t.Errorf("denied %q, want %q", decision.Deny, want)
+	}
+}
+
+func TestEvaluateWASMPolicyFailure(t *testing.T) {
+	module := filepath.Join(t.TempDir(), "invalid"+wasmExtension)
+	if err := os.WriteFile(module, []byte("not a module"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	input := Input{Phase: PhaseApply, Changes: []Change{{Operation: "dropIndex", Collection: "users"}}}
+	if _, err := Evaluate(context.Background(), []string{module}, input); err == nil {
+		t.Error("invalid module evaluated")
+	}
+}
@@ -0,0 +1,47 @@
+// Command denydrops is a policy denying dropped indexes and warning about
+// created ones, built for WASI by the tests.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+func main() {
+	var input struct {
+		Phase   string `json:"phase"`
+		Changes []struct {
+			Operation  string `json:"operation"`
+			Collection string `json:"collection"`
+			IndexName  string `json:"indexName"`
+		} `json:"changes"`
+	}
+	if err := json.NewDecoder(os.Stdin).Decode(&input); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// The arguments after the module name prefix the messages.
+	prefix := input.Phase
+	if len(os.Args) > 1 {
+		prefix = os.Args[1]
+	}
+
+	decision := struct {
+		Deny []string `json:"deny"`
+		Warn []string `json:"warn"`
+	}{}
+	for _, change := range input.Changes {
+		message := fmt.Sprintf("%s: %s %s.%s", prefix, change.Operation, change.Collection, change.IndexName)
+		switch change.Operation {
+		case "dropIndex":
+			decision.Deny = append(decision.Deny, message)
+		case "createIndex":
+			decision.Warn = append(decision.Warn, message)
+		}
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(decision); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,97 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// wasmExtension marks policies that are WebAssembly modules, which are run in
+// process rather than as executables.
+const wasmExtension = ".wasm"
+
+// isWASM reports whether the policy executable is a WebAssembly module.
+func isWASM(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), wasmExtension)
+}
+
+// wasmRuntime runs WebAssembly policies. Modules are sandboxed: they get the
+// input on stdin and their arguments, but no file system, environment or
+// network, and are stopped when the context is done.
+type wasmRuntime struct {
+	runtime wazero.Runtime
+	// compiled are the modules compiled so far by path, for policies
+	// configured more than once with other arguments.
+	compiled map[string]wazero.CompiledModule
+}
+
+// newWASMRuntime returns a runtime providing WASI, which the modules import.
+func newWASMRuntime(ctx context.Context) (*wasmRuntime, error) {
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		_ = runtime.Close(ctx)
+		return nil, fmt.Errorf("instantiating WASI: %w", err)
+	}
+	return &wasmRuntime{runtime: runtime, compiled: make(map[string]wazero.CompiledModule)}, nil
+}
+
+// run runs the WASI command module at path with the arguments and input on
+// stdin, and returns what it prints on stdout.
+func (r *wasmRuntime) run(ctx context.Context, path string, args []string, stdin []byte) ([]byte, error) {
+	compiled, err := r.compile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(append([]string{path}, args...)...).
+		WithStdin(bytes.NewReader(stdin)).
+		WithStdout(&stdout).
+		WithStderr(&stderr)
+
+	module, err := r.runtime.InstantiateModule(ctx, compiled, config)
+	if module != nil {
+		_ = module.Close(ctx)
+	}
+	// Commands such as Go programs exit when done, successfully with 0.
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// compile compiles the module at path, once.
+func (r *wasmRuntime) compile(ctx context.Context, path string) (wazero.CompiledModule, error) {
+	if compiled, ok := r.compiled[path]; ok {
+		return compiled, nil
+	}
+	binary, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading module: %w", err)
+	}
+	compiled, err := r.runtime.CompileModule(ctx, binary)
+	if err != nil {
+		return nil, fmt.Errorf("compiling module: %w", err)
+	}
+	r.compiled[path] = compiled
+	return compiled, nil
+}
+
+// close releases the runtime and the modules compiled by it.
+func (r *wasmRuntime) close(ctx context.Context) {
+	_ = r.runtime.Close(ctx)
+}
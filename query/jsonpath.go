@@ -0,0 +1,548 @@
+// Package query implements a subset of JSONPath evaluated over BSON values,
+// so queries on a schema keep extended JSON types intact.
+//
+// Supported syntax:
+//
+//	$                 the root
+//	.name ['name']    child field
+//	[0] [*] .*        array element, all elements or fields
+//	..name            recursive descent
+//	[?(@.a == 1)]     filter, with ==, !=, <, <=, >, >=, && and ||;
+//	                  [?(@.a)] keeps elements where the field exists
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Path is a compiled query.
+type Path struct {
+	steps []step
+}
+
+type stepKind int
+
+const (
+	stepField stepKind = iota
+	stepIndex
+	stepWildcard
+	stepDescend
+	stepFilter
+)
+
+type step struct {
+	kind   stepKind
+	field  string
+	index  int
+	filter expr
+}
+
+// Compile parses a JSONPath expression.
+func Compile(expression string) (*Path, error) {
+	p := &parser{input: strings.TrimSpace(expression)}
+	steps, err := p.parsePath(true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query %q: %w", expression, err)
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("invalid query %q: unexpected %q at offset %d", expression, p.rest(), p.pos)
+	}
+	return &Path{steps: steps}, nil
+}
+
+// Evaluate returns the values matched by the path, in document order.
+func (p *Path) Evaluate(root any) []any {
+	return evaluate(p.steps, []any{root})
+}
+
+func evaluate(steps []step, nodes []any) []any {
+	for _, s := range steps {
+		var next []any
+		for _, node := range nodes {
+			next = append(next, s.apply(node)...)
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+func (s step) apply(node any) []any {
+	switch s.kind {
+	case stepField:
+		if v, ok := field(node, s.field); ok {
+			return []any{v}
+		}
+	case stepIndex:
+		if arr, ok := node.(bson.A); ok {
+			i := s.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i >= 0 && i < len(arr) {
+				return []any{arr[i]}
+			}
+		}
+	case stepWildcard:
+		return children(node)
+	case stepDescend:
+		return descendants(node, s.field)
+	case stepFilter:
+		var matched []any
+		for _, child := range children(node) {
+			if truthy(s.filter.eval(child)) {
+				matched = append(matched, child)
+			}
+		}
+		return matched
+	}
+	return nil
+}
+
+func field(node any, name string) (any, bool) {
+	switch doc := node.(type) {
+	case bson.D:
+		for _, e := range doc {
+			if e.Key == name {
+				return e.Value, true
+			}
+		}
+	case bson.M:
+		v, ok := doc[name]
+		return v, ok
+	}
+	return nil, false
+}
+
+func children(node any) []any {
+	switch n := node.(type) {
+	case bson.A:
+		return slices.Clone(n)
+	case bson.D:
+		values := make([]any, 0, len(n))
+		for _, e := range n {
+			values = append(values, e.Value)
+		}
+		return values
+	}
+	return nil
+}
+
+// descendants returns the named fields of the node and all nodes below it.
+func descendants(node any, name string) []any {
+	var found []any
+	if v, ok := field(node, name); ok {
+		found = append(found, v)
+	}
+	for _, child := range children(node) {
+		found = append(found, descendants(child, name)...)
+	}
+	return found
+}
+
+// expr is a filter expression evaluated against the current element (@).
+type expr interface {
+	eval(current any) any
+}
+
+type pathExpr struct{ steps []step }
+
+// missing marks a path that doesn't resolve, which is distinct from null.
+type missing struct{}
+
+func (e pathExpr) eval(current any) any {
+	values := evaluate(e.steps, []any{current})
+	if len(values) == 0 {
+		return missing{}
+	}
+	return values[0]
+}
+
+type literalExpr struct{ value any }
+
+func (e literalExpr) eval(any) any { return e.value }
+
+type binaryExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e binaryExpr) eval(current any) any {
+	switch e.op {
+	case "&&":
+		return truthy(e.left.eval(current)) && truthy(e.right.eval(current))
+	case "||":
+		return truthy(e.left.eval(current)) || truthy(e.right.eval(current))
+	}
+
+	l, r := e.left.eval(current), e.right.eval(current)
+	if _, ok := l.(missing); ok {
+		return false
+	}
+	if _, ok := r.(missing); ok {
+		return false
+	}
+
+	c, comparable := compare(l, r)
+	switch e.op {
+	case "==":
+		return comparable && c == 0
+	case "!=":
+		return !comparable || c != 0
+	case "<":
+		return comparable && c < 0
+	case "<=":
+		return comparable && c <= 0
+	case ">":
+		return comparable && c > 0
+	case ">=":
+		return comparable && c >= 0
+	}
+	return false
+}
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case missing:
+		return false
+	case bool:
+		return v
+	default:
+		return true
+	}
+}
+
+// compare orders two scalar values, treating all numeric BSON types alike.
+func compare(a, b any) (int, bool) {
+	if af, ok := number(a); ok {
+		if bf, ok := number(b); ok {
+			switch {
+			case af < bf:
+				return -1, true
+			case af > bf:
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+
+	switch av := a.(type) {
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), true
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			if av == bv {
+				return 0, true
+			}
+			return 1, true
+		}
+	case nil, primitive.Null:
+		switch b.(type) {
+		case nil, primitive.Null:
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(n.String(), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) done() bool   { return p.pos >= len(p.input) }
+func (p *parser) rest() string { return p.input[p.pos:] }
+
+func (p *parser) peek(s string) bool {
+	return strings.HasPrefix(p.rest(), s)
+}
+
+func (p *parser) consume(s string) bool {
+	if p.peek(s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *parser) skipSpaces() {
+	for !p.done() && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// parsePath parses steps after the root ($ at the top level, @ inside filters).
+func (p *parser) parsePath(top bool) ([]step, error) {
+	root := "$"
+	if !top {
+		root = "@"
+	}
+	if !p.consume(root) {
+		return nil, fmt.Errorf("expected %q at offset %d", root, p.pos)
+	}
+
+	var steps []step
+	for !p.done() {
+		switch {
+		case p.consume(".."):
+			name := p.identifier()
+			if name == "" {
+				return nil, fmt.Errorf("expected field name after '..' at offset %d", p.pos)
+			}
+			steps = append(steps, step{kind: stepDescend, field: name})
+		case p.consume(".*"):
+			steps = append(steps, step{kind: stepWildcard})
+		case p.consume("."):
+			name := p.identifier()
+			if name == "" {
+				return nil, fmt.Errorf("expected field name at offset %d", p.pos)
+			}
+			steps = append(steps, step{kind: stepField, field: name})
+		case p.peek("["):
+			s, err := p.parseBracket()
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, s)
+		default:
+			return steps, nil
+		}
+	}
+	return steps, nil
+}
+
+func (p *parser) parseBracket() (step, error) {
+	p.consume("[")
+	p.skipSpaces()
+
+	var s step
+	switch {
+	case p.consume("*"):
+		s = step{kind: stepWildcard}
+	case p.consume("?("):
+		filter, err := p.parseOr()
+		if err != nil {
+			return step{}, err
+		}
+		p.skipSpaces()
+		if !p.consume(")") {
+			return step{}, fmt.Errorf("expected ')' at offset %d", p.pos)
+		}
+		s = step{kind: stepFilter, filter: filter}
+	case p.peek("'") || p.peek(`"`):
+		name, err := p.quoted()
+		if err != nil {
+			return step{}, err
+		}
+		s = step{kind: stepField, field: name}
+	default:
+		start := p.pos
+		if p.peek("-") {
+			p.pos++
+		}
+		for !p.done() && unicode.IsDigit(rune(p.input[p.pos])) {
+			p.pos++
+		}
+		index, err := strconv.Atoi(p.input[start:p.pos])
+		if err != nil {
+			return step{}, fmt.Errorf("expected index, '*', filter or quoted field at offset %d", start)
+		}
+		s = step{kind: stepIndex, index: index}
+	}
+
+	p.skipSpaces()
+	if !p.consume("]") {
+		return step{}, fmt.Errorf("expected ']' at offset %d", p.pos)
+	}
+	return s, nil
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if !p.consume("||") {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: "||", left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if !p.consume("&&") {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(op) {
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return binaryExpr{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseOperand() (expr, error) {
+	p.skipSpaces()
+
+	switch {
+	case p.consume("("):
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if !p.consume(")") {
+			return nil, fmt.Errorf("expected ')' at offset %d", p.pos)
+		}
+		return inner, nil
+	case p.peek("@"):
+		steps, err := p.parsePath(false)
+		if err != nil {
+			return nil, err
+		}
+		return pathExpr{steps: steps}, nil
+	case p.peek("'") || p.peek(`"`):
+		s, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		return literalExpr{value: s}, nil
+	case p.consume("true"):
+		return literalExpr{value: true}, nil
+	case p.consume("false"):
+		return literalExpr{value: false}, nil
+	case p.consume("null"):
+		return literalExpr{value: nil}, nil
+	}
+
+	start := p.pos
+	for !p.done() && strings.ContainsRune("+-.eE0123456789", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	n, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return nil, fmt.Errorf("expected operand at offset %d", start)
+	}
+	return literalExpr{value: n}, nil
+}
+
+func (p *parser) identifier() string {
+	start := p.pos
+	for !p.done() {
+		r := rune(p.input[p.pos])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '$' && r != '-' {
+			break
+		}
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *parser) quoted() (string, error) {
+	quote := p.input[p.pos]
+	end := strings.IndexByte(p.input[p.pos+1:], quote)
+	if end < 0 {
+		return "", fmt.Errorf("unterminated string at offset %d", p.pos)
+	}
+	s := p.input[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+	return s, nil
+}
+
+// Document converts a Go value to the BSON values a path is evaluated over,
+// using the value's bson tags.
+func Document(v any) (any, error) {
+	raw, err := bson.Marshal(bson.D{{Key: "v", Value: v}})
+	if err != nil {
+		return nil, err
+	}
+
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return doc[0].Value, nil
+}
+
+// MarshalJSON renders query results as an indented array of relaxed extended JSON.
+func MarshalJSON(values []any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, value := range values {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		data, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: value}}, false, false)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(bytes.TrimSuffix(bytes.TrimPrefix(data, []byte(`{"v":`)), []byte("}")))
+	}
+	buf.WriteByte(']')
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
@@ -0,0 +1,178 @@
+package schema
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// Access declares the users and custom roles of a database. Users are
+// identified by name only: passwords are never part of it.
+type Access struct {
+	Users []User `json:"users,omitempty"`
+	Roles []Role `json:"roles,omitempty"`
+}
+
+// User grants roles to a database user.
+type User struct {
+	User  string    `json:"user" bson:"user"`
+	Roles []RoleRef `json:"roles" bson:"roles"`
+}
+
+// RoleRef names a role of a database. An empty DB is the database of the
+// access file.
+type RoleRef struct {
+	Role string `json:"role" bson:"role"`
+	DB   string `json:"db,omitempty" bson:"db"`
+}
+
+// Role is a custom role defined in the database.
+type Role struct {
+	Role       string      `json:"role" bson:"role"`
+	Privileges []Privilege `json:"privileges" bson:"privileges"`
+	Roles      []RoleRef   `json:"roles" bson:"roles"`
+}
+
+// Privilege allows actions on a resource.
+type Privilege struct {
+	Resource Resource `json:"resource" bson:"resource"`
+	Actions  []string `json:"actions" bson:"actions"`
+}
+
+// Resource is a database and collection, where empty strings match all of
+// them, or the cluster or any resource.
+type Resource struct {
+	DB          *string `json:"db,omitempty" bson:"db,omitempty"`
+	Collection  *string `json:"collection,omitempty" bson:"collection,omitempty"`
+	Cluster     bool    `json:"cluster,omitempty" bson:"cluster,omitempty"`
+	AnyResource bool    `json:"anyResource,omitempty" bson:"anyResource,omitempty"`
+}
+
+// passwordFields are user fields refused so passwords stay out of version
+// control.
+var passwordFields = []string{"pwd", "password"}
+
+// ParseAccess decodes an access file, failing on unknown fields and on
+// passwords.
+func ParseAccess(data []byte) (Access, error) {
+	var raw struct {
+		Users []map[string]json.RawMessage `json:"users"`
+	}
+	if err := json.Unmarshal(data, &raw); err == nil {
+		for i, user := range raw.Users {
+			for _, field := range passwordFields {
+				if _, ok := user[field]; ok {
+					return Access{}, fmt.Errorf("users[%d]: %s isn't allowed, passwords are set outside mondex", i, field)
+				}
+			}
+		}
+	}
+
+	var access Access
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&access); err != nil {
+		return Access{}, err
+	}
+
+	for i, user := range access.Users {
+		if user.User == "" {
+			return Access{}, fmt.Errorf("users[%d]: user name is required", i)
+		}
+	}
+	for i, role := range access.Roles {
+		if role.Role == "" {
+			return Access{}, fmt.Errorf("roles[%d]: role name is required", i)
+		}
+	}
+	return access, nil
+}
+
+// Canonical returns the access with role references completed with the
+// database and every list sorted, so declarations compare equal to what the
+// server reports.
+func (a Access) Canonical(database string) Access {
+	// A section left out stays nil: it isn't managed.
+	var canonical Access
+	if a.Users != nil {
+		canonical.Users = make([]User, 0, len(a.Users))
+	}
+	if a.Roles != nil {
+		canonical.Roles = make([]Role, 0, len(a.Roles))
+	}
+	for _, user := range a.Users {
+		user.Roles = canonicalRoleRefs(user.Roles, database)
+		canonical.Users = append(canonical.Users, user)
+	}
+	for _, role := range a.Roles {
+		canonical.Roles = append(canonical.Roles, role.canonical(database))
+	}
+	slices.SortFunc(canonical.Users, func(a, b User) int { return cmp.Compare(a.User, b.User) })
+	slices.SortFunc(canonical.Roles, func(a, b Role) int { return cmp.Compare(a.Role, b.Role) })
+	return canonical
+}
+
+// Equal reports whether the roles grant the same privileges and roles. Both
+// are expected in canonical form.
+func (r Role) Equal(other Role) bool {
+	return reflect.DeepEqual(r, other)
+}
+
+func (r Role) canonical(database string) Role {
+	r.Roles = canonicalRoleRefs(r.Roles, database)
+	privileges := make([]Privilege, 0, len(r.Privileges))
+	for _, p := range r.Privileges {
+		p.Resource = p.Resource.canonical()
+		p.Actions = slices.Sorted(slices.Values(p.Actions))
+		privileges = append(privileges, p)
+	}
+	slices.SortFunc(privileges, func(a, b Privilege) int {
+		return cmp.Compare(a.Resource.String(), b.Resource.String())
+	})
+	r.Privileges = privileges
+	return r
+}
+
+func canonicalRoleRefs(refs []RoleRef, database string) []RoleRef {
+	canonical := make([]RoleRef, 0, len(refs))
+	for _, ref := range refs {
+		ref.DB = cmp.Or(ref.DB, database)
+		canonical = append(canonical, ref)
+	}
+	slices.SortFunc(canonical, func(a, b RoleRef) int {
+		return cmp.Or(cmp.Compare(a.DB, b.DB), cmp.Compare(a.Role, b.Role))
+	})
+	return slices.Compact(canonical)
+}
+
+// canonical spells out the empty db or collection of a database resource,
+// as the server reports them.
+func (r Resource) canonical() Resource {
+	if r.Cluster || r.AnyResource {
+		return r
+	}
+	empty := ""
+	r.DB = cmp.Or(r.DB, &empty)
+	r.Collection = cmp.Or(r.Collection, &empty)
+	return r
+}
+
+// String renders the resource, e.g. "app.users", "app.*" or "cluster".
+func (r Resource) String() string {
+	switch {
+	case r.Cluster:
+		return "cluster"
+	case r.AnyResource:
+		return "anyResource"
+	}
+	deref := func(s *string) string {
+		if s == nil || *s == "" {
+			return "*"
+		}
+		return *s
+	}
+	return deref(r.DB) + "." + deref(r.Collection)
+}
@@ -0,0 +1,143 @@
+package schema
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// defaultLanguageOverride is the field text indexes read the language from
+// unless told otherwise.
+const defaultLanguageOverride = "language"
+
+// Anonymize replaces the names of collections, fields and indexes, and the
+// strings of partial filters, by hashes, so the schema can be shared to
+// reproduce a problem without revealing the data model. The same name always
+// hashes the same, so the structure, types and options are kept: an index on
+// a field of another index still shares it. Owners, descriptions and meta are
+// left out.
+func Anonymize(schemas []Schema) []Schema {
+	anonymized := make([]Schema, 0, len(schemas))
+	for _, s := range schemas {
+		a := Schema{Collection: anonymousName("c", s.Collection), GridFS: s.GridFS, Indexes: make([]Index, 0, len(s.Indexes))}
+		for _, index := range s.Indexes {
+			a.Indexes = append(a.Indexes, index.anonymize())
+		}
+		anonymized = append(anonymized, a)
+	}
+	return anonymized
+}
+
+func (i Index) anonymize() Index {
+	a := i.WithoutAnnotations()
+	a.Key = anonymizeKeys(i.Key)
+	if i.Name == DefaultIndexName(i.Key) {
+		a.Name = DefaultIndexName(a.Key)
+	} else {
+		a.Name = anonymousName("i", i.Name)
+	}
+	a.Weights = anonymizeKeys(i.Weights)
+	if i.LanguageOverride != "" && i.LanguageOverride != defaultLanguageOverride {
+		a.LanguageOverride = anonymousPath(i.LanguageOverride)
+	}
+	a.PartialFilterExpression = anonymizeFilter(i.PartialFilterExpression)
+	a.WildcardProjection = anonymizeProjection(i.WildcardProjection)
+	a.ColumnstoreProjection = anonymizeProjection(i.ColumnstoreProjection)
+	return a
+}
+
+func anonymizeKeys(keys bson.D) bson.D {
+	if keys == nil {
+		return nil
+	}
+	anonymized := make(bson.D, 0, len(keys))
+	for _, e := range keys {
+		anonymized = append(anonymized, bson.E{Key: anonymousPath(e.Key), Value: e.Value})
+	}
+	return anonymized
+}
+
+func anonymizeProjection(projection bson.M) bson.M {
+	if projection == nil {
+		return nil
+	}
+	anonymized := make(bson.M, len(projection))
+	for path, value := range projection {
+		anonymized[anonymousPath(path)] = value
+	}
+	return anonymized
+}
+
+// anonymizeFilter hashes the fields and strings of a query, keeping its
+// operators.
+func anonymizeFilter(filter bson.M) bson.M {
+	if filter == nil {
+		return nil
+	}
+	anonymized := make(bson.M, len(filter))
+	for key, value := range filter {
+		anonymized[anonymousPath(key)] = anonymizeOperand(key, value)
+	}
+	return anonymized
+}
+
+// anonymizeOperand anonymizes the value of a field or operator, keeping the
+// type names of $type.
+func anonymizeOperand(key string, value any) any {
+	if key == "$type" {
+		return value
+	}
+	return anonymizeValue(value)
+}
+
+func anonymizeValue(value any) any {
+	switch v := value.(type) {
+	case string:
+		return anonymousName("v", v)
+	case bson.M:
+		return anonymizeFilter(v)
+	case bson.D:
+		anonymized := make(bson.D, 0, len(v))
+		for _, e := range v {
+			anonymized = append(anonymized, bson.E{Key: anonymousPath(e.Key), Value: anonymizeOperand(e.Key, e.Value)})
+		}
+		return anonymized
+	case bson.A:
+		anonymized := make(bson.A, 0, len(v))
+		for _, e := range v {
+			anonymized = append(anonymized, anonymizeValue(e))
+		}
+		return anonymized
+	}
+	return value
+}
+
+// revealingNothing are the fields kept as they are: _id and the internal
+// fields of text indexes.
+var revealingNothing = []string{"_id", "_fts", "_ftsx"}
+
+// anonymousPath hashes every field of a dotted path, keeping operators,
+// wildcards, array positions and the fields revealing nothing.
+func anonymousPath(path string) string {
+	fields := strings.Split(path, ".")
+	for i, field := range fields {
+		if strings.HasPrefix(field, "$") || slices.Contains(revealingNothing, field) || isPosition(field) {
+			continue
+		}
+		fields[i] = anonymousName("f", field)
+	}
+	return strings.Join(fields, ".")
+}
+
+func isPosition(field string) bool {
+	return field != "" && strings.Trim(field, "0123456789") == ""
+}
+
+// anonymousName hashes name into an identifier with the given prefix.
+func anonymousName(prefix, name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return prefix + "_" + hex.EncodeToString(sum[:])[:10]
+}
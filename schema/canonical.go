@@ -0,0 +1,216 @@
+package schema
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Canonical returns the index with its projections and storage engine options
+// in canonical form, so an index declared by hand compares equal to the one
+// the server reports.
+func (i Index) Canonical() Index {
+	i.WildcardProjection = canonicalProjection(i.WildcardProjection)
+	i.ColumnstoreProjection = canonicalProjection(i.ColumnstoreProjection)
+	i.StorageEngine = canonicalStorageEngine(i.StorageEngine)
+	return i
+}
+
+// DefaultIndexName is the name the server gives an index that isn't named,
+// e.g. "user_id_1_created_at_-1". Key values are written as numbers, so 1 and
+// 1.0 give the same name.
+func DefaultIndexName(key bson.D) string {
+	parts := make([]string, 0, 2*len(key))
+	for _, e := range key {
+		parts = append(parts, e.Key, fmt.Sprint(e.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+// Equal reports whether the indexes are the same once canonicalized, compared
+// as DefaultComparison does.
+func (i Index) Equal(other Index) bool {
+	return i.EqualWith(other, DefaultComparison)
+}
+
+// EqualWith reports whether the indexes are the same once canonicalized,
+// compared as c sets.
+func (i Index) EqualWith(other Index, c Comparison) bool {
+	a, aErr := canonicalDocument(i, c)
+	b, bErr := canonicalDocument(other, c)
+	return aErr == nil && bErr == nil && reflect.DeepEqual(a, b)
+}
+
+// canonicalProjection flattens nested documents into dotted paths and
+// normalizes inclusions to 1 and exclusions to 0, as the server does.
+func canonicalProjection(projection bson.M) bson.M {
+	if len(projection) == 0 {
+		return projection
+	}
+	canonical := make(bson.M, len(projection))
+	flattenProjection(canonical, "", projection)
+	return canonical
+}
+
+func flattenProjection(canonical bson.M, prefix string, v any) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+
+	switch v := v.(type) {
+	case bson.M:
+		for key, value := range v {
+			flattenProjection(canonical, join(key), value)
+		}
+	case bson.D:
+		for _, e := range v {
+			flattenProjection(canonical, join(e.Key), e.Value)
+		}
+	default:
+		canonical[prefix] = projectionValue(v)
+	}
+}
+
+// canonicalStorageEngine sorts the options of the configString of every
+// storage engine and trims the spaces around them, so options declared in any
+// order and spacing compare equal to those the server reports.
+func canonicalStorageEngine(storageEngine bson.M) bson.M {
+	if len(storageEngine) == 0 {
+		return storageEngine
+	}
+
+	canonical := make(bson.M, len(storageEngine))
+	for engine, options := range storageEngine {
+		switch options := options.(type) {
+		case bson.M:
+			copied := maps.Clone(options)
+			if config, ok := copied["configString"].(string); ok {
+				copied["configString"] = canonicalConfigString(config)
+			}
+			canonical[engine] = copied
+		case bson.D:
+			copied := slices.Clone(options)
+			for j, e := range copied {
+				if config, ok := e.Value.(string); ok && e.Key == "configString" {
+					copied[j].Value = canonicalConfigString(config)
+				}
+			}
+			canonical[engine] = copied
+		default:
+			canonical[engine] = options
+		}
+	}
+	return canonical
+}
+
+// canonicalConfigString sorts the comma-separated options of a WiredTiger
+// configuration string, leaving the commas nested in parentheses alone.
+func canonicalConfigString(config string) string {
+	var options []string
+	depth, start := 0, 0
+	for j, r := range config {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				options = append(options, config[start:j])
+				start = j + 1
+			}
+		}
+	}
+	options = append(options, config[start:])
+
+	canonical := make([]string, 0, len(options))
+	for _, option := range options {
+		if option = strings.TrimSpace(option); option != "" {
+			canonical = append(canonical, strings.ReplaceAll(option, " = ", "="))
+		}
+	}
+	slices.Sort(canonical)
+	return strings.Join(canonical, ",")
+}
+
+func projectionValue(v any) any {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return int32(1)
+		}
+		return int32(0)
+	case int32, int64, float64:
+		if normalizeNumber(v) == 0.0 {
+			return int32(0)
+		}
+		return int32(1)
+	default:
+		return v
+	}
+}
+
+// canonicalDocument converts the index to a document whose nested documents,
+// except the key unless its order is relaxed, are sorted by field name and
+// whose numbers are float64.
+func canonicalDocument(i Index, c Comparison) (bson.D, error) {
+	if c.IgnoreStorageEngine {
+		i.StorageEngine = nil
+	}
+	// Servers ignore background since 4.2, some still report it.
+	i.Background = false
+	raw, err := bson.Marshal(i.WithoutAnnotations().Canonical())
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	for j, e := range doc {
+		doc[j].Value = canonicalValue(e.Value, e.Key != "key" || c.KeyOrder == KeyOrderRelaxed)
+	}
+	return doc, nil
+}
+
+func canonicalValue(v any, sortFields bool) any {
+	switch v := v.(type) {
+	case bson.D:
+		doc := make(bson.D, 0, len(v))
+		for _, e := range v {
+			doc = append(doc, bson.E{Key: e.Key, Value: canonicalValue(e.Value, true)})
+		}
+		if sortFields {
+			slices.SortFunc(doc, func(a, b bson.E) int { return cmp.Compare(a.Key, b.Key) })
+		}
+		return doc
+	case bson.A:
+		array := make(bson.A, 0, len(v))
+		for _, element := range v {
+			array = append(array, canonicalValue(element, true))
+		}
+		return array
+	default:
+		return normalizeNumber(v)
+	}
+}
+
+func normalizeNumber(v any) any {
+	switch v := v.(type) {
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	default:
+		return v
+	}
+}
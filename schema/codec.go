@@ -0,0 +1,111 @@
+package schema
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Codec converts schema files written in a format to and from JSON, which
+// schemas are parsed from and written as. Registered codecs are picked by the
+// extension of the schema file.
+type Codec struct {
+	// Name names the format, e.g. for format --to.
+	Name string
+	// Extensions are the file extensions of the format, with the dot; the
+	// first is given to files converted to it.
+	Extensions []string
+	// ToJSON converts a schema file to JSON, keeping the order of object
+	// members, which is significant for index keys.
+	ToJSON func(data []byte) ([]byte, error)
+	// FromJSON converts a JSON schema file to the format, indented by the
+	// given number of spaces.
+	FromJSON func(data []byte, indent int) ([]byte, error)
+}
+
+// JSONCodec is the codec of JSON schema files, which need no conversion.
+// Files of unregistered extensions are JSON.
+var JSONCodec = Codec{
+	Name:       "json",
+	Extensions: []string{".json"},
+	ToJSON:     func(data []byte) ([]byte, error) { return data, nil },
+	FromJSON:   func(data []byte, _ int) ([]byte, error) { return data, nil },
+}
+
+// IsJSON reports whether the codec is JSONCodec, whose files are read and
+// written without conversion.
+func (c Codec) IsJSON() bool {
+	return c.Name == JSONCodec.Name
+}
+
+var (
+	codecsMu sync.RWMutex
+	// codecs are the registered codecs by name, and codecExtensions their
+	// names by lowercase extension.
+	codecs          = map[string]Codec{}
+	codecExtensions = map[string]string{}
+)
+
+// RegisterCodec makes the codec read and write the schema files of its
+// extensions. It panics when its name or one of its extensions is registered
+// already.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	if c.Name == "" || len(c.Extensions) == 0 || c.ToJSON == nil || c.FromJSON == nil {
+		panic(fmt.Sprintf("schema: incomplete codec %q", c.Name))
+	}
+	if _, ok := codecs[c.Name]; ok {
+		panic(fmt.Sprintf("schema: codec %q registered twice", c.Name))
+	}
+	for _, ext := range c.Extensions {
+		if name, ok := codecExtensions[strings.ToLower(ext)]; ok {
+			panic(fmt.Sprintf("schema: extension %s of codec %q registered by %q", ext, c.Name, name))
+		}
+	}
+
+	codecs[c.Name] = c
+	for _, ext := range c.Extensions {
+		codecExtensions[strings.ToLower(ext)] = c.Name
+	}
+}
+
+// CodecFor returns the codec of the schema file at path by its extension,
+// JSONCodec when none is registered for it.
+func CodecFor(path string) Codec {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	if name, ok := codecExtensions[strings.ToLower(filepath.Ext(path))]; ok {
+		return codecs[name]
+	}
+	return JSONCodec
+}
+
+// CodecNamed returns the registered codec with the name.
+func CodecNamed(name string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[name]
+	return c, ok
+}
+
+// CodecNames returns the names of the registered codecs, sorted.
+func CodecNames() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	return slices.Sorted(maps.Keys(codecs))
+}
+
+// The formats mondex reads and writes out of the box register like any other.
+func init() {
+	RegisterCodec(JSONCodec)
+	RegisterCodec(YAMLCodec)
+	RegisterCodec(HCLCodec)
+}
@@ -0,0 +1,62 @@
+package schema
+
+import (
+	"encoding/base64"
+	"slices"
+	"testing"
+)
+
+func TestCodecFor(t *testing.T) {
+	for path, want := range map[string]string{
+		"schema.json":      "json",
+		"schema.yaml":      "yaml",
+		"dir/schema.YML":   "yaml",
+		"schema.hcl":       "hcl",
+		"schema":           "json",
+		"schema.unknown":   "json",
+		"schema.yaml.json": "json",
+	} {
+		if got := CodecFor(path).Name; got != want {
+			t.Errorf("CodecFor(%q) = %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	codec := Codec{
+		Name:       "base64",
+		Extensions: []string{".b64"},
+		ToJSON: func(data []byte) ([]byte, error) {
+			return base64.StdEncoding.AppendDecode(nil, data)
+		},
+		FromJSON: func(data []byte, _ int) ([]byte, error) {
+			return base64.StdEncoding.AppendEncode(nil, data), nil
+		},
+	}
+	RegisterCodec(codec)
+
+	if got := CodecFor("schema.B64").Name; got != codec.Name {
+		t.Errorf("CodecFor(schema.B64) = %s, want %s", got, codec.Name)
+	}
+	if _, ok := CodecNamed(codec.Name); !ok {
+		t.Errorf("CodecNamed(%s) not found", codec.Name)
+	}
+	if names := CodecNames(); !slices.Contains(names, codec.Name) {
+		t.Errorf("CodecNames() = %v, want %s listed", names, codec.Name)
+	}
+
+	for name, c := range map[string]Codec{
+		"same name":      codec,
+		"same extension": {Name: "other", Extensions: []string{".YAML"}, ToJSON: codec.ToJSON, FromJSON: codec.FromJSON},
+		"incomplete":     {Name: "incomplete", Extensions: []string{".inc"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("registered")
+				}
+			}()
+			RegisterCodec(c)
+		})
+	}
+}
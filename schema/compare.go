@@ -0,0 +1,43 @@
+package schema
+
+import "fmt"
+
+// KeyOrder is how the fields of index keys compare.
+type KeyOrder string
+
+const (
+	// KeyOrderStrict compares key fields in order, as the server uses them:
+	// {a: 1, b: 1} and {b: 1, a: 1} are different indexes.
+	KeyOrderStrict KeyOrder = "strict"
+	// KeyOrderRelaxed compares key fields in any order, for audits of index
+	// options that disregard the key order.
+	KeyOrderRelaxed KeyOrder = "relaxed"
+)
+
+// Comparison is how EqualWith compares indexes, per class of field:
+//   - the key compares as set by KeyOrder;
+//   - nested option documents, e.g. partialFilterExpression, collation and
+//     weights, compare regardless of field order;
+//   - numbers compare by value whatever their type, e.g. 1 and 1.0;
+//   - storageEngine compares with the options of configString strings in
+//     any order and spacing, unless IgnoreStorageEngine is set;
+//   - annotations, description and meta, the building marker and the
+//     background option, which servers ignore, never compare.
+type Comparison struct {
+	KeyOrder KeyOrder
+	// IgnoreStorageEngine leaves storageEngine out of comparisons, for
+	// deployments whose storage engine options are managed separately.
+	IgnoreStorageEngine bool
+}
+
+// DefaultComparison compares indexes as the server tells them apart.
+var DefaultComparison = Comparison{KeyOrder: KeyOrderStrict}
+
+// Check reports an invalid key order. An empty key order keeps the default.
+func (c Comparison) Check() error {
+	switch c.KeyOrder {
+	case "", KeyOrderStrict, KeyOrderRelaxed:
+		return nil
+	}
+	return fmt.Errorf("invalid key order %q, want strict or relaxed", c.KeyOrder)
+}
@@ -0,0 +1,51 @@
+package schema
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	// currentTextIndexVersion is the text index version servers have created
+	// by default since MongoDB 3.2.
+	currentTextIndexVersion = 3
+	// currentSphereIndexVersion is the 2dsphere index version servers have
+	// created by default since MongoDB 3.2.
+	currentSphereIndexVersion = 3
+)
+
+// NormalizeDeprecated strips or translates deprecated index options so the index
+// matches what current servers store, describing every change made.
+func (i Index) NormalizeDeprecated() (Index, []string) {
+	var changes []string
+
+	if i.Background {
+		i.Background = false
+		changes = append(changes, "removed background, which MongoDB ignores since 4.2")
+	}
+
+	if i.TextIndexVersion > 0 && i.TextIndexVersion < currentTextIndexVersion {
+		changes = append(changes, fmt.Sprintf("removed textIndexVersion %d so new text indexes get the current version %d",
+			i.TextIndexVersion, currentTextIndexVersion))
+		i.TextIndexVersion = 0
+	}
+
+	if i.SphereIndexVersion > 0 && i.SphereIndexVersion < currentSphereIndexVersion {
+		changes = append(changes, fmt.Sprintf("removed 2dsphereIndexVersion %d so new 2dsphere indexes get the current version %d",
+			i.SphereIndexVersion, currentSphereIndexVersion))
+		i.SphereIndexVersion = 0
+	}
+
+	key := make(bson.D, 0, len(i.Key))
+	for _, e := range i.Key {
+		if e.Value == "geoHaystack" {
+			changes = append(changes, fmt.Sprintf("translated geoHaystack on %s, removed in MongoDB 5.0, to a 2d index", e.Key))
+			e.Value = "2d"
+		}
+		key = append(key, e)
+	}
+	i.Key = key
+
+	return i, changes
+}
@@ -0,0 +1,81 @@
+package schema
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// KeySpec renders the index key in shell notation, e.g. {user_id: 1, created_at: -1}.
+func (i Index) KeySpec() string {
+	parts := make([]string, 0, len(i.Key))
+	for _, e := range i.Key {
+		parts = append(parts, fmt.Sprintf("%s: %v", e.Key, formatValue(e.Value)))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// Flags summarizes the notable index options, e.g. ["unique", "ttl=3600s"].
+func (i Index) Flags() []string {
+	var flags []string
+	if i.Unique {
+		flags = append(flags, "unique")
+	}
+	if i.Sparse {
+		flags = append(flags, "sparse")
+	}
+	if i.Hidden {
+		flags = append(flags, "hidden")
+	}
+	if i.ExpireAfterSeconds != nil {
+		flags = append(flags, fmt.Sprintf("ttl=%ds", *i.ExpireAfterSeconds))
+	}
+	if len(i.PartialFilterExpression) > 0 {
+		flags = append(flags, "partial")
+	}
+	if i.Collation != nil {
+		flags = append(flags, "collation="+i.Collation.Locale)
+	}
+	if len(i.Weights) > 0 {
+		flags = append(flags, "text")
+	}
+	if len(i.WildcardProjection) > 0 {
+		flags = append(flags, "wildcardProjection")
+	}
+	if len(i.ColumnstoreProjection) > 0 {
+		flags = append(flags, "columnstoreProjection")
+	}
+	if i.Building {
+		flags = append(flags, "building")
+	}
+	return flags
+}
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Options returns the options set on the index, without its key and name,
+// in declaration order.
+func (i Index) Options() bson.D {
+	raw, err := bson.Marshal(i)
+	if err != nil {
+		return nil
+	}
+
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil
+	}
+
+	return slices.DeleteFunc(doc, func(e bson.E) bool {
+		return e.Key == "key" || e.Key == "name"
+	})
+}
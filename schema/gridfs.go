@@ -0,0 +1,128 @@
+package schema
+
+import (
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Suffixes of the two collections of a GridFS bucket.
+const (
+	filesSuffix  = ".files"
+	chunksSuffix = ".chunks"
+)
+
+// GridFSFilesIndex is the index drivers create on the files collection of a
+// bucket.
+func GridFSFilesIndex() Index {
+	return Index{
+		Key:  bson.D{{Key: "filename", Value: 1}, {Key: "uploadDate", Value: 1}},
+		Name: "filename_1_uploadDate_1",
+	}
+}
+
+// GridFSChunksIndex is the index drivers create on the chunks collection of a
+// bucket.
+func GridFSChunksIndex() Index {
+	return Index{
+		Key:    bson.D{{Key: "files_id", Value: 1}, {Key: "n", Value: 1}},
+		Name:   "files_id_1_n_1",
+		Unique: true,
+	}
+}
+
+// IsGridFSDefault reports whether the index is the standard index of the
+// files or chunks collection of a GridFS bucket.
+func IsGridFSDefault(collection string, index Index) bool {
+	switch {
+	case strings.HasSuffix(collection, filesSuffix):
+		return index.Equal(GridFSFilesIndex())
+	case strings.HasSuffix(collection, chunksSuffix):
+		return index.Equal(GridFSChunksIndex())
+	}
+	return false
+}
+
+// ExpandBuckets replaces the declared GridFS buckets by their files and
+// chunks collections with the standard indexes, so they compare with the
+// collections of the database.
+func ExpandBuckets(schemas []Schema) []Schema {
+	expanded := make([]Schema, 0, len(schemas))
+	for _, s := range schemas {
+		if !s.GridFS {
+			expanded = append(expanded, s)
+			continue
+		}
+
+		files := Schema{
+			Collection:  s.Collection + filesSuffix,
+			Owner:       s.Owner,
+			Description: s.Description,
+			Meta:        s.Meta,
+			ReadOnly:    s.ReadOnly,
+		}
+		if !slices.ContainsFunc(s.Indexes, func(index Index) bool { return index.Name == GridFSFilesIndex().Name }) {
+			files.Indexes = append(files.Indexes, GridFSFilesIndex())
+		}
+		files.Indexes = append(files.Indexes, s.Indexes...)
+
+		chunks := Schema{
+			Collection: s.Collection + chunksSuffix,
+			Owner:      s.Owner,
+			ReadOnly:   s.ReadOnly,
+			Indexes:    []Index{GridFSChunksIndex()},
+		}
+		expanded = append(expanded, files, chunks)
+	}
+	return expanded
+}
+
+// CollapseBuckets recognizes the files and chunks collection pairs of GridFS
+// buckets having the standard indexes and replaces each by a bucket, keeping
+// the other indexes of the files collection. Pairs with additional chunks
+// indexes are left as collections.
+func CollapseBuckets(schemas []Schema) []Schema {
+	find := func(collection string) int {
+		return slices.IndexFunc(schemas, func(s Schema) bool { return s.Collection == collection })
+	}
+
+	collapsed := make([]Schema, 0, len(schemas))
+	seen := make(map[string]bool)
+	for _, s := range schemas {
+		bucket, isFiles := strings.CutSuffix(s.Collection, filesSuffix)
+		if !isFiles {
+			bucket, _ = strings.CutSuffix(s.Collection, chunksSuffix)
+		}
+		files, chunks := find(bucket+filesSuffix), find(bucket+chunksSuffix)
+		if files < 0 || chunks < 0 || !isBucket(schemas[files], schemas[chunks]) {
+			collapsed = append(collapsed, s)
+			continue
+		}
+		if seen[bucket] {
+			continue
+		}
+		seen[bucket] = true
+
+		indexes := slices.DeleteFunc(slices.Clone(schemas[files].Indexes), func(index Index) bool {
+			return index.Equal(GridFSFilesIndex())
+		})
+		collapsed = append(collapsed, Schema{
+			Collection:  bucket,
+			Owner:       schemas[files].Owner,
+			Description: schemas[files].Description,
+			Meta:        schemas[files].Meta,
+			GridFS:      true,
+			ReadOnly:    schemas[files].ReadOnly,
+			Indexes:     indexes,
+		})
+	}
+	return collapsed
+}
+
+// isBucket reports whether the collections have the standard GridFS indexes,
+// and the chunks collection no other.
+func isBucket(files, chunks Schema) bool {
+	return slices.ContainsFunc(files.Indexes, func(index Index) bool { return index.Equal(GridFSFilesIndex()) }) &&
+		len(chunks.Indexes) == 1 && chunks.Indexes[0].Equal(GridFSChunksIndex())
+}
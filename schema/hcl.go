@@ -0,0 +1,551 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// HCLCodec is the codec of HCL schema files, which declare every collection
+// in a block labeled by its name, in the style of Atlas:
+//
+//	collection "users" {
+//	  owner = "identity"
+//
+//	  index "email_1" {
+//	    key    = { email = 1 }
+//	    unique = true
+//	  }
+//	}
+//
+// Indexes and search indexes are index and search_index blocks labeled by
+// their name, and the other fields attributes named as in JSON.
+var HCLCodec = Codec{
+	Name:       "hcl",
+	Extensions: []string{".hcl"},
+	ToJSON:     HCLToJSON,
+	FromJSON:   JSONToHCL,
+}
+
+// hclCollectionBlock is the type of the blocks declaring collections.
+const hclCollectionBlock = "collection"
+
+// hclBlockFields are the fields of a collection written as blocks, by block
+// type. Every element of the field is a block labeled by its name.
+var hclBlockFields = map[string]string{
+	"index":        "indexes",
+	"search_index": "searchIndexes",
+}
+
+// hclAttributeNames are the attribute names of the fields whose JSON names
+// aren't HCL identifiers.
+var hclAttributeNames = map[string]string{
+	"2dsphereIndexVersion": "sphereIndexVersion",
+}
+
+// HCLToJSON converts an HCL schema file to JSON. Objects keep the order of
+// their keys, which is significant for index keys, and blocks and attributes
+// the order they are declared in.
+func HCLToJSON(data []byte) ([]byte, error) {
+	file, diags := hclsyntax.ParseConfig(data, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, hclError(diags)
+	}
+	body := file.Body.(*hclsyntax.Body)
+	for _, item := range hclBodyItems(body) {
+		if attr, ok := item.(*hclsyntax.Attribute); ok {
+			return nil, fmt.Errorf("line %d: attribute %s outside of a collection block", attr.NameRange.Start.Line, attr.Name)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, block := range body.Blocks {
+		if block.Type != hclCollectionBlock || len(block.Labels) != 1 {
+			return nil, fmt.Errorf("line %d: want a collection block labeled by its name", block.TypeRange.Start.Line)
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeHCLBlock(&buf, block, hclCollectionBlock, hclBlockFields); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// writeHCLBlock writes the block as a JSON object, with its label as the
+// labelField member. The nested blocks of the types of blockFields become
+// arrays of the fields; a collection without index blocks has no indexes.
+func writeHCLBlock(buf *bytes.Buffer, block *hclsyntax.Block, labelField string, blockFields map[string]string) error {
+	if len(block.Labels) > 1 {
+		return fmt.Errorf("line %d: %s block with more than one label", block.TypeRange.Start.Line, block.Type)
+	}
+
+	written, writtenBlocks := make(map[string]bool), make(map[string]bool)
+	writeField := func(name string) {
+		if len(written) > 0 {
+			buf.WriteByte(',')
+		}
+		written[name] = true
+		encoded, _ := json.Marshal(name)
+		buf.Write(encoded)
+		buf.WriteByte(':')
+	}
+
+	buf.WriteByte('{')
+	for _, label := range block.Labels {
+		writeField(labelField)
+		encoded, _ := json.Marshal(label)
+		buf.Write(encoded)
+	}
+	for _, item := range hclBodyItems(block.Body) {
+		switch item := item.(type) {
+		case *hclsyntax.Attribute:
+			name := jsonFieldName(item.Name)
+			if written[name] {
+				return fmt.Errorf("line %d: %s set twice", item.NameRange.Start.Line, name)
+			}
+			writeField(name)
+			if err := writeHCLExpr(buf, item.Expr); err != nil {
+				return err
+			}
+		case *hclsyntax.Block:
+			field, ok := blockFields[item.Type]
+			if !ok {
+				return fmt.Errorf("line %d: unexpected %s block", item.TypeRange.Start.Line, item.Type)
+			}
+			if writtenBlocks[item.Type] {
+				// All blocks of the type were written with the first one.
+				continue
+			}
+			if written[field] {
+				return fmt.Errorf("line %d: %s set twice", item.TypeRange.Start.Line, field)
+			}
+			writtenBlocks[item.Type] = true
+			writeField(field)
+			buf.WriteByte('[')
+			first := true
+			for _, nested := range block.Body.Blocks {
+				if nested.Type != item.Type {
+					continue
+				}
+				if !first {
+					buf.WriteByte(',')
+				}
+				first = false
+				if err := writeHCLBlock(buf, nested, "name", nil); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte(']')
+		}
+	}
+	if labelField == hclCollectionBlock && !written["indexes"] {
+		writeField("indexes")
+		buf.WriteString("[]")
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// hclBodyItems returns the attributes and blocks of the body in the order
+// they are declared.
+func hclBodyItems(body *hclsyntax.Body) []hclsyntax.Node {
+	items := make([]hclsyntax.Node, 0, len(body.Attributes)+len(body.Blocks))
+	for _, attr := range body.Attributes {
+		items = append(items, attr)
+	}
+	for _, block := range body.Blocks {
+		items = append(items, block)
+	}
+	slices.SortFunc(items, func(a, b hclsyntax.Node) int {
+		return a.Range().Start.Byte - b.Range().Start.Byte
+	})
+	return items
+}
+
+// writeHCLExpr writes the value of a literal expression as JSON, keeping the
+// order of object keys.
+func writeHCLExpr(buf *bytes.Buffer, expr hclsyntax.Expression) error {
+	switch expr := expr.(type) {
+	case *hclsyntax.TupleConsExpr:
+		buf.WriteByte('[')
+		for i, item := range expr.Exprs {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeHCLExpr(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	case *hclsyntax.ObjectConsExpr:
+		buf.WriteByte('{')
+		for i, item := range expr.Items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := hclObjectKey(item.KeyExpr)
+			if err != nil {
+				return err
+			}
+			encoded, _ := json.Marshal(key)
+			buf.Write(encoded)
+			buf.WriteByte(':')
+			if err := writeHCLExpr(buf, item.ValueExpr); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	}
+
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return hclError(diags)
+	}
+	if value.IsNull() {
+		buf.WriteString("null")
+		return nil
+	}
+	if !value.Type().IsPrimitiveType() {
+		return fmt.Errorf("line %d: want a literal value", expr.Range().Start.Line)
+	}
+	encoded, err := ctyjson.Marshal(value, value.Type())
+	if err != nil {
+		return fmt.Errorf("line %d: %w", expr.Range().Start.Line, err)
+	}
+	buf.Write(encoded)
+	return nil
+}
+
+// hclObjectKey returns the key of an object item, a bare identifier or a
+// string.
+func hclObjectKey(expr hclsyntax.Expression) (string, error) {
+	if keyword := hcl.ExprAsKeyword(expr); keyword != "" {
+		return keyword, nil
+	}
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return "", hclError(diags)
+	}
+	if value.IsNull() || value.Type() != cty.String {
+		return "", fmt.Errorf("line %d: object keys must be strings", expr.Range().Start.Line)
+	}
+	return value.AsString(), nil
+}
+
+// hclError returns the first error of the diagnostics, located by line.
+func hclError(diags hcl.Diagnostics) error {
+	for _, diag := range diags {
+		if diag.Severity != hcl.DiagError {
+			continue
+		}
+		msg := diag.Summary
+		if diag.Detail != "" {
+			msg += "; " + diag.Detail
+		}
+		if diag.Subject != nil {
+			return fmt.Errorf("line %d: %s", diag.Subject.Start.Line, msg)
+		}
+		return errors.New(msg)
+	}
+	return diags
+}
+
+// JSONToHCL converts a JSON schema file to HCL. HCL is always indented by
+// two spaces, its canonical style, so the indent is ignored.
+func JSONToHCL(data []byte, _ int) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	doc, err := orderedJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	collections, ok := doc.([]any)
+	if doc != nil && !ok {
+		return nil, errors.New("schema file must be an array of collections")
+	}
+
+	var buf bytes.Buffer
+	for i, collection := range collections {
+		fields, ok := collection.([]jsonMember)
+		if !ok {
+			return nil, fmt.Errorf("[%d]: collection must be an object", i)
+		}
+		name, ok := memberValue(fields, hclCollectionBlock).(string)
+		if !ok {
+			return nil, fmt.Errorf("[%d]: collection without a name", i)
+		}
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		fmt.Fprintf(&buf, "%s %s {\n", hclCollectionBlock, hclString(name))
+		if err := writeHCLBody(&buf, fields, hclCollectionBlock, true); err != nil {
+			return nil, fmt.Errorf("collection %q: %w", name, err)
+		}
+		buf.WriteString("}\n")
+	}
+	return hclwrite.Format(buf.Bytes()), nil
+}
+
+// writeHCLBody writes the fields of an object but labelField as the body of
+// its block: attributes first, then, for a collection, a block for every
+// index and search index.
+func writeHCLBody(buf *bytes.Buffer, fields []jsonMember, labelField string, collection bool) error {
+	written := false
+	var blocks []jsonMember
+	for _, field := range fields {
+		if field.key == labelField {
+			continue
+		}
+		if collection && hclBlockType(field.key) != "" && isObjectArray(field.value) {
+			blocks = append(blocks, field)
+			continue
+		}
+		name := hclAttributeName(field.key)
+		if !hclsyntax.ValidIdentifier(name) {
+			return fmt.Errorf("field %q can't be an HCL attribute", field.key)
+		}
+		fmt.Fprintf(buf, "%s = ", name)
+		writeHCLValue(buf, field.value)
+		buf.WriteByte('\n')
+		written = true
+	}
+
+	for _, field := range blocks {
+		for _, item := range field.value.([]any) {
+			if written {
+				buf.WriteByte('\n')
+			}
+			written = true
+			itemFields := item.([]jsonMember)
+			buf.WriteString(hclBlockType(field.key))
+			labelField := ""
+			if name, ok := memberValue(itemFields, "name").(string); ok {
+				fmt.Fprintf(buf, " %s", hclString(name))
+				labelField = "name"
+			}
+			buf.WriteString(" {\n")
+			if err := writeHCLBody(buf, itemFields, labelField, false); err != nil {
+				return err
+			}
+			buf.WriteString("}\n")
+		}
+	}
+	return nil
+}
+
+// hclBlockType returns the type of the blocks the field is written as, if
+// any.
+func hclBlockType(field string) string {
+	for block, name := range hclBlockFields {
+		if name == field {
+			return block
+		}
+	}
+	return ""
+}
+
+// hclAttributeName returns the attribute name of a field, and jsonFieldName
+// the field of an attribute name.
+func hclAttributeName(field string) string {
+	if name, ok := hclAttributeNames[field]; ok {
+		return name
+	}
+	return field
+}
+
+func jsonFieldName(attr string) string {
+	for field, name := range hclAttributeNames {
+		if name == attr {
+			return field
+		}
+	}
+	return attr
+}
+
+// writeHCLValue writes a JSON value as an HCL expression. Objects and arrays
+// of scalars fit on a line; others get one per member.
+func writeHCLValue(buf *bytes.Buffer, value any) {
+	switch v := value.(type) {
+	case []jsonMember:
+		if len(v) == 0 {
+			buf.WriteString("{}")
+			return
+		}
+		flat := !slices.ContainsFunc(v, func(m jsonMember) bool { return !isScalar(m.value) })
+		buf.WriteByte('{')
+		for i, member := range v {
+			switch {
+			case !flat:
+				buf.WriteByte('\n')
+			case i > 0:
+				buf.WriteString(", ")
+			default:
+				buf.WriteByte(' ')
+			}
+			key := member.key
+			if !hclsyntax.ValidIdentifier(key) || key == "true" || key == "false" || key == "null" {
+				key = hclString(key)
+			}
+			fmt.Fprintf(buf, "%s = ", key)
+			writeHCLValue(buf, member.value)
+		}
+		if flat {
+			buf.WriteString(" }")
+		} else {
+			buf.WriteString("\n}")
+		}
+	case []any:
+		flat := !slices.ContainsFunc(v, func(item any) bool { return !isScalar(item) })
+		buf.WriteByte('[')
+		for i, item := range v {
+			switch {
+			case !flat:
+				buf.WriteByte('\n')
+			case i > 0:
+				buf.WriteString(", ")
+			}
+			writeHCLValue(buf, item)
+			if !flat {
+				buf.WriteByte(',')
+			}
+		}
+		if !flat {
+			buf.WriteByte('\n')
+		}
+		buf.WriteByte(']')
+	case string:
+		buf.WriteString(hclString(v))
+	case json.Number:
+		buf.WriteString(v.String())
+	case bool:
+		fmt.Fprint(buf, v)
+	default:
+		buf.WriteString("null")
+	}
+}
+
+// hclString quotes s as an HCL string, escaping the template sequences.
+func hclString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		case (r == '$' || r == '%') && strings.HasPrefix(s[i+1:], "{"):
+			b.WriteRune(r)
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// jsonMember is a member of a JSON object decoded by orderedJSON.
+type jsonMember struct {
+	key   string
+	value any
+}
+
+// orderedJSON decodes the next JSON value, with objects as their members in
+// order and numbers as json.Number.
+func orderedJSON(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if errors.Is(err, io.EOF) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+	var array []any
+	members := []jsonMember{}
+	for dec.More() {
+		var key string
+		if delim == '{' {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key = tok.(string)
+		}
+		value, err := orderedJSON(dec)
+		if err != nil {
+			return nil, err
+		}
+		if delim == '{' {
+			members = append(members, jsonMember{key: key, value: value})
+		} else {
+			array = append(array, value)
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if delim == '{' {
+		return members, nil
+	}
+	if array == nil {
+		array = []any{}
+	}
+	return array, nil
+}
+
+// memberValue returns the value of the member with the key, or nil.
+func memberValue(members []jsonMember, key string) any {
+	for _, member := range members {
+		if member.key == key {
+			return member.value
+		}
+	}
+	return nil
+}
+
+// isObjectArray reports whether the value is an array of objects.
+func isObjectArray(value any) bool {
+	array, ok := value.([]any)
+	return ok && !slices.ContainsFunc(array, func(item any) bool {
+		_, ok := item.([]jsonMember)
+		return !ok
+	})
+}
+
+// isScalar reports whether the value is neither an object nor an array.
+func isScalar(value any) bool {
+	switch value.(type) {
+	case []jsonMember, []any:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const hclSchema = `collection "users" {
+  owner     = "identity"
+  validator = { "$jsonSchema" = { required = ["email"] } }
+
+  index "email_1_at_-1" {
+    key    = { email = 1, at = -1 }
+    unique = true
+  }
+
+  index {
+    key                = { location = "2dsphere" }
+    sphereIndexVersion = 3
+  }
+
+  search_index "default" {
+    definition = { mappings = { dynamic = true } }
+  }
+}
+
+collection "audit_log" {
+  options = { capped = true, size = 10485760 }
+}
+`
+
+func TestHCLToJSON(t *testing.T) {
+	data, err := HCLToJSON([]byte(hclSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas, err := Parse("schema.hcl", data)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, data)
+	}
+
+	if len(schemas) != 2 || schemas[0].Collection != "users" || schemas[1].Collection != "audit_log" {
+		t.Fatalf("collections = %+v", schemas)
+	}
+	users := schemas[0]
+	if len(users.Indexes) != 2 || len(users.SearchIndexes) != 1 {
+		t.Fatalf("indexes = %+v, search indexes = %+v", users.Indexes, users.SearchIndexes)
+	}
+	email := users.Indexes[0]
+	if email.Name != "email_1_at_-1" || !email.Unique || email.Key[0].Key != "email" || email.Key[1].Key != "at" {
+		t.Errorf("index = %+v, want email_1_at_-1 keyed by email, then at", email)
+	}
+	if users.Indexes[1].SphereIndexVersion != 3 {
+		t.Errorf("2dsphereIndexVersion = %d, want 3", users.Indexes[1].SphereIndexVersion)
+	}
+	if schemas[1].Indexes == nil || schemas[1].Options == nil {
+		t.Errorf("audit_log = %+v, want its options and no indexes", schemas[1])
+	}
+}
+
+func TestHCLRoundTrip(t *testing.T) {
+	data, err := HCLToJSON([]byte(hclSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Parse("schema.hcl", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	converted, err := JSONToHCL(data, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = HCLToJSON(converted)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, converted)
+	}
+	got, err := Parse("schema.hcl", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip changed the schema:\n%s", converted)
+	}
+	if !strings.Contains(string(converted), `index "email_1_at_-1" {`) {
+		t.Errorf("indexes aren't blocks labeled by name:\n%s", converted)
+	}
+}
+
+func TestHCLStrings(t *testing.T) {
+	data := `[{"collection": "a", "meta": {"note": "${literal} %{x} \"quoted\"\n"}, "indexes": []}]`
+	converted, err := JSONToHCL([]byte(data), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := HCLToJSON(converted)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, converted)
+	}
+	if want := `{"note":"${literal} %{x} \"quoted\"\n"}`; !strings.Contains(string(back), want) {
+		t.Errorf("got %s, want %s in it", back, want)
+	}
+}
+
+func TestHCLToJSONErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"top-level attribute": "owner = \"x\"\n",
+		"unlabeled":           "collection {\n}\n",
+		"unknown block":       "collection \"a\" {\n  view \"b\" {\n  }\n}\n",
+		"variable":            "collection \"a\" {\n  owner = team\n}\n",
+		"set twice":           "collection \"a\" {\n  indexes = []\n  index {\n  }\n}\n",
+		"syntax":              "collection \"a\" {\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := HCLToJSON([]byte(data)); err == nil || !strings.HasPrefix(err.Error(), "line ") {
+				t.Errorf("got %v, want an error located by line", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// indexTypes are the string values an index key field can take.
+var indexTypes = []any{"2d", "2dsphere", "columnstore", "hashed", "text"}
+
+// CheckKey type-checks the key values of the index and the options that only
+// apply to some index types.
+func (i Index) CheckKey() error {
+	if len(i.Key) == 0 {
+		return errors.New("index key is empty")
+	}
+
+	counts := make(map[string]int)
+	for n, e := range i.Key {
+		switch v := e.Value.(type) {
+		case string:
+			if !slices.Contains(indexTypes, any(v)) {
+				return fmt.Errorf("field %s: unknown index type %q", e.Key, v)
+			}
+			counts[v]++
+			if v == "2d" && n > 0 {
+				return fmt.Errorf("field %s: a 2d field must come first in the key", e.Key)
+			}
+		case int32, int64, float64:
+			if !isSortOrder(v) {
+				return fmt.Errorf("field %s: sort order must be 1 or -1", e.Key)
+			}
+		default:
+			return fmt.Errorf("field %s: expected 1, -1 or an index type, got %v", e.Key, e.Value)
+		}
+	}
+
+	switch {
+	case counts["2d"] > 1:
+		return errors.New("an index can have only one 2d field")
+	case counts["hashed"] > 1:
+		return errors.New("an index can have only one hashed field")
+	case counts["hashed"] > 0 && i.Unique:
+		return errors.New("hashed indexes can't be unique")
+	}
+
+	if counts["columnstore"] > 0 {
+		if len(i.Key) > 1 || !strings.HasSuffix(i.Key[0].Key, "$**") {
+			return errors.New(`a columnstore index has a single field, "$**" or ending in ".$**"`)
+		}
+	} else if len(i.ColumnstoreProjection) > 0 {
+		return errors.New("columnstoreProjection only applies to columnstore indexes")
+	}
+
+	if counts["2d"] == 0 && (i.Bits != 0 || i.Min != nil || i.Max != nil) {
+		return errors.New("bits, min and max only apply to 2d indexes")
+	}
+	if i.Bits < 0 || i.Bits > 32 {
+		return fmt.Errorf("bits must be between 1 and 32, got %d", i.Bits)
+	}
+	if i.Min != nil && i.Max != nil && *i.Min >= *i.Max {
+		return fmt.Errorf("min %v must be less than max %v", *i.Min, *i.Max)
+	}
+	if counts["2dsphere"] == 0 && i.SphereIndexVersion != 0 {
+		return errors.New("2dsphereIndexVersion only applies to 2dsphere indexes")
+	}
+
+	return nil
+}
+
+func isSortOrder(v any) bool {
+	switch v := v.(type) {
+	case int32:
+		return v == 1 || v == -1
+	case int64:
+		return v == 1 || v == -1
+	case float64:
+		return v == 1 || v == -1
+	}
+	return false
+}
+
+// IsColumnstore reports whether the index is a columnstore index.
+func (i Index) IsColumnstore() bool {
+	return slices.ContainsFunc(i.Key, func(e bson.E) bool {
+		return e.Value == "columnstore"
+	})
+}
@@ -0,0 +1,110 @@
+package schema
+
+import (
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// CollectionOptions are the options a collection is created with, as
+// listCollections reports them. They can't change once it exists.
+type CollectionOptions struct {
+	// Capped collections keep at most Size bytes and, when set, Max
+	// documents, the oldest being removed first.
+	Capped bool  `bson:"capped,omitempty"`
+	Size   int64 `bson:"size,omitempty"`
+	Max    int64 `bson:"max,omitempty"`
+	// TimeSeries stores the collection as time series buckets, whose
+	// documents expire after ExpireAfterSeconds when set.
+	TimeSeries         *TimeSeriesOptions `bson:"timeseries,omitempty"`
+	ExpireAfterSeconds *int64             `bson:"expireAfterSeconds,omitempty"`
+	// ClusteredIndex orders the documents of the collection by its key.
+	ClusteredIndex *ClusteredIndex `bson:"clusteredIndex,omitempty"`
+	// Collation is the default collation of the collection and its indexes.
+	Collation *Collation `bson:"collation,omitempty"`
+}
+
+// TimeSeriesOptions are the options of a time series collection.
+type TimeSeriesOptions struct {
+	TimeField             string `bson:"timeField"`
+	MetaField             string `bson:"metaField,omitempty"`
+	Granularity           string `bson:"granularity,omitempty"`
+	BucketMaxSpanSeconds  int64  `bson:"bucketMaxSpanSeconds,omitempty"`
+	BucketRoundingSeconds int64  `bson:"bucketRoundingSeconds,omitempty"`
+}
+
+// ClusteredIndex is the key a clustered collection is ordered by, which
+// must be {_id: 1}.
+type ClusteredIndex struct {
+	Key    bson.D `bson:"key"`
+	Unique bool   `bson:"unique"`
+	Name   string `bson:"name,omitempty"`
+}
+
+// IsZero reports whether no option is set, as for most collections.
+func (o CollectionOptions) IsZero() bool {
+	return reflect.ValueOf(o).IsZero()
+}
+
+func (o CollectionOptions) MarshalJSON() ([]byte, error) {
+	return bson.MarshalExtJSON(o, false, false)
+}
+
+func (o *CollectionOptions) UnmarshalJSON(data []byte) error {
+	return bson.UnmarshalExtJSON(data, false, o)
+}
+
+// HasOptions reports whether the schema declares the options the collection
+// is created with.
+func (s Schema) HasOptions() bool {
+	return s.Options != nil
+}
+
+// OptionsMatch reports whether the collection has the options the schema
+// declares, those left out matching whatever the server chose, such as the
+// bucket span derived from the granularity or the collation defaults.
+func (s Schema) OptionsMatch(current Schema) bool {
+	if s.Options == nil {
+		return true
+	}
+	if current.Options == nil {
+		return false
+	}
+	declared := *s.Options
+	if declared.Size > 0 {
+		// Servers raise the size of capped collections to at least 4096
+		// bytes and to a multiple of 256.
+		declared.Size = max(4096, (declared.Size+255)/256*256)
+	}
+	return declaredFieldsMatch(reflect.ValueOf(declared), reflect.ValueOf(*current.Options))
+}
+
+// declaredFieldsMatch reports whether the fields set in declared have the
+// same value in current, comparing nested structs field by field.
+func declaredFieldsMatch(declared, current reflect.Value) bool {
+	switch declared.Kind() {
+	case reflect.Pointer:
+		if declared.IsNil() {
+			return true
+		}
+		if current.IsNil() {
+			return false
+		}
+		return declaredFieldsMatch(declared.Elem(), current.Elem())
+	case reflect.Struct:
+		for i := range declared.NumField() {
+			if !declaredFieldsMatch(declared.Field(i), current.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	if declared.IsZero() {
+		return true
+	}
+	if declared.Type() == reflect.TypeOf(bson.D{}) {
+		// Key values compare by number, e.g. 1 and 1.0.
+		return reflect.DeepEqual(canonicalValue(declared.Interface(), false), canonicalValue(current.Interface(), false))
+	}
+	return reflect.DeepEqual(declared.Interface(), current.Interface())
+}
@@ -0,0 +1,247 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ParseError is a problem in a schema file located by line and column, with
+// the offending line quoted.
+type ParseError struct {
+	File    string
+	Line    int
+	Column  int
+	Msg     string
+	Snippet string
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Msg)
+	if e.Snippet != "" {
+		msg += "\n" + e.Snippet
+	}
+	return msg
+}
+
+// Parse decodes the contents of a schema file. Malformed JSON and values of the
+// wrong type are reported as a *ParseError pointing at the offending value.
+func Parse(file string, data []byte) ([]Schema, error) {
+	var schemas []Schema
+	err := json.Unmarshal(data, &schemas)
+	if err == nil {
+		return schemas, nil
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		// The offending byte is the last one read.
+		return nil, newParseError(file, data, int(syntaxErr.Offset)-1, syntaxErr.Error())
+	}
+
+	offset, msg := locateCollectionError(data)
+	if msg == "" {
+		msg = strings.TrimPrefix(err.Error(), "json: ")
+	}
+	return nil, newParseError(file, data, offset, msg)
+}
+
+// rawValue is an element of a JSON array or a member of a JSON object, with its
+// offset in the enclosing value.
+type rawValue struct {
+	key    string
+	offset int
+	data   json.RawMessage
+}
+
+// rawElements splits a JSON array or object into its values.
+func rawElements(data []byte, open json.Delim) ([]rawValue, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != open {
+		return nil, false
+	}
+
+	var values []rawValue
+	for dec.More() {
+		var v rawValue
+		if open == '{' {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, false
+			}
+			v.key, _ = tok.(string)
+		}
+		if err := dec.Decode(&v.data); err != nil {
+			return nil, false
+		}
+		v.offset = int(dec.InputOffset()) - len(v.data)
+		values = append(values, v)
+	}
+	return values, true
+}
+
+// locateCollectionError finds the first value of the schema file that can't be
+// decoded, returning its offset and what was expected there.
+func locateCollectionError(data []byte) (int, string) {
+	collections, ok := rawElements(data, '[')
+	if !ok {
+		return len(data) - len(bytes.TrimLeft(data, " \t\r\n")), "expected an array of collections"
+	}
+
+	for _, collection := range collections {
+		var s Schema
+		if json.Unmarshal(collection.data, &s) == nil {
+			continue
+		}
+		offset, msg := locateFieldError(collection.data, reflect.TypeOf(s), "json", "collection", decodeSchemaField)
+		return collection.offset + offset, msg
+	}
+	return 0, ""
+}
+
+func locateIndexError(data []byte) (int, string) {
+	indexes, ok := rawElements(data, '[')
+	if !ok {
+		return 0, "expected array for indexes"
+	}
+
+	for _, index := range indexes {
+		var i Index
+		if json.Unmarshal(index.data, &i) == nil {
+			continue
+		}
+		offset, msg := locateFieldError(index.data, reflect.TypeOf(i), "bson", "index", decodeIndexField)
+		return index.offset + offset, msg
+	}
+	return 0, ""
+}
+
+// locateFieldError finds the first member of the object that can't be decoded
+// into a field of t on its own, descending into indexes and collations.
+func locateFieldError(data []byte, t reflect.Type, tagName, what string, decode func([]byte) error) (int, string) {
+	fields, ok := rawElements(data, '{')
+	if !ok {
+		return 0, "expected object for " + what
+	}
+
+	for _, field := range fields {
+		key, err := json.Marshal(field.key)
+		if err != nil {
+			continue
+		}
+		object := append(append(append([]byte("{"), key...), ':'), field.data...)
+		err = decode(append(object, '}'))
+		if err == nil {
+			continue
+		}
+
+		switch {
+		case what == "collection" && field.key == "indexes":
+			if offset, msg := locateIndexError(field.data); msg != "" {
+				return field.offset + offset, msg
+			}
+		case what == "index" && field.key == ttlField && isJSONString(field.data):
+			return field.offset, err.Error()
+		case what == "index" && field.key == "collation":
+			if offset, msg := locateFieldError(field.data, reflect.TypeOf(Collation{}), "bson", "index collation", decodeCollationField); offset > 0 {
+				return field.offset + offset, msg
+			}
+		}
+
+		label := what + " " + field.key
+		if field.key == what {
+			label = what
+		}
+		return field.offset, fmt.Sprintf("expected %s for %s", expectedType(t, tagName, field.key), label)
+	}
+	return 0, "invalid " + what
+}
+
+func isJSONString(data []byte) bool {
+	return len(data) > 0 && data[0] == '"'
+}
+
+func decodeSchemaField(data []byte) error {
+	var s Schema
+	return json.Unmarshal(data, &s)
+}
+
+func decodeIndexField(data []byte) error {
+	var i Index
+	return json.Unmarshal(data, &i)
+}
+
+func decodeCollationField(data []byte) error {
+	var c Collation
+	return bson.UnmarshalExtJSON(data, false, &c)
+}
+
+// expectedType describes in JSON terms the type of the struct field encoded as key.
+func expectedType(t reflect.Type, tagName, key string) string {
+	for i := range t.NumField() {
+		if strings.Split(t.Field(i).Tag.Get(tagName), ",")[0] == key {
+			return jsonType(t.Field(i).Type)
+		}
+	}
+	return "valid value"
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return jsonType(t.Elem())
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		if t == reflect.TypeOf(bson.D{}) {
+			return "object"
+		}
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func newParseError(file string, data []byte, offset int, msg string) *ParseError {
+	offset = max(0, min(offset, len(data)))
+
+	lineStart := bytes.LastIndexByte(data[:offset], '\n') + 1
+	lineEnd := bytes.IndexByte(data[offset:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(data)
+	} else {
+		lineEnd += offset
+	}
+	line := strings.TrimRight(string(data[lineStart:lineEnd]), "\r")
+
+	e := &ParseError{
+		File:   file,
+		Line:   bytes.Count(data[:offset], []byte("\n")) + 1,
+		Column: utf8.RuneCount(data[lineStart:offset]) + 1,
+		Msg:    msg,
+	}
+	if strings.TrimSpace(line) != "" {
+		// Keep tabs in the padding so the caret lines up with the quoted line.
+		padding := strings.Map(func(r rune) rune {
+			if r == '\t' {
+				return r
+			}
+			return ' '
+		}, string(data[lineStart:offset]))
+		gutter := fmt.Sprintf("%5d | ", e.Line)
+		e.Snippet = gutter + line + "\n" + strings.Repeat(" ", len(gutter)-2) + "| " + padding + "^"
+	}
+	return e
+}
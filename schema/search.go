@@ -0,0 +1,41 @@
+package schema
+
+import (
+	"cmp"
+	"reflect"
+)
+
+// The search index types, for indexes that don't set theirs.
+const (
+	SearchIndexType       = "search"
+	VectorSearchIndexType = "vectorSearch"
+)
+
+// SearchIndex is an Atlas Search or Vector Search index of a collection.
+type SearchIndex struct {
+	Name string `json:"name"`
+	// Type is "search", the default, or "vectorSearch".
+	Type string `json:"type,omitempty"`
+	// Definition holds the mappings, analyzers or vector fields of the
+	// index, as extended JSON.
+	Definition map[string]any `json:"definition"`
+}
+
+// Equal reports whether the search indexes have the same name, type and
+// definition.
+func (i SearchIndex) Equal(other SearchIndex) bool {
+	return i.Name == other.Name &&
+		cmp.Or(i.Type, SearchIndexType) == cmp.Or(other.Type, SearchIndexType) &&
+		reflect.DeepEqual(i.Definition, other.Definition)
+}
+
+// FindSearchIndex returns the search index of the schema with the name, or
+// nil.
+func (s Schema) FindSearchIndex(name string) *SearchIndex {
+	for i := range s.SearchIndexes {
+		if s.SearchIndexes[i].Name == name {
+			return &s.SearchIndexes[i]
+		}
+	}
+	return nil
+}
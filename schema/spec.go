@@ -0,0 +1,315 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// SpecID identifies the JSON Schema describing the schema file format.
+const SpecID = "https://github.com/ltman/mondex/schema.json"
+
+// indexFieldDescriptions documents the index options in the JSON Schema.
+var indexFieldDescriptions = map[string]string{
+	"key":                     "Indexed fields mapped to 1 or -1 for the sort order, or to an index type such as \"text\", \"2dsphere\" or \"columnstore\".",
+	"name":                    "Index name, unique within the collection, by default the one the server gives it, e.g. a_1_b_-1.",
+	"background":              "Build the index in the background (ignored by MongoDB 4.2 and later).",
+	"unique":                  "Reject documents that duplicate the indexed value.",
+	"sparse":                  "Only index documents that have the indexed fields.",
+	"expireAfterSeconds":      "Delete documents this many seconds after the indexed date (TTL index), or after a duration such as \"30d\" or \"12h\".",
+	"storageEngine":           "Storage engine options for the index.",
+	"partialFilterExpression": "Only index documents matching this filter.",
+	"collation":               "Language-specific rules for string comparison.",
+	"default_language":        "Default language of a text index.",
+	"language_override":       "Field holding the language of each document in a text index.",
+	"textIndexVersion":        "Text index version.",
+	"weights":                 "Relative weight of each field of a text index.",
+	"hidden":                  "Hide the index from the query planner.",
+	"wildcardProjection":      "Fields included in or excluded from a wildcard index.",
+	"columnstoreProjection":   "Fields included in or excluded from a columnstore index.",
+	"2dsphereIndexVersion":    "2dsphere index version.",
+	"bits":                    "Precision of the geohash of a 2d index, from 1 to 32 bits.",
+	"min":                     "Lower bound of the coordinates of a 2d index.",
+	"max":                     "Upper bound of the coordinates of a 2d index.",
+	"description":             "Free-form documentation; never sent to MongoDB.",
+	"meta":                    "Free-form annotations; never sent to MongoDB.",
+	"building":                "Set by inspect on indexes still being built; never sent to MongoDB.",
+}
+
+// Spec returns the JSON Schema of the schema file format. Index and collation
+// options are derived from the Index and Collation types, so the spec can't
+// drift from what mondex decodes.
+func Spec() map[string]any {
+	return map[string]any{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         SpecID,
+		"title":       "mondex schema file",
+		"description": "Collections and the indexes declared on them.",
+		"type":        "array",
+		"items": map[string]any{
+			"type":                 "object",
+			"required":             []string{"collection", "indexes"},
+			"additionalProperties": false,
+			"properties": map[string]any{
+				"collection": map[string]any{
+					"type":        "string",
+					"minLength":   1,
+					"description": "Collection name.",
+				},
+				"owner": map[string]any{
+					"type":        "string",
+					"description": "Team or person owning the collection's indexes.",
+				},
+				"description": map[string]any{
+					"type":        "string",
+					"description": "Free-form documentation of the collection.",
+				},
+				"meta": map[string]any{
+					"type":        "object",
+					"description": "Free-form annotations of the collection.",
+				},
+				"gridfs": map[string]any{
+					"type":        "boolean",
+					"description": "Declare a GridFS bucket named after collection, with the standard indexes of its files and chunks collections.",
+				},
+				"readOnly": map[string]any{
+					"type":        "boolean",
+					"description": "Only verify the indexes of the collection, owned by another system, without ever changing them.",
+				},
+				"validator": map[string]any{
+					"type":        "object",
+					"description": "Document validation of the collection, e.g. {\"$jsonSchema\": {...}}, as extended JSON. An empty object removes it; leaving it out leaves it alone.",
+				},
+				"validationLevel": map[string]any{
+					"enum":        ValidationLevels,
+					"description": "Which documents the validator applies to (default strict).",
+				},
+				"validationAction": map[string]any{
+					"enum":        ValidationActions,
+					"description": "Whether invalid documents are rejected or logged (default error).",
+				},
+				"options": collectionOptionsSpec(),
+				"indexes": map[string]any{
+					"type":  "array",
+					"items": structSpec(reflect.TypeOf(Index{}), []string{"key"}),
+				},
+				"searchIndexes": map[string]any{
+					"type":        "array",
+					"description": "Atlas Search and Vector Search indexes, compared when search indexes are enabled.",
+					"items": map[string]any{
+						"type":                 "object",
+						"required":             []string{"name", "definition"},
+						"additionalProperties": false,
+						"properties": map[string]any{
+							"name": map[string]any{"type": "string", "description": "Name of the search index."},
+							"type": map[string]any{
+								"enum":        []string{SearchIndexType, VectorSearchIndexType},
+								"description": "Kind of the search index (default search).",
+							},
+							"definition": map[string]any{
+								"type":        "object",
+								"description": "Mappings, analyzers or vector fields of the index, as extended JSON.",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// collectionOptionsSpec describes the options collections are created with.
+func collectionOptionsSpec() map[string]any {
+	return map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"description":          "Options the collection is created with; they can't change once it exists.",
+		"properties": map[string]any{
+			"capped": map[string]any{
+				"type":        "boolean",
+				"description": "Keep at most size bytes, removing the oldest documents first.",
+			},
+			"size": map[string]any{
+				"type":        "integer",
+				"description": "Maximum size of a capped collection in bytes, raised to at least 4096 and a multiple of 256.",
+			},
+			"max": map[string]any{
+				"type":        "integer",
+				"description": "Maximum number of documents of a capped collection.",
+			},
+			"timeseries": map[string]any{
+				"type":                 "object",
+				"required":             []string{"timeField"},
+				"additionalProperties": false,
+				"description":          "Store the collection as time series.",
+				"properties": map[string]any{
+					"timeField":             map[string]any{"type": "string", "description": "Field holding the date of each measurement."},
+					"metaField":             map[string]any{"type": "string", "description": "Field identifying the series of each measurement."},
+					"granularity":           map[string]any{"enum": []string{"seconds", "minutes", "hours"}, "description": "Interval between measurements of a series."},
+					"bucketMaxSpanSeconds":  map[string]any{"type": "integer", "description": "Time span of a bucket, instead of the granularity."},
+					"bucketRoundingSeconds": map[string]any{"type": "integer", "description": "Rounding of the start of a bucket, with bucketMaxSpanSeconds."},
+				},
+			},
+			"expireAfterSeconds": map[string]any{
+				"type":        "integer",
+				"description": "Delete the documents of a time series or clustered collection this many seconds after their date.",
+			},
+			"clusteredIndex": map[string]any{
+				"type":                 "object",
+				"required":             []string{"key", "unique"},
+				"additionalProperties": false,
+				"description":          "Order the documents of the collection by _id.",
+				"properties": map[string]any{
+					"key":    map[string]any{"type": "object", "description": "Must be {\"_id\": 1}."},
+					"unique": map[string]any{"type": "boolean", "description": "Must be true."},
+					"name":   map[string]any{"type": "string", "description": "Name of the clustered index."},
+				},
+			},
+			"collation": structSpec(reflect.TypeOf(Collation{}), []string{"locale"}),
+		},
+	}
+}
+
+// structSpec describes the bson-tagged fields of t as a closed JSON object.
+func structSpec(t reflect.Type, required []string) map[string]any {
+	properties := make(map[string]any)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("bson"), ",")[0]
+
+		var property map[string]any
+		switch name {
+		case "key":
+			property = map[string]any{
+				"type":          "object",
+				"minProperties": 1,
+				"additionalProperties": map[string]any{
+					"anyOf": []any{
+						map[string]any{"enum": []any{1, -1}},
+						map[string]any{"enum": indexTypes},
+					},
+				},
+			}
+		case "collation":
+			property = structSpec(reflect.TypeOf(Collation{}), []string{"locale"})
+		case ttlField:
+			property = map[string]any{
+				"anyOf": []any{
+					map[string]any{"type": "integer"},
+					map[string]any{"type": "string", "pattern": ttlPattern},
+				},
+			}
+		default:
+			property = map[string]any{"type": jsonType(field.Type)}
+		}
+		if description, ok := indexFieldDescriptions[name]; ok {
+			property["description"] = description
+		}
+		properties[name] = property
+	}
+
+	return map[string]any{
+		"type":                 "object",
+		"required":             required,
+		"additionalProperties": false,
+		"properties":           properties,
+	}
+}
+
+// Validate checks the contents of a schema file against Spec, returning a
+// *ParseError for every violation.
+func Validate(file string, data []byte) error {
+	spec, err := json.Marshal(Spec())
+	if err != nil {
+		return err
+	}
+	compiled, err := jsonschema.CompileString(SpecID, string(spec))
+	if err != nil {
+		return fmt.Errorf("compiling schema spec: %w", err)
+	}
+
+	var document any
+	if err := json.Unmarshal(data, &document); err != nil {
+		_, err = Parse(file, data)
+		return err
+	}
+
+	err = compiled.Validate(document)
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+
+	var errs []error
+	for _, leaf := range leafErrors(validationErr) {
+		msg := leaf.Message
+		switch {
+		case strings.HasSuffix(leaf.KeywordLocation, "/"+ttlField+"/anyOf"):
+			msg = "expected seconds or a duration such as \"30d\" for index " + ttlField
+		case strings.HasSuffix(leaf.KeywordLocation, "/anyOf"):
+			msg = "expected 1, -1 or an index type for index key"
+		}
+		errs = append(errs, newParseError(file, data, pointerOffset(data, leaf.InstanceLocation), msg))
+	}
+	return errors.Join(errs...)
+}
+
+// leafErrors returns the most specific causes of a validation error. Failed
+// alternatives are reported once, as the anyOf that none of them satisfied.
+func leafErrors(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 || strings.HasSuffix(err.KeywordLocation, "/anyOf") {
+		return []*jsonschema.ValidationError{err}
+	}
+	var leaves []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		for _, leaf := range leafErrors(cause) {
+			if !slices.ContainsFunc(leaves, func(l *jsonschema.ValidationError) bool {
+				return l.InstanceLocation == leaf.InstanceLocation && l.Message == leaf.Message
+			}) {
+				leaves = append(leaves, leaf)
+			}
+		}
+	}
+	return leaves
+}
+
+// pointerOffset returns the offset of the value a JSON pointer refers to, or of
+// the deepest existing value on its way.
+func pointerOffset(data []byte, pointer string) int {
+	offset := len(data) - len(strings.TrimLeft(string(data), " \t\r\n"))
+	if pointer == "" {
+		return offset
+	}
+
+	current := data[offset:]
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+
+		var values []rawValue
+		var found bool
+		if index, err := strconv.Atoi(token); err == nil && len(current) > 0 && current[0] == '[' {
+			values, _ = rawElements(current, '[')
+			if index >= 0 && index < len(values) {
+				current, offset, found = values[index].data, offset+values[index].offset, true
+			}
+		} else {
+			values, _ = rawElements(current, '{')
+			for _, v := range values {
+				if v.key == token {
+					current, offset, found = v.data, offset+v.offset, true
+					break
+				}
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return offset
+}
@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Decode reads a JSON schema file one collection at a time, so only the
+// decoded schemas are held in memory. Errors aren't located; Parse the
+// contents to report where they are.
+func Decode(r io.Reader) ([]Schema, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return nil, nil
+	}
+	if tok != json.Delim('[') {
+		return nil, fmt.Errorf("expected array of collections")
+	}
+
+	schemas := make([]Schema, 0)
+	for dec.More() {
+		var s Schema
+		if err := dec.Decode(&s); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, s)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the array of collections")
+	}
+	return schemas, nil
+}
+
+// Encode writes schemas as a JSON schema file one collection at a time, with
+// the same output as json.MarshalIndent(schemas, "", indent).
+func Encode(w io.Writer, schemas []Schema, indent string) error {
+	if len(schemas) == 0 {
+		_, err := io.WriteString(w, "[]")
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[\n")
+	for i, s := range schemas {
+		data, err := json.MarshalIndent(s, indent, indent)
+		if err != nil {
+			return err
+		}
+		bw.WriteString(indent)
+		bw.Write(data)
+		if i < len(schemas)-1 {
+			bw.WriteByte(',')
+		}
+		bw.WriteByte('\n')
+	}
+	bw.WriteString("]")
+	return bw.Flush()
+}
@@ -0,0 +1,124 @@
+package schema
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// testSchemaFile returns a schema file declaring the collections, each with
+// a few indexes.
+func testSchemaFile(tb testing.TB, collections int) []byte {
+	tb.Helper()
+	var b bytes.Buffer
+	b.WriteString("[\n")
+	for i := range collections {
+		if i > 0 {
+			b.WriteString(",\n")
+		}
+		fmt.Fprintf(&b, `  {"collection": "c%d", "indexes": [
+    {"name": "a_1", "key": {"a": 1}},
+    {"name": "b_1_c_-1", "key": {"b": 1, "c": -1}, "unique": true},
+    {"name": "createdAt_1", "key": {"createdAt": 1}, "expireAfterSeconds": 3600}
+  ]}`, i)
+	}
+	b.WriteString("\n]\n")
+	return b.Bytes()
+}
+
+func TestDecodeMatchesParse(t *testing.T) {
+	data := testSchemaFile(t, 10)
+	want, err := Parse("schema.json", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeReadsEverything(t *testing.T) {
+	// Hashing the file as it's decoded relies on Decode reading all of it.
+	data := testSchemaFile(t, 10)
+	h := sha256.New()
+	if _, err := Decode(io.TeeReader(bytes.NewReader(data), h)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.Sum(nil), sha256.Sum256(data); !bytes.Equal(got, want[:]) {
+		t.Errorf("hash while decoding = %x, want %x", got, want)
+	}
+}
+
+func TestEncodeMatchesMarshalIndent(t *testing.T) {
+	schemas, err := Parse("schema.json", testSchemaFile(t, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := json.MarshalIndent(schemas, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := Encode(&got, schemas, "  "); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != string(want) {
+		t.Errorf("Encode =\n%s\nwant\n%s", got.String(), want)
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	data := testSchemaFile(b, 5000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := Decode(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeHashed(b *testing.B) {
+	data := testSchemaFile(b, 5000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for range b.N {
+		h := sha256.New()
+		if _, err := Decode(io.TeeReader(bytes.NewReader(data), h)); err != nil {
+			b.Fatal(err)
+		}
+		h.Sum(nil)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	data := testSchemaFile(b, 5000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := Parse("schema.json", data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	schemas, err := Parse("schema.json", testSchemaFile(b, 5000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for range b.N {
+		if err := Encode(io.Discard, schemas, "  "); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
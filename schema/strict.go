@@ -0,0 +1,115 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// UnknownFieldError reports a field of the schema file that mondex doesn't
+// recognize, which would otherwise be silently dropped.
+type UnknownFieldError struct {
+	// Path locates the object holding the field, e.g. [2].indexes[0].
+	Path  string
+	Field string
+	// Collection and Index name the enclosing entries when known.
+	Collection string
+	Index      string
+}
+
+func (e *UnknownFieldError) Error() string {
+	msg := fmt.Sprintf("unknown field %q at %s", e.Field, e.Path)
+	var context []string
+	if e.Collection != "" {
+		context = append(context, fmt.Sprintf("collection %q", e.Collection))
+	}
+	if e.Index != "" {
+		context = append(context, fmt.Sprintf("index %q", e.Index))
+	}
+	if len(context) > 0 {
+		msg += " (" + strings.Join(context, ", ") + ")"
+	}
+	return msg
+}
+
+var (
+	collectionFields = taggedFields(reflect.TypeOf(Schema{}), "json")
+	indexFields      = taggedFields(reflect.TypeOf(Index{}), "bson")
+	collationFields  = taggedFields(reflect.TypeOf(Collation{}), "bson")
+)
+
+// CheckUnknownFields returns an UnknownFieldError for the first collection,
+// index or collation field of the schema file that isn't part of the format.
+// Malformed JSON is left for the decoder to report.
+func CheckUnknownFields(data []byte) error {
+	var collections []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &collections); err != nil {
+		return nil
+	}
+
+	for i, collection := range collections {
+		path := fmt.Sprintf("[%d]", i)
+		name := stringField(collection, "collection")
+		if field := unknownField(collection, collectionFields); field != "" {
+			return &UnknownFieldError{Path: path, Field: field, Collection: name}
+		}
+
+		var indexes []map[string]json.RawMessage
+		if err := json.Unmarshal(collection["indexes"], &indexes); err != nil {
+			continue
+		}
+		for j, index := range indexes {
+			indexPath := fmt.Sprintf("%s.indexes[%d]", path, j)
+			indexName := stringField(index, "name")
+			if field := unknownField(index, indexFields); field != "" {
+				return &UnknownFieldError{Path: indexPath, Field: field, Collection: name, Index: indexName}
+			}
+
+			var collation map[string]json.RawMessage
+			if err := json.Unmarshal(index["collation"], &collation); err == nil {
+				if field := unknownField(collation, collationFields); field != "" {
+					return &UnknownFieldError{Path: indexPath + ".collation", Field: field, Collection: name, Index: indexName}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// unknownField returns the alphabetically first key of the object that isn't known.
+func unknownField(object map[string]json.RawMessage, known []string) string {
+	var unknown []string
+	for key := range object {
+		if !slices.Contains(known, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return ""
+	}
+	slices.Sort(unknown)
+	return unknown[0]
+}
+
+func stringField(object map[string]json.RawMessage, key string) string {
+	var s string
+	_ = json.Unmarshal(object[key], &s)
+	return s
+}
+
+// taggedFields lists the field names a struct is encoded with under the tag.
+func taggedFields(t reflect.Type, tagName string) []string {
+	var fields []string
+	for i := range t.NumField() {
+		name := strings.Split(t.Field(i).Tag.Get(tagName), ",")[0]
+		if name == "" {
+			name = strings.ToLower(t.Field(i).Name)
+		}
+		if name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,69 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ttlField is the index option holding the TTL, which the schema file also
+// accepts as a duration.
+const ttlField = "expireAfterSeconds"
+
+// ttlPattern matches TTLs given as durations, e.g. "30d", "12h" or "1d12h".
+const ttlPattern = `^([0-9]+[smhdw])+$`
+
+var (
+	ttlRegexp = regexp.MustCompile(ttlPattern)
+	ttlPart   = regexp.MustCompile(`([0-9]+)([smhdw])`)
+)
+
+var ttlUnits = map[string]int64{
+	"s": 1,
+	"m": 60,
+	"h": 60 * 60,
+	"d": 24 * 60 * 60,
+	"w": 7 * 24 * 60 * 60,
+}
+
+// ParseTTL converts a TTL given as a duration, a sequence of numbers with
+// units s, m, h, d or w such as "30d" or "1d12h", to seconds.
+func ParseTTL(s string) (int32, error) {
+	if !ttlRegexp.MatchString(s) {
+		return 0, fmt.Errorf("invalid TTL %q, want seconds or a duration such as 30d or 12h", s)
+	}
+
+	var seconds int64
+	for _, part := range ttlPart.FindAllStringSubmatch(s, -1) {
+		n, err := strconv.ParseInt(part[1], 10, 64)
+		if err != nil || n > math.MaxInt32 {
+			return 0, fmt.Errorf("TTL %q is too long", s)
+		}
+		seconds += n * ttlUnits[part[2]]
+		if seconds > math.MaxInt32 {
+			return 0, fmt.Errorf("TTL %q is too long", s)
+		}
+	}
+	return int32(seconds), nil
+}
+
+// normalizeTTL replaces a TTL given as a duration in an index document with
+// its number of seconds.
+func normalizeTTL(doc bson.D) error {
+	for i, e := range doc {
+		if e.Key != ttlField {
+			continue
+		}
+		if s, ok := e.Value.(string); ok {
+			seconds, err := ParseTTL(s)
+			if err != nil {
+				return err
+			}
+			doc[i].Value = seconds
+		}
+	}
+	return nil
+}
@@ -6,14 +6,40 @@ import (
 
 // Schema represents a MongoDB collection schema
 type Schema struct {
-	Collection string  `json:"collection"`
-	Indexes    []Index `json:"indexes"`
+	Collection  string         `json:"collection"`
+	Owner       string         `json:"owner,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Meta        map[string]any `json:"meta,omitempty"`
+	// GridFS declares a GridFS bucket named Collection: its files and chunks
+	// collections with the standard indexes, plus Indexes on the files.
+	GridFS bool `json:"gridfs,omitempty"`
+	// ReadOnly declares a collection another system owns: diff generates no
+	// commands for it but reports where its indexes differ.
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// Validator declares the document validation of the collection, e.g. a
+	// $jsonSchema, as extended JSON; nil leaves it alone and an empty one
+	// removes it. ValidationLevel and ValidationAction default to those of
+	// the server.
+	Validator        map[string]any `json:"validator,omitempty"`
+	ValidationLevel  string         `json:"validationLevel,omitempty"`
+	ValidationAction string         `json:"validationAction,omitempty"`
+	// Options declares the options the collection is created with, such as
+	// capped, timeseries or clusteredIndex. They can't change afterwards,
+	// so diff only reports a collection whose options differ.
+	Options *CollectionOptions `json:"options,omitempty"`
+	Indexes []Index            `json:"indexes"`
+	// SearchIndexes declares the Atlas Search and Vector Search indexes of
+	// the collection, which are only compared when search indexes are
+	// enabled.
+	SearchIndexes []SearchIndex `json:"searchIndexes,omitempty"`
 }
 
-// Index represents a MongoDB index configuration
+// Index represents a MongoDB index configuration. Its name may be left out
+// of the declared schema for the one the server gives it, as DefaultIndexName
+// returns it.
 type Index struct {
 	Key                     bson.D     `bson:"key"`
-	Name                    string     `bson:"name"`
+	Name                    string     `bson:"name,omitempty"`
 	Background              bool       `bson:"background,omitempty"`
 	Unique                  bool       `bson:"unique,omitempty"`
 	Sparse                  bool       `bson:"sparse,omitempty"`
@@ -27,6 +53,20 @@ type Index struct {
 	Weights                 bson.D     `bson:"weights,omitempty"`
 	Hidden                  bool       `bson:"hidden,omitempty"`
 	WildcardProjection      bson.M     `bson:"wildcardProjection,omitempty"`
+	ColumnstoreProjection   bson.M     `bson:"columnstoreProjection,omitempty"`
+	SphereIndexVersion      int        `bson:"2dsphereIndexVersion,omitempty"`
+	Bits                    int        `bson:"bits,omitempty"`
+	Min                     *float64   `bson:"min,omitempty"`
+	Max                     *float64   `bson:"max,omitempty"`
+
+	// Description and Meta annotate the declared schema only; they are never
+	// compared or sent to MongoDB.
+	Description string `bson:"description,omitempty"`
+	Meta        bson.D `bson:"meta,omitempty"`
+
+	// Building marks an index inspect found still being built. Like the
+	// annotations, it is never compared or sent to MongoDB.
+	Building bool `bson:"building,omitempty"`
 }
 
 // Collation specifies language-specific rules for string comparison
@@ -42,10 +82,32 @@ type Collation struct {
 	Backwards       *bool  `bson:"backwards,omitempty"`
 }
 
+// WithoutAnnotations returns the index without its description, meta and
+// building fields.
+func (i Index) WithoutAnnotations() Index {
+	i.Description = ""
+	i.Meta = nil
+	i.Building = false
+	return i
+}
+
 func (i Index) MarshalJSON() ([]byte, error) {
 	return bson.MarshalExtJSON(i, false, false)
 }
 
+// UnmarshalJSON decodes an index of the schema file, where the TTL may be
+// given as a duration such as "30d".
 func (i *Index) UnmarshalJSON(bytes []byte) error {
-	return bson.UnmarshalExtJSON(bytes, false, &i)
+	var doc bson.D
+	if err := bson.UnmarshalExtJSON(bytes, false, &doc); err != nil {
+		return err
+	}
+	if err := normalizeTTL(doc); err != nil {
+		return err
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, i)
 }
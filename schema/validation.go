@@ -0,0 +1,48 @@
+package schema
+
+import (
+	"cmp"
+	"reflect"
+)
+
+// The validation level and action of the server, for collections that don't
+// set them.
+const (
+	DefaultValidationLevel  = "strict"
+	DefaultValidationAction = "error"
+)
+
+// ValidationLevels and ValidationActions are the values the server accepts.
+var (
+	ValidationLevels  = []string{"off", "strict", "moderate"}
+	ValidationActions = []string{"error", "warn", "errorAndLog"}
+)
+
+// ManagesValidation reports whether the schema declares the document
+// validation of the collection.
+func (s Schema) ManagesValidation() bool {
+	return s.Validator != nil
+}
+
+// HasValidation reports whether the collection validates documents.
+func (s Schema) HasValidation() bool {
+	return len(s.Validator) > 0
+}
+
+// ValidationEqual reports whether the collections validate documents alike,
+// with the level and action of the server when unset. Collections without a
+// validator compare equal whatever their level and action.
+func (s Schema) ValidationEqual(other Schema) bool {
+	if !s.HasValidation() || !other.HasValidation() {
+		return s.HasValidation() == other.HasValidation()
+	}
+	return reflect.DeepEqual(s.Validator, other.Validator) &&
+		cmp.Or(s.ValidationLevel, DefaultValidationLevel) == cmp.Or(other.ValidationLevel, DefaultValidationLevel) &&
+		cmp.Or(s.ValidationAction, DefaultValidationAction) == cmp.Or(other.ValidationAction, DefaultValidationAction)
+}
+
+// WithValidationOf returns the schema with the document validation of other.
+func (s Schema) WithValidationOf(other Schema) Schema {
+	s.Validator, s.ValidationLevel, s.ValidationAction = other.Validator, other.ValidationLevel, other.ValidationAction
+	return s
+}
@@ -0,0 +1,409 @@
+package tui
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	"github.com/ltman/mondex/schema"
+)
+
+const (
+	listWidth = 32
+
+	keyCtrlC     = 3
+	keyTab       = '\t'
+	keyEnter     = '\r'
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// Source is a named set of collection schemas shown by the browser.
+type Source struct {
+	Name    string
+	Schemas []schema.Schema
+}
+
+// Browse opens a full-screen terminal UI for navigating the collections and
+// indexes of the sources. With two sources, the drift view shows them side by
+// side, indexes comparing as c sets. It returns when the user quits.
+func Browse(in, out *os.File, c schema.Comparison, sources ...Source) error {
+	if len(sources) == 0 {
+		return fmt.Errorf("nothing to browse")
+	}
+
+	fd := int(in.Fd()) //nolint:gosec // file descriptors fit in an int
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("switching terminal to raw mode: %w", err)
+	}
+	defer func() {
+		_ = term.Restore(fd, state)
+	}()
+
+	w := bufio.NewWriter(out)
+	fmt.Fprint(w, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(w, "\x1b[?25h\x1b[?1049l")
+		_ = w.Flush()
+	}()
+
+	b := &browser{sources: sources, comparison: c}
+	b.filter()
+
+	input := bufio.NewReader(in)
+	for {
+		width, height, err := term.GetSize(int(out.Fd())) //nolint:gosec // file descriptors fit in an int
+		if err != nil {
+			width, height = 100, 30
+		}
+		b.render(w, width, height)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		key, err := readKey(input)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if quit := b.handle(key, height); quit {
+			return nil
+		}
+	}
+}
+
+type browser struct {
+	sources    []Source
+	comparison schema.Comparison
+	// source is the index of the source shown outside the drift view.
+	source int
+	drift  bool
+
+	query     string
+	searching bool
+
+	collections []string
+	selected    int
+	listOffset  int
+	// detailOffset scrolls the index pane.
+	detailOffset int
+}
+
+// handle applies a key press and reports whether the browser should quit.
+func (b *browser) handle(key string, height int) bool {
+	if b.searching {
+		switch key {
+		case string(rune(keyEnter)), string(rune(keyEscape)):
+			b.searching = false
+		case string(rune(keyBackspace)):
+			if b.query != "" {
+				_, size := utf8.DecodeLastRuneInString(b.query)
+				b.query = b.query[:len(b.query)-size]
+			}
+		default:
+			if len(key) == 1 && key[0] >= ' ' {
+				b.query += key
+			}
+		}
+		b.filter()
+		return false
+	}
+
+	switch key {
+	case "q", string(rune(keyCtrlC)):
+		return true
+	case "/":
+		b.searching = true
+	case string(rune(keyEscape)):
+		b.query = ""
+		b.filter()
+	case "j", "down":
+		b.move(1, height)
+	case "k", "up":
+		b.move(-1, height)
+	case "J", "pgdown":
+		b.detailOffset++
+	case "K", "pgup":
+		b.detailOffset = max(b.detailOffset-1, 0)
+	case "d":
+		if len(b.sources) > 1 {
+			b.drift = !b.drift
+			b.filter()
+		}
+	case string(rune(keyTab)):
+		b.source = (b.source + 1) % len(b.sources)
+		b.filter()
+	}
+	return false
+}
+
+func (b *browser) move(delta, height int) {
+	if len(b.collections) == 0 {
+		return
+	}
+	b.selected = min(max(b.selected+delta, 0), len(b.collections)-1)
+	b.detailOffset = 0
+
+	visible := max(height-3, 1)
+	if b.selected < b.listOffset {
+		b.listOffset = b.selected
+	} else if b.selected >= b.listOffset+visible {
+		b.listOffset = b.selected - visible + 1
+	}
+}
+
+// filter recomputes the collection list from the visible sources and the search query.
+func (b *browser) filter() {
+	var names []string
+	for i, source := range b.sources {
+		if !b.drift && i != b.source {
+			continue
+		}
+		for _, s := range source.Schemas {
+			if !slices.Contains(names, s.Collection) && strings.Contains(s.Collection, b.query) {
+				names = append(names, s.Collection)
+			}
+		}
+	}
+	slices.Sort(names)
+
+	b.collections = names
+	b.selected = min(b.selected, max(len(names)-1, 0))
+	b.listOffset = min(b.listOffset, b.selected)
+	b.detailOffset = 0
+}
+
+func (b *browser) render(w io.Writer, width, height int) {
+	fmt.Fprint(w, "\x1b[H\x1b[2J")
+
+	title := "mondex browse — " + b.sources[b.source].Name
+	if b.drift {
+		title = fmt.Sprintf("mondex browse — drift: %s vs %s", b.sources[0].Name, b.sources[1].Name)
+	}
+	writeLine(w, 1, "\x1b[7m"+pad(title, width)+"\x1b[0m")
+
+	var collection string
+	if len(b.collections) > 0 {
+		collection = b.collections[b.selected]
+	}
+	detail := b.detailLines(collection)
+	detail = detail[min(b.detailOffset, len(detail)):]
+
+	rows := max(height-3, 1)
+	for row := 0; row < rows; row++ {
+		var left string
+		if i := b.listOffset + row; i < len(b.collections) {
+			left = " " + b.collections[i]
+			if b.drift {
+				left = " " + b.driftMarker(b.collections[i]) + " " + b.collections[i]
+			}
+			left = pad(left, listWidth)
+			if i == b.selected {
+				left = "\x1b[7m" + left + "\x1b[0m"
+			}
+		} else {
+			left = pad("", listWidth)
+		}
+
+		var right string
+		if row < len(detail) {
+			right = detail[row]
+		}
+		writeLine(w, row+2, left+"│ "+truncate(right, width-listWidth-2))
+	}
+
+	status := "j/k move · J/K scroll · / search · tab source · d drift · q quit"
+	if len(b.sources) < 2 {
+		status = "j/k move · J/K scroll · / search · q quit"
+	}
+	if b.searching || b.query != "" {
+		status = "search: " + b.query
+		if b.searching {
+			status += "█"
+		}
+	}
+	writeLine(w, height, "\x1b[2m"+truncate(status, width)+"\x1b[0m")
+}
+
+// detailLines describes the indexes of the collection in the current view.
+func (b *browser) detailLines(collection string) []string {
+	if collection == "" {
+		return []string{"no collections"}
+	}
+
+	if !b.drift {
+		s, ok := findSchema(b.sources[b.source].Schemas, collection)
+		if !ok {
+			return []string{"collection not present in " + b.sources[b.source].Name}
+		}
+		lines := []string{collection, ""}
+		for _, index := range s.Indexes {
+			lines = append(lines, describeIndex(index)...)
+		}
+		return lines
+	}
+
+	left, _ := findSchema(b.sources[0].Schemas, collection)
+	right, _ := findSchema(b.sources[1].Schemas, collection)
+
+	var names []string
+	for _, index := range append(slices.Clone(left.Indexes), right.Indexes...) {
+		if !slices.Contains(names, index.Name) {
+			names = append(names, index.Name)
+		}
+	}
+	slices.Sort(names)
+
+	lines := []string{
+		collection,
+		"",
+		fmt.Sprintf("  %-28s %-12s %s", "index", b.sources[0].Name, b.sources[1].Name),
+	}
+	for _, name := range names {
+		l, inLeft := findIndex(left.Indexes, name)
+		r, inRight := findIndex(right.Indexes, name)
+
+		marker, leftState, rightState := " ", "present", "present"
+		switch {
+		case !inRight:
+			marker, rightState = "+", "missing"
+		case !inLeft:
+			marker, leftState = "-", "missing"
+		case !b.sameIndex(l, r):
+			marker, leftState, rightState = "~", "differs", "differs"
+		}
+		lines = append(lines, fmt.Sprintf("%s %-28s %-12s %s", marker, name, leftState, rightState))
+
+		if inLeft && (!inRight || marker == "~") {
+			lines = append(lines, "    "+b.sources[0].Name+": "+l.KeySpec()+" "+strings.Join(l.Flags(), " "))
+		}
+		if inRight && (!inLeft || marker == "~") {
+			lines = append(lines, "    "+b.sources[1].Name+": "+r.KeySpec()+" "+strings.Join(r.Flags(), " "))
+		}
+	}
+	return lines
+}
+
+// driftMarker summarizes whether the collection differs between the two sources.
+func (b *browser) driftMarker(collection string) string {
+	left, inLeft := findSchema(b.sources[0].Schemas, collection)
+	right, inRight := findSchema(b.sources[1].Schemas, collection)
+
+	switch {
+	case !inRight:
+		return "+"
+	case !inLeft:
+		return "-"
+	case len(left.Indexes) != len(right.Indexes):
+		return "~"
+	}
+	for _, index := range left.Indexes {
+		other, ok := findIndex(right.Indexes, index.Name)
+		if !ok || !b.sameIndex(index, other) {
+			return "~"
+		}
+	}
+	return " "
+}
+
+func describeIndex(index schema.Index) []string {
+	lines := []string{"• " + index.Name, "    key: " + index.KeySpec()}
+	if flags := index.Flags(); len(flags) > 0 {
+		lines = append(lines, "    options: "+strings.Join(flags, ", "))
+	}
+	if len(index.PartialFilterExpression) > 0 {
+		filter, _ := json.Marshal(index.PartialFilterExpression)
+		lines = append(lines, "    partialFilterExpression: "+string(filter))
+	}
+	return append(lines, "")
+}
+
+func findSchema(schemas []schema.Schema, collection string) (schema.Schema, bool) {
+	i := slices.IndexFunc(schemas, func(s schema.Schema) bool {
+		return s.Collection == collection
+	})
+	if i < 0 {
+		return schema.Schema{}, false
+	}
+	return schemas[i], true
+}
+
+func findIndex(indexes []schema.Index, name string) (schema.Index, bool) {
+	i := slices.IndexFunc(indexes, func(index schema.Index) bool {
+		return index.Name == name
+	})
+	if i < 0 {
+		return schema.Index{}, false
+	}
+	return indexes[i], true
+}
+
+// sameIndex compares two indexes in canonical form, ignoring annotations.
+func (b *browser) sameIndex(x, y schema.Index) bool {
+	return x.EqualWith(y, b.comparison)
+}
+
+// readKey reads one key press, translating common escape sequences.
+func readKey(r *bufio.Reader) (string, error) {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	if c != keyEscape || r.Buffered() == 0 {
+		return string(c), nil
+	}
+
+	seq := make([]byte, 0, 4)
+	for r.Buffered() > 0 && len(seq) < 4 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		seq = append(seq, b)
+		if b >= 'A' && b <= 'Z' || b == '~' {
+			break
+		}
+	}
+
+	switch string(seq) {
+	case "[A":
+		return "up", nil
+	case "[B":
+		return "down", nil
+	case "[5~":
+		return "pgup", nil
+	case "[6~":
+		return "pgdown", nil
+	}
+	return string(rune(keyEscape)), nil
+}
+
+func writeLine(w io.Writer, row int, text string) {
+	fmt.Fprintf(w, "\x1b[%d;1H%s", row, text)
+}
+
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
+
+func pad(s string, width int) string {
+	s = truncate(s, width)
+	return s + strings.Repeat(" ", width-utf8.RuneCountInString(s))
+}
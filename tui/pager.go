@@ -0,0 +1,277 @@
+package tui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const (
+	ansiBold    = "\x1b[1m"
+	ansiKey     = "\x1b[36m"
+	ansiString  = "\x1b[32m"
+	ansiNumber  = "\x1b[33m"
+	ansiLiteral = "\x1b[35m"
+	ansiReset   = "\x1b[0m"
+)
+
+// Section is a collapsible part of the text shown by Page.
+type Section struct {
+	Title string
+	Lines []string
+}
+
+// pagerRow is a line of the pager: a section title or one of its lines.
+type pagerRow struct {
+	section int
+	title   bool
+	text    string
+}
+
+// Page shows the sections of JSON text in a full-screen pager, highlighting
+// their syntax when color is set, with sections folded and unfolded on
+// demand. Text that fits on the screen is printed as is. It returns when the
+// user quits.
+func Page(in, out *os.File, sections []Section, color bool) error {
+	p := &pager{sections: sections, folded: make([]bool, len(sections)), color: color}
+
+	width, height, err := term.GetSize(int(out.Fd())) //nolint:gosec // file descriptors fit in an int
+	if err != nil {
+		width, height = 100, 30
+	}
+	if rows := p.rows(); len(rows) < height {
+		w := bufio.NewWriter(out)
+		for _, row := range rows {
+			fmt.Fprintln(w, p.format(row, width, false))
+		}
+		return w.Flush()
+	}
+
+	fd := int(in.Fd()) //nolint:gosec // file descriptors fit in an int
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("switching terminal to raw mode: %w", err)
+	}
+	defer func() {
+		_ = term.Restore(fd, state)
+	}()
+
+	w := bufio.NewWriter(out)
+	fmt.Fprint(w, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(w, "\x1b[?25h\x1b[?1049l")
+		_ = w.Flush()
+	}()
+
+	input := bufio.NewReader(in)
+	for {
+		width, height, err := term.GetSize(int(out.Fd())) //nolint:gosec // file descriptors fit in an int
+		if err != nil {
+			width, height = 100, 30
+		}
+		p.render(w, width, height)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		key, err := readKey(input)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if quit := p.handle(key, max(height-1, 1)); quit {
+			return nil
+		}
+	}
+}
+
+type pager struct {
+	sections []Section
+	folded   []bool
+	color    bool
+
+	// cursor is the selected row and offset the first row on screen.
+	cursor, offset int
+}
+
+// rows lists the lines to show, leaving out those of folded sections.
+func (p *pager) rows() []pagerRow {
+	var rows []pagerRow
+	for i, section := range p.sections {
+		rows = append(rows, pagerRow{section: i, title: true, text: section.Title})
+		if p.folded[i] {
+			continue
+		}
+		for _, line := range section.Lines {
+			rows = append(rows, pagerRow{section: i, text: line})
+		}
+	}
+	return rows
+}
+
+// handle applies a key press and reports whether the pager should quit.
+func (p *pager) handle(key string, visible int) bool {
+	rows := p.rows()
+	switch key {
+	case "q", string(rune(keyCtrlC)):
+		return true
+	case "j", "down":
+		p.cursor++
+	case "k", "up":
+		p.cursor--
+	case " ", "f", "pgdown":
+		p.cursor += visible
+		p.offset += visible
+	case "b", "pgup":
+		p.cursor -= visible
+		p.offset -= visible
+	case "g":
+		p.cursor = 0
+	case "G":
+		p.cursor = len(rows) - 1
+	case "n":
+		for i := p.cursor + 1; i < len(rows); i++ {
+			if rows[i].title {
+				p.cursor = i
+				break
+			}
+		}
+	case "p":
+		for i := p.cursor - 1; i >= 0; i-- {
+			if rows[i].title {
+				p.cursor = i
+				break
+			}
+		}
+	case string(rune(keyEnter)), string(rune(keyTab)):
+		if len(rows) > 0 {
+			section := rows[p.cursor].section
+			p.folded[section] = !p.folded[section]
+			p.cursor = p.titleRow(section)
+		}
+	case "c", "e":
+		for i := range p.folded {
+			p.folded[i] = key == "c"
+		}
+		if len(rows) > 0 {
+			p.cursor = p.titleRow(rows[p.cursor].section)
+		}
+	}
+
+	last := len(p.rows()) - 1
+	p.cursor = min(max(p.cursor, 0), max(last, 0))
+	p.offset = min(max(p.offset, 0), max(last-visible+1, 0))
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	} else if p.cursor >= p.offset+visible {
+		p.offset = p.cursor - visible + 1
+	}
+	return false
+}
+
+// titleRow returns the row of the title of the section.
+func (p *pager) titleRow(section int) int {
+	for i, row := range p.rows() {
+		if row.title && row.section == section {
+			return i
+		}
+	}
+	return 0
+}
+
+func (p *pager) render(w io.Writer, width, height int) {
+	fmt.Fprint(w, "\x1b[H\x1b[2J")
+
+	rows := p.rows()
+	visible := max(height-1, 1)
+	for line := 0; line < visible; line++ {
+		i := p.offset + line
+		if i >= len(rows) {
+			break
+		}
+		text := p.format(rows[i], width, true)
+		if i == p.cursor {
+			text = "\x1b[7m" + pad(p.plain(rows[i], true), width) + "\x1b[0m"
+		}
+		writeLine(w, line+1, text)
+	}
+
+	last := min(p.offset+visible, len(rows))
+	status := fmt.Sprintf("%d-%d/%d · j/k move · space/b page · enter fold · c/e fold/unfold all · n/p section · q quit",
+		min(p.offset+1, last), last, len(rows))
+	writeLine(w, height, "\x1b[2m"+truncate(status, width)+"\x1b[0m")
+}
+
+// plain is the text of a row, with a fold marker on titles when interactive.
+func (p *pager) plain(row pagerRow, interactive bool) string {
+	if !row.title {
+		return "  " + row.text
+	}
+	if !interactive {
+		return row.text
+	}
+	if p.folded[row.section] {
+		return fmt.Sprintf("▸ %s (%d lines)", row.text, len(p.sections[row.section].Lines))
+	}
+	return "▾ " + row.text
+}
+
+// format is the row truncated to the width and highlighted.
+func (p *pager) format(row pagerRow, width int, interactive bool) string {
+	text := truncate(p.plain(row, interactive), width)
+	if !p.color {
+		return text
+	}
+	if row.title {
+		return ansiBold + text + ansiReset
+	}
+	return highlightJSON(text)
+}
+
+// highlightJSON colors the keys, strings, numbers and literals of a line of
+// indented JSON. Strings cut short by truncation are colored to the end.
+func highlightJSON(line string) string {
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(line))
+			color := ansiString
+			if strings.HasPrefix(strings.TrimLeft(line[end:], " "), ":") {
+				color = ansiKey
+			}
+			b.WriteString(color + line[i:end] + ansiReset)
+			i = end
+		case c == '-' || c >= '0' && c <= '9':
+			end := i + 1
+			for end < len(line) && strings.IndexByte("0123456789.eE+-", line[end]) >= 0 {
+				end++
+			}
+			b.WriteString(ansiNumber + line[i:end] + ansiReset)
+			i = end
+		case strings.HasPrefix(line[i:], "true") || strings.HasPrefix(line[i:], "false") || strings.HasPrefix(line[i:], "null"):
+			end := i + strings.IndexFunc(line[i:]+" ", func(r rune) bool { return r < 'a' || r > 'z' })
+			b.WriteString(ansiLiteral + line[i:end] + ansiReset)
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,66 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	driverversion "go.mongodb.org/mongo-driver/version"
+)
+
+// Build metadata, injected at build time with:
+//
+//	go build -ldflags "-X github.com/ltman/mondex/version.Version=v1.2.3 \
+//	  -X github.com/ltman/mondex/version.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/ltman/mondex/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// When they aren't injected, they are filled from the module and VCS
+// information embedded by the Go toolchain (e.g. after `go install`).
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+// Info describes the binary that is running.
+type Info struct {
+	Version       string `json:"version"`
+	Commit        string `json:"commit"`
+	Date          string `json:"date"`
+	GoVersion     string `json:"goVersion"`
+	DriverVersion string `json:"mongoDriverVersion"`
+}
+
+// Get returns the build metadata of the running binary.
+func Get() Info {
+	info := Info{
+		Version:       Version,
+		Commit:        Commit,
+		Date:          Date,
+		GoVersion:     runtime.Version(),
+		DriverVersion: driverversion.Driver,
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	if info.Version == "dev" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+		info.Version = build.Main.Version
+	}
+	for _, setting := range build.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && info.Commit == "":
+			info.Commit = setting.Value
+		case setting.Key == "vcs.time" && info.Date == "":
+			info.Date = setting.Value
+		}
+	}
+
+	return info
+}
+
+// String returns the version of the running binary.
+func String() string {
+	return Get().Version
+}